@@ -2,12 +2,14 @@ package app
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io/fs"
 	"log"
 	"net/http"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/shishberg/mezzaops/internal/config"
@@ -19,139 +21,199 @@ import (
 	"github.com/shishberg/mezzaops/internal/webhook"
 )
 
+// confirmationTTL is how long a push waits for approval.
+const confirmationTTL = 10 * time.Minute
+
 // App wires all components together.
 type App struct {
-	cfg           *config.Config
-	env           *config.Env
+	configPath    string
+	profile       string
+	templatesFS   fs.FS
+	secrets       *config.SecretStore
 	manager       *service.Manager
 	confirmations *service.ConfirmationTracker
-	discordBot    *discord.Bot
-	mmBot         *mattermost.Bot
-	matrixBot     *matrix.Bot
-	webhookSrv    *http.Server
-	dashboardSrv  *http.Server
-	cancel        context.CancelFunc
+	notifier      *swapNotifier
+
+	// mu guards the config and the components below, which reloadConfig
+	// replaces when their settings change.
+	mu           sync.Mutex
+	cfg          *config.Config
+	env          *config.Env
+	discordBot   *discord.Bot
+	mmBot        *mattermost.Bot
+	matrixBot    *matrix.Bot
+	webhookSrv   *http.Server
+	webhookH     *webhook.Handler
+	dashboardSrv *http.Server
+	runCtx       context.Context                 // set by Run
+	running      map[component]*runningComponent // started by Run
+	cancel       context.CancelFunc
+
+	// reloadMu serializes applying config changes.
+	reloadMu sync.Mutex
 }
 
-// New loads config and env, creates all components, and returns a ready App.
-// templatesFS must contain index.html at its root.
-func New(configPath string, envPath string, templatesFS fs.FS) (*App, error) {
-	cfg, err := config.LoadConfig(configPath)
+// New loads config (with the overlay for profile, if non-empty) and secrets
+// (from the configured sources, then envPath), creates all components, and
+// returns a ready App. templatesFS must contain index.html at its root.
+func New(configPath, profile, envPath string, templatesFS fs.FS) (*App, error) {
+	cfg, err := config.LoadConfig(configPath, profile)
 	if err != nil {
 		return nil, fmt.Errorf("loading config: %w", err)
 	}
 
-	env, err := config.LoadEnv(envPath)
+	secrets, err := config.NewSecretStore(cfg.Secrets, envPath)
+	if err != nil {
+		return nil, fmt.Errorf("loading secrets: %w", err)
+	}
+	env, err := secrets.Env()
 	if err != nil {
-		return nil, fmt.Errorf("loading env: %w", err)
+		return nil, fmt.Errorf("loading secrets: %w", err)
 	}
 
-	svcs, err := config.LoadServices(cfg.ServicesDir)
+	svcs, err := config.LoadServices(cfg.ServicesDir, cfg.Profile)
 	if err != nil {
 		return nil, fmt.Errorf("loading services: %w", err)
 	}
 
 	a := &App{
+		configPath:    configPath,
+		profile:       profile,
+		templatesFS:   templatesFS,
+		secrets:       secrets,
+		confirmations: service.NewConfirmationTracker(confirmationTTL, cfg.StateDir),
+		notifier:      &swapNotifier{},
 		cfg:           cfg,
 		env:           env,
-		confirmations: service.NewConfirmationTracker(10 * time.Minute),
+		running:       make(map[component]*runningComponent),
 	}
 
-	// Create Manager with NopNotifier initially.
-	a.manager, err = service.NewManager(cfg, svcs, service.NopNotifier{})
+	// The manager notifies through swapNotifier, which forwards to whichever
+	// frontends are currently configured.
+	a.manager, err = service.NewManager(cfg, svcs, a.notifier)
 	if err != nil {
 		return nil, fmt.Errorf("creating manager: %w", err)
 	}
+	a.manager.SetSecrets(secrets)
+	a.manager.SetOnReload(a.onManagerReload)
 
-	// Build notifier list.
-	var notifiers service.MultiNotifier
-
-	// Discord: check env.DiscordToken, then fall back to token.txt.
-	discordToken := env.DiscordToken
-	if discordToken == "" {
-		if data, readErr := os.ReadFile("token.txt"); readErr == nil {
-			discordToken = strings.TrimSpace(string(data))
+	for _, c := range components {
+		if err := a.build(c, cfg, env); err != nil {
+			a.manager.Stop()
+			return nil, err
 		}
 	}
+	a.updateNotifier()
 
-	if cfg.Discord != nil && discordToken != "" {
-		dcfg := discord.Config{
-			Token:     discordToken,
-			GuildID:   cfg.Discord.GuildID,
-			ChannelID: cfg.Discord.ChannelID,
-		}
-		a.discordBot = discord.New(dcfg, a.manager)
-		notifiers = append(notifiers, a.discordBot.Notifier())
-	}
+	return a, nil
+}
 
-	// Mattermost.
-	if cfg.Mattermost != nil && env.MattermostToken != "" {
-		mcfg := mattermost.Config{
-			URL:     cfg.Mattermost.URL,
-			Token:   env.MattermostToken,
-			Channel: cfg.Mattermost.Channel,
+// build creates the component from cfg and env, storing it in its App field
+// (nil if it is not configured). a.mu must be held, or a not yet shared.
+func (a *App) build(c component, cfg *config.Config, env *config.Env) error {
+	switch c {
+	case discordComponent:
+		a.discordBot = nil
+		// Discord: check env.DiscordToken, then fall back to token.txt.
+		discordToken := env.DiscordToken
+		if discordToken == "" {
+			if data, readErr := os.ReadFile("token.txt"); readErr == nil {
+				discordToken = strings.TrimSpace(string(data))
+			}
 		}
-		a.mmBot = mattermost.New(mcfg, a.manager)
-		a.mmBot.SetConfirmHandler(a)
-		notifiers = append(notifiers, mattermost.NewNotifier(a.mmBot))
-	}
-
-	// Matrix. All four secrets are required; partial config is silently
-	// skipped to match the Discord/Mattermost behaviour.
-	if cfg.Matrix != nil &&
-		env.MatrixUserID != "" && env.MatrixDeviceID != "" &&
-		env.MatrixAccessToken != "" && env.MatrixPickleKey != "" {
-		mxcfg := matrix.Config{
-			Homeserver:    cfg.Matrix.Homeserver,
-			Room:          cfg.Matrix.Room,
-			CommandPrefix: cfg.Matrix.CommandPrefix,
-			CryptoDB:      cfg.Matrix.CryptoDB,
-			UserID:        env.MatrixUserID,
-			DeviceID:      env.MatrixDeviceID,
-			AccessToken:   env.MatrixAccessToken,
-			PickleKey:     env.MatrixPickleKey,
+		if cfg.Discord != nil && discordToken != "" {
+			dcfg := discord.Config{
+				Token:     discordToken,
+				GuildID:   cfg.Discord.GuildID,
+				ChannelID: cfg.Discord.ChannelID,
+			}
+			a.discordBot = discord.New(dcfg, a.manager)
+			a.discordBot.SetConfirmHandler(a)
 		}
-		a.matrixBot = matrix.New(mxcfg, cfg.StateDir, a.manager)
-		a.matrixBot.SetConfirmHandler(a)
-		notifiers = append(notifiers, matrix.NewNotifier(a.matrixBot))
-	}
 
-	// Set the real notifier on the manager.
-	if len(notifiers) > 0 {
-		a.manager.SetNotifier(notifiers)
-	}
+	case mattermostComponent:
+		a.mmBot = nil
+		if cfg.Mattermost != nil && env.MattermostToken != "" {
+			mcfg := mattermost.Config{
+				URL:     cfg.Mattermost.URL,
+				Token:   env.MattermostToken,
+				Channel: cfg.Mattermost.Channel,
+			}
+			a.mmBot = mattermost.New(mcfg, a.manager)
+			a.mmBot.SetConfirmHandler(a)
+		}
 
-	// Webhook server.
-	if cfg.Webhook != nil && env.WebhookSecret != "" {
-		whHandler := webhook.NewHandler(env.WebhookSecret, a)
-		webhookMux := http.NewServeMux()
-		webhookMux.Handle("POST /webhook/github", whHandler)
-
-		a.webhookSrv = &http.Server{
-			Addr:         fmt.Sprintf(":%d", cfg.Webhook.Port),
-			Handler:      webhookMux,
-			ReadTimeout:  10 * time.Second,
-			WriteTimeout: 10 * time.Second,
+	case matrixComponent:
+		// All four secrets are required; partial config is silently
+		// skipped to match the Discord/Mattermost behaviour.
+		a.matrixBot = nil
+		if cfg.Matrix != nil &&
+			env.MatrixUserID != "" && env.MatrixDeviceID != "" &&
+			env.MatrixAccessToken != "" && env.MatrixPickleKey != "" {
+			mxcfg := matrix.Config{
+				Homeserver:    cfg.Matrix.Homeserver,
+				Room:          cfg.Matrix.Room,
+				CommandPrefix: cfg.Matrix.CommandPrefix,
+				CryptoDB:      cfg.Matrix.CryptoDB,
+				UserID:        env.MatrixUserID,
+				DeviceID:      env.MatrixDeviceID,
+				AccessToken:   env.MatrixAccessToken,
+				PickleKey:     env.MatrixPickleKey,
+			}
+			a.matrixBot = matrix.New(mxcfg, cfg.StateDir, a.manager)
+			a.matrixBot.SetConfirmHandler(a)
 		}
-	}
 
-	// Dashboard server.
-	if cfg.Dashboard != nil {
-		dash, dashErr := dashboard.New(a.manager, templatesFS)
-		if dashErr != nil {
-			a.manager.Stop()
-			return nil, fmt.Errorf("creating dashboard: %w", dashErr)
+	case webhookComponent:
+		a.webhookSrv, a.webhookH = nil, nil
+		if cfg.Webhook != nil && env.WebhookSecret != "" {
+			a.webhookH = webhook.NewHandler(env.WebhookSecret, a)
+			webhookMux := http.NewServeMux()
+			webhookMux.Handle("POST /webhook/github", a.webhookH)
+
+			a.webhookSrv = &http.Server{
+				Addr:         fmt.Sprintf(":%d", cfg.Webhook.Port),
+				Handler:      webhookMux,
+				ReadTimeout:  10 * time.Second,
+				WriteTimeout: 10 * time.Second,
+			}
 		}
 
-		a.dashboardSrv = &http.Server{
-			Addr:         fmt.Sprintf(":%d", cfg.Dashboard.Port),
-			Handler:      dash,
-			ReadTimeout:  10 * time.Second,
-			WriteTimeout: 10 * time.Second,
+	case dashboardComponent:
+		a.dashboardSrv = nil
+		if cfg.Dashboard != nil {
+			dash, err := dashboard.New(a.manager, a.templatesFS)
+			if err != nil {
+				return fmt.Errorf("creating dashboard: %w", err)
+			}
+
+			a.dashboardSrv = &http.Server{
+				Addr:         fmt.Sprintf(":%d", cfg.Dashboard.Port),
+				Handler:      dash,
+				ReadTimeout:  10 * time.Second,
+				WriteTimeout: 10 * time.Second,
+			}
 		}
 	}
+	return nil
+}
 
-	return a, nil
+// updateNotifier points the manager's notifications at the current frontends.
+func (a *App) updateNotifier() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var notifiers service.MultiNotifier
+	if a.discordBot != nil {
+		notifiers = append(notifiers, a.discordBot.Notifier())
+	}
+	if a.mmBot != nil {
+		notifiers = append(notifiers, mattermost.NewNotifier(a.mmBot))
+	}
+	if a.matrixBot != nil {
+		notifiers = append(notifiers, matrix.NewNotifier(a.matrixBot))
+	}
+	a.notifier.set(notifiers)
 }
 
 // Manager returns the service manager for use by the CLI frontend.
@@ -162,62 +224,28 @@ func (a *App) Manager() *service.Manager {
 // Run starts all enabled components and blocks until ctx is cancelled.
 func (a *App) Run(ctx context.Context) error {
 	ctx, cancel := context.WithCancel(ctx)
-	a.cancel = cancel
-
-	if a.webhookSrv != nil {
-		go func() {
-			log.Printf("webhook server listening on %s", a.webhookSrv.Addr)
-			if err := a.webhookSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-				log.Printf("webhook server error: %v", err)
-			}
-		}()
-	}
-
-	if a.dashboardSrv != nil {
-		go func() {
-			log.Printf("dashboard server listening on %s", a.dashboardSrv.Addr)
-			if err := a.dashboardSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-				log.Printf("dashboard server error: %v", err)
-			}
-		}()
-	}
-
-	if a.discordBot != nil {
-		go func() {
-			if err := a.discordBot.Run(ctx); err != nil {
-				log.Printf("discord bot error: %v", err)
-			}
-		}()
-	}
 
-	if a.mmBot != nil {
-		go func() {
-			if err := a.mmBot.Run(ctx); err != nil {
-				log.Printf("mattermost bot error: %v", err)
-			}
-		}()
-	}
-
-	if a.matrixBot != nil {
-		go func() {
-			if err := a.matrixBot.Run(ctx); err != nil {
-				log.Printf("matrix bot error: %v", err)
-			}
-		}()
+	a.mu.Lock()
+	a.cancel = cancel
+	a.runCtx = ctx
+	for _, c := range components {
+		a.startLocked(c)
 	}
+	mmBot, matrixBot := a.mmBot, a.matrixBot
+	a.mu.Unlock()
 
 	// Wait for frontends to be ready before signalling the manager.
 	go func() {
-		if a.mmBot != nil {
+		if mmBot != nil {
 			select {
-			case <-a.mmBot.Ready():
+			case <-mmBot.Ready():
 			case <-ctx.Done():
 				return
 			}
 		}
-		if a.matrixBot != nil {
+		if matrixBot != nil {
 			select {
-			case <-a.matrixBot.Ready():
+			case <-matrixBot.Ready():
 			case <-ctx.Done():
 				return
 			}
@@ -231,23 +259,15 @@ func (a *App) Run(ctx context.Context) error {
 
 // Shutdown gracefully stops all components.
 func (a *App) Shutdown() {
-	if a.cancel != nil {
-		a.cancel()
+	a.mu.Lock()
+	cancel := a.cancel
+	a.mu.Unlock()
+	if cancel != nil {
+		cancel()
 	}
 
-	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer shutdownCancel()
-
-	if a.webhookSrv != nil {
-		if err := a.webhookSrv.Shutdown(shutdownCtx); err != nil {
-			log.Printf("webhook server shutdown: %v", err)
-		}
-	}
-
-	if a.dashboardSrv != nil {
-		if err := a.dashboardSrv.Shutdown(shutdownCtx); err != nil {
-			log.Printf("dashboard server shutdown: %v", err)
-		}
+	for _, c := range components {
+		a.stop(c)
 	}
 
 	a.manager.Stop()
@@ -274,35 +294,180 @@ func (a *App) HandlePush(event webhook.PushEvent) {
 		Timestamp: event.HeadCommit.Timestamp,
 	})
 
+	// Redeliveries and re-pushes of the commit already deployed need
+	// neither a confirmation nor a deploy.
+	req := service.DeployRequest{Trigger: service.TriggerWebhook, Actor: event.Pusher, Commit: event.HeadCommit.ID}
+	var already *service.AlreadyDeployedError
+	if errors.As(a.manager.CheckDeployed(svcName, req), &already) {
+		log.Printf("app: %v, skipping push", already)
+		a.manager.NotifyEvent(svcName, fmt.Sprintf("push skipped: already at `%s`", service.ShortSHA(already.Commit)))
+		return
+	}
+
 	svcCfg, _ := a.manager.GetServiceConfig(svcName)
-	if svcCfg.RequireConfirmation {
-		a.confirmations.AddPending(svcName, event.Branch)
-		if a.mmBot != nil {
-			msg := fmt.Sprintf("Deploy queued for **%s** (repo: %s, branch: %s). "+
-				"Reply `@mezzaops confirm %s` to proceed.", svcName, event.Repo, event.Branch, svcName)
-			a.mmBot.PostMessage(context.Background(), msg)
+	paused := a.manager.DeployBlock(svcName)
+	if rules := svcCfg.ApprovalRules(); rules != nil {
+		pending := service.PendingApproval{
+			Service:   svcName,
+			Branch:    event.Branch,
+			Commit:    event.HeadCommit.ID,
+			Pusher:    event.Pusher,
+			Since:     time.Now(),
+			Required:  rules.RequiredApprovals(),
+			Approvers: rules.Approvers,
 		}
-		if a.matrixBot != nil {
-			msg := fmt.Sprintf("Deploy queued for **%s** (repo: %s, branch: %s). "+
-				"Reply `%s confirm %s` to proceed.",
-				svcName, event.Repo, event.Branch, a.matrixBot.CommandPrefix(), svcName)
-			a.matrixBot.PostMessage(context.Background(), msg)
+		a.confirmations.AddPending(pending)
+		note := approvalNote(rules)
+		if paused != "" {
+			note += fmt.Sprintf(" Deploys are paused (%s); confirming deploys anyway.", paused)
 		}
+		a.mu.Lock()
+		discordBot, mmBot, matrixBot := a.discordBot, a.mmBot, a.matrixBot
+		a.mu.Unlock()
+		if discordBot == nil && mmBot == nil && matrixBot == nil {
+			return
+		}
+		// The plan fetches from origin, which can take longer than the
+		// webhook sender is willing to wait.
+		go func() {
+			plan := a.confirmationPlan(svcName)
+			if discordBot != nil {
+				msg := fmt.Sprintf("Deploy queued for **%s** (repo: %s, branch: %s). "+
+					"Approve or deny it below, or with `/ops confirm` or `/ops deny`.%s",
+					svcName, event.Repo, event.Branch, note)
+				discordBot.PostConfirmation(svcName, msg, plan, pending.Since.Add(confirmationTTL))
+			}
+			if mmBot != nil {
+				msg := fmt.Sprintf("Deploy queued for **%s** (repo: %s, branch: %s). "+
+					"Reply `@mezzaops confirm %s` to proceed or `@mezzaops deny %s` to drop it.%s\n\n```\n%s\n```",
+					svcName, event.Repo, event.Branch, svcName, svcName, note, plan)
+				mmBot.PostMessage(context.Background(), msg)
+			}
+			if matrixBot != nil {
+				prefix := matrixBot.CommandPrefix()
+				msg := fmt.Sprintf("Deploy queued for **%s** (repo: %s, branch: %s). "+
+					"Reply `%s confirm %s` to proceed or `%s deny %s` to drop it.%s\n\n```\n%s\n```",
+					svcName, event.Repo, event.Branch, prefix, svcName, prefix, svcName, note, plan)
+				matrixBot.PostMessage(context.Background(), msg)
+			}
+		}()
 		return
 	}
 
-	if err := a.manager.RequestDeploy(svcName); err != nil {
+	if paused != "" {
+		// Held until the freeze lifts or the next deploy window opens;
+		// `confirm` deploys it sooner.
+		if err := a.manager.HoldDeploy(svcName, req); err != nil {
+			log.Printf("app: hold deploy for %s: %v", svcName, err)
+		}
+		return
+	}
+	if err := a.manager.RequestDeploy(svcName, req); err != nil {
 		log.Printf("app: request deploy for %s: %v", svcName, err)
 	}
 }
 
-// Confirm implements mattermost.ConfirmHandler.
-func (a *App) Confirm(svc string) bool {
-	if !a.confirmations.Confirm(svc) {
-		return false
+// confirmationPlan returns the deploy plan appended to a confirmation
+// prompt, so whoever confirms can see what the deploy brings in.
+func (a *App) confirmationPlan(svc string) string {
+	plan, err := a.manager.Plan(svc)
+	if err != nil {
+		return fmt.Sprintf("Could not plan the deploy: %v", err)
+	}
+	return strings.TrimRight(service.FormatPlan(plan), "\n")
+}
+
+// approvalNote describes who needs to approve a push, or "" if one
+// approval from anyone will do.
+func approvalNote(rules *config.ApprovalsConfig) string {
+	n := rules.RequiredApprovals()
+	var note string
+	switch {
+	case n == 1 && len(rules.Approvers) == 0:
+		return ""
+	case n == 1:
+		note = " Needs approval"
+	default:
+		note = fmt.Sprintf(" Needs %d approvals", n)
 	}
-	if err := a.manager.RequestDeploy(svc); err != nil {
-		log.Printf("app: confirm deploy for %s: %v", svc, err)
+	if len(rules.Approvers) > 0 {
+		note += " from " + strings.Join(rules.Approvers, ", ")
 	}
-	return true
+	return note + "."
+}
+
+// Confirm implements the frontends' ConfirmHandler. It records actor's approval
+// of the push awaiting approval for svc, and deploys it once it has all the
+// approvals it needs, which the returned PendingApproval reports. With no
+// push awaiting approval, it deploys a push held by a freeze or deploy
+// window instead.
+func (a *App) Confirm(svc, actor string) (service.PendingApproval, error) {
+	if !a.confirmations.IsPending(svc) {
+		if state, ok := a.manager.GetServiceState(svc); ok && state.Held != nil {
+			if err := a.mayRelease(svc, actor); err != nil {
+				return service.PendingApproval{}, err
+			}
+			if a.manager.ReleaseHeld(svc, actor) {
+				return service.PendingApproval{Service: svc, ApprovedBy: []string{actor}}, nil
+			}
+		}
+	}
+	p, err := a.confirmations.Approve(svc, actor)
+	if err != nil {
+		return p, err
+	}
+	if !p.Approved() {
+		log.Printf("app: %s approved by %s, %d of %d", svc, actor, len(p.ApprovedBy), p.Required)
+		return p, nil
+	}
+	a.closePrompt(svc, "Approved by "+strings.Join(p.ApprovedBy, ", ")+".")
+	if err := a.manager.RequestDeploy(svc, p.Request()); err != nil {
+		return p, fmt.Errorf("approved, but the deploy failed: %w", err)
+	}
+	return p, nil
+}
+
+// mayRelease checks that actor may release svc's held push, which deploys it
+// despite a freeze: services needing approval only let their approvers.
+func (a *App) mayRelease(svc, actor string) error {
+	svcCfg, _ := a.manager.GetServiceConfig(svc)
+	rules := svcCfg.ApprovalRules()
+	if rules == nil {
+		return nil
+	}
+	if actor == "" {
+		return errors.New("approvals need to know who you are")
+	}
+	if !rules.MayApprove(actor) {
+		return fmt.Errorf("%s is not an approver for %s", actor, svc)
+	}
+	return nil
+}
+
+// Deny implements the frontends' ConfirmHandler. It drops the push awaiting
+// approval for svc.
+func (a *App) Deny(svc, actor string) error {
+	p, err := a.confirmations.Deny(svc, actor)
+	if err != nil {
+		return err
+	}
+	log.Printf("app: %s denied by %s", p, actor)
+	a.closePrompt(svc, "Denied by "+actor+".")
+	return nil
+}
+
+// closePrompt disables the buttons on svc's confirmation prompt in Discord,
+// now that the push has been handled.
+func (a *App) closePrompt(svc, note string) {
+	a.mu.Lock()
+	discordBot := a.discordBot
+	a.mu.Unlock()
+	if discordBot != nil {
+		discordBot.ClosePrompt(svc, note)
+	}
+}
+
+// PendingApprovals implements the frontends' ConfirmHandler.
+func (a *App) PendingApprovals() []service.PendingApproval {
+	return a.confirmations.Pending()
 }
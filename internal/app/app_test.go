@@ -8,12 +8,13 @@ import (
 	"testing/fstest"
 	"time"
 
+	"github.com/shishberg/mezzaops/internal/service"
 	"github.com/shishberg/mezzaops/internal/webhook"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
-const minimalTemplate = `<!DOCTYPE html><html><body>{{range $name, $state := .}}{{$name}}{{end}}</body></html>`
+const minimalTemplate = `<!DOCTYPE html><html><body>{{range $name, $state := .Services}}{{$name}}{{end}}</body></html>`
 const minimalServiceTemplate = `<!DOCTYPE html><html><body>{{.Name}}</body></html>`
 
 func writeTestConfig(t *testing.T, dir string) string {
@@ -79,9 +80,11 @@ func TestNew_DashboardOnly(t *testing.T) {
 	tmplFS := fstest.MapFS{
 		"index.html":   &fstest.MapFile{Data: []byte(minimalTemplate)},
 		"service.html": &fstest.MapFile{Data: []byte(minimalServiceTemplate)},
+		"deploys.html": &fstest.MapFile{Data: []byte(minimalServiceTemplate)},
+		"plan.html":    &fstest.MapFile{Data: []byte(minimalServiceTemplate)},
 	}
 
-	a, err := app_New(cfgPath, envPath, tmplFS)
+	a, err := app_New(cfgPath, "", envPath, tmplFS)
 	require.NoError(t, err)
 	require.NotNil(t, a)
 
@@ -110,9 +113,11 @@ func TestNew_NoFrontends(t *testing.T) {
 	tmplFS := fstest.MapFS{
 		"index.html":   &fstest.MapFile{Data: []byte(minimalTemplate)},
 		"service.html": &fstest.MapFile{Data: []byte(minimalServiceTemplate)},
+		"deploys.html": &fstest.MapFile{Data: []byte(minimalServiceTemplate)},
+		"plan.html":    &fstest.MapFile{Data: []byte(minimalServiceTemplate)},
 	}
 
-	a, err := app_New(cfgPath, envPath, tmplFS)
+	a, err := app_New(cfgPath, "", envPath, tmplFS)
 	require.NoError(t, err)
 	require.NotNil(t, a)
 
@@ -136,9 +141,11 @@ func TestHandlePush_MatchingService(t *testing.T) {
 	tmplFS := fstest.MapFS{
 		"index.html":   &fstest.MapFile{Data: []byte(minimalTemplate)},
 		"service.html": &fstest.MapFile{Data: []byte(minimalServiceTemplate)},
+		"deploys.html": &fstest.MapFile{Data: []byte(minimalServiceTemplate)},
+		"plan.html":    &fstest.MapFile{Data: []byte(minimalServiceTemplate)},
 	}
 
-	a, err := app_New(cfgPath, envPath, tmplFS)
+	a, err := app_New(cfgPath, "", envPath, tmplFS)
 	require.NoError(t, err)
 	defer a.manager.Stop()
 
@@ -180,9 +187,11 @@ state_dir: ` + filepath.Join(dir, "state") + `
 	tmplFS := fstest.MapFS{
 		"index.html":   &fstest.MapFile{Data: []byte(minimalTemplate)},
 		"service.html": &fstest.MapFile{Data: []byte(minimalServiceTemplate)},
+		"deploys.html": &fstest.MapFile{Data: []byte(minimalServiceTemplate)},
+		"plan.html":    &fstest.MapFile{Data: []byte(minimalServiceTemplate)},
 	}
 
-	a, err := app_New(cfgPath, envPath, tmplFS)
+	a, err := app_New(cfgPath, "", envPath, tmplFS)
 	require.NoError(t, err)
 	defer a.manager.Stop()
 
@@ -191,6 +200,9 @@ state_dir: ` + filepath.Join(dir, "state") + `
 
 	// Check that confirmation is pending
 	assert.True(t, a.confirmations.IsPending("confirmsvc"))
+
+	// The prompt's plan says why there isn't one, as dir is no checkout.
+	assert.Contains(t, a.confirmationPlan("confirmsvc"), "Could not plan the deploy")
 }
 
 func TestConfirm_AfterPush(t *testing.T) {
@@ -220,9 +232,11 @@ state_dir: ` + filepath.Join(dir, "state") + `
 	tmplFS := fstest.MapFS{
 		"index.html":   &fstest.MapFile{Data: []byte(minimalTemplate)},
 		"service.html": &fstest.MapFile{Data: []byte(minimalServiceTemplate)},
+		"deploys.html": &fstest.MapFile{Data: []byte(minimalServiceTemplate)},
+		"plan.html":    &fstest.MapFile{Data: []byte(minimalServiceTemplate)},
 	}
 
-	a, err := app_New(cfgPath, envPath, tmplFS)
+	a, err := app_New(cfgPath, "", envPath, tmplFS)
 	require.NoError(t, err)
 	defer a.manager.Stop()
 
@@ -231,13 +245,180 @@ state_dir: ` + filepath.Join(dir, "state") + `
 	assert.True(t, a.confirmations.IsPending("confirmsvc"))
 
 	// Confirm it
-	ok := a.Confirm("confirmsvc")
-	assert.True(t, ok)
+	p, err := a.Confirm("confirmsvc", "alice")
+	require.NoError(t, err)
+	assert.True(t, p.Approved())
 
 	// Pending should be cleared
 	assert.False(t, a.confirmations.IsPending("confirmsvc"))
 }
 
+func TestConfirm_Approvals(t *testing.T) {
+	dir := t.TempDir()
+	svcDir := filepath.Join(dir, "services")
+	require.NoError(t, os.MkdirAll(svcDir, 0o755))
+
+	svcYAML := `branch: main
+repo: org/approvalrepo
+dir: /tmp
+approvals:
+  required: 2
+  approvers: [alice, bob, carol]
+deploy:
+  - echo ok
+`
+	require.NoError(t, os.WriteFile(filepath.Join(svcDir, "approvalsvc.yaml"), []byte(svcYAML), 0o644))
+
+	configYAML := `services_dir: ` + svcDir + `
+log_dir: ` + filepath.Join(dir, "logs") + `
+state_dir: ` + filepath.Join(dir, "state") + `
+`
+	cfgPath := filepath.Join(dir, "config.yaml")
+	require.NoError(t, os.WriteFile(cfgPath, []byte(configYAML), 0o644))
+
+	envPath := filepath.Join(dir, ".env")
+	require.NoError(t, os.WriteFile(envPath, []byte(""), 0o644))
+
+	tmplFS := fstest.MapFS{
+		"index.html":   &fstest.MapFile{Data: []byte(minimalTemplate)},
+		"service.html": &fstest.MapFile{Data: []byte(minimalServiceTemplate)},
+		"deploys.html": &fstest.MapFile{Data: []byte(minimalServiceTemplate)},
+		"plan.html":    &fstest.MapFile{Data: []byte(minimalServiceTemplate)},
+	}
+
+	a, err := app_New(cfgPath, "", envPath, tmplFS)
+	require.NoError(t, err)
+
+	a.HandlePush(webhook.PushEvent{Repo: "org/approvalrepo", Branch: "main", Pusher: "dave",
+		HeadCommit: webhook.HeadCommit{ID: "abc1234def"}})
+
+	_, err = a.Confirm("approvalsvc", "mallory")
+	assert.ErrorContains(t, err, "mallory is not an approver")
+
+	p, err := a.Confirm("approvalsvc", "alice")
+	require.NoError(t, err)
+	assert.False(t, p.Approved())
+	assert.Equal(t, []string{"alice"}, p.ApprovedBy)
+
+	// The pending approval survives a restart.
+	a.manager.Stop()
+	a, err = app_New(cfgPath, "", envPath, tmplFS)
+	require.NoError(t, err)
+	defer a.manager.Stop()
+
+	pending := a.PendingApprovals()
+	require.Len(t, pending, 1)
+	assert.Equal(t, "abc1234def", pending[0].Commit)
+	assert.Equal(t, "dave", pending[0].Pusher)
+
+	_, err = a.Confirm("approvalsvc", "alice")
+	assert.ErrorContains(t, err, "already approved")
+
+	require.NoError(t, a.Deny("approvalsvc", "carol"))
+	assert.Empty(t, a.PendingApprovals())
+	_, err = a.Confirm("approvalsvc", "bob")
+	assert.ErrorContains(t, err, "awaiting approval")
+
+	// Releasing a held push is limited to approvers too.
+	_, err = a.manager.Freeze("all", 0, "release", "alice")
+	require.NoError(t, err)
+	require.NoError(t, a.manager.HoldDeploy("approvalsvc",
+		service.DeployRequest{Trigger: service.TriggerWebhook, Actor: "dave", Commit: "abc1234def"}))
+	_, err = a.Confirm("approvalsvc", "mallory")
+	assert.ErrorContains(t, err, "mallory is not an approver")
+	state, _ := a.manager.GetServiceState("approvalsvc")
+	assert.NotNil(t, state.Held)
+	_, err = a.Confirm("approvalsvc", "bob")
+	require.NoError(t, err)
+	state, _ = a.manager.GetServiceState("approvalsvc")
+	assert.Nil(t, state.Held)
+}
+
+func TestHandlePush_HeldWhileFrozen(t *testing.T) {
+	dir := t.TempDir()
+	cfgPath := writeMinimalConfig(t, dir)
+	envPath := filepath.Join(dir, ".env")
+
+	tmplFS := fstest.MapFS{
+		"index.html":   &fstest.MapFile{Data: []byte(minimalTemplate)},
+		"service.html": &fstest.MapFile{Data: []byte(minimalServiceTemplate)},
+		"deploys.html": &fstest.MapFile{Data: []byte(minimalServiceTemplate)},
+		"plan.html":    &fstest.MapFile{Data: []byte(minimalServiceTemplate)},
+	}
+
+	a, err := app_New(cfgPath, "", envPath, tmplFS)
+	require.NoError(t, err)
+	defer a.manager.Stop()
+
+	_, err = a.manager.Freeze("all", 0, "release", "alice")
+	require.NoError(t, err)
+
+	a.HandlePush(webhook.PushEvent{
+		Repo:       "org/testrepo",
+		Branch:     "main",
+		Pusher:     "bob",
+		HeadCommit: webhook.HeadCommit{ID: "abc1234def"},
+	})
+
+	state, ok := a.manager.GetServiceState("testsvc")
+	require.True(t, ok)
+	assert.NotEqual(t, "deploying", state.Status)
+	require.NotNil(t, state.Held)
+	assert.Equal(t, "bob", state.Held.Actor)
+	assert.Equal(t, "abc1234def", state.Held.Commit)
+
+	// Confirming deploys the held push despite the freeze, recording who
+	// released it.
+	_, err = a.Confirm("testsvc", "alice")
+	assert.NoError(t, err)
+	state, _ = a.manager.GetServiceState("testsvc")
+	assert.Nil(t, state.Held)
+	require.Eventually(t, func() bool {
+		records, _ := a.manager.GetDeployHistory("testsvc")
+		return len(records) == 1
+	}, 10*time.Second, 20*time.Millisecond)
+	records, _ := a.manager.GetDeployHistory("testsvc")
+	assert.Equal(t, service.TriggerChat, records[0].Trigger)
+	assert.Equal(t, "alice", records[0].Actor)
+}
+
+func TestHandlePush_SkipsDeployedCommit(t *testing.T) {
+	dir := t.TempDir()
+	cfgPath := writeMinimalConfig(t, dir)
+	envPath := filepath.Join(dir, ".env")
+
+	stateDir := filepath.Join(dir, "state")
+	require.NoError(t, os.MkdirAll(stateDir, 0o755))
+	require.NoError(t, service.SaveState(stateDir, "testsvc", service.State{DeployedCommit: "abc1234def"}))
+
+	tmplFS := fstest.MapFS{
+		"index.html":   &fstest.MapFile{Data: []byte(minimalTemplate)},
+		"service.html": &fstest.MapFile{Data: []byte(minimalServiceTemplate)},
+		"deploys.html": &fstest.MapFile{Data: []byte(minimalServiceTemplate)},
+		"plan.html":    &fstest.MapFile{Data: []byte(minimalServiceTemplate)},
+	}
+
+	a, err := app_New(cfgPath, "", envPath, tmplFS)
+	require.NoError(t, err)
+	defer a.manager.Stop()
+
+	// Frozen, so a push that isn't skipped is held where we can see it.
+	_, err = a.manager.Freeze("all", 0, "release", "alice")
+	require.NoError(t, err)
+
+	push := webhook.PushEvent{Repo: "org/testrepo", Branch: "main", Pusher: "bob",
+		HeadCommit: webhook.HeadCommit{ID: "abc1234def"}}
+	a.HandlePush(push)
+	state, _ := a.manager.GetServiceState("testsvc")
+	assert.Nil(t, state.Held, "push of the deployed commit should be skipped")
+
+	push.HeadCommit.ID = "fedcba9876"
+	a.HandlePush(push)
+	state, _ = a.manager.GetServiceState("testsvc")
+	require.NotNil(t, state.Held)
+	assert.Equal(t, "fedcba9876", state.Held.Commit)
+}
+
 func TestConfirm_WithoutPending(t *testing.T) {
 	dir := t.TempDir()
 	cfgPath := writeMinimalConfig(t, dir)
@@ -246,15 +427,17 @@ func TestConfirm_WithoutPending(t *testing.T) {
 	tmplFS := fstest.MapFS{
 		"index.html":   &fstest.MapFile{Data: []byte(minimalTemplate)},
 		"service.html": &fstest.MapFile{Data: []byte(minimalServiceTemplate)},
+		"deploys.html": &fstest.MapFile{Data: []byte(minimalServiceTemplate)},
+		"plan.html":    &fstest.MapFile{Data: []byte(minimalServiceTemplate)},
 	}
 
-	a, err := app_New(cfgPath, envPath, tmplFS)
+	a, err := app_New(cfgPath, "", envPath, tmplFS)
 	require.NoError(t, err)
 	defer a.manager.Stop()
 
-	// Confirm with no pending should return false
-	ok := a.Confirm("nonexistent")
-	assert.False(t, ok)
+	// Confirm with nothing pending is an error
+	_, err = a.Confirm("nonexistent", "alice")
+	assert.Error(t, err)
 }
 
 func TestShutdown(t *testing.T) {
@@ -265,9 +448,11 @@ func TestShutdown(t *testing.T) {
 	tmplFS := fstest.MapFS{
 		"index.html":   &fstest.MapFile{Data: []byte(minimalTemplate)},
 		"service.html": &fstest.MapFile{Data: []byte(minimalServiceTemplate)},
+		"deploys.html": &fstest.MapFile{Data: []byte(minimalServiceTemplate)},
+		"plan.html":    &fstest.MapFile{Data: []byte(minimalServiceTemplate)},
 	}
 
-	a, err := app_New(cfgPath, envPath, tmplFS)
+	a, err := app_New(cfgPath, "", envPath, tmplFS)
 	require.NoError(t, err)
 
 	ctx, cancel := context.WithCancel(context.Background())
@@ -301,9 +486,11 @@ func TestManager_Accessor(t *testing.T) {
 	tmplFS := fstest.MapFS{
 		"index.html":   &fstest.MapFile{Data: []byte(minimalTemplate)},
 		"service.html": &fstest.MapFile{Data: []byte(minimalServiceTemplate)},
+		"deploys.html": &fstest.MapFile{Data: []byte(minimalServiceTemplate)},
+		"plan.html":    &fstest.MapFile{Data: []byte(minimalServiceTemplate)},
 	}
 
-	a, err := app_New(cfgPath, envPath, tmplFS)
+	a, err := app_New(cfgPath, "", envPath, tmplFS)
 	require.NoError(t, err)
 	defer a.manager.Stop()
 
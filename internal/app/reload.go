@@ -0,0 +1,322 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/shishberg/mezzaops/internal/config"
+	"github.com/shishberg/mezzaops/internal/deploy"
+	"github.com/shishberg/mezzaops/internal/service"
+)
+
+// component identifies a frontend or HTTP server that can be restarted on
+// its own when its part of the config changes.
+type component string
+
+const (
+	discordComponent    component = "discord bot"
+	mattermostComponent component = "mattermost bot"
+	matrixComponent     component = "matrix bot"
+	webhookComponent    component = "webhook server"
+	dashboardComponent  component = "dashboard server"
+)
+
+// components lists every component in start order.
+var components = []component{
+	webhookComponent, dashboardComponent,
+	discordComponent, mattermostComponent, matrixComponent,
+}
+
+// stopTimeout bounds how long stop waits for a component to exit.
+const stopTimeout = 10 * time.Second
+
+// runningComponent is a component started by Run.
+type runningComponent struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// runFunc returns the blocking run function for the component as currently
+// built, or nil if it is not configured. a.mu must be held.
+func (a *App) runFunc(c component) func(context.Context) error {
+	switch c {
+	case discordComponent:
+		if a.discordBot != nil {
+			return a.discordBot.Run
+		}
+	case mattermostComponent:
+		if a.mmBot != nil {
+			return a.mmBot.Run
+		}
+	case matrixComponent:
+		if a.matrixBot != nil {
+			return a.matrixBot.Run
+		}
+	case webhookComponent:
+		if a.webhookSrv != nil {
+			return serve(a.webhookSrv)
+		}
+	case dashboardComponent:
+		if a.dashboardSrv != nil {
+			return serve(a.dashboardSrv)
+		}
+	}
+	return nil
+}
+
+// serve returns a run function that serves srv until ctx is cancelled and
+// then shuts it down gracefully.
+func serve(srv *http.Server) func(context.Context) error {
+	return func(ctx context.Context) error {
+		errCh := make(chan error, 1)
+		go func() { errCh <- srv.ListenAndServe() }()
+
+		select {
+		case err := <-errCh:
+			return err
+		case <-ctx.Done():
+		}
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		return srv.Shutdown(shutdownCtx)
+	}
+}
+
+// startLocked launches the component, if configured, under a.runCtx. a.mu
+// must be held.
+func (a *App) startLocked(c component) {
+	run := a.runFunc(c)
+	if run == nil || a.runCtx == nil {
+		return
+	}
+	switch c {
+	case webhookComponent:
+		log.Printf("webhook server listening on %s", a.webhookSrv.Addr)
+	case dashboardComponent:
+		log.Printf("dashboard server listening on %s", a.dashboardSrv.Addr)
+	}
+
+	ctx, cancel := context.WithCancel(a.runCtx)
+	rc := &runningComponent{cancel: cancel, done: make(chan struct{})}
+	a.running[c] = rc
+	go func() {
+		defer close(rc.done)
+		if err := run(ctx); err != nil && err != http.ErrServerClosed {
+			log.Printf("%s error: %v", c, err)
+		}
+	}()
+}
+
+// stop cancels the component if it is running and waits for it to exit.
+func (a *App) stop(c component) {
+	a.mu.Lock()
+	rc := a.running[c]
+	delete(a.running, c)
+	a.mu.Unlock()
+	if rc == nil {
+		return
+	}
+
+	rc.cancel()
+	select {
+	case <-rc.done:
+	case <-time.After(stopTimeout):
+		log.Printf("app: %s did not stop within %v", c, stopTimeout)
+	}
+}
+
+// onManagerReload runs at the end of the reload command. It re-reads
+// config.yaml and secrets and applies frontend changes in the background:
+// the reload may have come from a frontend that is about to be restarted,
+// and waiting for it to stop from inside its own handler would deadlock.
+func (a *App) onManagerReload() error {
+	cfg, env, err := a.loadConfig()
+	if err != nil {
+		return err
+	}
+	go a.applyConfig(cfg, env)
+	return nil
+}
+
+// reloadConfig re-reads config.yaml and secrets and applies the changes
+// before returning.
+func (a *App) reloadConfig() error {
+	cfg, env, err := a.loadConfig()
+	if err != nil {
+		return err
+	}
+	a.applyConfig(cfg, env)
+	return nil
+}
+
+// loadConfig re-reads config.yaml (with the profile overlay) and resolves
+// secrets from its sources.
+func (a *App) loadConfig() (*config.Config, *config.Env, error) {
+	cfg, err := config.LoadConfig(a.configPath, a.profile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("loading config: %w", err)
+	}
+
+	a.mu.Lock()
+	oldSources := a.cfg.Secrets
+	a.mu.Unlock()
+	if !reflect.DeepEqual(oldSources, cfg.Secrets) {
+		if err := a.secrets.SetSources(cfg.Secrets); err != nil {
+			return nil, nil, fmt.Errorf("loading secrets: %w", err)
+		}
+	}
+
+	env, err := a.secrets.Env()
+	if err != nil {
+		return nil, nil, fmt.Errorf("loading secrets: %w", err)
+	}
+	return cfg, env, nil
+}
+
+// applyConfig restarts the frontends and HTTP servers whose settings or
+// credentials differ between the current config and cfg, leaving the others
+// (and the manager and its services) untouched. A changed webhook secret is
+// applied without rebinding the listener.
+func (a *App) applyConfig(cfg *config.Config, env *config.Env) {
+	a.reloadMu.Lock()
+	defer a.reloadMu.Unlock()
+
+	a.mu.Lock()
+	old, oldEnv := a.cfg, a.env
+	a.cfg, a.env = cfg, env
+	a.mu.Unlock()
+
+	if cfg.ServicesDir != old.ServicesDir || cfg.LogDir != old.LogDir || cfg.StateDir != old.StateDir {
+		log.Printf("app: services_dir, log_dir and state_dir changes take effect after a restart")
+	}
+	if n := cfg.MaxConcurrentDeploys(); n != old.MaxConcurrentDeploys() {
+		a.manager.SetMaxConcurrent(n)
+		log.Printf("app: deploy.max_concurrent set to %d", n)
+	}
+	if u := cfg.DashboardURL(); u != old.DashboardURL() {
+		a.manager.SetPublicURL(u)
+	}
+
+	changed := map[component]bool{
+		discordComponent: !reflect.DeepEqual(old.Discord, cfg.Discord) ||
+			oldEnv.DiscordToken != env.DiscordToken,
+		mattermostComponent: !reflect.DeepEqual(old.Mattermost, cfg.Mattermost) ||
+			oldEnv.MattermostToken != env.MattermostToken,
+		matrixComponent: !reflect.DeepEqual(old.Matrix, cfg.Matrix) ||
+			oldEnv.MatrixUserID != env.MatrixUserID || oldEnv.MatrixDeviceID != env.MatrixDeviceID ||
+			oldEnv.MatrixAccessToken != env.MatrixAccessToken || oldEnv.MatrixPickleKey != env.MatrixPickleKey,
+		webhookComponent: !reflect.DeepEqual(old.Webhook, cfg.Webhook) ||
+			(oldEnv.WebhookSecret == "") != (env.WebhookSecret == ""),
+		dashboardComponent: !reflect.DeepEqual(old.Dashboard, cfg.Dashboard),
+	}
+
+	for _, c := range components {
+		if !changed[c] {
+			continue
+		}
+		a.stop(c)
+		if c == discordComponent {
+			// The old bot's presence updates go nowhere once it has stopped.
+			a.manager.SetOnChange(nil)
+		}
+
+		a.mu.Lock()
+		err := a.build(c, cfg, env)
+		if err == nil {
+			a.startLocked(c)
+		}
+		a.mu.Unlock()
+		if err != nil {
+			log.Printf("app: reloading %s: %v", c, err)
+			continue
+		}
+		log.Printf("app: %s reloaded", c)
+	}
+
+	if !changed[webhookComponent] && env.WebhookSecret != oldEnv.WebhookSecret {
+		a.mu.Lock()
+		if a.webhookH != nil {
+			a.webhookH.SetSecret(env.WebhookSecret)
+		}
+		a.mu.Unlock()
+	}
+
+	a.updateNotifier()
+}
+
+// swapNotifier forwards to a set of notifiers that can be replaced while the
+// manager is running, as frontends are reloaded.
+type swapNotifier struct {
+	mu sync.RWMutex
+	n  service.MultiNotifier
+}
+
+var _ service.Notifier = (*swapNotifier)(nil)
+
+func (s *swapNotifier) set(n service.MultiNotifier) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.n = n
+}
+
+func (s *swapNotifier) get() service.MultiNotifier {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.n
+}
+
+// ServiceEvent forwards to the current frontends.
+func (s *swapNotifier) ServiceEvent(name, event string) {
+	s.get().ServiceEvent(name, event)
+}
+
+// DeployStarted forwards to the current frontends.
+func (s *swapNotifier) DeployStarted(name string) {
+	s.get().DeployStarted(name)
+}
+
+// DeployProgress forwards to the current frontends.
+func (s *swapNotifier) DeployProgress(name string, steps []deploy.StepResult) {
+	s.get().DeployProgress(name, steps)
+}
+
+// DeploySucceeded forwards to the current frontends.
+func (s *swapNotifier) DeploySucceeded(name string, changes service.Changelog) {
+	s.get().DeploySucceeded(name, changes)
+}
+
+// DeployFailed forwards to the current frontends.
+func (s *swapNotifier) DeployFailed(name, step, output, logURL string) {
+	s.get().DeployFailed(name, step, output, logURL)
+}
+
+// DeployVerifyFailed forwards to the current frontends.
+func (s *swapNotifier) DeployVerifyFailed(name, rolledBackTo, output, logURL string) {
+	s.get().DeployVerifyFailed(name, rolledBackTo, output, logURL)
+}
+
+// RollbackStarted forwards to the current frontends.
+func (s *swapNotifier) RollbackStarted(name, sha string) {
+	s.get().RollbackStarted(name, sha)
+}
+
+// RollbackSucceeded forwards to the current frontends.
+func (s *swapNotifier) RollbackSucceeded(name, sha string) {
+	s.get().RollbackSucceeded(name, sha)
+}
+
+// RollbackFailed forwards to the current frontends.
+func (s *swapNotifier) RollbackFailed(name, step, output, logURL string) {
+	s.get().RollbackFailed(name, step, output, logURL)
+}
+
+// WebhookReceived forwards to the current frontends.
+func (s *swapNotifier) WebhookReceived(name string, info service.WebhookInfo) {
+	s.get().WebhookReceived(name, info)
+}
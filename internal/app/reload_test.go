@@ -0,0 +1,176 @@
+package app
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// freePort returns a TCP port that was free a moment ago.
+func freePort(t *testing.T) int {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := l.Addr().(*net.TCPAddr).Port
+	require.NoError(t, l.Close())
+	return port
+}
+
+// writeServerConfig writes config.yaml with the given extra YAML appended.
+func writeServerConfig(t *testing.T, dir, extra string) string {
+	t.Helper()
+	svcDir := filepath.Join(dir, "services")
+	configYAML := `services_dir: ` + svcDir + `
+log_dir: ` + filepath.Join(dir, "logs") + `
+state_dir: ` + filepath.Join(dir, "state") + `
+` + extra
+	cfgPath := filepath.Join(dir, "config.yaml")
+	require.NoError(t, os.WriteFile(cfgPath, []byte(configYAML), 0o644))
+	return cfgPath
+}
+
+// get returns the status of a GET to the local port, or 0 if it fails.
+func get(port int, path string) int {
+	client := &http.Client{Timeout: time.Second}
+	resp, err := client.Get(fmt.Sprintf("http://127.0.0.1:%d%s", port, path))
+	if err != nil {
+		return 0
+	}
+	_ = resp.Body.Close()
+	return resp.StatusCode
+}
+
+// runApp runs a in the background and stops it when the test ends.
+func runApp(t *testing.T, a *App) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		_ = a.Run(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		a.Shutdown()
+		<-done
+	})
+}
+
+func TestReloadConfig_RebindsServersWithoutTouchingManager(t *testing.T) {
+	dir := t.TempDir()
+	writeTestConfig(t, dir)
+	envPath := filepath.Join(dir, ".env")
+	require.NoError(t, os.WriteFile(envPath, []byte("GITHUB_WEBHOOK_SECRET=s\n"), 0o644))
+
+	dashPort, newDashPort, hookPort := freePort(t), freePort(t), freePort(t)
+	cfgPath := writeServerConfig(t, dir, fmt.Sprintf("dashboard:\n  port: %d\n", dashPort))
+
+	tmplFS := fstest.MapFS{
+		"index.html":   &fstest.MapFile{Data: []byte(minimalTemplate)},
+		"service.html": &fstest.MapFile{Data: []byte(minimalServiceTemplate)},
+		"deploys.html": &fstest.MapFile{Data: []byte(minimalServiceTemplate)},
+		"plan.html":    &fstest.MapFile{Data: []byte(minimalServiceTemplate)},
+	}
+	a, err := New(cfgPath, "", envPath, tmplFS)
+	require.NoError(t, err)
+	runApp(t, a)
+
+	manager := a.manager
+	assert.Eventually(t, func() bool { return get(dashPort, "/") == http.StatusOK }, 5*time.Second, 20*time.Millisecond)
+	assert.Nil(t, a.webhookSrv)
+
+	writeServerConfig(t, dir, fmt.Sprintf("dashboard:\n  port: %d\nwebhook:\n  port: %d\n", newDashPort, hookPort))
+	require.NoError(t, a.reloadConfig())
+
+	assert.Eventually(t, func() bool { return get(newDashPort, "/") == http.StatusOK }, 5*time.Second, 20*time.Millisecond)
+	assert.Equal(t, 0, get(dashPort, "/"), "old dashboard listener should be closed")
+	// GET on the webhook path is not allowed, but proves the server is up.
+	assert.Eventually(t, func() bool {
+		return get(hookPort, "/webhook/github") == http.StatusMethodNotAllowed
+	}, 5*time.Second, 20*time.Millisecond)
+
+	assert.Same(t, manager, a.manager)
+	_, ok := a.manager.GetServiceConfig("testsvc")
+	assert.True(t, ok)
+}
+
+func TestReload_RotatesWebhookSecretInPlace(t *testing.T) {
+	dir := t.TempDir()
+	writeTestConfig(t, dir)
+	envPath := filepath.Join(dir, ".env")
+	require.NoError(t, os.WriteFile(envPath, []byte("GITHUB_WEBHOOK_SECRET=old\n"), 0o644))
+
+	port := freePort(t)
+	cfgPath := writeServerConfig(t, dir, fmt.Sprintf("webhook:\n  port: %d\n", port))
+	a, err := New(cfgPath, "", envPath, fstest.MapFS{})
+	require.NoError(t, err)
+	runApp(t, a)
+	handler := a.webhookH
+
+	post := func(secret string) int {
+		body := `{"ref":"refs/heads/other","repository":{"full_name":"org/none"}}`
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(body))
+		req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("http://127.0.0.1:%d/webhook/github", port), strings.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("X-GitHub-Event", "push")
+		req.Header.Set("X-Hub-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return 0
+		}
+		_ = resp.Body.Close()
+		return resp.StatusCode
+	}
+	assert.Eventually(t, func() bool { return post("old") == http.StatusOK }, 5*time.Second, 20*time.Millisecond)
+
+	// The reload command re-reads .env; only the secret changes, so the
+	// listener is kept and the handler gets the new secret.
+	require.NoError(t, os.WriteFile(envPath, []byte("GITHUB_WEBHOOK_SECRET=new\n"), 0o644))
+	require.NoError(t, a.manager.Reload())
+
+	assert.Eventually(t, func() bool { return post("new") == http.StatusOK }, 5*time.Second, 20*time.Millisecond)
+	assert.Equal(t, http.StatusForbidden, post("old"))
+	a.mu.Lock()
+	assert.Same(t, handler, a.webhookH)
+	a.mu.Unlock()
+}
+
+func TestReloadConfig_InvalidConfigKeepsRunning(t *testing.T) {
+	dir := t.TempDir()
+	writeTestConfig(t, dir)
+	envPath := filepath.Join(dir, ".env")
+	require.NoError(t, os.WriteFile(envPath, nil, 0o644))
+
+	port := freePort(t)
+	cfgPath := writeServerConfig(t, dir, fmt.Sprintf("dashboard:\n  port: %d\n", port))
+	tmplFS := fstest.MapFS{
+		"index.html":   &fstest.MapFile{Data: []byte(minimalTemplate)},
+		"service.html": &fstest.MapFile{Data: []byte(minimalServiceTemplate)},
+		"deploys.html": &fstest.MapFile{Data: []byte(minimalServiceTemplate)},
+		"plan.html":    &fstest.MapFile{Data: []byte(minimalServiceTemplate)},
+	}
+	a, err := New(cfgPath, "", envPath, tmplFS)
+	require.NoError(t, err)
+	runApp(t, a)
+	assert.Eventually(t, func() bool { return get(port, "/") == http.StatusOK }, 5*time.Second, 20*time.Millisecond)
+
+	require.NoError(t, os.WriteFile(cfgPath, []byte("dashbaord:\n  port: 1\n"), 0o644))
+	err = a.reloadConfig()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "dashbaord")
+	assert.Equal(t, http.StatusOK, get(port, "/"))
+}
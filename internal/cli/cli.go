@@ -3,21 +3,35 @@ package cli
 import (
 	"bufio"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"slices"
 	"strings"
+	"time"
+
+	"github.com/shishberg/mezzaops/internal/service"
 )
 
 // ServiceManager matches the interface used by Discord/Mattermost frontends.
 type ServiceManager interface {
 	Do(name, op string) string
-	RequestDeploy(name string) error
+	RequestDeploy(name string, req service.DeployRequest) error
+	RequestRollback(name, target string, req service.DeployRequest) (string, error)
+	CancelDeploy(name, actor string) error
+	Freeze(target string, d time.Duration, reason, actor string) (service.Freeze, error)
+	Unfreeze(target, actor string) error
+	Resume(name, actor string) error
+	ScheduleDeploy(name string, at time.Time, req service.DeployRequest) (service.ScheduledDeploy, error)
+	ScheduledDeploys() []service.ScheduledDeploy
+	Unschedule(id, actor string) (service.ScheduledDeploy, error)
 	StartAll()
 	StopAll()
 	Reload() error
 	ServiceNames() []string
 	CountRunning() (int, int)
+	DeployQueue() service.DeployQueue
 }
 
 // Run starts an interactive CLI reading from stdin.
@@ -57,7 +71,23 @@ func RunWithReader(ctx context.Context, manager ServiceManager, r io.Reader) err
 			fmt.Println("  restart <service>   Restart a service")
 			fmt.Println("  logs <service>      Show service logs")
 			fmt.Println("  pull <service>      Git pull in service dir")
-			fmt.Println("  deploy <service>    Request a deploy")
+			fmt.Println("  plan <service>      Show the commits and files a deploy would bring in")
+			fmt.Println("  deploy <service>[@ref] [--force] [at <time>|in <duration>]")
+			fmt.Println("                      Request a deploy, optionally of a tag, branch or commit;")
+			fmt.Println("                      --force deploys even if the commit is already deployed;")
+			fmt.Println("                      at 15:04 or in 2h schedules it for later")
+			fmt.Println("  history <service>   Show recent deploys")
+			fmt.Println("  rollback <service> [sha|N]")
+			fmt.Println("                      Roll back to a commit or the Nth previous good deploy")
+			fmt.Println("  cancel <service>    Cancel a running deploy")
+			fmt.Println("  freeze <service|all> [duration] [reason]")
+			fmt.Println("                      Hold pushes instead of deploying them")
+			fmt.Println("  unfreeze <service|all>")
+			fmt.Println("                      Lift a freeze and deploy any held push")
+			fmt.Println("  resume <service>    Resume auto-deploy after failed deploys paused it")
+			fmt.Println("  queue               Show running, queued and superseded deploys")
+			fmt.Println("  scheduled           Show scheduled deploys")
+			fmt.Println("  unschedule <id>     Cancel a scheduled deploy")
 			fmt.Println("  reload              Reload config")
 			fmt.Println("  start-all           Start all services")
 			fmt.Println("  stop-all            Stop all services")
@@ -68,7 +98,7 @@ func RunWithReader(ctx context.Context, manager ServiceManager, r io.Reader) err
 		case "quit", "exit":
 			return nil
 
-		case "status", "start", "stop", "restart", "logs", "pull":
+		case "status", "start", "stop", "restart", "logs", "pull", "plan", "history":
 			if svc == "" {
 				fmt.Printf("usage: %s <service>\n", cmd)
 				continue
@@ -77,15 +107,114 @@ func RunWithReader(ctx context.Context, manager ServiceManager, r io.Reader) err
 
 		case "deploy":
 			if svc == "" {
-				fmt.Println("usage: deploy <service>")
+				fmt.Println("usage: deploy <service>[@ref] [--force] [at <time>|in <duration>]")
 				continue
 			}
-			if err := manager.RequestDeploy(svc); err != nil {
+			name, ref := service.SplitRef(svc)
+			at, args, err := service.ParseSchedule(fields[2:], time.Now())
+			if err != nil {
+				fmt.Println("error:", err)
+				continue
+			}
+			req := service.DeployRequest{Trigger: service.TriggerCLI, Actor: os.Getenv("USER"), Ref: ref,
+				Force: slices.Contains(args, "--force")}
+			if !at.IsZero() {
+				if s, err := manager.ScheduleDeploy(name, at, req); err != nil {
+					fmt.Println("error:", err)
+				} else {
+					fmt.Printf("deploy #%s of %s scheduled for %s\n", s.ID, svc, s.When())
+				}
+				continue
+			}
+			var already *service.AlreadyDeployedError
+			if err := manager.RequestDeploy(name, req); errors.As(err, &already) {
+				fmt.Printf("%v; use --force to deploy it again\n", already)
+			} else if err != nil {
 				fmt.Println("error:", err)
 			} else {
 				fmt.Println("deploy requested for", svc)
 			}
 
+		case "rollback":
+			if svc == "" {
+				fmt.Println("usage: rollback <service> [sha|N]")
+				continue
+			}
+			var target string
+			if len(fields) >= 3 {
+				target = fields[2]
+			}
+			req := service.DeployRequest{Trigger: service.TriggerCLI, Actor: os.Getenv("USER")}
+			sha, err := manager.RequestRollback(svc, target, req)
+			if err != nil {
+				fmt.Println("error:", err)
+			} else {
+				fmt.Printf("rollback of %s to %s requested\n", svc, service.ShortSHA(sha))
+			}
+
+		case "cancel":
+			if svc == "" {
+				fmt.Println("usage: cancel <service>")
+				continue
+			}
+			if err := manager.CancelDeploy(svc, os.Getenv("USER")); err != nil {
+				fmt.Println("error:", err)
+			} else {
+				fmt.Println("cancelling deploy of", svc)
+			}
+
+		case "freeze":
+			if svc == "" {
+				fmt.Println("usage: freeze <service|all> [duration] [reason]")
+				continue
+			}
+			d, reason := service.ParseFreezeArgs(fields[2:])
+			f, err := manager.Freeze(svc, d, reason, os.Getenv("USER"))
+			if err != nil {
+				fmt.Println("error:", err)
+			} else {
+				fmt.Println(svc, f)
+			}
+
+		case "unfreeze":
+			if svc == "" {
+				fmt.Println("usage: unfreeze <service|all>")
+				continue
+			}
+			if err := manager.Unfreeze(svc, os.Getenv("USER")); err != nil {
+				fmt.Println("error:", err)
+			} else {
+				fmt.Println("unfroze", svc)
+			}
+
+		case "resume":
+			if svc == "" {
+				fmt.Println("usage: resume <service>")
+				continue
+			}
+			if err := manager.Resume(svc, os.Getenv("USER")); err != nil {
+				fmt.Println("error:", err)
+			} else {
+				fmt.Println("resumed auto-deploy of", svc)
+			}
+
+		case "queue":
+			fmt.Print(service.FormatQueue(manager.DeployQueue()))
+
+		case "scheduled":
+			fmt.Print(service.FormatSchedule(manager.ScheduledDeploys()))
+
+		case "unschedule":
+			if svc == "" {
+				fmt.Println("usage: unschedule <id>")
+				continue
+			}
+			if s, err := manager.Unschedule(svc, os.Getenv("USER")); err != nil {
+				fmt.Println("error:", err)
+			} else {
+				fmt.Printf("cancelled scheduled deploy #%s of %s\n", s.ID, s.Service)
+			}
+
 		case "reload":
 			if err := manager.Reload(); err != nil {
 				fmt.Println("error:", err)
@@ -6,9 +6,13 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"slices"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/shishberg/mezzaops/internal/service"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -17,6 +21,12 @@ import (
 type mockManager struct {
 	doCalls        []doCall
 	deployCalls    []string
+	deployReqs     []service.DeployRequest
+	rollbackCalls  []string
+	cancelCalls    []string
+	freezeCalls    []string
+	resumeCalls    []string
+	scheduled      []service.ScheduledDeploy
 	reloaded       bool
 	startAllCalled bool
 	stopAllCalled  bool
@@ -31,11 +41,61 @@ func (m *mockManager) Do(name, op string) string {
 	return fmt.Sprintf("%s: %s done", name, op)
 }
 
-func (m *mockManager) RequestDeploy(name string) error {
+func (m *mockManager) RequestDeploy(name string, req service.DeployRequest) error {
 	m.deployCalls = append(m.deployCalls, name)
+	m.deployReqs = append(m.deployReqs, req)
 	return nil
 }
 
+func (m *mockManager) RequestRollback(name, target string, req service.DeployRequest) (string, error) {
+	m.rollbackCalls = append(m.rollbackCalls, name+" "+target)
+	return "0123456789abcdef", nil
+}
+
+func (m *mockManager) CancelDeploy(name, actor string) error {
+	m.cancelCalls = append(m.cancelCalls, name)
+	return nil
+}
+
+func (m *mockManager) Freeze(target string, d time.Duration, reason, actor string) (service.Freeze, error) {
+	m.freezeCalls = append(m.freezeCalls, fmt.Sprintf("freeze %s %s %s", target, d, reason))
+	return service.Freeze{Target: target, Reason: reason}, nil
+}
+
+func (m *mockManager) Unfreeze(target, actor string) error {
+	m.freezeCalls = append(m.freezeCalls, "unfreeze "+target)
+	return nil
+}
+
+func (m *mockManager) Resume(name, actor string) error {
+	m.resumeCalls = append(m.resumeCalls, name)
+	return nil
+}
+
+func (m *mockManager) ScheduleDeploy(name string, at time.Time, req service.DeployRequest) (service.ScheduledDeploy, error) {
+	s := service.ScheduledDeploy{
+		ID:           strconv.Itoa(len(m.scheduled) + 1),
+		At:           at,
+		QueuedDeploy: service.QueuedDeploy{Service: name, DeployRequest: req},
+	}
+	m.scheduled = append(m.scheduled, s)
+	return s, nil
+}
+
+func (m *mockManager) ScheduledDeploys() []service.ScheduledDeploy {
+	return m.scheduled
+}
+
+func (m *mockManager) Unschedule(id, actor string) (service.ScheduledDeploy, error) {
+	for i, s := range m.scheduled {
+		if s.ID == id {
+			m.scheduled = slices.Delete(m.scheduled, i, i+1)
+			return s, nil
+		}
+	}
+	return service.ScheduledDeploy{}, fmt.Errorf("no scheduled deploy #%s", id)
+}
+
 func (m *mockManager) StartAll() {
 	m.startAllCalled = true
 }
@@ -57,6 +117,13 @@ func (m *mockManager) CountRunning() (int, int) {
 	return 1, 2
 }
 
+func (m *mockManager) DeployQueue() service.DeployQueue {
+	return service.DeployQueue{
+		MaxConcurrent: 1,
+		Running:       []service.QueuedDeploy{{Service: "api", DeployRequest: service.DeployRequest{Trigger: service.TriggerWebhook}}},
+	}
+}
+
 // captureOutput redirects os.Stdout to capture printed output during test.
 func captureOutput(t *testing.T, fn func()) string {
 	t.Helper()
@@ -119,6 +186,20 @@ func TestCLI_StartService(t *testing.T) {
 	assert.Contains(t, output, "myservice: start done")
 }
 
+func TestCLI_Plan(t *testing.T) {
+	mgr := &mockManager{}
+	input := strings.NewReader("plan myservice\nquit\n")
+
+	output := captureOutput(t, func() {
+		err := RunWithReader(context.Background(), mgr, input)
+		require.NoError(t, err)
+	})
+
+	require.Len(t, mgr.doCalls, 1)
+	assert.Equal(t, "plan", mgr.doCalls[0].op)
+	assert.Contains(t, output, "myservice: plan done")
+}
+
 func TestCLI_Quit(t *testing.T) {
 	mgr := &mockManager{}
 	input := strings.NewReader("quit\n")
@@ -150,6 +231,7 @@ func TestCLI_Deploy(t *testing.T) {
 
 	require.Len(t, mgr.deployCalls, 1)
 	assert.Equal(t, "myapp", mgr.deployCalls[0])
+	assert.Equal(t, service.TriggerCLI, mgr.deployReqs[0].Trigger)
 	assert.Contains(t, output, "deploy requested for myapp")
 }
 
@@ -166,6 +248,19 @@ func TestCLI_Reload(t *testing.T) {
 	assert.Contains(t, output, "config reloaded")
 }
 
+func TestCLI_Queue(t *testing.T) {
+	mgr := &mockManager{}
+	input := strings.NewReader("queue\nquit\n")
+
+	output := captureOutput(t, func() {
+		err := RunWithReader(context.Background(), mgr, input)
+		require.NoError(t, err)
+	})
+
+	assert.Contains(t, output, "1 running, 0 queued (max 1 at once)")
+	assert.Contains(t, output, "1. api: deploy (webhook)")
+}
+
 func TestCLI_Count(t *testing.T) {
 	mgr := &mockManager{}
 	input := strings.NewReader("count\nquit\n")
@@ -216,3 +311,90 @@ func TestCLI_MissingServiceArg(t *testing.T) {
 	assert.Contains(t, output, "usage: start <service>")
 	assert.Empty(t, mgr.doCalls)
 }
+
+func TestCLI_Rollback(t *testing.T) {
+	mgr := &mockManager{}
+	input := strings.NewReader("rollback myapp 2\nquit\n")
+
+	output := captureOutput(t, func() {
+		err := RunWithReader(context.Background(), mgr, input)
+		require.NoError(t, err)
+	})
+
+	assert.Equal(t, []string{"myapp 2"}, mgr.rollbackCalls)
+	assert.Contains(t, output, "rollback of myapp to 0123456 requested")
+}
+
+func TestCLI_Cancel(t *testing.T) {
+	mgr := &mockManager{}
+	input := strings.NewReader("cancel myapp\ncancel\nquit\n")
+
+	output := captureOutput(t, func() {
+		err := RunWithReader(context.Background(), mgr, input)
+		require.NoError(t, err)
+	})
+
+	assert.Equal(t, []string{"myapp"}, mgr.cancelCalls)
+	assert.Contains(t, output, "cancelling deploy of myapp")
+	assert.Contains(t, output, "usage: cancel <service>")
+}
+
+func TestCLI_Freeze(t *testing.T) {
+	mgr := &mockManager{}
+	input := strings.NewReader("freeze myapp 2h db migration\nunfreeze myapp\nfreeze\nquit\n")
+
+	output := captureOutput(t, func() {
+		err := RunWithReader(context.Background(), mgr, input)
+		require.NoError(t, err)
+	})
+
+	assert.Equal(t, []string{"freeze myapp 2h0m0s db migration", "unfreeze myapp"}, mgr.freezeCalls)
+	assert.Contains(t, output, "myapp frozen: db migration")
+	assert.Contains(t, output, "unfroze myapp")
+	assert.Contains(t, output, "usage: freeze <service|all> [duration] [reason]")
+}
+
+func TestCLI_Resume(t *testing.T) {
+	mgr := &mockManager{}
+	input := strings.NewReader("resume myapp\nresume\nquit\n")
+
+	output := captureOutput(t, func() {
+		err := RunWithReader(context.Background(), mgr, input)
+		require.NoError(t, err)
+	})
+
+	assert.Equal(t, []string{"myapp"}, mgr.resumeCalls)
+	assert.Contains(t, output, "resumed auto-deploy of myapp")
+	assert.Contains(t, output, "usage: resume <service>")
+}
+
+func TestCLI_ScheduleDeploy(t *testing.T) {
+	mgr := &mockManager{}
+	input := strings.NewReader("deploy myapp@v2 in 90m\nscheduled\nunschedule 1\nunschedule 1\nscheduled\nquit\n")
+
+	output := captureOutput(t, func() {
+		err := RunWithReader(context.Background(), mgr, input)
+		require.NoError(t, err)
+	})
+
+	assert.Empty(t, mgr.deployCalls)
+	assert.Contains(t, output, "deploy #1 of myapp@v2 scheduled for ")
+	assert.Contains(t, output, "#1 myapp: deploy @v2 (cli) at ")
+	assert.Contains(t, output, "cancelled scheduled deploy #1 of myapp")
+	assert.Contains(t, output, "error: no scheduled deploy #1")
+	assert.Contains(t, output, "no deploys scheduled")
+}
+
+func TestCLI_DeployRef(t *testing.T) {
+	mgr := &mockManager{}
+	input := strings.NewReader("deploy myapp@v1.4.2\nquit\n")
+
+	captureOutput(t, func() {
+		err := RunWithReader(context.Background(), mgr, input)
+		require.NoError(t, err)
+	})
+
+	require.Len(t, mgr.deployCalls, 1)
+	assert.Equal(t, "myapp", mgr.deployCalls[0])
+	assert.Equal(t, "v1.4.2", mgr.deployReqs[0].Ref)
+}
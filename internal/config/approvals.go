@@ -0,0 +1,56 @@
+package config
+
+import "strings"
+
+// ApprovalsConfig requires pushes to be approved in chat before they deploy.
+type ApprovalsConfig struct {
+	// Required is how many different people must approve. Default 1.
+	Required int `yaml:"required,omitempty"`
+
+	// Approvers lists the chat users who may approve or deny. Empty means
+	// anyone who can send the bot commands. Names match on every frontend,
+	// so a name must be the same person in each one enabled.
+	Approvers []string `yaml:"approvers,omitempty"`
+}
+
+// RequiredApprovals returns how many approvals a push needs.
+func (a *ApprovalsConfig) RequiredApprovals() int {
+	if a.Required > 0 {
+		return a.Required
+	}
+	return 1
+}
+
+// MayApprove reports whether user is allowed to approve or deny. Names are
+// compared ignoring case and any leading "@", so "@alice" matches "alice".
+func (a *ApprovalsConfig) MayApprove(user string) bool {
+	if len(a.Approvers) == 0 {
+		return true
+	}
+	for _, approver := range a.Approvers {
+		if SameUser(approver, user) {
+			return true
+		}
+	}
+	return false
+}
+
+// SameUser reports whether two chat user names are the same person, ignoring
+// case and any leading "@". Names carry no frontend, so "alice" in Discord
+// and "alice" in Mattermost are taken to be the same person.
+func SameUser(a, b string) bool {
+	return strings.EqualFold(strings.TrimPrefix(a, "@"), strings.TrimPrefix(b, "@"))
+}
+
+// ApprovalRules returns the approvals a push to the service needs, or nil if
+// it deploys without any. require_confirmation alone needs one approval from
+// anyone.
+func (s *ServiceConfig) ApprovalRules() *ApprovalsConfig {
+	if s.Approvals != nil {
+		return s.Approvals
+	}
+	if s.RequireConfirmation {
+		return &ApprovalsConfig{}
+	}
+	return nil
+}
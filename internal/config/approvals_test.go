@@ -0,0 +1,53 @@
+package config_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/shishberg/mezzaops/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadServices_Approvals(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"api.yaml":    "approvals:\n  required: 2\n  approvers: [alice, \"@bob\", carol]\n",
+		"web.yaml":    "require_confirmation: true\n",
+		"worker.yaml": "dir: /opt/worker\n",
+	})
+
+	services, err := config.LoadServices(dir, "")
+	require.NoError(t, err)
+	require.Len(t, services, 3)
+
+	api := services[0].ApprovalRules()
+	require.NotNil(t, api)
+	assert.Equal(t, 2, api.RequiredApprovals())
+	assert.True(t, api.MayApprove("Alice"))
+	assert.True(t, api.MayApprove("@bob"))
+	assert.True(t, api.MayApprove("bob"))
+	assert.False(t, api.MayApprove("mallory"))
+
+	web := services[1].ApprovalRules()
+	require.NotNil(t, web)
+	assert.Equal(t, 1, web.RequiredApprovals())
+	assert.True(t, web.MayApprove("anyone"))
+
+	assert.Nil(t, services[2].ApprovalRules())
+}
+
+func TestValidateServices_Approvals(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"a.yaml": "approvals:\n  required: 3\n  approvers: [alice, bob]\n",
+		"b.yaml": "approvals:\n  required: -1\n",
+		"c.yaml": "approvals:\n  required: 2\n",
+	})
+
+	problems := problemStrings(t, config.ValidateServices(dir, ""))
+	assert.Equal(t, []string{
+		filepath.Join(dir, "a.yaml") + ":2: approvals.required is 3 but only 2 approvers are listed",
+		filepath.Join(dir, "b.yaml") + ":2: approvals.required must not be negative",
+	}, problems)
+}
@@ -0,0 +1,49 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// CloneURL returns the URL to clone the service's repo from. A repo given
+// as a GitHub name ("org/name") or host path ("github.com/org/name") is
+// cloned over SSH if the service has a deploy key, and HTTPS otherwise;
+// full URLs, scp-style addresses and local paths are used as they are.
+func (s *ServiceConfig) CloneURL() string {
+	repo := s.Repo
+	if strings.Contains(repo, "://") || strings.HasPrefix(repo, "git@") || filepath.IsAbs(repo) {
+		return repo
+	}
+	host, path := "github.com", repo
+	if h, p, ok := strings.Cut(repo, "/"); ok && strings.Contains(h, ".") {
+		host, path = h, p
+	}
+	path = strings.TrimSuffix(path, ".git")
+	if s.DeployKey != "" {
+		return fmt.Sprintf("git@%s:%s.git", host, path)
+	}
+	return fmt.Sprintf("https://%s/%s.git", host, path)
+}
+
+// GitSSHCommand returns the GIT_SSH_COMMAND that makes git use the service's
+// deploy key, or "" if it has none. Hosts not yet in known_hosts are
+// accepted on first use, since a new server has never seen the git host.
+func (s *ServiceConfig) GitSSHCommand() string {
+	if s.DeployKey == "" {
+		return ""
+	}
+	key := "'" + strings.ReplaceAll(s.DeployKey, "'", `'\''`) + "'"
+	return "ssh -i " + key + " -o IdentitiesOnly=yes -o StrictHostKeyChecking=accept-new"
+}
+
+// AwaitingClone reports whether the service's dir doesn't exist yet but can
+// be cloned from its repo, which the first deploy does.
+func (s *ServiceConfig) AwaitingClone() bool {
+	if s.Repo == "" || s.Dir == "" {
+		return false
+	}
+	_, err := os.Stat(s.Dir)
+	return os.IsNotExist(err)
+}
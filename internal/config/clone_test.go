@@ -0,0 +1,55 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/shishberg/mezzaops/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServiceConfig_CloneURL(t *testing.T) {
+	for _, tc := range []struct {
+		repo, key, want string
+	}{
+		{"org/api", "", "https://github.com/org/api.git"},
+		{"github.com/org/api", "", "https://github.com/org/api.git"},
+		{"github.com/org/api", "/keys/api", "git@github.com:org/api.git"},
+		{"gitlab.example.com/org/api.git", "/keys/api", "git@gitlab.example.com:org/api.git"},
+		{"https://git.example.com/api.git", "/keys/api", "https://git.example.com/api.git"},
+		{"git@github.com:org/api.git", "", "git@github.com:org/api.git"},
+		{"/srv/git/api.git", "", "/srv/git/api.git"},
+	} {
+		svc := config.ServiceConfig{Repo: tc.repo, DeployKey: tc.key}
+		assert.Equal(t, tc.want, svc.CloneURL(), "repo %q, deploy key %q", tc.repo, tc.key)
+	}
+}
+
+func TestServiceConfig_GitSSHCommand(t *testing.T) {
+	assert.Empty(t, (&config.ServiceConfig{}).GitSSHCommand())
+	svc := config.ServiceConfig{DeployKey: "/keys/bob's key"}
+	assert.Equal(t, `ssh -i '/keys/bob'\''s key' -o IdentitiesOnly=yes -o StrictHostKeyChecking=accept-new`, svc.GitSSHCommand())
+}
+
+func TestValidateServices_Clone(t *testing.T) {
+	dir := t.TempDir()
+	key := filepath.Join(dir, "id_ed25519")
+	require.NoError(t, os.WriteFile(key, nil, 0o600))
+	missing := filepath.Join(dir, "not-cloned-yet")
+	writeFiles(t, dir, map[string]string{
+		// A missing dir is fine with a repo to clone it from.
+		"a.yaml": "dir: " + missing + "\nrepo: org/a\nbranch: main\nentrypoint: [\"./a\"]\ndeploy_key: " + key + "\n",
+		"b.yaml": "dir: " + missing + "\n",
+		"c.yaml": "deploy_key: " + key + "\n",
+		"d.yaml": "repo: org/d\nbranch: main\ndeploy_key: /nonexistent/key\n",
+	})
+
+	problems := problemStrings(t, config.ValidateServices(dir, ""))
+	assert.Equal(t, []string{
+		filepath.Join(dir, "b.yaml") + ":1: dir " + missing + " does not exist",
+		filepath.Join(dir, "c.yaml") + ":1: deploy_key is set but repo is empty",
+		filepath.Join(dir, "d.yaml") + ":3: deploy_key /nonexistent/key does not exist",
+	}, problems)
+}
@@ -1,13 +1,14 @@
 package config
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
 
-	"github.com/joho/godotenv"
 	"gopkg.in/yaml.v3"
 )
 
@@ -40,6 +41,18 @@ type WebhookConfig struct {
 // DashboardConfig holds web dashboard settings.
 type DashboardConfig struct {
 	Port int `yaml:"port"`
+
+	// PublicURL is where users reach the dashboard, e.g.
+	// "https://ops.example.com". If set, failure notifications link to the
+	// deploy's full log there.
+	PublicURL string `yaml:"public_url,omitempty"`
+}
+
+// DeployConfig holds settings shared by every service's deploys.
+type DeployConfig struct {
+	// MaxConcurrent caps how many deploys run at once; the rest wait in a
+	// first-come, first-served queue. 0 means no limit.
+	MaxConcurrent int `yaml:"max_concurrent,omitempty"`
 }
 
 // Config is the top-level application configuration loaded from YAML.
@@ -47,33 +60,97 @@ type Config struct {
 	ServicesDir string            `yaml:"services_dir"`
 	LogDir      string            `yaml:"log_dir"`
 	StateDir    string            `yaml:"state_dir"`
-	Discord     *DiscordConfig    `yaml:"discord"`
-	Mattermost  *MattermostConfig `yaml:"mattermost"`
-	Matrix      *MatrixConfig     `yaml:"matrix"`
-	Webhook     *WebhookConfig    `yaml:"webhook"`
-	Dashboard   *DashboardConfig  `yaml:"dashboard"`
+	Discord     *DiscordConfig    `yaml:"discord,omitempty"`
+	Mattermost  *MattermostConfig `yaml:"mattermost,omitempty"`
+	Matrix      *MatrixConfig     `yaml:"matrix,omitempty"`
+	Webhook     *WebhookConfig    `yaml:"webhook,omitempty"`
+	Dashboard   *DashboardConfig  `yaml:"dashboard,omitempty"`
+	Deploy      *DeployConfig     `yaml:"deploy,omitempty"`
+	Secrets     []SecretSource    `yaml:"secrets,omitempty"`
+
+	// Profile is the overlay applied by LoadConfig (e.g. "prod"), or "" for
+	// none. Services are loaded with the same profile.
+	Profile string `yaml:"-"`
+}
+
+// MaxConcurrentDeploys returns the deploy.max_concurrent limit, 0 for none.
+func (c *Config) MaxConcurrentDeploys() int {
+	if c.Deploy == nil {
+		return 0
+	}
+	return c.Deploy.MaxConcurrent
+}
+
+// DashboardURL returns the dashboard's public base URL without a trailing
+// slash, or "" if none is configured.
+func (c *Config) DashboardURL() string {
+	if c.Dashboard == nil {
+		return ""
+	}
+	return strings.TrimRight(c.Dashboard.PublicURL, "/")
 }
 
 // ServiceProcessConfig describes how to manage a service's process.
 type ServiceProcessConfig struct {
-	Cmd string `yaml:"cmd"`
+	Cmd string `yaml:"cmd,omitempty"`
 }
 
 // ServiceConfig describes a single deployable service.
 type ServiceConfig struct {
 	Name                string               `yaml:"-"`
-	Branch              string               `yaml:"branch"`
-	Repo                string               `yaml:"repo"`
-	Dir                 string               `yaml:"dir"`
-	Entrypoint          []string             `yaml:"entrypoint"`
-	Process             ServiceProcessConfig `yaml:"process"`
-	Deploy              []string             `yaml:"deploy"`
-	ServiceName         string               `yaml:"service_name"`
-	UserService         bool                 `yaml:"user_service"`
-	Sudo                bool                 `yaml:"sudo"`
-	RequireConfirmation bool                 `yaml:"require_confirmation"`
-	SelfDeploy          bool                 `yaml:"self_deploy"`
-	Adopt               *bool                `yaml:"adopt"`
+	Branch              string               `yaml:"branch,omitempty"`
+	Repo                string               `yaml:"repo,omitempty"`
+	Dir                 string               `yaml:"dir,omitempty"`
+	Entrypoint          []string             `yaml:"entrypoint,omitempty"`
+	Process             ServiceProcessConfig `yaml:"process,omitempty"`
+	Deploy              []DeployStep         `yaml:"deploy,omitempty"`
+	ServiceName         string               `yaml:"service_name,omitempty"`
+	UserService         bool                 `yaml:"user_service,omitempty"`
+	Sudo                bool                 `yaml:"sudo,omitempty"`
+	RequireConfirmation bool                 `yaml:"require_confirmation,omitempty"`
+	SelfDeploy          bool                 `yaml:"self_deploy,omitempty"`
+	Adopt               *bool                `yaml:"adopt,omitempty"`
+	Extends             string               `yaml:"extends,omitempty"`
+
+	// DeployKey is the path to the SSH private key file for git to use with
+	// repo, such as a GitHub deploy key. If dir doesn't exist, the first
+	// deploy clones repo into it, over SSH when there is a deploy key.
+	DeployKey string `yaml:"deploy_key,omitempty"`
+
+	// DeployWindows limits when pushes deploy automatically; pushes outside
+	// every window are held until the next one opens. Empty means any time.
+	DeployWindows []DeployWindow `yaml:"deploy_windows,omitempty"`
+
+	// Approvals requires pushes to be approved in chat before they deploy,
+	// like require_confirmation but with rules on who and how many.
+	Approvals *ApprovalsConfig `yaml:"approvals,omitempty"`
+
+	// PauseAfterFailures pauses automatic deploys of pushes after this many
+	// deploys in a row have failed, until a deploy succeeds or someone
+	// resumes them. Zero never pauses.
+	PauseAfterFailures int `yaml:"pause_after_failures,omitempty"`
+
+	// Verify checks the service after each deploy restarts it, rolling the
+	// deploy back if it fails. Nil means a successful restart is enough.
+	Verify *VerifyConfig `yaml:"verify,omitempty"`
+
+	// Releases builds each deploy in its own directory under dir and runs
+	// the service from dir/current. Nil deploys in dir in place.
+	Releases *ReleasesConfig `yaml:"releases,omitempty"`
+
+	// Env sets extra environment variables for the process and deploy steps.
+	// SecretEnv does the same with values looked up by secret name, resolved
+	// afresh each time the process starts or a deploy runs.
+	Env       map[string]string `yaml:"env,omitempty"`
+	SecretEnv map[string]string `yaml:"secret_env,omitempty"`
+
+	// Profiles holds per-profile overrides, merged over the rest of the
+	// config when that profile is active. LoadServices applies and clears it.
+	Profiles map[string]ServiceConfig `yaml:"profiles,omitempty"`
+
+	// Sources lists the files merged to produce this config, base first:
+	// _defaults.yaml, any templates named by extends, then the service file.
+	Sources []string `yaml:"-"`
 }
 
 // ShouldAdopt returns whether this service should be adopted on startup.
@@ -96,11 +173,22 @@ type Env struct {
 	MatrixPickleKey   string
 }
 
-// LoadConfig reads a YAML config file and applies defaults.
-func LoadConfig(path string) (*Config, error) {
-	data, err := os.ReadFile(path)
+// LoadConfig reads a YAML config file and applies defaults. If profile is
+// non-empty, the overlay file at ProfilePath(path, profile) must exist and is
+// deep-merged over the base file: mappings merge key by key, and any other
+// value in the overlay replaces the base one.
+func LoadConfig(path, profile string) (*Config, error) {
+	node, err := readConfigNode(path, "config")
 	if err != nil {
-		return nil, fmt.Errorf("reading config: %w", err)
+		return nil, err
+	}
+
+	if profile != "" {
+		overlay, err := readConfigNode(ProfilePath(path, profile), "profile overlay")
+		if err != nil {
+			return nil, err
+		}
+		node = mergeNodes(node, overlay)
 	}
 
 	cfg := &Config{
@@ -108,58 +196,91 @@ func LoadConfig(path string) (*Config, error) {
 		LogDir:      "./logs",
 		StateDir:    "./state",
 	}
-
-	if err := yaml.Unmarshal(data, cfg); err != nil {
+	if err := node.Decode(cfg); err != nil {
 		return nil, fmt.Errorf("parsing config: %w", err)
 	}
+	cfg.Profile = profile
 
 	return cfg, nil
 }
 
+// ProfilePath returns the overlay file for profile next to the config file
+// at path: "config.yaml" with profile "prod" gives "config.prod.yaml".
+func ProfilePath(path, profile string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "." + profile + ext
+}
+
+// readConfigNode reads a config file, strictly checks it against Config, and
+// returns its root node. what names the file in error messages.
+func readConfigNode(path, what string) (*yaml.Node, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", what, err)
+	}
+	if err := decodeStrict(data, &Config{}); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", what, err)
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", what, err)
+	}
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 {
+		return &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}, nil
+	}
+	return doc.Content[0], nil
+}
+
 // LoadEnv reads secrets from a .env file. If path is empty or the file does
-// not exist, it falls back to os.Getenv for each variable.
+// not exist, it falls back to os.Getenv for each variable. Use SecretStore to
+// also consult the sources configured under secrets:.
 func LoadEnv(path string) (*Env, error) {
-	if path != "" {
-		vars, err := godotenv.Read(path)
-		if err == nil {
-			return &Env{
-				DiscordToken:      vars["DISCORD_TOKEN"],
-				MattermostToken:   vars["MATTERMOST_TOKEN"],
-				WebhookSecret:     vars["GITHUB_WEBHOOK_SECRET"],
-				MatrixUserID:      vars["MATRIX_USER_ID"],
-				MatrixDeviceID:    vars["MATRIX_DEVICE_ID"],
-				MatrixAccessToken: vars["MATRIX_ACCESS_TOKEN"],
-				MatrixPickleKey:   vars["MATRIX_PICKLE_KEY"],
-			}, nil
-		}
-		// Only fall through to os.Getenv if the file simply doesn't exist.
-		// Other errors (permission denied, malformed content) are real problems.
-		if !errors.Is(err, os.ErrNotExist) {
-			return nil, fmt.Errorf("reading env file: %w", err)
+	p, err := newEnvProvider(path)
+	if err != nil {
+		return nil, err
+	}
+	return resolveEnv(p)
+}
+
+// LoadServices scans a directory for .yaml/.yml files and returns the
+// effective ServiceConfig for each. Files starting with "_" are shared
+// fragments rather than services: _defaults.yaml is merged under every
+// service, and "extends: name" merges the service over _name.yaml; either
+// may use the .yml extension instead, but not both. If profile
+// is non-empty, the merged "profiles: {<profile>: ...}" section is then
+// merged on top. ${...} references are expanded last (see expandService).
+// The Name field is set from the filename. Unknown keys are rejected so that
+// typos surface as errors instead of silently falling back to defaults.
+func LoadServices(dir, profile string) ([]ServiceConfig, error) {
+	loaded, problems, err := loadServiceDir(dir, profile)
+	if err != nil {
+		return nil, err
+	}
+	if len(problems) > 0 {
+		p := problems[0]
+		msg := p.Message
+		if p.Line > 0 {
+			msg = fmt.Sprintf("line %d: %s", p.Line, msg)
 		}
+		return nil, fmt.Errorf("parsing service file %s: %s", filepath.Base(p.File), msg)
 	}
 
-	return &Env{
-		DiscordToken:      os.Getenv("DISCORD_TOKEN"),
-		MattermostToken:   os.Getenv("MATTERMOST_TOKEN"),
-		WebhookSecret:     os.Getenv("GITHUB_WEBHOOK_SECRET"),
-		MatrixUserID:      os.Getenv("MATRIX_USER_ID"),
-		MatrixDeviceID:    os.Getenv("MATRIX_DEVICE_ID"),
-		MatrixAccessToken: os.Getenv("MATRIX_ACCESS_TOKEN"),
-		MatrixPickleKey:   os.Getenv("MATRIX_PICKLE_KEY"),
-	}, nil
+	services := make([]ServiceConfig, 0, len(loaded))
+	for _, ls := range loaded {
+		services = append(services, ls.svc)
+	}
+	return services, nil
 }
 
-// LoadServices scans a directory for .yaml/.yml files and parses each as a
-// ServiceConfig. The Name field is set from the filename when not provided
-// in the YAML itself.
-func LoadServices(dir string) ([]ServiceConfig, error) {
+// serviceFiles returns the paths of the .yaml/.yml files in dir, in directory
+// (alphabetical) order.
+func serviceFiles(dir string) ([]string, error) {
 	entries, err := os.ReadDir(dir)
 	if err != nil {
 		return nil, fmt.Errorf("reading services dir: %w", err)
 	}
 
-	var services []ServiceConfig
+	var files []string
 	for _, entry := range entries {
 		if entry.IsDir() {
 			continue
@@ -168,23 +289,24 @@ func LoadServices(dir string) ([]ServiceConfig, error) {
 		if ext != ".yaml" && ext != ".yml" {
 			continue
 		}
+		files = append(files, filepath.Join(dir, entry.Name()))
+	}
+	return files, nil
+}
 
-		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
-		if err != nil {
-			return nil, fmt.Errorf("reading service file %s: %w", entry.Name(), err)
-		}
-
-		var svc ServiceConfig
-		if err := yaml.Unmarshal(data, &svc); err != nil {
-			return nil, fmt.Errorf("parsing service file %s: %w", entry.Name(), err)
-		}
-
-		if svc.Name == "" {
-			svc.Name = strings.TrimSuffix(entry.Name(), ext)
-		}
+// serviceNameFromFile derives a service name from its config file name.
+func serviceNameFromFile(path string) string {
+	base := filepath.Base(path)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
 
-		services = append(services, svc)
+// decodeStrict unmarshals YAML into v, rejecting keys that do not map to a
+// field. An empty document leaves v untouched.
+func decodeStrict(data []byte, v any) error {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(v); err != nil && !errors.Is(err, io.EOF) {
+		return err
 	}
-
-	return services, nil
+	return nil
 }
@@ -30,11 +30,13 @@ webhook:
   port: 9090
 dashboard:
   port: 9091
+deploy:
+  max_concurrent: 2
 `
 	path := filepath.Join(t.TempDir(), "config.yaml")
 	require.NoError(t, os.WriteFile(path, []byte(yaml), 0o644))
 
-	cfg, err := config.LoadConfig(path)
+	cfg, err := config.LoadConfig(path, "")
 	require.NoError(t, err)
 
 	assert.Equal(t, "/opt/services", cfg.ServicesDir)
@@ -59,6 +61,8 @@ dashboard:
 
 	require.NotNil(t, cfg.Dashboard)
 	assert.Equal(t, 9091, cfg.Dashboard.Port)
+
+	assert.Equal(t, 2, cfg.MaxConcurrentDeploys())
 }
 
 func TestLoadConfig_OnlyDiscord(t *testing.T) {
@@ -70,7 +74,7 @@ discord:
 	path := filepath.Join(t.TempDir(), "config.yaml")
 	require.NoError(t, os.WriteFile(path, []byte(yaml), 0o644))
 
-	cfg, err := config.LoadConfig(path)
+	cfg, err := config.LoadConfig(path, "")
 	require.NoError(t, err)
 
 	require.NotNil(t, cfg.Discord)
@@ -86,12 +90,13 @@ func TestLoadConfig_Defaults(t *testing.T) {
 	path := filepath.Join(t.TempDir(), "config.yaml")
 	require.NoError(t, os.WriteFile(path, []byte(yaml), 0o644))
 
-	cfg, err := config.LoadConfig(path)
+	cfg, err := config.LoadConfig(path, "")
 	require.NoError(t, err)
 
 	assert.Equal(t, "./services", cfg.ServicesDir)
 	assert.Equal(t, "./logs", cfg.LogDir)
 	assert.Equal(t, "./state", cfg.StateDir)
+	assert.Equal(t, 0, cfg.MaxConcurrentDeploys())
 }
 
 func TestLoadEnv_FromFile(t *testing.T) {
@@ -162,7 +167,7 @@ func TestLoadEnv_ErrorOnUnreadableFile(t *testing.T) {
 }
 
 func TestLoadConfig_FileNotFound(t *testing.T) {
-	_, err := config.LoadConfig(filepath.Join(t.TempDir(), "missing.yaml"))
+	_, err := config.LoadConfig(filepath.Join(t.TempDir(), "missing.yaml"), "")
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "reading config")
 }
@@ -171,20 +176,20 @@ func TestLoadConfig_InvalidYAML(t *testing.T) {
 	path := filepath.Join(t.TempDir(), "bad.yaml")
 	require.NoError(t, os.WriteFile(path, []byte("{{invalid"), 0o644))
 
-	_, err := config.LoadConfig(path)
+	_, err := config.LoadConfig(path, "")
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "parsing config")
 }
 
 func TestLoadServices_EmptyDirectory(t *testing.T) {
 	dir := t.TempDir()
-	services, err := config.LoadServices(dir)
+	services, err := config.LoadServices(dir, "")
 	require.NoError(t, err)
 	assert.Empty(t, services)
 }
 
 func TestLoadServices_NonexistentDirectory(t *testing.T) {
-	_, err := config.LoadServices(filepath.Join(t.TempDir(), "nope"))
+	_, err := config.LoadServices(filepath.Join(t.TempDir(), "nope"), "")
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "reading services dir")
 }
@@ -193,7 +198,7 @@ func TestLoadServices_InvalidYAMLFile(t *testing.T) {
 	dir := t.TempDir()
 	require.NoError(t, os.WriteFile(filepath.Join(dir, "bad.yaml"), []byte("{{invalid"), 0o644))
 
-	_, err := config.LoadServices(dir)
+	_, err := config.LoadServices(dir, "")
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "parsing service file")
 }
@@ -218,7 +223,7 @@ dir: /opt/baz
 	require.NoError(t, os.WriteFile(filepath.Join(dir, "bar.yaml"), []byte(svc1), 0o644))
 	require.NoError(t, os.WriteFile(filepath.Join(dir, "baz.yml"), []byte(svc2), 0o644))
 
-	services, err := config.LoadServices(dir)
+	services, err := config.LoadServices(dir, "")
 	require.NoError(t, err)
 	require.Len(t, services, 2)
 
@@ -226,7 +231,7 @@ dir: /opt/baz
 	assert.Equal(t, "bar", services[0].Name)
 	assert.Equal(t, "main", services[0].Branch)
 	assert.Equal(t, []string{"go", "run", "."}, services[0].Entrypoint)
-	assert.Equal(t, []string{"git pull", "go build"}, services[0].Deploy)
+	assert.Equal(t, config.Steps("git pull", "go build"), services[0].Deploy)
 
 	assert.Equal(t, "baz", services[1].Name)
 	assert.Equal(t, "develop", services[1].Branch)
@@ -241,7 +246,7 @@ repo: https://github.com/foo/bar
 `
 	require.NoError(t, os.WriteFile(filepath.Join(dir, "myservice.yaml"), []byte(yaml), 0o644))
 
-	services, err := config.LoadServices(dir)
+	services, err := config.LoadServices(dir, "")
 	require.NoError(t, err)
 	require.Len(t, services, 1)
 	assert.Equal(t, "myservice", services[0].Name)
@@ -256,7 +261,7 @@ func TestLoadServices_IgnoresNonYAMLAndDirectories(t *testing.T) {
 	require.NoError(t, os.WriteFile(filepath.Join(dir, "notes.md"), []byte("# notes"), 0o644))
 	require.NoError(t, os.Mkdir(filepath.Join(dir, "subdir"), 0o755))
 
-	services, err := config.LoadServices(dir)
+	services, err := config.LoadServices(dir, "")
 	require.NoError(t, err)
 	require.Len(t, services, 1)
 	assert.Equal(t, "good", services[0].Name)
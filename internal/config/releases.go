@@ -0,0 +1,35 @@
+package config
+
+import "path/filepath"
+
+// In release mode these are relative to a service's dir: each deploy builds
+// in ReleasesDir/<timestamp-sha>, and CurrentLink points at the live one.
+const (
+	ReleasesDir = "releases"
+	CurrentLink = "current"
+)
+
+// ReleasesConfig switches a service to release mode. Deploys build in a
+// fresh git worktree instead of updating dir in place, and only a build that
+// succeeds goes live, by swapping the current symlink to it.
+type ReleasesConfig struct {
+	// Keep is how many releases to keep, including the live one. Default 5.
+	Keep int `yaml:"keep,omitempty"`
+}
+
+// KeepReleases returns how many releases to keep.
+func (r *ReleasesConfig) KeepReleases() int {
+	if r.Keep > 0 {
+		return r.Keep
+	}
+	return 5
+}
+
+// WorkDir returns the directory the service runs in: dir/current in release
+// mode, otherwise dir itself.
+func (s *ServiceConfig) WorkDir() string {
+	if s.Releases != nil {
+		return filepath.Join(s.Dir, CurrentLink)
+	}
+	return s.Dir
+}
@@ -0,0 +1,43 @@
+package config_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/shishberg/mezzaops/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadServices_Releases(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"api.yaml": "dir: /opt/api\nreleases:\n  keep: 3\n",
+		"web.yaml": "dir: /opt/web\nreleases: {}\n",
+	})
+
+	services, err := config.LoadServices(dir, "")
+	require.NoError(t, err)
+	require.Len(t, services, 2)
+	assert.Equal(t, 3, services[0].Releases.KeepReleases())
+	assert.Equal(t, "/opt/api/current", services[0].WorkDir())
+	assert.Equal(t, 5, services[1].Releases.KeepReleases())
+
+	plain := config.ServiceConfig{Dir: "/opt/x"}
+	assert.Equal(t, "/opt/x", plain.WorkDir())
+}
+
+func TestValidateServices_Releases(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"a.yaml": "releases:\n  keep: -1\n",
+		"b.yaml": "dir: " + dir + "\nentrypoint: [./server]\nreleases: {}\n",
+	})
+
+	path := filepath.Join(dir, "a.yaml")
+	problems := problemStrings(t, config.ValidateServices(dir, ""))
+	assert.Equal(t, []string{
+		path + ":1: releases needs dir, the git checkout releases are built from",
+		path + ":2: releases.keep must not be negative",
+	}, problems)
+}
@@ -0,0 +1,292 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// SecretSource configures one place secrets are read from. Sources are tried
+// in the order listed; .env and the process environment are always tried
+// last.
+type SecretSource struct {
+	// Type is "dir", "sops", "age" or "exec".
+	Type string `yaml:"type"`
+	// Path is the directory for "dir" (default $CREDENTIALS_DIRECTORY, as set
+	// by systemd's LoadCredential=) or the encrypted file for "sops" and
+	// "age".
+	Path string `yaml:"path,omitempty"`
+	// Identity is the age identity file used to decrypt Path.
+	Identity string `yaml:"identity,omitempty"`
+	// Command is the helper for "exec". The secret name is appended as the
+	// last argument and the helper prints the value on stdout.
+	Command []string `yaml:"command,omitempty"`
+}
+
+// secretCommandTimeout bounds each decrypt or exec helper invocation.
+const secretCommandTimeout = 30 * time.Second
+
+// SecretProvider looks up secrets by name. ok is false when the provider does
+// not have the secret.
+type SecretProvider interface {
+	Lookup(name string) (value string, ok bool, err error)
+}
+
+// SecretStore resolves secrets from the configured sources, falling back to
+// .env and the process environment. Encrypted files and .env are read when
+// the store is created and again on Reload; directories and exec helpers are
+// consulted on every lookup.
+type SecretStore struct {
+	envPath string
+
+	mu        sync.RWMutex
+	sources   []SecretSource
+	providers []SecretProvider
+}
+
+// NewSecretStore creates a SecretStore for sources plus the .env file at
+// envPath (see LoadEnv).
+func NewSecretStore(sources []SecretSource, envPath string) (*SecretStore, error) {
+	s := &SecretStore{envPath: envPath}
+	if err := s.SetSources(sources); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Reload re-reads encrypted files and .env so rotated secrets are picked up.
+// On error the previous providers are kept.
+func (s *SecretStore) Reload() error {
+	s.mu.RLock()
+	sources := s.sources
+	s.mu.RUnlock()
+	return s.SetSources(sources)
+}
+
+// SetSources replaces the configured sources and reads them as Reload does.
+// On error the previous sources and providers are kept.
+func (s *SecretStore) SetSources(sources []SecretSource) error {
+	var providers []SecretProvider
+	for i, src := range sources {
+		p, err := newSecretProvider(src)
+		if err != nil {
+			return fmt.Errorf("secrets[%d] (%s): %w", i, src.Type, err)
+		}
+		providers = append(providers, p)
+	}
+	envProvider, err := newEnvProvider(s.envPath)
+	if err != nil {
+		return err
+	}
+	providers = append(providers, envProvider)
+
+	s.mu.Lock()
+	s.sources = sources
+	s.providers = providers
+	s.mu.Unlock()
+	return nil
+}
+
+// Lookup returns the value of the named secret from the first source that
+// has it.
+func (s *SecretStore) Lookup(name string) (string, bool, error) {
+	s.mu.RLock()
+	providers := s.providers
+	s.mu.RUnlock()
+
+	for _, p := range providers {
+		v, ok, err := p.Lookup(name)
+		if err != nil {
+			return "", false, fmt.Errorf("secret %s: %w", name, err)
+		}
+		if ok {
+			return v, true, nil
+		}
+	}
+	return "", false, nil
+}
+
+// Env resolves the frontend tokens and webhook secret.
+func (s *SecretStore) Env() (*Env, error) {
+	return resolveEnv(s)
+}
+
+// resolveEnv looks up each Env field by its environment variable name.
+func resolveEnv(p SecretProvider) (*Env, error) {
+	env := &Env{}
+	for _, f := range []struct {
+		name string
+		dst  *string
+	}{
+		{"DISCORD_TOKEN", &env.DiscordToken},
+		{"MATTERMOST_TOKEN", &env.MattermostToken},
+		{"GITHUB_WEBHOOK_SECRET", &env.WebhookSecret},
+		{"MATRIX_USER_ID", &env.MatrixUserID},
+		{"MATRIX_DEVICE_ID", &env.MatrixDeviceID},
+		{"MATRIX_ACCESS_TOKEN", &env.MatrixAccessToken},
+		{"MATRIX_PICKLE_KEY", &env.MatrixPickleKey},
+	} {
+		v, _, err := p.Lookup(f.name)
+		if err != nil {
+			return nil, err
+		}
+		*f.dst = v
+	}
+	return env, nil
+}
+
+// newSecretProvider builds the provider for one configured source.
+func newSecretProvider(src SecretSource) (SecretProvider, error) {
+	switch src.Type {
+	case "dir":
+		dir := src.Path
+		if dir == "" {
+			dir = os.Getenv("CREDENTIALS_DIRECTORY")
+		}
+		if dir == "" {
+			return nil, errors.New("no path set and $CREDENTIALS_DIRECTORY is empty")
+		}
+		return dirProvider{dir: dir}, nil
+	case "sops":
+		if src.Path == "" {
+			return nil, errors.New("path is required")
+		}
+		return decryptFile(src.Path, "sops", "--decrypt", src.Path)
+	case "age":
+		if src.Path == "" || src.Identity == "" {
+			return nil, errors.New("path and identity are required")
+		}
+		return decryptFile(src.Path, "age", "--decrypt", "-i", src.Identity, src.Path)
+	case "exec":
+		if len(src.Command) == 0 {
+			return nil, errors.New("command is required")
+		}
+		return execProvider{argv: src.Command}, nil
+	default:
+		return nil, fmt.Errorf("unknown type %q (want dir, sops, age or exec)", src.Type)
+	}
+}
+
+// mapProvider serves secrets from a fixed set of values.
+type mapProvider map[string]string
+
+func (p mapProvider) Lookup(name string) (string, bool, error) {
+	v, ok := p[name]
+	return v, ok, nil
+}
+
+// envProvider serves secrets from a .env file or, if there is none, the
+// process environment.
+type envProvider struct {
+	vars map[string]string // nil: use the process environment
+}
+
+// newEnvProvider reads the .env file at path. If path is empty or the file
+// does not exist, lookups fall back to the process environment.
+func newEnvProvider(path string) (envProvider, error) {
+	if path == "" {
+		return envProvider{}, nil
+	}
+	vars, err := godotenv.Read(path)
+	if err != nil {
+		// Only fall through to os.Getenv if the file simply doesn't exist.
+		// Other errors (permission denied, malformed content) are real problems.
+		if !errors.Is(err, os.ErrNotExist) {
+			return envProvider{}, fmt.Errorf("reading env file: %w", err)
+		}
+		return envProvider{}, nil
+	}
+	return envProvider{vars: vars}, nil
+}
+
+func (p envProvider) Lookup(name string) (string, bool, error) {
+	if p.vars != nil {
+		v, ok := p.vars[name]
+		return v, ok, nil
+	}
+	v, ok := os.LookupEnv(name)
+	return v, ok, nil
+}
+
+// dirProvider serves each secret from a file of the same name (or its
+// lowercase form) in a directory, as systemd credentials are laid out.
+type dirProvider struct {
+	dir string
+}
+
+func (p dirProvider) Lookup(name string) (string, bool, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) {
+		return "", false, nil
+	}
+	for _, n := range []string{name, strings.ToLower(name)} {
+		data, err := os.ReadFile(filepath.Join(p.dir, n))
+		if err == nil {
+			return strings.TrimRight(string(data), "\r\n"), true, nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return "", false, err
+		}
+	}
+	return "", false, nil
+}
+
+// execProvider runs a helper with the secret name appended. A helper that
+// exits non-zero or prints nothing does not have the secret.
+type execProvider struct {
+	argv []string
+}
+
+func (p execProvider) Lookup(name string) (string, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), secretCommandTimeout)
+	defer cancel()
+
+	args := append(append([]string{}, p.argv[1:]...), name)
+	out, err := exec.CommandContext(ctx, p.argv[0], args...).Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && ctx.Err() == nil {
+			return "", false, nil
+		}
+		return "", false, fmt.Errorf("running %s: %w", p.argv[0], err)
+	}
+	v := strings.TrimRight(string(out), "\r\n")
+	return v, v != "", nil
+}
+
+// decryptFile runs a decryption tool and parses its output as a flat YAML or
+// JSON mapping, or as dotenv lines.
+func decryptFile(path, tool string, args ...string) (mapProvider, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), secretCommandTimeout)
+	defer cancel()
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, tool, args...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("decrypting %s: %w: %s", path, err, msg)
+		}
+		return nil, fmt.Errorf("decrypting %s: %w", path, err)
+	}
+
+	var vars map[string]string
+	if err := yaml.Unmarshal(out, &vars); err == nil && len(vars) > 0 {
+		return vars, nil
+	}
+	vars, err = godotenv.Unmarshal(string(out))
+	if err != nil {
+		return nil, fmt.Errorf("parsing decrypted %s: %w", path, err)
+	}
+	return vars, nil
+}
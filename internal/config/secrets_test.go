@@ -0,0 +1,117 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/shishberg/mezzaops/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSecretStore_SourceOrder(t *testing.T) {
+	credDir := t.TempDir()
+	writeFiles(t, credDir, map[string]string{
+		"DISCORD_TOKEN": "from-dir\n",
+		"db_password":   "hunter2",
+	})
+	envPath := filepath.Join(t.TempDir(), ".env")
+	require.NoError(t, os.WriteFile(envPath, []byte("DISCORD_TOKEN=from-env\nMATTERMOST_TOKEN=mm-from-env\n"), 0o600))
+
+	store, err := config.NewSecretStore([]config.SecretSource{
+		{Type: "dir", Path: credDir},
+		{Type: "exec", Command: []string{"sh", "-c", `[ "$1" = API_KEY ] && echo key-from-helper`, "helper"}},
+	}, envPath)
+	require.NoError(t, err)
+
+	env, err := store.Env()
+	require.NoError(t, err)
+	assert.Equal(t, "from-dir", env.DiscordToken, "earlier sources win")
+	assert.Equal(t, "mm-from-env", env.MattermostToken, ".env is the fallback")
+	assert.Empty(t, env.WebhookSecret)
+
+	v, ok, err := store.Lookup("DB_PASSWORD")
+	require.NoError(t, err)
+	assert.True(t, ok, "dir falls back to the lowercase file name")
+	assert.Equal(t, "hunter2", v)
+
+	v, ok, err = store.Lookup("API_KEY")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "key-from-helper", v)
+
+	_, ok, err = store.Lookup("NOPE")
+	require.NoError(t, err)
+	assert.False(t, ok, "a helper exiting non-zero does not have the secret")
+}
+
+func TestSecretStore_CredentialsDirectoryDefault(t *testing.T) {
+	credDir := t.TempDir()
+	writeFiles(t, credDir, map[string]string{"GITHUB_WEBHOOK_SECRET": "s3cret"})
+	t.Setenv("CREDENTIALS_DIRECTORY", credDir)
+
+	store, err := config.NewSecretStore([]config.SecretSource{{Type: "dir"}}, "")
+	require.NoError(t, err)
+	env, err := store.Env()
+	require.NoError(t, err)
+	assert.Equal(t, "s3cret", env.WebhookSecret)
+}
+
+func TestSecretStore_SopsFileReloaded(t *testing.T) {
+	// A fake sops that "decrypts" by printing the file.
+	bin := t.TempDir()
+	writeFiles(t, bin, map[string]string{"sops": "#!/bin/sh\n[ \"$1\" = --decrypt ] && exec cat \"$2\"\n"})
+	require.NoError(t, os.Chmod(filepath.Join(bin, "sops"), 0o755))
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "secrets.enc.yaml")
+	writeFiles(t, dir, map[string]string{"secrets.enc.yaml": "MATTERMOST_TOKEN: one\n"})
+
+	store, err := config.NewSecretStore([]config.SecretSource{{Type: "sops", Path: path}}, "")
+	require.NoError(t, err)
+	env, err := store.Env()
+	require.NoError(t, err)
+	assert.Equal(t, "one", env.MattermostToken)
+
+	// Rotated values are only seen after Reload.
+	writeFiles(t, dir, map[string]string{"secrets.enc.yaml": "MATTERMOST_TOKEN=two\n"})
+	env, err = store.Env()
+	require.NoError(t, err)
+	assert.Equal(t, "one", env.MattermostToken)
+
+	require.NoError(t, store.Reload())
+	env, err = store.Env()
+	require.NoError(t, err)
+	assert.Equal(t, "two", env.MattermostToken)
+}
+
+func TestNewSecretStore_BadSource(t *testing.T) {
+	_, err := config.NewSecretStore([]config.SecretSource{{Type: "vault"}}, "")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `secrets[0] (vault): unknown type "vault"`)
+}
+
+func TestValidate_SecretSources(t *testing.T) {
+	dir := t.TempDir()
+	svcDir := filepath.Join(dir, "services")
+	require.NoError(t, os.MkdirAll(svcDir, 0o755))
+	t.Setenv("CREDENTIALS_DIRECTORY", "")
+
+	path := filepath.Join(dir, "config.yaml")
+	writeFiles(t, dir, map[string]string{"config.yaml": "services_dir: " + svcDir + `
+secrets:
+  - type: dir
+  - type: age
+    path: ` + filepath.Join(dir, "secrets.age") + `
+  - type: exec
+`})
+
+	problems := problemStrings(t, config.Validate(path, "", nil))
+	assert.Equal(t, []string{
+		path + ":3: secrets[0]: dir has no path and $CREDENTIALS_DIRECTORY is not set",
+		path + ":4: secrets[1]: age requires identity",
+		path + ":6: secrets[2]: exec requires command",
+	}, problems)
+}
@@ -0,0 +1,348 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// defaultsPartial names the optional fragment in the services directory
+// (_defaults.yaml or _defaults.yml) whose settings are merged under every
+// service.
+const defaultsPartial = "defaults"
+
+// Files in the services directory whose names start with partialPrefix are
+// shared fragments (defaults and templates), not services. A template named
+// "go-service" lives in "_go-service.yaml" (or ".yml") and is used with
+// "extends: go-service".
+const partialPrefix = "_"
+
+// loadedService is a resolved service together with the node tree of its own
+// file, which validation uses to locate problems.
+type loadedService struct {
+	path string
+	root *yaml.Node
+	svc  ServiceConfig
+}
+
+// serviceLoader resolves the service files in one directory, caching the
+// shared fragments so each is parsed (and its problems reported) only once.
+type serviceLoader struct {
+	dir      string
+	partials map[string]*yaml.Node // by path; nil entry = failed to parse
+	problems []Problem
+}
+
+// loadServiceDir resolves every service in dir: its file is merged over any
+// templates it extends, which are merged over _defaults.yaml (or .yml); the section for
+// profile is merged on top of that, and ${...} references are then expanded.
+// Problems are collected rather than returned on the first one, so validation
+// can report them all. The error is only non-nil when the directory itself
+// cannot be read.
+func loadServiceDir(dir, profile string) ([]loadedService, []Problem, error) {
+	files, err := serviceFiles(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	l := &serviceLoader{dir: dir, partials: make(map[string]*yaml.Node)}
+
+	var base *yaml.Node
+	var baseSources []string
+	if defaultsPath, ok := l.findPartial(defaultsPartial); ok {
+		if root := l.partial(defaultsPath); root != nil {
+			base, baseSources = l.resolve(defaultsPath, root, nil)
+		}
+	}
+
+	var services []loadedService
+	for _, path := range files {
+		if strings.HasPrefix(filepath.Base(path), partialPrefix) {
+			continue
+		}
+		root := l.parse(path)
+		if root == nil {
+			continue
+		}
+
+		merged, sources := l.resolve(path, root, nil)
+		if base != nil {
+			merged = mergeNodes(base, merged)
+			sources = append(append([]string{}, baseSources...), sources...)
+		}
+		merged = applyProfile(merged, profile)
+
+		var svc ServiceConfig
+		if err := merged.Decode(&svc); err != nil {
+			l.problems = append(l.problems, yamlProblems(path, err)...)
+			continue
+		}
+		svc.Name = serviceNameFromFile(path)
+		svc.Sources = sources
+		for _, ref := range expandService(&svc) {
+			l.problems = append(l.problems, Problem{
+				File:    path,
+				Message: fmt.Sprintf("unknown variable ${%s}", ref),
+			})
+		}
+
+		services = append(services, loadedService{path: path, root: root, svc: svc})
+	}
+
+	// A broken template is reached once per service using it; report it once.
+	var problems []Problem
+	for _, p := range l.problems {
+		if !slices.Contains(problems, p) {
+			problems = append(problems, p)
+		}
+	}
+	return services, problems, nil
+}
+
+// parse reads path, strictly decodes it to report unknown keys, and returns
+// its root mapping node. It returns nil (after recording problems) if the
+// file cannot be used.
+func (l *serviceLoader) parse(path string) *yaml.Node {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		l.problems = append(l.problems, Problem{File: path, Message: err.Error()})
+		return nil
+	}
+	var probe ServiceConfig
+	root, problems := decodeForValidation(path, data, &probe)
+	l.problems = append(l.problems, problems...)
+	if root == nil || len(problems) > 0 {
+		return nil
+	}
+	if root.Kind == yaml.DocumentNode || root.Kind == 0 {
+		// Empty file: treat as an empty mapping.
+		return &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	}
+	return root
+}
+
+// findPartial returns the path of the fragment called name, which may use
+// either extension. If neither file exists it returns the .yaml path and
+// false; if both do, it records a problem and returns false.
+func (l *serviceLoader) findPartial(name string) (string, bool) {
+	var found []string
+	for _, ext := range []string{".yaml", ".yml"} {
+		path := filepath.Join(l.dir, partialPrefix+name+ext)
+		if _, err := os.Stat(path); err == nil {
+			found = append(found, path)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return filepath.Join(l.dir, partialPrefix+name+".yaml"), false
+	case 1:
+		return found[0], true
+	}
+	l.problems = append(l.problems, Problem{
+		File:    found[0],
+		Message: fmt.Sprintf("%s also exists; keep only one of them", filepath.Base(found[1])),
+	})
+	return "", false
+}
+
+// partial is parse with caching, for defaults and templates.
+func (l *serviceLoader) partial(path string) *yaml.Node {
+	if root, ok := l.partials[path]; ok {
+		return root
+	}
+	root := l.parse(path)
+	l.partials[path] = root
+	return root
+}
+
+// resolve merges root over the templates it extends, recursively. It
+// returns the merged node and the files that contributed to it, base first.
+// chain holds the files already being resolved, to detect cycles.
+func (l *serviceLoader) resolve(path string, root *yaml.Node, chain []string) (*yaml.Node, []string) {
+	chain = append(chain, path)
+	name := scalarValue(root, "extends")
+	if name == "" {
+		return root, []string{path}
+	}
+
+	tmplPath, ok := l.findPartial(name)
+	if !ok {
+		if tmplPath != "" {
+			l.problems = append(l.problems, Problem{
+				File:    path,
+				Line:    keyLine(root, "extends"),
+				Message: fmt.Sprintf("template %q not found (expected %s or .yml)", name, tmplPath),
+			})
+		}
+		return root, []string{path}
+	}
+	for _, p := range chain {
+		if p == tmplPath {
+			l.problems = append(l.problems, Problem{
+				File:    path,
+				Line:    keyLine(root, "extends"),
+				Message: fmt.Sprintf("template %q is part of an extends cycle", name),
+			})
+			return root, []string{path}
+		}
+	}
+	tmpl := l.partial(tmplPath)
+	if tmpl == nil {
+		return root, []string{path}
+	}
+
+	base, sources := l.resolve(tmplPath, tmpl, chain)
+	return mergeNodes(base, root), append(sources, path)
+}
+
+// applyProfile removes the profiles section from the mapping node and, if
+// profile is non-empty and has an entry there, merges that entry on top.
+func applyProfile(node *yaml.Node, profile string) *yaml.Node {
+	if node.Kind != yaml.MappingNode {
+		return node
+	}
+	out := *node
+	out.Content = nil
+	var overlay *yaml.Node
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, val := node.Content[i], node.Content[i+1]
+		if key.Value != "profiles" {
+			out.Content = append(out.Content, key, val)
+			continue
+		}
+		if profile == "" || val.Kind != yaml.MappingNode {
+			continue
+		}
+		for j := 0; j+1 < len(val.Content); j += 2 {
+			if val.Content[j].Value == profile {
+				overlay = val.Content[j+1]
+			}
+		}
+	}
+	if overlay == nil {
+		return &out
+	}
+	return mergeNodes(&out, overlay)
+}
+
+// scalarValue returns the scalar value of key in the mapping node, or "".
+func scalarValue(node *yaml.Node, key string) string {
+	if node.Kind != yaml.MappingNode {
+		return ""
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key && node.Content[i+1].Kind == yaml.ScalarNode {
+			return node.Content[i+1].Value
+		}
+	}
+	return ""
+}
+
+// mergeNodes returns a new node with over deep-merged on top of base.
+// Mappings are merged key by key; any other value in over (scalars and
+// sequences alike) replaces the one in base. Neither input is modified.
+func mergeNodes(base, over *yaml.Node) *yaml.Node {
+	if base.Kind != yaml.MappingNode || over.Kind != yaml.MappingNode {
+		return over
+	}
+
+	out := *base
+	out.Content = append([]*yaml.Node(nil), base.Content...)
+	for i := 0; i+1 < len(over.Content); i += 2 {
+		key, val := over.Content[i], over.Content[i+1]
+		replaced := false
+		for j := 0; j+1 < len(out.Content); j += 2 {
+			if out.Content[j].Value == key.Value {
+				out.Content[j+1] = mergeNodes(out.Content[j+1], val)
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			out.Content = append(out.Content, key, val)
+		}
+	}
+	return &out
+}
+
+// varRefRE matches ${NAME} and ${service.field} references.
+var varRefRE = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*(?:\.[A-Za-z_]+)?)\}`)
+
+// expandService replaces ${...} references in every string field of svc.
+// ${service.name}, ${service.dir}, ${service.branch} and ${service.repo}
+// refer to the service itself; dir, branch and repo are expanded first so
+// other fields see their final values. ${VAR} is replaced with the
+// environment variable VAR when it is set, and otherwise left as-is so that
+// deploy steps can still use shell syntax such as ${HOME}. It returns the
+// unknown service.* references it found.
+func expandService(svc *ServiceConfig) []string {
+	var unknown []string
+	vars := map[string]string{"service.name": svc.Name}
+	expand := func(s string) string {
+		return varRefRE.ReplaceAllStringFunc(s, func(ref string) string {
+			name := ref[2 : len(ref)-1]
+			if v, ok := vars[name]; ok {
+				return v
+			}
+			if strings.HasPrefix(name, "service.") {
+				unknown = append(unknown, name)
+				return ref
+			}
+			if v, ok := os.LookupEnv(name); ok {
+				return v
+			}
+			return ref
+		})
+	}
+
+	svc.Dir = expand(svc.Dir)
+	svc.Branch = expand(svc.Branch)
+	svc.Repo = expand(svc.Repo)
+	vars["service.dir"] = svc.Dir
+	vars["service.branch"] = svc.Branch
+	vars["service.repo"] = svc.Repo
+
+	expandStrings(reflect.ValueOf(svc).Elem(), expand)
+	return unknown
+}
+
+// expandStrings applies fn to every settable string reachable from v through
+// struct fields, pointers, slices and map values. Fields tagged yaml:"-"
+// (Name, Sources) are skipped.
+func expandStrings(v reflect.Value, fn func(string) string) {
+	switch v.Kind() {
+	case reflect.String:
+		if v.CanSet() {
+			v.SetString(fn(v.String()))
+		}
+	case reflect.Ptr:
+		if !v.IsNil() {
+			expandStrings(v.Elem(), fn)
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			expandStrings(v.Index(i), fn)
+		}
+	case reflect.Map:
+		if v.Type().Elem().Kind() != reflect.String {
+			return
+		}
+		for _, k := range v.MapKeys() {
+			v.SetMapIndex(k, reflect.ValueOf(fn(v.MapIndex(k).String())))
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			if t.Field(i).Tag.Get("yaml") == "-" {
+				continue
+			}
+			expandStrings(v.Field(i), fn)
+		}
+	}
+}
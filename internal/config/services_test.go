@@ -0,0 +1,255 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/shishberg/mezzaops/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+	}
+}
+
+func TestLoadServices_Defaults(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"_defaults.yaml": `branch: main
+sudo: true
+process:
+  cmd: "./run"
+deploy:
+  - git pull
+`,
+		"api.yaml": `repo: org/api
+deploy:
+  - make
+`,
+	})
+
+	services, err := config.LoadServices(dir, "")
+	require.NoError(t, err)
+	require.Len(t, services, 1, "_defaults.yaml must not be loaded as a service")
+
+	svc := services[0]
+	assert.Equal(t, "api", svc.Name)
+	assert.Equal(t, "main", svc.Branch)
+	assert.Equal(t, "org/api", svc.Repo)
+	assert.True(t, svc.Sudo)
+	assert.Equal(t, "./run", svc.Process.Cmd)
+	// Lists are replaced, not appended.
+	assert.Equal(t, config.Steps("make"), svc.Deploy)
+	assert.Equal(t, []string{
+		filepath.Join(dir, "_defaults.yaml"),
+		filepath.Join(dir, "api.yaml"),
+	}, svc.Sources)
+}
+
+func TestLoadServices_Extends(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"_defaults.yaml": "branch: main\n",
+		"_base.yaml":     "process:\n  cmd: ./base\nrequire_confirmation: true\n",
+		"_go-service.yaml": `extends: base
+deploy:
+  - git pull
+  - go build -o ${service.name} .
+entrypoint: ["./${service.name}"]
+`,
+		"api.yaml":    "extends: go-service\nrepo: org/api\n",
+		"worker.yaml": "extends: go-service\nrepo: org/worker\nbranch: prod\nrequire_confirmation: false\n",
+	})
+
+	services, err := config.LoadServices(dir, "")
+	require.NoError(t, err)
+	require.Len(t, services, 2)
+
+	api, worker := services[0], services[1]
+	assert.Equal(t, "api", api.Name)
+	assert.Equal(t, "main", api.Branch)
+	assert.Equal(t, "./base", api.Process.Cmd)
+	assert.True(t, api.RequireConfirmation)
+	assert.Equal(t, config.Steps("git pull", "go build -o api ."), api.Deploy)
+	assert.Equal(t, []string{"./api"}, api.Entrypoint)
+	assert.Equal(t, "go-service", api.Extends)
+	assert.Equal(t, []string{
+		filepath.Join(dir, "_defaults.yaml"),
+		filepath.Join(dir, "_base.yaml"),
+		filepath.Join(dir, "_go-service.yaml"),
+		filepath.Join(dir, "api.yaml"),
+	}, api.Sources)
+
+	assert.Equal(t, "worker", worker.Name)
+	assert.Equal(t, "prod", worker.Branch)
+	assert.False(t, worker.RequireConfirmation)
+	assert.Equal(t, []string{"./worker"}, worker.Entrypoint)
+}
+
+func TestLoadServices_Expansion(t *testing.T) {
+	t.Setenv("MEZZAOPS_TEST_ROOT", "/srv")
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"_defaults.yaml": "dir: ${MEZZAOPS_TEST_ROOT}/${service.name}\n",
+		"api.yaml": `branch: main
+repo: org/${service.name}
+process:
+  cmd: "cd ${service.dir} && ./api"
+deploy:
+  - echo ${service.repo}@${service.branch}
+  - echo ${MEZZAOPS_TEST_UNSET_VAR} ${HOME:-x}
+`,
+	})
+
+	services, err := config.LoadServices(dir, "")
+	require.NoError(t, err)
+	require.Len(t, services, 1)
+
+	svc := services[0]
+	assert.Equal(t, "/srv/api", svc.Dir)
+	assert.Equal(t, "org/api", svc.Repo)
+	assert.Equal(t, "cd /srv/api && ./api", svc.Process.Cmd)
+	assert.Equal(t, config.Steps(
+		"echo org/api@main",
+		// Unset variables and shell syntax are left for the shell.
+		"echo ${MEZZAOPS_TEST_UNSET_VAR} ${HOME:-x}",
+	), svc.Deploy)
+}
+
+func TestLoadServices_ExtendsMissingTemplate(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"api.yaml": "extends: nope\n"})
+
+	_, err := config.LoadServices(dir, "")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `parsing service file api.yaml: line 1: template "nope" not found`)
+}
+
+func TestLoadServices_YmlPartials(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"_defaults.yml":   "branch: main\n",
+		"_go-service.yml": "process:\n  cmd: ./run\n",
+		"api.yaml":        "extends: go-service\nrepo: org/api\n",
+	})
+
+	services, err := config.LoadServices(dir, "")
+	require.NoError(t, err)
+	require.Len(t, services, 1)
+	assert.Equal(t, "main", services[0].Branch)
+	assert.Equal(t, "./run", services[0].Process.Cmd)
+	assert.Equal(t, []string{
+		filepath.Join(dir, "_defaults.yml"),
+		filepath.Join(dir, "_go-service.yml"),
+		filepath.Join(dir, "api.yaml"),
+	}, services[0].Sources)
+}
+
+func TestValidateServices_PartialWithBothExtensions(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"_defaults.yaml": "branch: main\n",
+		"_defaults.yml":  "branch: dev\n",
+		"_base.yaml":     "sudo: true\n",
+		"_base.yml":      "sudo: false\n",
+		"api.yaml":       "extends: base\nrepo: org/api\nbranch: main\n",
+		"web.yaml":       "extends: base\nrepo: org/web\nbranch: main\n",
+	})
+
+	problems := problemStrings(t, config.ValidateServices(dir, ""))
+	assert.Equal(t, []string{
+		filepath.Join(dir, "_defaults.yaml") + ": _defaults.yml also exists; keep only one of them",
+		filepath.Join(dir, "_base.yaml") + ": _base.yml also exists; keep only one of them",
+	}, problems)
+}
+
+func TestValidateServices_ExtendsCycle(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"_a.yaml":   "extends: b\n",
+		"_b.yaml":   "extends: a\n",
+		"api.yaml":  "extends: a\n",
+		"api2.yaml": "extends: b\n",
+	})
+
+	problems := problemStrings(t, config.ValidateServices(dir, ""))
+	assert.Equal(t, []string{
+		filepath.Join(dir, "_b.yaml") + `:1: template "a" is part of an extends cycle`,
+		filepath.Join(dir, "_a.yaml") + `:1: template "b" is part of an extends cycle`,
+	}, problems)
+}
+
+func TestValidateServices_ProblemInDefaultsReportedOnce(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"_defaults.yaml": "brnch: main\n",
+		"a.yaml":         "repo: org/a\nbranch: main\n",
+		"b.yaml":         "repo: org/b\nbranch: main\n",
+	})
+
+	problems := problemStrings(t, config.ValidateServices(dir, ""))
+	assert.Equal(t, []string{
+		filepath.Join(dir, "_defaults.yaml") + `:1: unknown field "brnch" (did you mean "branch"?)`,
+	}, problems)
+}
+
+func TestValidateServices_UnknownServiceVariable(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.yaml")
+	writeFiles(t, dir, map[string]string{"a.yaml": "process:\n  cmd: ./${service.nmae}\n"})
+
+	problems := problemStrings(t, config.ValidateServices(dir, ""))
+	assert.Equal(t, []string{path + ": unknown variable ${service.nmae}"}, problems)
+}
+
+func TestLoadServices_Profile(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"_defaults.yaml": "branch: main\nprofiles:\n  prod:\n    sudo: true\n",
+		"api.yaml": `repo: org/api
+process:
+  cmd: ./api --port 8080
+profiles:
+  prod:
+    branch: release
+    process:
+      cmd: ./api --port 80
+  dev:
+    require_confirmation: true
+`,
+	})
+
+	services, err := config.LoadServices(dir, "")
+	require.NoError(t, err)
+	require.Len(t, services, 1)
+	assert.Equal(t, "main", services[0].Branch)
+	assert.Equal(t, "./api --port 8080", services[0].Process.Cmd)
+	assert.False(t, services[0].Sudo)
+	assert.Nil(t, services[0].Profiles)
+
+	services, err = config.LoadServices(dir, "prod")
+	require.NoError(t, err)
+	require.Len(t, services, 1)
+	svc := services[0]
+	assert.Equal(t, "release", svc.Branch)
+	assert.Equal(t, "./api --port 80", svc.Process.Cmd)
+	// Profile sections merge like everything else, so _defaults' prod
+	// section still applies.
+	assert.True(t, svc.Sudo)
+	assert.False(t, svc.RequireConfirmation)
+	assert.Nil(t, svc.Profiles)
+}
+
+func TestValidateServices_UnknownFieldInProfile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.yaml")
+	writeFiles(t, dir, map[string]string{"a.yaml": "branch: main\nprofiles:\n  prod:\n    brnch: release\n"})
+
+	problems := problemStrings(t, config.ValidateServices(dir, "prod"))
+	assert.Equal(t, []string{path + `:4: unknown field "brnch" (did you mean "branch"?)`}, problems)
+}
@@ -0,0 +1,143 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DeployStep is one deploy step. In YAML it is either a plain string, which
+// is run with `sh -c`, or a mapping with the fields below.
+type DeployStep struct {
+	Name    string        `yaml:"name,omitempty"`
+	Run     string        `yaml:"run"`
+	Timeout time.Duration `yaml:"timeout,omitempty"` // 0 means no limit
+
+	// Retries is how many times a failed step is run again. The wait before
+	// each retry starts at Backoff (default 1s) and doubles.
+	Retries int           `yaml:"retries,omitempty"`
+	Backoff time.Duration `yaml:"backoff,omitempty"`
+
+	// Env adds environment variables for this step only. Dir overrides the
+	// working directory; relative paths are relative to the service dir.
+	Env map[string]string `yaml:"env,omitempty"`
+	Dir string            `yaml:"dir,omitempty"`
+
+	// ContinueOnError records a failure of this step without failing the
+	// deploy.
+	ContinueOnError bool `yaml:"continue_on_error,omitempty"`
+
+	// When restricts the step to some deploys; nil runs it on every deploy.
+	When *StepCondition `yaml:"when,omitempty"`
+}
+
+// StepCondition restricts a deploy step. Every condition that is set must
+// hold for the step to run.
+type StepCondition struct {
+	// Branch is a glob (path.Match syntax) matched against the branch being
+	// deployed, e.g. "main" or "release/*".
+	Branch string `yaml:"branch,omitempty"`
+
+	// Changed lists paths or globs; the step runs only if the deploy changed
+	// at least one matching file. A pattern without a slash matches at any
+	// depth, "**" matches any number of directories, and a pattern also
+	// matches everything under a directory of that name.
+	Changed []string `yaml:"changed,omitempty"`
+}
+
+// Steps wraps plain commands as deploy steps.
+func Steps(cmds ...string) []DeployStep {
+	steps := make([]DeployStep, len(cmds))
+	for i, cmd := range cmds {
+		steps[i] = DeployStep{Run: cmd}
+	}
+	return steps
+}
+
+// Label names the step in output and notifications: its name if set,
+// otherwise its command.
+func (s DeployStep) Label() string {
+	if s.Name != "" {
+		return s.Name
+	}
+	return s.Run
+}
+
+// String returns the step's command, prefixed with its name if it has one.
+func (s DeployStep) String() string {
+	if s.Name != "" {
+		return s.Name + ": " + s.Run
+	}
+	return s.Run
+}
+
+// isPlain reports whether the step has nothing but a command, so it can be
+// written back as a plain string.
+func (s DeployStep) isPlain() bool {
+	return reflect.DeepEqual(s, DeployStep{Run: s.Run})
+}
+
+// UnmarshalYAML accepts either a plain string or a mapping. Mapping keys are
+// checked as strictly as decodeStrict would, since a custom unmarshaler does
+// not inherit the decoder's KnownFields setting.
+func (s *DeployStep) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*s = DeployStep{}
+		return node.Decode(&s.Run)
+	}
+	if errs := unknownKeys(node, reflect.TypeOf(*s)); len(errs) > 0 {
+		return &yaml.TypeError{Errors: errs}
+	}
+	type plain DeployStep
+	var p plain
+	if err := node.Decode(&p); err != nil {
+		return err
+	}
+	if p.Run == "" {
+		return &yaml.TypeError{Errors: []string{fmt.Sprintf("line %d: deploy step has no run command", node.Line)}}
+	}
+	*s = DeployStep(p)
+	return nil
+}
+
+// MarshalYAML writes plain steps back as strings.
+func (s DeployStep) MarshalYAML() (any, error) {
+	if s.isPlain() {
+		return s.Run, nil
+	}
+	type plain DeployStep
+	return plain(s), nil
+}
+
+// unknownKeys returns a yaml.v3-style "field X not found in type Y" error for
+// each key in the mapping node that t (a struct) has no yaml tag for,
+// descending into nested struct fields.
+func unknownKeys(node *yaml.Node, t reflect.Type) []string {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if node.Kind != yaml.MappingNode || t.Kind() != reflect.Struct {
+		return nil
+	}
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < t.NumField(); i++ {
+		tag := strings.Split(t.Field(i).Tag.Get("yaml"), ",")[0]
+		if tag != "" && tag != "-" {
+			fields[tag] = t.Field(i).Type
+		}
+	}
+	var errs []string
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, val := node.Content[i], node.Content[i+1]
+		ft, ok := fields[key.Value]
+		if !ok {
+			errs = append(errs, fmt.Sprintf("line %d: field %s not found in type %s", key.Line, key.Value, t))
+			continue
+		}
+		errs = append(errs, unknownKeys(val, ft)...)
+	}
+	return errs
+}
@@ -0,0 +1,108 @@
+package config_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/shishberg/mezzaops/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestLoadServices_StructuredSteps(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"api.yaml": `deploy:
+  - git pull
+  - name: build
+    run: go build -o ${service.name} .
+    timeout: 5m
+    retries: 2
+    backoff: 10s
+    env:
+      CGO_ENABLED: "0"
+    dir: cmd/api
+  - name: migrate
+    run: ./migrate
+    continue_on_error: true
+    when:
+      branch: main
+      changed: [migrations]
+`,
+	})
+
+	services, err := config.LoadServices(dir, "")
+	require.NoError(t, err)
+	require.Len(t, services, 1)
+
+	assert.Equal(t, []config.DeployStep{
+		{Run: "git pull"},
+		{
+			Name:    "build",
+			Run:     "go build -o api .",
+			Timeout: 5 * time.Minute,
+			Retries: 2,
+			Backoff: 10 * time.Second,
+			Env:     map[string]string{"CGO_ENABLED": "0"},
+			Dir:     "cmd/api",
+		},
+		{
+			Name:            "migrate",
+			Run:             "./migrate",
+			ContinueOnError: true,
+			When:            &config.StepCondition{Branch: "main", Changed: []string{"migrations"}},
+		},
+	}, services[0].Deploy)
+}
+
+func TestValidateServices_UnknownStepField(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.yaml")
+	writeFiles(t, dir, map[string]string{
+		"a.yaml": `deploy:
+  - name: build
+    run: go build
+    timout: 5m
+    when:
+      brnch: main
+`,
+	})
+
+	problems := problemStrings(t, config.ValidateServices(dir, ""))
+	assert.Equal(t, []string{
+		path + `:4: unknown field "timout" (did you mean "timeout"?)`,
+		path + `:6: unknown field "brnch" (did you mean "branch"?)`,
+	}, problems)
+}
+
+func TestValidateServices_StepWithoutRun(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.yaml")
+	writeFiles(t, dir, map[string]string{"a.yaml": "deploy:\n  - name: build\n"})
+
+	problems := problemStrings(t, config.ValidateServices(dir, ""))
+	assert.Equal(t, []string{path + ":2: deploy step has no run command"}, problems)
+}
+
+func TestDeployStep_MarshalYAML(t *testing.T) {
+	steps := []config.DeployStep{
+		{Run: "git pull"},
+		{Name: "build", Run: "go build", Timeout: time.Minute},
+	}
+
+	data, err := yaml.Marshal(steps)
+	require.NoError(t, err)
+	assert.Equal(t, "- git pull\n- name: build\n  run: go build\n  timeout: 1m0s\n", string(data))
+
+	var back []config.DeployStep
+	require.NoError(t, yaml.Unmarshal(data, &back))
+	assert.Equal(t, steps, back)
+}
+
+func TestDeployStep_Label(t *testing.T) {
+	assert.Equal(t, "go build", config.DeployStep{Run: "go build"}.Label())
+	assert.Equal(t, "build", config.DeployStep{Name: "build", Run: "go build"}.Label())
+	assert.Equal(t, "build: go build", config.DeployStep{Name: "build", Run: "go build"}.String())
+}
@@ -0,0 +1,589 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Problem is a single validation finding. File and Line locate the offending
+// key when known; Line is 0 when the problem is not tied to a specific key.
+type Problem struct {
+	File    string
+	Line    int
+	Message string
+}
+
+// String formats the problem as "file:line: message", dropping the parts
+// that are unknown.
+func (p Problem) String() string {
+	switch {
+	case p.File != "" && p.Line > 0:
+		return fmt.Sprintf("%s:%d: %s", p.File, p.Line, p.Message)
+	case p.File != "":
+		return fmt.Sprintf("%s: %s", p.File, p.Message)
+	default:
+		return p.Message
+	}
+}
+
+// ValidationError collects every problem found while validating config and
+// service files, so a single run reports all of them instead of the first.
+type ValidationError struct {
+	Problems []Problem
+}
+
+// Error lists every problem on its own line.
+func (e *ValidationError) Error() string {
+	var b strings.Builder
+	if len(e.Problems) == 1 {
+		b.WriteString("1 problem found:")
+	} else {
+		fmt.Fprintf(&b, "%d problems found:", len(e.Problems))
+	}
+	for _, p := range e.Problems {
+		b.WriteString("\n  ")
+		b.WriteString(p.String())
+	}
+	return b.String()
+}
+
+// Validate strictly parses the config file at configPath and every service
+// file in its services_dir, and checks them for semantic problems. If profile
+// is non-empty, its overlay file is checked too and the checks apply to the
+// merged result, as LoadConfig and LoadServices would see it. If env is
+// non-nil, enabled frontends are also checked for missing secrets. It returns
+// a *ValidationError listing every problem found, or nil.
+func Validate(configPath, profile string, env *Env) error {
+	var problems []Problem
+
+	cfg, cfgProblems := validateConfigFile(configPath, profile, env)
+	problems = append(problems, cfgProblems...)
+
+	if cfg != nil {
+		svcProblems, err := validateServicesDir(cfg.ServicesDir, profile)
+		if err != nil {
+			problems = append(problems, Problem{File: configPath, Message: err.Error()})
+		}
+		problems = append(problems, svcProblems...)
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// ValidateServices strictly parses every service file in dir and checks the
+// services, with profile applied, individually and against each other. It
+// returns a *ValidationError listing every problem found, or nil.
+func ValidateServices(dir, profile string) error {
+	problems, err := validateServicesDir(dir, profile)
+	if err != nil {
+		return err
+	}
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// validateConfigFile checks config.yaml merged with the overlay for profile,
+// if any. The returned Config is nil when the file could not be parsed at all.
+func validateConfigFile(path, profile string, env *Env) (*Config, []Problem) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, []Problem{{File: path, Message: err.Error()}}
+	}
+
+	cfg := &Config{
+		ServicesDir: "./services",
+		LogDir:      "./logs",
+		StateDir:    "./state",
+	}
+	root, problems := decodeForValidation(path, data, cfg)
+	if root == nil {
+		return nil, problems
+	}
+
+	// Problems point at the overlay when it sets the offending key.
+	var overlay *yaml.Node
+	overlayPath := ProfilePath(path, profile)
+	if profile != "" {
+		data, err := os.ReadFile(overlayPath)
+		if err != nil {
+			return nil, append(problems, Problem{File: overlayPath, Message: err.Error()})
+		}
+		var overlayProblems []Problem
+		overlay, overlayProblems = decodeForValidation(overlayPath, data, &Config{})
+		problems = append(problems, overlayProblems...)
+		if overlay == nil {
+			return nil, problems
+		}
+		if overlay.Kind == yaml.MappingNode {
+			_ = mergeNodes(root, overlay).Decode(cfg)
+		}
+	}
+
+	at := func(msg string, keys ...string) Problem {
+		if overlay != nil {
+			if line := keyLine(overlay, keys...); line > 0 {
+				return Problem{File: overlayPath, Line: line, Message: msg}
+			}
+		}
+		return Problem{File: path, Line: keyLine(root, keys...), Message: msg}
+	}
+
+	if cfg.Webhook != nil {
+		if cfg.Webhook.Port < 0 || cfg.Webhook.Port > 65535 {
+			problems = append(problems, at(fmt.Sprintf("webhook port %d is out of range", cfg.Webhook.Port), "webhook", "port"))
+		}
+		if env != nil && env.WebhookSecret == "" {
+			problems = append(problems, at("webhook is configured but GITHUB_WEBHOOK_SECRET is not set", "webhook"))
+		}
+	}
+	if cfg.Dashboard != nil {
+		if cfg.Dashboard.Port < 0 || cfg.Dashboard.Port > 65535 {
+			problems = append(problems, at(fmt.Sprintf("dashboard port %d is out of range", cfg.Dashboard.Port), "dashboard", "port"))
+		}
+		if u := cfg.Dashboard.PublicURL; u != "" {
+			if parsed, err := url.Parse(u); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+				problems = append(problems, at(fmt.Sprintf("dashboard.public_url %q must be an http or https URL", u), "dashboard", "public_url"))
+			}
+		}
+	}
+	if cfg.Webhook != nil && cfg.Dashboard != nil &&
+		cfg.Webhook.Port != 0 && cfg.Webhook.Port == cfg.Dashboard.Port {
+		problems = append(problems, at(fmt.Sprintf("dashboard port %d is already used by webhook", cfg.Dashboard.Port), "dashboard", "port"))
+	}
+
+	if cfg.Deploy != nil && cfg.Deploy.MaxConcurrent < 0 {
+		problems = append(problems, at("deploy.max_concurrent must not be negative", "deploy", "max_concurrent"))
+	}
+
+	if cfg.Discord != nil && env != nil && env.DiscordToken == "" {
+		if _, err := os.Stat("token.txt"); err != nil {
+			problems = append(problems, at("discord is configured but DISCORD_TOKEN is not set", "discord"))
+		}
+	}
+
+	if cfg.Mattermost != nil {
+		if cfg.Mattermost.URL == "" {
+			problems = append(problems, at("mattermost.url is required", "mattermost"))
+		}
+		if cfg.Mattermost.Channel == "" {
+			problems = append(problems, at("mattermost.channel is required", "mattermost"))
+		}
+		if env != nil && env.MattermostToken == "" {
+			problems = append(problems, at("mattermost is configured but MATTERMOST_TOKEN is not set", "mattermost"))
+		}
+	}
+
+	if cfg.Matrix != nil {
+		if cfg.Matrix.Homeserver == "" {
+			problems = append(problems, at("matrix.homeserver is required", "matrix"))
+		}
+		if r := cfg.Matrix.Room; r == "" {
+			problems = append(problems, at("matrix.room is required", "matrix"))
+		} else if !strings.HasPrefix(r, "!") && !strings.HasPrefix(r, "#") {
+			problems = append(problems, at(fmt.Sprintf("matrix.room %q must start with '!' (room ID) or '#' (alias)", r), "matrix", "room"))
+		}
+		if env != nil {
+			var missing []string
+			for name, val := range map[string]string{
+				"MATRIX_USER_ID":      env.MatrixUserID,
+				"MATRIX_DEVICE_ID":    env.MatrixDeviceID,
+				"MATRIX_ACCESS_TOKEN": env.MatrixAccessToken,
+				"MATRIX_PICKLE_KEY":   env.MatrixPickleKey,
+			} {
+				if val == "" {
+					missing = append(missing, name)
+				}
+			}
+			if len(missing) > 0 {
+				slices.Sort(missing)
+				problems = append(problems, at("matrix is configured but "+strings.Join(missing, ", ")+" not set", "matrix"))
+			}
+		}
+	}
+
+	for i, src := range cfg.Secrets {
+		if msg := checkSecretSource(src); msg != "" {
+			p := at(fmt.Sprintf("secrets[%d]: %s", i, msg), "secrets")
+			if seq := keyNode(overlay, "secrets"); seq != nil && i < len(seq.Content) {
+				p.File, p.Line = overlayPath, seq.Content[i].Line
+			} else if seq := keyNode(root, "secrets"); seq != nil && i < len(seq.Content) {
+				p.Line = seq.Content[i].Line
+			}
+			problems = append(problems, p)
+		}
+	}
+
+	return cfg, problems
+}
+
+// checkSecretSource returns what is wrong with a secrets entry, or "". It
+// only inspects the config and filesystem; nothing is decrypted or run.
+func checkSecretSource(src SecretSource) string {
+	switch src.Type {
+	case "dir":
+		dir := src.Path
+		if dir == "" {
+			dir = os.Getenv("CREDENTIALS_DIRECTORY")
+			if dir == "" {
+				return "dir has no path and $CREDENTIALS_DIRECTORY is not set"
+			}
+		}
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			return fmt.Sprintf("directory %s does not exist", dir)
+		}
+	case "sops", "age":
+		if src.Path == "" {
+			return src.Type + " requires path"
+		}
+		if src.Type == "age" && src.Identity == "" {
+			return "age requires identity"
+		}
+		if _, err := os.Stat(src.Path); err != nil {
+			return fmt.Sprintf("%s does not exist", src.Path)
+		}
+		if _, err := exec.LookPath(src.Type); err != nil {
+			return fmt.Sprintf("%s not found on PATH", src.Type)
+		}
+	case "exec":
+		if len(src.Command) == 0 {
+			return "exec requires command"
+		}
+	default:
+		return fmt.Sprintf("unknown type %q (want dir, sops, age or exec)", src.Type)
+	}
+	return ""
+}
+
+// validateServicesDir checks every service file in dir. The error is only
+// non-nil when the directory itself cannot be read.
+func validateServicesDir(dir, profile string) ([]Problem, error) {
+	loaded, problems, err := loadServiceDir(dir, profile)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ls := range loaded {
+		problems = append(problems, checkService(ls.path, ls.root, ls.svc)...)
+	}
+
+	// Two services mapped to the same repo and branch would race for every
+	// push; FindServiceByRepo would pick one arbitrarily.
+	type repoKey struct{ repo, branch string }
+	seen := make(map[repoKey]loadedService)
+	for _, ls := range loaded {
+		if ls.svc.Repo == "" || ls.svc.Branch == "" {
+			continue
+		}
+		key := repoKey{strings.TrimPrefix(ls.svc.Repo, "github.com/"), ls.svc.Branch}
+		if prev, ok := seen[key]; ok {
+			problems = append(problems, Problem{
+				File: ls.path,
+				Line: keyLine(ls.root, "repo"),
+				Message: fmt.Sprintf("repo %s branch %s is already mapped to service %q (%s)",
+					key.repo, key.branch, prev.svc.Name, prev.path),
+			})
+			continue
+		}
+		seen[key] = ls
+	}
+
+	return problems, nil
+}
+
+// checkService runs the per-service semantic checks.
+func checkService(path string, root *yaml.Node, svc ServiceConfig) []Problem {
+	var problems []Problem
+	at := func(msg string, keys ...string) {
+		problems = append(problems, Problem{File: path, Line: keyLine(root, keys...), Message: msg})
+	}
+
+	if len(svc.Entrypoint) > 0 && svc.Process.Cmd != "" {
+		at("entrypoint and process.cmd are mutually exclusive", "process")
+	}
+	if svc.ServiceName != "" && (len(svc.Entrypoint) > 0 || svc.Process.Cmd != "") {
+		at("service_name selects the launchctl/systemctl backend and cannot be combined with entrypoint or process.cmd", "service_name")
+	}
+	if svc.ServiceName == "" && svc.UserService {
+		at("user_service only applies to service_name", "user_service")
+	}
+	if svc.ServiceName == "" && svc.Sudo {
+		at("sudo only applies to service_name", "sudo")
+	}
+
+	if svc.Repo != "" && svc.Branch == "" {
+		at("repo is set but branch is empty; pushes will never match", "repo")
+	}
+	if svc.Branch != "" && svc.Repo == "" {
+		at("branch is set but repo is empty; pushes will never match", "branch")
+	}
+
+	for i, w := range svc.DeployWindows {
+		if err := w.Check(); err != nil {
+			p := Problem{File: path, Line: keyLine(root, "deploy_windows"), Message: fmt.Sprintf("deploy_windows[%d]: %v", i, err)}
+			if seq := keyNode(root, "deploy_windows"); seq != nil && i < len(seq.Content) {
+				p.Line = seq.Content[i].Line
+			}
+			problems = append(problems, p)
+		}
+	}
+
+	if a := svc.Approvals; a != nil {
+		if a.Required < 0 {
+			at("approvals.required must not be negative", "approvals", "required")
+		} else if len(a.Approvers) > 0 && a.RequiredApprovals() > len(a.Approvers) {
+			at(fmt.Sprintf("approvals.required is %d but only %d approvers are listed", a.RequiredApprovals(), len(a.Approvers)), "approvals", "required")
+		}
+	}
+
+	if svc.PauseAfterFailures < 0 {
+		at("pause_after_failures must not be negative", "pause_after_failures")
+	}
+
+	if v := svc.Verify; v != nil {
+		if v.Soak <= 0 {
+			at("verify.soak must be a positive duration", "verify", "soak")
+		}
+		if svc.SelfDeploy {
+			at("verify does not apply to self_deploy services, which are not restarted by the deploy", "verify")
+		}
+	}
+
+	if svc.DeployKey != "" {
+		if svc.Repo == "" {
+			at("deploy_key is set but repo is empty", "deploy_key")
+		} else if _, err := os.Stat(svc.DeployKey); err != nil {
+			at(fmt.Sprintf("deploy_key %s does not exist", svc.DeployKey), "deploy_key")
+		}
+	}
+
+	// A missing dir with a repo is cloned by the first deploy.
+	if svc.Dir != "" && !svc.AwaitingClone() {
+		if fi, err := os.Stat(svc.Dir); err != nil {
+			at(fmt.Sprintf("dir %s does not exist", svc.Dir), "dir")
+		} else if !fi.IsDir() {
+			at(fmt.Sprintf("dir %s is not a directory", svc.Dir), "dir")
+		}
+	}
+
+	if svc.Releases != nil {
+		if svc.Dir == "" {
+			at("releases needs dir, the git checkout releases are built from", "releases")
+		}
+		if svc.Releases.Keep < 0 {
+			at("releases.keep must not be negative", "releases", "keep")
+		}
+	}
+
+	if len(svc.Entrypoint) > 0 && !awaitingFirstRelease(svc) && !awaitingFirstClone(svc) {
+		if msg := checkExecutable(svc.Entrypoint[0], svc.WorkDir()); msg != "" {
+			at(msg, "entrypoint")
+		}
+	}
+
+	return problems
+}
+
+// awaitingFirstClone reports whether a service's dir has yet to be cloned,
+// so a relative entrypoint has nothing to resolve against yet.
+func awaitingFirstClone(svc ServiceConfig) bool {
+	return strings.Contains(svc.Entrypoint[0], "/") && svc.AwaitingClone()
+}
+
+// awaitingFirstRelease reports whether a release-mode service has never been
+// deployed, so a relative entrypoint has nothing to resolve against yet.
+func awaitingFirstRelease(svc ServiceConfig) bool {
+	if svc.Releases == nil || !strings.Contains(svc.Entrypoint[0], "/") {
+		return false
+	}
+	_, err := os.Stat(svc.WorkDir())
+	return err != nil
+}
+
+// checkExecutable reports why name cannot be run, or "" if it can. Names
+// containing a slash are resolved relative to dir, the way exec.Cmd does
+// with Cmd.Dir set; bare names are looked up on PATH.
+func checkExecutable(name, dir string) string {
+	if !strings.Contains(name, "/") {
+		if _, err := exec.LookPath(name); err != nil {
+			return fmt.Sprintf("executable %q not found on PATH", name)
+		}
+		return ""
+	}
+	path := name
+	if !filepath.IsAbs(path) && dir != "" {
+		path = filepath.Join(dir, path)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return fmt.Sprintf("executable %s does not exist", path)
+	}
+	if fi.IsDir() || fi.Mode()&0o111 == 0 {
+		return fmt.Sprintf("%s is not executable", path)
+	}
+	return ""
+}
+
+// decodeForValidation parses data into a node tree and strictly decodes it
+// into v, converting YAML errors into located problems. The returned root is
+// nil if the document could not be parsed at all.
+func decodeForValidation(path string, data []byte, v any) (*yaml.Node, []Problem) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, yamlProblems(path, err)
+	}
+	root := &doc
+	if doc.Kind == yaml.DocumentNode && len(doc.Content) > 0 {
+		root = doc.Content[0]
+	}
+	if err := decodeStrict(data, v); err != nil {
+		return root, yamlProblems(path, err)
+	}
+	return root, nil
+}
+
+// yamlLineRE matches the "line N: " prefix yaml.v3 puts on its messages.
+var yamlLineRE = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+
+// unknownFieldRE matches yaml.v3's KnownFields error text.
+var unknownFieldRE = regexp.MustCompile(`^field (\S+) not found in type (\S+)$`)
+
+// yamlProblems converts a yaml.v3 error into one problem per message.
+func yamlProblems(path string, err error) []Problem {
+	msgs := []string{err.Error()}
+	var te *yaml.TypeError
+	if errors.As(err, &te) {
+		msgs = te.Errors
+	}
+
+	problems := make([]Problem, 0, len(msgs))
+	for _, msg := range msgs {
+		p := Problem{File: path, Message: msg}
+		if m := yamlLineRE.FindStringSubmatch(msg); m != nil {
+			p.Line, _ = strconv.Atoi(m[1])
+			p.Message = m[2]
+		}
+		if m := unknownFieldRE.FindStringSubmatch(p.Message); m != nil {
+			p.Message = fmt.Sprintf("unknown field %q", m[1])
+			if s := suggestField(m[1]); s != "" {
+				p.Message += fmt.Sprintf(" (did you mean %q?)", s)
+			}
+		}
+		problems = append(problems, p)
+	}
+	return problems
+}
+
+// keyLine returns the line of the deepest key along path that exists in the
+// mapping node root, or 0 if even the first key is missing.
+func keyLine(root *yaml.Node, path ...string) int {
+	line := 0
+	node := root
+	for _, key := range path {
+		if node == nil || node.Kind != yaml.MappingNode {
+			break
+		}
+		var next *yaml.Node
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == key {
+				line = node.Content[i].Line
+				next = node.Content[i+1]
+				break
+			}
+		}
+		if next == nil {
+			break
+		}
+		node = next
+	}
+	return line
+}
+
+// keyNode returns the value node of key in the mapping node, or nil.
+func keyNode(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// suggestField returns the known config key closest to name, or "" if none
+// is within a small edit distance.
+func suggestField(name string) string {
+	best, bestDist := "", 4
+	for _, known := range knownFields() {
+		if d := editDistance(name, known); d < bestDist {
+			best, bestDist = known, d
+		}
+	}
+	return best
+}
+
+// knownFields lists every yaml key accepted in config.yaml and service files.
+func knownFields() []string {
+	var fields []string
+	seen := make(map[reflect.Type]bool)
+	var walk func(t reflect.Type)
+	walk = func(t reflect.Type) {
+		for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Map {
+			t = t.Elem()
+		}
+		// ServiceConfig.Profiles refers back to ServiceConfig.
+		if t.Kind() != reflect.Struct || seen[t] {
+			return
+		}
+		seen[t] = true
+		for i := 0; i < t.NumField(); i++ {
+			tag := strings.Split(t.Field(i).Tag.Get("yaml"), ",")[0]
+			if tag == "" || tag == "-" {
+				continue
+			}
+			fields = append(fields, tag)
+			walk(t.Field(i).Type)
+		}
+	}
+	walk(reflect.TypeOf(Config{}))
+	walk(reflect.TypeOf(ServiceConfig{}))
+	return fields
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
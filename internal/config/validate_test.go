@@ -0,0 +1,271 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/shishberg/mezzaops/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// problemStrings returns the formatted problems from a *ValidationError.
+func problemStrings(t *testing.T, err error) []string {
+	t.Helper()
+	require.Error(t, err)
+	var verr *config.ValidationError
+	require.ErrorAs(t, err, &verr)
+	out := make([]string, len(verr.Problems))
+	for i, p := range verr.Problems {
+		out[i] = p.String()
+	}
+	return out
+}
+
+func TestLoadServices_RejectsUnknownField(t *testing.T) {
+	dir := t.TempDir()
+	yaml := "branch: main\nentry_point: [\"./app\"]\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "svc.yaml"), []byte(yaml), 0o644))
+
+	_, err := config.LoadServices(dir, "")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "parsing service file svc.yaml")
+	assert.Contains(t, err.Error(), "entry_point")
+}
+
+func TestLoadConfig_RejectsUnknownField(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("state_dri: /tmp\n"), 0o644))
+
+	_, err := config.LoadConfig(path, "")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "state_dri")
+}
+
+func TestValidateServices_Valid(t *testing.T) {
+	dir := t.TempDir()
+	yaml := "dir: " + dir + "\nentrypoint: [sleep, \"1\"]\nbranch: main\nrepo: org/a\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.yaml"), []byte(yaml), 0o644))
+
+	assert.NoError(t, config.ValidateServices(dir, ""))
+}
+
+func TestValidateServices_UnknownFieldWithSuggestion(t *testing.T) {
+	dir := t.TempDir()
+	yaml := "branch: main\nrepo: org/a\nrequre_confirmation: true\n"
+	path := filepath.Join(dir, "a.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(yaml), 0o644))
+
+	problems := problemStrings(t, config.ValidateServices(dir, ""))
+	require.Len(t, problems, 1)
+	assert.Equal(t, path+`:3: unknown field "requre_confirmation" (did you mean "require_confirmation"?)`, problems[0])
+}
+
+func TestValidateServices_ConflictingBackends(t *testing.T) {
+	dir := t.TempDir()
+	yaml := `entrypoint: [sleep, "1"]
+process:
+  cmd: "sleep 1"
+service_name: foo.service
+`
+	path := filepath.Join(dir, "a.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(yaml), 0o644))
+
+	problems := problemStrings(t, config.ValidateServices(dir, ""))
+	require.Len(t, problems, 2)
+	assert.Equal(t, path+":2: entrypoint and process.cmd are mutually exclusive", problems[0])
+	assert.True(t, strings.HasPrefix(problems[1], path+":4: service_name selects"), problems[1])
+}
+
+func TestValidateServices_MissingDirAndExecutable(t *testing.T) {
+	dir := t.TempDir()
+	yaml := `dir: /nonexistent/mezzaops-test
+entrypoint: ["mezzaops-no-such-binary"]
+`
+	path := filepath.Join(dir, "a.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(yaml), 0o644))
+
+	problems := problemStrings(t, config.ValidateServices(dir, ""))
+	assert.Equal(t, []string{
+		path + ":1: dir /nonexistent/mezzaops-test does not exist",
+		path + `:2: executable "mezzaops-no-such-binary" not found on PATH`,
+	}, problems)
+}
+
+func TestValidateServices_RelativeExecutable(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "app"), []byte("#!/bin/sh\n"), 0o644))
+	yaml := "dir: " + dir + "\nentrypoint: [\"./app\"]\n"
+	path := filepath.Join(dir, "a.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(yaml), 0o644))
+
+	problems := problemStrings(t, config.ValidateServices(dir, ""))
+	assert.Equal(t, []string{path + ":2: " + filepath.Join(dir, "app") + " is not executable"}, problems)
+
+	require.NoError(t, os.Chmod(filepath.Join(dir, "app"), 0o755))
+	assert.NoError(t, config.ValidateServices(dir, ""))
+}
+
+func TestValidateServices_DuplicateRepoBranch(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.yaml"), []byte("branch: main\nrepo: github.com/org/x\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "b.yaml"), []byte("branch: main\nrepo: org/x\n"), 0o644))
+
+	problems := problemStrings(t, config.ValidateServices(dir, ""))
+	require.Len(t, problems, 1)
+	assert.Contains(t, problems[0], filepath.Join(dir, "b.yaml")+":2: repo org/x branch main is already mapped to service \"a\"")
+}
+
+func TestValidateServices_RepoWithoutBranch(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("repo: org/x\n"), 0o644))
+
+	problems := problemStrings(t, config.ValidateServices(dir, ""))
+	assert.Equal(t, []string{path + ":1: repo is set but branch is empty; pushes will never match"}, problems)
+}
+
+func TestValidateServices_NegativePauseAfterFailures(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("pause_after_failures: -1\n"), 0o644))
+
+	problems := problemStrings(t, config.ValidateServices(dir, ""))
+	assert.Equal(t, []string{path + ":1: pause_after_failures must not be negative"}, problems)
+}
+
+func TestValidateServices_SyntaxError(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("branch: main\n  repo: [\n"), 0o644))
+
+	problems := problemStrings(t, config.ValidateServices(dir, ""))
+	require.Len(t, problems, 1)
+	assert.True(t, strings.HasPrefix(problems[0], path+":"), problems[0])
+}
+
+func TestValidate_FrontendsAndPorts(t *testing.T) {
+	dir := t.TempDir()
+	svcDir := filepath.Join(dir, "services")
+	require.NoError(t, os.MkdirAll(svcDir, 0o755))
+
+	yaml := `services_dir: ` + svcDir + `
+mattermost:
+  url: "http://mm"
+matrix:
+  homeserver: "https://matrix.example.org"
+  room: "general"
+webhook:
+  port: 8080
+dashboard:
+  port: 8080
+`
+	path := filepath.Join(dir, "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(yaml), 0o644))
+
+	env := &config.Env{WebhookSecret: "s", MattermostToken: "t"}
+	problems := problemStrings(t, config.Validate(path, "", env))
+	assert.Equal(t, []string{
+		path + ":10: dashboard port 8080 is already used by webhook",
+		path + ":2: mattermost.channel is required",
+		path + `:6: matrix.room "general" must start with '!' (room ID) or '#' (alias)`,
+		path + ":4: matrix is configured but MATRIX_ACCESS_TOKEN, MATRIX_DEVICE_ID, MATRIX_PICKLE_KEY, MATRIX_USER_ID not set",
+	}, problems)
+}
+
+func TestValidate_NegativeMaxConcurrent(t *testing.T) {
+	dir := t.TempDir()
+	svcDir := filepath.Join(dir, "services")
+	require.NoError(t, os.MkdirAll(svcDir, 0o755))
+
+	path := filepath.Join(dir, "config.yaml")
+	yaml := "services_dir: " + svcDir + "\ndeploy:\n  max_concurrent: -1\n"
+	require.NoError(t, os.WriteFile(path, []byte(yaml), 0o644))
+
+	problems := problemStrings(t, config.Validate(path, "", nil))
+	assert.Equal(t, []string{path + ":3: deploy.max_concurrent must not be negative"}, problems)
+}
+
+func TestValidate_DashboardPublicURL(t *testing.T) {
+	dir := t.TempDir()
+	svcDir := filepath.Join(dir, "services")
+	require.NoError(t, os.MkdirAll(svcDir, 0o755))
+
+	path := filepath.Join(dir, "config.yaml")
+	yaml := "services_dir: " + svcDir + "\ndashboard:\n  port: 9091\n  public_url: ops.example.com\n"
+	require.NoError(t, os.WriteFile(path, []byte(yaml), 0o644))
+
+	problems := problemStrings(t, config.Validate(path, "", nil))
+	assert.Equal(t, []string{path + `:4: dashboard.public_url "ops.example.com" must be an http or https URL`}, problems)
+
+	cfg := &config.Config{Dashboard: &config.DashboardConfig{PublicURL: "https://ops.example.com/"}}
+	assert.Equal(t, "https://ops.example.com", cfg.DashboardURL())
+	assert.Equal(t, "", (&config.Config{}).DashboardURL())
+}
+
+func TestValidate_IncludesServiceProblems(t *testing.T) {
+	dir := t.TempDir()
+	svcDir := filepath.Join(dir, "services")
+	require.NoError(t, os.MkdirAll(svcDir, 0o755))
+	svcPath := filepath.Join(svcDir, "a.yaml")
+	require.NoError(t, os.WriteFile(svcPath, []byte("entry_point: [x]\n"), 0o644))
+
+	path := filepath.Join(dir, "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("services_dir: "+svcDir+"\n"), 0o644))
+
+	problems := problemStrings(t, config.Validate(path, "", nil))
+	assert.Equal(t, []string{svcPath + `:1: unknown field "entry_point" (did you mean "entrypoint"?)`}, problems)
+}
+
+func TestLoadConfig_ProfileOverlay(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	writeFiles(t, dir, map[string]string{
+		"config.yaml": `state_dir: /var/lib/mezzaops
+mattermost:
+  url: "http://mm"
+  channel: ops
+webhook:
+  port: 8080
+`,
+		"config.dev.yaml": `state_dir: ./state
+mattermost:
+  channel: ops-dev
+`,
+	})
+
+	cfg, err := config.LoadConfig(path, "dev")
+	require.NoError(t, err)
+	assert.Equal(t, "dev", cfg.Profile)
+	assert.Equal(t, "./state", cfg.StateDir)
+	assert.Equal(t, "./logs", cfg.LogDir)
+	assert.Equal(t, "http://mm", cfg.Mattermost.URL)
+	assert.Equal(t, "ops-dev", cfg.Mattermost.Channel)
+	assert.Equal(t, 8080, cfg.Webhook.Port)
+
+	_, err = config.LoadConfig(path, "prod")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "reading profile overlay")
+}
+
+func TestValidate_ProfileOverlay(t *testing.T) {
+	dir := t.TempDir()
+	svcDir := filepath.Join(dir, "services")
+	require.NoError(t, os.MkdirAll(svcDir, 0o755))
+	path := filepath.Join(dir, "config.yaml")
+	overlayPath := filepath.Join(dir, "config.prod.yaml")
+	writeFiles(t, dir, map[string]string{
+		"config.yaml":      "services_dir: " + svcDir + "\nwebhook:\n  port: 8080\n",
+		"config.prod.yaml": "dashboard:\n  port: 8080\nstate_dri: /tmp\n",
+	})
+
+	assert.NoError(t, config.Validate(path, "", nil))
+
+	problems := problemStrings(t, config.Validate(path, "prod", nil))
+	assert.Equal(t, []string{
+		overlayPath + `:3: unknown field "state_dri" (did you mean "state_dir"?)`,
+		overlayPath + ":2: dashboard port 8080 is already used by webhook",
+	}, problems)
+}
@@ -0,0 +1,57 @@
+package config
+
+import (
+	"strings"
+	"time"
+)
+
+// VerifyConfig checks a service after a deploy restarts it. For Soak after
+// the restart the service must keep running and, if Check is set, pass it;
+// otherwise the deploy fails verification and is rolled back.
+type VerifyConfig struct {
+	Soak time.Duration `yaml:"soak"`
+
+	// Check is a health or readiness check: an http(s) URL that must answer
+	// 2xx, or else a shell command that must exit 0. It must pass at least
+	// once during the soak and must not fail after that.
+	Check string `yaml:"check,omitempty"`
+
+	// Interval is how often the service is checked (default 5s); Timeout
+	// bounds each check (default 10s).
+	Interval time.Duration `yaml:"interval,omitempty"`
+	Timeout  time.Duration `yaml:"timeout,omitempty"`
+
+	// Rollback restores the previous commit when verification fails.
+	// Defaults to true.
+	Rollback *bool `yaml:"rollback,omitempty"`
+}
+
+// CheckInterval returns how often the service is checked during the soak.
+func (v *VerifyConfig) CheckInterval() time.Duration {
+	if v.Interval > 0 {
+		return v.Interval
+	}
+	return 5 * time.Second
+}
+
+// CheckTimeout returns how long a single check may take.
+func (v *VerifyConfig) CheckTimeout() time.Duration {
+	if v.Timeout > 0 {
+		return v.Timeout
+	}
+	return 10 * time.Second
+}
+
+// ShouldRollback returns whether a deploy that fails verification is rolled
+// back. Defaults to true if not explicitly set.
+func (v *VerifyConfig) ShouldRollback() bool {
+	if v.Rollback != nil {
+		return *v.Rollback
+	}
+	return true
+}
+
+// IsHTTP reports whether Check is a URL rather than a command.
+func (v *VerifyConfig) IsHTTP() bool {
+	return strings.HasPrefix(v.Check, "http://") || strings.HasPrefix(v.Check, "https://")
+}
@@ -0,0 +1,58 @@
+package config_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/shishberg/mezzaops/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadServices_Verify(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"api.yaml": `verify:
+  soak: 30s
+  check: http://localhost:8080/healthz
+  interval: 2s
+  rollback: false
+`,
+	})
+
+	services, err := config.LoadServices(dir, "")
+	require.NoError(t, err)
+	require.Len(t, services, 1)
+	v := services[0].Verify
+	require.NotNil(t, v)
+	assert.Equal(t, 30*time.Second, v.Soak)
+	assert.True(t, v.IsHTTP())
+	assert.Equal(t, 2*time.Second, v.CheckInterval())
+	assert.Equal(t, 10*time.Second, v.CheckTimeout())
+	assert.False(t, v.ShouldRollback())
+}
+
+func TestVerifyConfig_Defaults(t *testing.T) {
+	v := &config.VerifyConfig{Soak: time.Minute, Check: "curl -fs localhost:8080"}
+	assert.False(t, v.IsHTTP())
+	assert.Equal(t, 5*time.Second, v.CheckInterval())
+	assert.True(t, v.ShouldRollback())
+}
+
+func TestValidateServices_BadVerify(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"a.yaml": `self_deploy: true
+verify:
+  check: "true"
+`,
+	})
+
+	path := filepath.Join(dir, "a.yaml")
+	problems := problemStrings(t, config.ValidateServices(dir, ""))
+	assert.Equal(t, []string{
+		path + ":2: verify.soak must be a positive duration",
+		path + ":2: verify does not apply to self_deploy services, which are not restarted by the deploy",
+	}, problems)
+}
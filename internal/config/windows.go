@@ -0,0 +1,127 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// DeployWindow is a weekly period in which pushes deploy automatically. A
+// service with deploy_windows holds pushes that arrive outside all of them.
+type DeployWindow struct {
+	// Days lists weekdays ("mon" … "sun") or ranges of them ("mon-fri");
+	// empty means every day.
+	Days []string `yaml:"days,omitempty"`
+
+	// Start and End are times of day, "15:04". An End at or before Start
+	// runs past midnight into the next day.
+	Start string `yaml:"start"`
+	End   string `yaml:"end"`
+
+	// Timezone is an IANA zone such as "Europe/London"; empty means the
+	// host's local time.
+	Timezone string `yaml:"timezone,omitempty"`
+}
+
+var weekdays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// Check reports what is wrong with the window, or nil.
+func (w DeployWindow) Check() error {
+	_, _, _, _, err := w.parse()
+	return err
+}
+
+// Contains reports whether t falls inside the window. A window that fails
+// Check contains nothing, so a typo holds pushes rather than deploying them.
+func (w DeployWindow) Contains(t time.Time) bool {
+	days, start, end, loc, err := w.parse()
+	if err != nil {
+		return false
+	}
+	t = t.In(loc)
+	now := t.Hour()*60 + t.Minute()
+	today := t.Weekday()
+	yesterday := (today + 6) % 7
+
+	if start < end {
+		return days[today] && now >= start && now < end
+	}
+	// Overnight (or all-day when start == end): the part after midnight
+	// belongs to the previous day's window.
+	return (days[today] && now >= start) || (days[yesterday] && now < end)
+}
+
+// String describes the window, e.g. "mon-fri 09:00-17:00 Europe/London".
+func (w DeployWindow) String() string {
+	s := w.Start + "-" + w.End
+	if len(w.Days) > 0 {
+		s = strings.Join(w.Days, ",") + " " + s
+	}
+	if w.Timezone != "" {
+		s += " " + w.Timezone
+	}
+	return s
+}
+
+// parse returns the window's days (indexed by time.Weekday), its start and
+// end in minutes after midnight, and its location.
+func (w DeployWindow) parse() (days [7]bool, start, end int, loc *time.Location, err error) {
+	if len(w.Days) == 0 {
+		days = [7]bool{true, true, true, true, true, true, true}
+	}
+	for _, d := range w.Days {
+		from, to, isRange := strings.Cut(strings.ToLower(d), "-")
+		if !isRange {
+			to = from
+		}
+		i, j := slices.Index(weekdays, from), slices.Index(weekdays, to)
+		if i < 0 || j < 0 {
+			return days, 0, 0, nil, fmt.Errorf("unknown day %q (want mon, tue, … or a range like mon-fri)", d)
+		}
+		for k := i; ; k = (k + 1) % 7 {
+			days[k] = true
+			if k == j {
+				break
+			}
+		}
+	}
+
+	if start, err = minuteOfDay(w.Start); err != nil {
+		return days, 0, 0, nil, fmt.Errorf("start: %w", err)
+	}
+	if end, err = minuteOfDay(w.End); err != nil {
+		return days, 0, 0, nil, fmt.Errorf("end: %w", err)
+	}
+
+	loc = time.Local
+	if w.Timezone != "" {
+		if loc, err = time.LoadLocation(w.Timezone); err != nil {
+			return days, 0, 0, nil, fmt.Errorf("timezone: %w", err)
+		}
+	}
+	return days, start, end, loc, nil
+}
+
+// minuteOfDay parses "15:04" into minutes after midnight.
+func minuteOfDay(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a time like 09:00", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// InDeployWindow reports whether t falls inside any of windows. With no
+// windows configured, every time is allowed.
+func InDeployWindow(windows []DeployWindow, t time.Time) bool {
+	if len(windows) == 0 {
+		return true
+	}
+	for _, w := range windows {
+		if w.Contains(t) {
+			return true
+		}
+	}
+	return false
+}
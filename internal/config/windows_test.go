@@ -0,0 +1,85 @@
+package config_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/shishberg/mezzaops/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeployWindow_Contains(t *testing.T) {
+	// 2026-10-19 is a Monday.
+	at := func(day int, clock string) time.Time {
+		tm, err := time.Parse("15:04", clock)
+		require.NoError(t, err)
+		return time.Date(2026, 10, 18+day, tm.Hour(), tm.Minute(), 0, 0, time.UTC)
+	}
+	const mon, fri, sat, sun = 1, 5, 6, 0
+
+	business := config.DeployWindow{Days: []string{"mon-fri"}, Start: "09:00", End: "17:00", Timezone: "UTC"}
+	assert.True(t, business.Contains(at(mon, "09:00")))
+	assert.True(t, business.Contains(at(fri, "16:59")))
+	assert.False(t, business.Contains(at(fri, "17:00")))
+	assert.False(t, business.Contains(at(mon, "08:59")))
+	assert.False(t, business.Contains(at(sat, "12:00")))
+
+	overnight := config.DeployWindow{Days: []string{"fri"}, Start: "22:00", End: "06:00", Timezone: "UTC"}
+	assert.True(t, overnight.Contains(at(fri, "23:00")))
+	assert.True(t, overnight.Contains(at(sat, "05:59")))
+	assert.False(t, overnight.Contains(at(sat, "23:00")))
+	assert.False(t, overnight.Contains(at(fri, "05:00")))
+
+	weekend := config.DeployWindow{Days: []string{"sat-sun"}, Start: "00:00", End: "00:00", Timezone: "UTC"}
+	assert.True(t, weekend.Contains(at(sun, "12:00")))
+	assert.False(t, weekend.Contains(at(mon, "12:00")))
+
+	assert.False(t, config.DeployWindow{Start: "9am", End: "17:00"}.Contains(at(mon, "12:00")))
+}
+
+func TestDeployWindow_Timezone(t *testing.T) {
+	w := config.DeployWindow{Start: "09:00", End: "17:00", Timezone: "Asia/Tokyo"}
+	// 01:00 UTC is 10:00 in Tokyo.
+	assert.True(t, w.Contains(time.Date(2026, 10, 19, 1, 0, 0, 0, time.UTC)))
+	assert.False(t, w.Contains(time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)))
+}
+
+func TestInDeployWindow(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	assert.True(t, config.InDeployWindow(nil, now))
+	assert.False(t, config.InDeployWindow([]config.DeployWindow{
+		{Start: "13:00", End: "14:00", Timezone: "UTC"},
+	}, now))
+	assert.True(t, config.InDeployWindow([]config.DeployWindow{
+		{Start: "13:00", End: "14:00", Timezone: "UTC"},
+		{Start: "11:00", End: "12:30", Timezone: "UTC"},
+	}, now))
+}
+
+func TestValidateServices_BadDeployWindow(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.yaml")
+	writeFiles(t, dir, map[string]string{
+		"a.yaml": `deploy_windows:
+  - days: [mon-fri]
+    start: "09:00"
+    end: "17:00"
+  - days: [funday]
+    start: "10:00"
+    end: "12:00"
+  - start: 9am
+    end: "12:00"
+  - start: "09:00"
+    end: "12:00"
+    timezone: Mars/Olympus
+`,
+	})
+
+	problems := problemStrings(t, config.ValidateServices(dir, ""))
+	require.Len(t, problems, 3)
+	assert.Equal(t, path+`:5: deploy_windows[1]: unknown day "funday" (want mon, tue, … or a range like mon-fri)`, problems[0])
+	assert.Equal(t, path+`:8: deploy_windows[2]: start: "9am" is not a time like 09:00`, problems[1])
+	assert.Contains(t, problems[2], path+`:10: deploy_windows[3]: timezone:`)
+}
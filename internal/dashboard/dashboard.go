@@ -3,10 +3,13 @@ package dashboard
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
+	"io"
 	"io/fs"
 	"net/http"
+	"path/filepath"
 	"reflect"
 	"strings"
 
@@ -21,8 +24,11 @@ type ConfigField struct {
 }
 
 // ConfigFields uses reflection to extract non-zero fields from a
-// ServiceConfig, returning them in declaration order. The Name field
-// (yaml:"-") is skipped because it is already shown in the page heading.
+// ServiceConfig, returning them in declaration order. cfg is the effective
+// config, after defaults, templates and ${...} references are resolved, so
+// the page shows what the service actually runs with. Fields tagged
+// yaml:"-" (Name, Sources) are skipped; the name is already shown in the
+// page heading and the sources are listed separately.
 func ConfigFields(cfg config.ServiceConfig) []ConfigField {
 	var fields []ConfigField
 	v := reflect.ValueOf(cfg)
@@ -32,7 +38,7 @@ func ConfigFields(cfg config.ServiceConfig) []ConfigField {
 		sf := t.Field(i)
 		fv := v.Field(i)
 
-		tag := sf.Tag.Get("yaml")
+		tag, _, _ := strings.Cut(sf.Tag.Get("yaml"), ",")
 		if tag == "-" || tag == "" {
 			continue
 		}
@@ -71,7 +77,7 @@ func ConfigFields(cfg config.ServiceConfig) []ConfigField {
 			for j := 0; j < st.NumField(); j++ {
 				ssf := st.Field(j)
 				sfv := sv.Field(j)
-				stag := ssf.Tag.Get("yaml")
+				stag, _, _ := strings.Cut(ssf.Tag.Get("yaml"), ",")
 				if stag == "-" || stag == "" {
 					continue
 				}
@@ -110,6 +116,16 @@ type StateProvider interface {
 	GetServiceState(name string) (service.ServiceState, bool)
 	GetServiceLogs(name string) string
 	GetServiceConfig(name string) (config.ServiceConfig, bool)
+	GetDeployHistory(name string) ([]service.DeployRecord, bool)
+	Plan(name string) (*service.DeployPlan, error)
+	OpenDeployLog(name, id string) (io.ReadCloser, error)
+	ScheduledDeploys() []service.ScheduledDeploy
+}
+
+// indexData is the template data for the overview page.
+type indexData struct {
+	Services  map[string]service.ServiceState
+	Scheduled []service.ScheduledDeploy
 }
 
 // serviceDetailData is the template data for the service detail page.
@@ -117,9 +133,23 @@ type serviceDetailData struct {
 	Name         string
 	State        service.ServiceState
 	ConfigFields []ConfigField
+	Sources      []string
 	Logs         string
 }
 
+// deploysData is the template data for the deploy history page.
+type deploysData struct {
+	Name    string
+	Deploys []service.DeployRecord
+}
+
+// planData is the template data for the deploy plan page.
+type planData struct {
+	Name  string
+	Plan  *service.DeployPlan
+	Error string
+}
+
 // Dashboard serves the web UI and JSON API for service status.
 type Dashboard struct {
 	provider StateProvider
@@ -129,7 +159,7 @@ type Dashboard struct {
 
 // New creates a Dashboard, parsing templates from the given filesystem.
 func New(provider StateProvider, templatesFS fs.FS) (*Dashboard, error) {
-	tmpl, err := template.ParseFS(templatesFS, "index.html", "service.html")
+	tmpl, err := template.ParseFS(templatesFS, "index.html", "service.html", "deploys.html", "plan.html")
 	if err != nil {
 		return nil, err
 	}
@@ -142,8 +172,14 @@ func New(provider StateProvider, templatesFS fs.FS) (*Dashboard, error) {
 
 	d.mux.HandleFunc("GET /", d.handleIndex)
 	d.mux.HandleFunc("GET /api/status", d.handleAPIStatus)
+	d.mux.HandleFunc("GET /api/scheduled", d.handleAPIScheduled)
 	d.mux.HandleFunc("GET /service/{name}", d.handleServiceDetail)
 	d.mux.HandleFunc("GET /api/service/{name}/logs", d.handleAPIServiceLogs)
+	d.mux.HandleFunc("GET /service/{name}/deploys", d.handleDeploys)
+	d.mux.HandleFunc("GET /api/service/{name}/deploys", d.handleAPIDeploys)
+	d.mux.HandleFunc("GET /api/service/{name}/deploys/{id}/log", d.handleAPIDeployLog)
+	d.mux.HandleFunc("GET /service/{name}/plan", d.handlePlan)
+	d.mux.HandleFunc("GET /api/service/{name}/plan", d.handleAPIPlan)
 
 	return d, nil
 }
@@ -154,9 +190,12 @@ func (d *Dashboard) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 }
 
 func (d *Dashboard) handleIndex(w http.ResponseWriter, _ *http.Request) {
-	states := d.provider.GetAllStates()
+	data := indexData{
+		Services:  d.provider.GetAllStates(),
+		Scheduled: d.provider.ScheduledDeploys(),
+	}
 	var buf bytes.Buffer
-	if err := d.tmpl.ExecuteTemplate(&buf, "index.html", states); err != nil {
+	if err := d.tmpl.ExecuteTemplate(&buf, "index.html", data); err != nil {
 		http.Error(w, "template error: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -172,6 +211,14 @@ func (d *Dashboard) handleAPIStatus(w http.ResponseWriter, _ *http.Request) {
 	}
 }
 
+func (d *Dashboard) handleAPIScheduled(w http.ResponseWriter, _ *http.Request) {
+	scheduled := d.provider.ScheduledDeploys()
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(scheduled); err != nil {
+		http.Error(w, "json error: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
 func (d *Dashboard) handleServiceDetail(w http.ResponseWriter, r *http.Request) {
 	name := r.PathValue("name")
 
@@ -190,6 +237,9 @@ func (d *Dashboard) handleServiceDetail(w http.ResponseWriter, r *http.Request)
 		ConfigFields: ConfigFields(cfg),
 		Logs:         logs,
 	}
+	for _, src := range cfg.Sources {
+		data.Sources = append(data.Sources, filepath.Base(src))
+	}
 
 	var buf bytes.Buffer
 	if err := d.tmpl.ExecuteTemplate(&buf, "service.html", data); err != nil {
@@ -215,3 +265,101 @@ func (d *Dashboard) handleAPIServiceLogs(w http.ResponseWriter, r *http.Request)
 		http.Error(w, "json error: "+err.Error(), http.StatusInternalServerError)
 	}
 }
+
+func (d *Dashboard) handleDeploys(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+
+	records, ok := d.provider.GetDeployHistory(name)
+	if !ok {
+		http.Error(w, "service not found", http.StatusNotFound)
+		return
+	}
+
+	var buf bytes.Buffer
+	data := deploysData{Name: name, Deploys: records}
+	if err := d.tmpl.ExecuteTemplate(&buf, "deploys.html", data); err != nil {
+		http.Error(w, "template error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = w.Write(buf.Bytes())
+}
+
+func (d *Dashboard) handleAPIDeploys(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+
+	records, ok := d.provider.GetDeployHistory(name)
+	if !ok {
+		http.Error(w, "service not found", http.StatusNotFound)
+		return
+	}
+	if records == nil {
+		records = []service.DeployRecord{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(records); err != nil {
+		http.Error(w, "json error: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// handleAPIDeployLog streams a deploy's full output as plain text.
+func (d *Dashboard) handleAPIDeployLog(w http.ResponseWriter, r *http.Request) {
+	rc, err := d.provider.OpenDeployLog(r.PathValue("name"), r.PathValue("id"))
+	if errors.Is(err, fs.ErrNotExist) {
+		http.Error(w, "deploy not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rc.Close() //nolint:errcheck // read-only
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = io.Copy(w, rc)
+}
+
+func (d *Dashboard) handlePlan(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+
+	if _, ok := d.provider.GetServiceState(name); !ok {
+		http.Error(w, "service not found", http.StatusNotFound)
+		return
+	}
+
+	data := planData{Name: name}
+	plan, err := d.provider.Plan(name)
+	if err != nil {
+		data.Error = err.Error()
+	}
+	data.Plan = plan
+
+	var buf bytes.Buffer
+	if err := d.tmpl.ExecuteTemplate(&buf, "plan.html", data); err != nil {
+		http.Error(w, "template error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = w.Write(buf.Bytes())
+}
+
+func (d *Dashboard) handleAPIPlan(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+
+	if _, ok := d.provider.GetServiceState(name); !ok {
+		http.Error(w, "service not found", http.StatusNotFound)
+		return
+	}
+
+	plan, err := d.provider.Plan(name)
+	if err != nil {
+		http.Error(w, "plan failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(plan); err != nil {
+		http.Error(w, "json error: "+err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -2,14 +2,19 @@ package dashboard_test
 
 import (
 	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/shishberg/mezzaops/internal/config"
 	"github.com/shishberg/mezzaops/internal/dashboard"
+	"github.com/shishberg/mezzaops/internal/deploy"
 	"github.com/shishberg/mezzaops/internal/service"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -19,6 +24,9 @@ type mockStateProvider struct {
 	states  map[string]service.ServiceState
 	configs map[string]config.ServiceConfig
 	logs    map[string]string
+	deploys map[string][]service.DeployRecord
+	plans   map[string]*service.DeployPlan
+	sched   []service.ScheduledDeploy
 }
 
 func (m *mockStateProvider) GetAllStates() map[string]service.ServiceState {
@@ -45,6 +53,33 @@ func (m *mockStateProvider) GetServiceConfig(name string) (config.ServiceConfig,
 	return c, ok
 }
 
+func (m *mockStateProvider) GetDeployHistory(name string) ([]service.DeployRecord, bool) {
+	if _, ok := m.states[name]; !ok {
+		return nil, false
+	}
+	return m.deploys[name], true
+}
+
+func (m *mockStateProvider) Plan(name string) (*service.DeployPlan, error) {
+	if p, ok := m.plans[name]; ok {
+		return p, nil
+	}
+	return nil, fmt.Errorf("git fetch failed")
+}
+
+func (m *mockStateProvider) OpenDeployLog(name, id string) (io.ReadCloser, error) {
+	for _, r := range m.deploys[name] {
+		if r.ID == id {
+			return io.NopCloser(strings.NewReader(r.Output)), nil
+		}
+	}
+	return nil, fs.ErrNotExist
+}
+
+func (m *mockStateProvider) ScheduledDeploys() []service.ScheduledDeploy {
+	return m.sched
+}
+
 func TestDashboard_RendersServices(t *testing.T) {
 	provider := &mockStateProvider{
 		states: map[string]service.ServiceState{
@@ -79,6 +114,48 @@ func TestDashboard_RendersServices(t *testing.T) {
 	assert.Contains(t, body, "failed")
 }
 
+func TestDashboard_ScheduledDeploys(t *testing.T) {
+	at := time.Date(2026, 4, 7, 2, 0, 0, 0, time.UTC)
+	provider := &mockStateProvider{
+		states: map[string]service.ServiceState{"myapp": {Status: "running"}},
+		sched: []service.ScheduledDeploy{{
+			ID: "3",
+			At: at,
+			QueuedDeploy: service.QueuedDeploy{
+				Service:       "myapp",
+				DeployRequest: service.DeployRequest{Trigger: service.TriggerChat, Actor: "alice", Ref: "v1.2"},
+			},
+		}},
+	}
+
+	d, err := dashboard.New(provider, os.DirFS("../../templates"))
+	require.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+	d.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	body := rr.Body.String()
+	assert.Contains(t, body, "Scheduled deploys")
+	assert.Contains(t, body, "#3")
+	assert.Contains(t, body, "2026-04-07 02:00 UTC")
+	assert.Contains(t, body, "deploy @v1.2 (chat by alice)")
+
+	rr = httptest.NewRecorder()
+	d.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/scheduled", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var result []service.ScheduledDeploy
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &result))
+	require.Len(t, result, 1)
+	assert.Equal(t, "3", result[0].ID)
+	assert.True(t, result[0].At.Equal(at))
+	assert.Equal(t, "myapp", result[0].Service)
+
+	provider.sched = nil
+	rr = httptest.NewRecorder()
+	d.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.NotContains(t, rr.Body.String(), "Scheduled deploys")
+}
+
 func TestDashboard_JSONEndpoint(t *testing.T) {
 	provider := &mockStateProvider{
 		states: map[string]service.ServiceState{
@@ -124,6 +201,36 @@ func TestDashboard_StatusBadges(t *testing.T) {
 	assert.Contains(t, body, "badge-stopped")
 }
 
+func TestDashboard_Paused(t *testing.T) {
+	provider := &mockStateProvider{
+		states: map[string]service.ServiceState{
+			"web": {
+				Status:  "running",
+				Release: "20261019-093000.000-0123456",
+				Paused:  "frozen by alice: release week",
+				Freeze:  &service.Freeze{Target: "web", By: "alice", Reason: "release week"},
+				Held:    &service.HeldDeploy{Actor: "bob", Since: time.Date(2026, 10, 19, 9, 30, 0, 0, time.UTC)},
+			},
+		},
+	}
+
+	d, err := dashboard.New(provider, os.DirFS("../../templates"))
+	require.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+	d.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	body := rr.Body.String()
+	assert.Contains(t, body, `title="frozen by alice: release week">frozen, push held</span>`)
+
+	rr = httptest.NewRecorder()
+	d.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/service/web", nil))
+	body = rr.Body.String()
+	assert.Contains(t, body, "frozen by alice: release week")
+	assert.Contains(t, body, "from bob")
+	assert.Contains(t, body, "2026-10-19 09:30:00")
+	assert.Contains(t, body, "<code>20261019-093000.000-0123456</code>")
+}
+
 func TestDashboard_ServiceDetail(t *testing.T) {
 	provider := &mockStateProvider{
 		states: map[string]service.ServiceState{
@@ -136,10 +243,11 @@ func TestDashboard_ServiceDetail(t *testing.T) {
 		},
 		configs: map[string]config.ServiceConfig{
 			"myapp": {
-				Name:   "myapp",
-				Dir:    "/opt/myapp",
-				Branch: "main",
-				Repo:   "github.com/org/myapp",
+				Name:    "myapp",
+				Dir:     "/opt/myapp",
+				Branch:  "main",
+				Repo:    "github.com/org/myapp",
+				Sources: []string{"/etc/mezzaops/services/_defaults.yaml", "/etc/mezzaops/services/myapp.yaml"},
 			},
 		},
 		logs: map[string]string{
@@ -166,6 +274,7 @@ func TestDashboard_ServiceDetail(t *testing.T) {
 	assert.Contains(t, body, "github.com/org/myapp")
 	assert.Contains(t, body, "dir")
 	assert.Contains(t, body, "/opt/myapp")
+	assert.Contains(t, body, "<code>_defaults.yaml</code> &rarr; <code>myapp.yaml</code>")
 }
 
 func TestConfigFields(t *testing.T) {
@@ -280,6 +389,153 @@ func TestDashboard_ServiceNameLinks(t *testing.T) {
 	assert.Contains(t, body, `href="/service/myapp"`)
 }
 
+func historyProvider() *mockStateProvider {
+	started := time.Date(2026, 4, 6, 12, 0, 0, 0, time.UTC)
+	return &mockStateProvider{
+		states: map[string]service.ServiceState{
+			"myapp": {Status: "running"},
+		},
+		deploys: map[string][]service.DeployRecord{
+			"myapp": {{
+				ID:        "20260406-120000.000",
+				Trigger:   service.TriggerWebhook,
+				Actor:     "alice",
+				Started:   started,
+				Finished:  started.Add(12 * time.Second),
+				Duration:  12 * time.Second,
+				Result:    "success",
+				SHABefore: "1111111111111111111111111111111111111111",
+				SHAAfter:  "2222222222222222222222222222222222222222",
+				Steps: []deploy.StepResult{
+					{Step: "go build .", Status: "success", Duration: 11 * time.Second},
+				},
+				Output: "$ go build .\n",
+			}},
+		},
+	}
+}
+
+func TestDashboard_DeployHistoryPage(t *testing.T) {
+	d, err := dashboard.New(historyProvider(), os.DirFS("../../templates"))
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/service/myapp/deploys", nil)
+	rr := httptest.NewRecorder()
+	d.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	body := rr.Body.String()
+	assert.Contains(t, body, "webhook by alice")
+	assert.Contains(t, body, "<code>2222222</code>")
+	assert.Contains(t, body, "1111111111111111111111111111111111111111")
+	assert.Contains(t, body, "go build .")
+	assert.Contains(t, body, "12s")
+	assert.Contains(t, body, `href="/api/service/myapp/deploys/20260406-120000.000/log"`)
+}
+
+func TestDashboard_DeployLogAPI(t *testing.T) {
+	d, err := dashboard.New(historyProvider(), os.DirFS("../../templates"))
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/service/myapp/deploys/20260406-120000.000/log", nil)
+	rr := httptest.NewRecorder()
+	d.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "text/plain; charset=utf-8", rr.Header().Get("Content-Type"))
+	assert.Equal(t, "$ go build .\n", rr.Body.String())
+
+	for _, path := range []string{
+		"/api/service/myapp/deploys/20990101-000000.000/log",
+		"/api/service/nope/deploys/20260406-120000.000/log",
+	} {
+		req = httptest.NewRequest(http.MethodGet, path, nil)
+		rr = httptest.NewRecorder()
+		d.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusNotFound, rr.Code, path)
+	}
+}
+
+func TestDashboard_DeployHistoryAPI(t *testing.T) {
+	d, err := dashboard.New(historyProvider(), os.DirFS("../../templates"))
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/service/myapp/deploys", nil)
+	rr := httptest.NewRecorder()
+	d.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var records []service.DeployRecord
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &records))
+	require.Len(t, records, 1)
+	assert.Equal(t, "alice", records[0].Actor)
+	assert.Equal(t, "2222222222222222222222222222222222222222", records[0].SHAAfter)
+
+	req = httptest.NewRequest(http.MethodGet, "/api/service/nope/deploys", nil)
+	rr = httptest.NewRecorder()
+	d.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestDashboard_PlanPage(t *testing.T) {
+	provider := &mockStateProvider{
+		states: map[string]service.ServiceState{
+			"myapp":  {Status: "running"},
+			"broken": {Status: "running"},
+		},
+		plans: map[string]*service.DeployPlan{
+			"myapp": {
+				Service:  "myapp",
+				Upstream: "origin/main",
+				Head:     "1111111111111111111111111111111111111111",
+				Target:   "2222222222222222222222222222222222222222",
+				Commits: []service.PlanCommit{
+					{SHA: "2222222222222222222222222222222222222222", Author: "alice", Subject: "Add widgets"},
+				},
+				Files: []string{"M\twidgets.go"},
+				Dirty: []string{" M config.local"},
+			},
+		},
+	}
+	d, err := dashboard.New(provider, os.DirFS("../../templates"))
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/service/myapp/plan", nil)
+	rr := httptest.NewRecorder()
+	d.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	body := rr.Body.String()
+	assert.Contains(t, body, "1 incoming commit<")
+	assert.Contains(t, body, "<code>2222222</code> Add widgets")
+	assert.Contains(t, body, "widgets.go")
+	assert.Contains(t, body, "config.local")
+
+	req = httptest.NewRequest(http.MethodGet, "/service/broken/plan", nil)
+	rr = httptest.NewRecorder()
+	d.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), "git fetch failed")
+
+	req = httptest.NewRequest(http.MethodGet, "/api/service/myapp/plan", nil)
+	rr = httptest.NewRecorder()
+	d.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var plan service.DeployPlan
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &plan))
+	assert.Equal(t, "origin/main", plan.Upstream)
+	require.Len(t, plan.Commits, 1)
+	assert.Equal(t, "alice", plan.Commits[0].Author)
+
+	req = httptest.NewRequest(http.MethodGet, "/api/service/broken/plan", nil)
+	rr = httptest.NewRecorder()
+	d.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+
+	req = httptest.NewRequest(http.MethodGet, "/service/nope/plan", nil)
+	rr = httptest.NewRecorder()
+	d.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
 // assertAutoReloadToggle verifies that a rendered dashboard page has an
 // auto-reload toggle that is off by default, persists via localStorage, and
 // does not fire location.reload() unconditionally on page load.
@@ -3,50 +3,298 @@ package deploy
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"os"
 	"os/exec"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/shishberg/mezzaops/internal/config"
 )
 
+// defaultBackoff is the wait before a step's first retry when it sets
+// retries but no backoff.
+const defaultBackoff = time.Second
+
+// waitDelay bounds how long a killed step may keep its output pipes open.
+const waitDelay = 5 * time.Second
+
 // Result describes the outcome of running a sequence of deploy steps.
 type Result struct {
-	Status     string // "success" or "failed"
-	Output     string // combined stdout/stderr from all steps
-	FailedStep string // which step failed, empty on success
+	Status     string       // "success" or "failed"
+	Output     string       // combined stdout/stderr from all steps
+	FailedStep string       // label of the step that failed, empty on success
+	Steps      []StepResult // one entry per step that ran or was skipped, in order
+}
+
+// StepResult describes the outcome of a single deploy step.
+type StepResult struct {
+	Step     string        `json:"step"`
+	Status   string        `json:"status"` // "success", "failed" or "skipped"; "running" in progress reports
+	Output   string        `json:"output,omitempty"`
+	Duration time.Duration `json:"duration"`
+	Attempts int           `json:"attempts,omitempty"` // set when the step was retried
 }
 
-// RunSteps executes shell steps sequentially in the given working directory.
-// It stops on the first failure or context cancellation.
-func RunSteps(ctx context.Context, steps []string, workingDir string) (*Result, error) {
-	var output bytes.Buffer
+// Conditions is what steps' when: conditions are checked against.
+type Conditions struct {
+	// Branch is the branch being deployed.
+	Branch string
+
+	// Since is the commit checked out before the deploy. Changed files are
+	// those that differ between it and HEAD when the step is reached, so a
+	// step after `git pull` sees what the pull brought in. If Since is empty
+	// or the diff fails, changed: conditions are treated as met.
+	Since string
+}
+
+// RunSteps executes steps sequentially in the given working directory. If
+// env is non-nil it is used as the steps' environment instead of the current
+// process's. It stops on the first failure not marked continue_on_error, or
+// on context cancellation.
+//
+// If progress is non-nil it is called with Status "running" as each step
+// starts, and with the step's result when it finishes or is skipped.
+func RunSteps(ctx context.Context, steps []config.DeployStep, workingDir string, env []string, cond Conditions, progress func(StepResult)) (*Result, error) {
+	return RunStepsTo(ctx, steps, workingDir, env, cond, progress, nil)
+}
+
+// RunStepsTo is RunSteps, also copying the combined output to log, if it is
+// non-nil, as the steps write it. A write error from log cuts the output of
+// the running step short, so log should swallow its own errors.
+func RunStepsTo(ctx context.Context, steps []config.DeployStep, workingDir string, env []string, cond Conditions, progress func(StepResult), log io.Writer) (*Result, error) {
+	var buf bytes.Buffer
+	var output io.Writer = &buf
+	if log != nil {
+		output = io.MultiWriter(&buf, log)
+	}
+	var results []StepResult
+	report := func(sr StepResult) {
+		if progress != nil {
+			progress(sr)
+		}
+	}
+	failed := func(step config.DeployStep) *Result {
+		return &Result{
+			Status:     "failed",
+			Output:     buf.String(),
+			FailedStep: step.Label(),
+			Steps:      results,
+		}
+	}
 
 	for _, step := range steps {
 		if ctx.Err() != nil {
-			return &Result{
-				Status:     "failed",
-				Output:     output.String(),
-				FailedStep: step,
-			}, nil
+			return failed(step), nil
+		}
+
+		if reason := skipReason(ctx, step.When, workingDir, cond); reason != "" {
+			fmt.Fprintf(output, "# skipped %s: %s\n", step.Label(), reason)
+			sr := StepResult{Step: step.Label(), Status: "skipped", Output: reason}
+			results = append(results, sr)
+			report(sr)
+			continue
 		}
 
-		fmt.Fprintf(&output, "$ %s\n", step)
+		if step.Name != "" {
+			fmt.Fprintf(output, "# %s\n", step.Name)
+		}
+		fmt.Fprintf(output, "$ %s\n", step.Run)
 
-		cmd := exec.CommandContext(ctx, "sh", "-c", step)
-		cmd.Dir = workingDir
-		cmd.Stdout = &output
-		cmd.Stderr = &output
+		var stepOut bytes.Buffer
+		w := io.MultiWriter(output, &stepOut)
 
-		if err := cmd.Run(); err != nil {
-			fmt.Fprintf(&output, "ERROR: %s\n", err)
-			return &Result{
-				Status:     "failed",
-				Output:     output.String(),
-				FailedStep: step,
-			}, nil
+		report(StepResult{Step: step.Label(), Status: "running"})
+		start := time.Now()
+		attempts, err := runStep(ctx, step, workingDir, env, w)
+		sr := StepResult{Step: step.Label(), Status: "success", Duration: time.Since(start)}
+		if attempts > 1 {
+			sr.Attempts = attempts
+		}
+		if err != nil {
+			sr.Status = "failed"
+			if step.ContinueOnError {
+				fmt.Fprintf(w, "continuing: %s has continue_on_error set\n", step.Label())
+			}
+		}
+		sr.Output = stepOut.String()
+		results = append(results, sr)
+		report(sr)
+
+		if err != nil && !step.ContinueOnError {
+			return failed(step), nil
 		}
 	}
 
 	return &Result{
 		Status: "success",
-		Output: output.String(),
+		Output: buf.String(),
+		Steps:  results,
 	}, nil
 }
+
+// runStep runs a step, retrying it as configured, and returns how many
+// attempts were made and the last attempt's error.
+func runStep(ctx context.Context, step config.DeployStep, workingDir string, env []string, w io.Writer) (int, error) {
+	dir := workingDir
+	if step.Dir != "" {
+		dir = step.Dir
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(workingDir, dir)
+		}
+	}
+	if len(step.Env) > 0 {
+		if env == nil {
+			env = os.Environ()
+		}
+		env = slices.Clone(env)
+		keys := make([]string, 0, len(step.Env))
+		for k := range step.Env {
+			keys = append(keys, k)
+		}
+		slices.Sort(keys)
+		for _, k := range keys {
+			env = append(env, k+"="+step.Env[k])
+		}
+	}
+
+	backoff := step.Backoff
+	if backoff <= 0 {
+		backoff = defaultBackoff
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := runCommand(ctx, step, dir, env, w)
+		if err == nil || attempt > step.Retries || ctx.Err() != nil {
+			return attempt, err
+		}
+		fmt.Fprintf(w, "retrying in %s (attempt %d of %d)\n", backoff, attempt+1, step.Retries+1)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return attempt, err
+		}
+		backoff *= 2
+	}
+}
+
+// runCommand runs one attempt of a step in its own process group, so a
+// timeout or cancellation kills everything the step started, not just sh.
+func runCommand(ctx context.Context, step config.DeployStep, dir string, env []string, w io.Writer) error {
+	if step.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, step.Timeout)
+		defer cancel()
+	}
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", step.Run)
+	cmd.Dir = dir
+	cmd.Env = env
+	cmd.Stdout = w
+	cmd.Stderr = w
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	cmd.WaitDelay = waitDelay
+
+	err := cmd.Run()
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			fmt.Fprintf(w, "ERROR: timed out after %s\n", step.Timeout)
+		} else {
+			fmt.Fprintf(w, "ERROR: %s\n", err)
+		}
+	}
+	return err
+}
+
+// skipReason returns why a step's conditions are not met, or "" if it
+// should run.
+func skipReason(ctx context.Context, when *config.StepCondition, dir string, cond Conditions) string {
+	if when == nil {
+		return ""
+	}
+	if when.Branch != "" {
+		if ok, _ := path.Match(when.Branch, cond.Branch); !ok {
+			if cond.Branch == "" {
+				return fmt.Sprintf("branch is unknown, want %s", when.Branch)
+			}
+			return fmt.Sprintf("branch is %s, want %s", cond.Branch, when.Branch)
+		}
+	}
+	if len(when.Changed) > 0 && cond.Since != "" {
+		files, err := changedFiles(ctx, dir, cond.Since)
+		if err == nil && !anyMatch(when.Changed, files) {
+			return "no matching files changed"
+		}
+	}
+	return ""
+}
+
+// changedFiles lists the files that differ between since and HEAD.
+func changedFiles(ctx context.Context, dir, since string) ([]string, error) {
+	cmd := exec.CommandContext(ctx, "git", "diff", "--name-only", since, "HEAD")
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, line := range strings.Split(string(out), "\n") {
+		if line != "" {
+			files = append(files, line)
+		}
+	}
+	return files, nil
+}
+
+// anyMatch reports whether any file matches any pattern, either as a glob
+// or as a directory containing it. A pattern without a slash matches at any
+// depth, like a .gitignore entry, and "**" matches any number of directories.
+func anyMatch(patterns, files []string) bool {
+	for _, pattern := range patterns {
+		pattern = strings.TrimPrefix(strings.TrimSuffix(pattern, "/"), "/")
+		if !strings.Contains(pattern, "/") {
+			pattern = "**/" + pattern
+		}
+		segs := strings.Split(pattern, "/")
+		under := append(segs[:len(segs):len(segs)], "**")
+		for _, file := range files {
+			parts := strings.Split(file, "/")
+			if matchSegments(segs, parts) || matchSegments(under, parts) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchSegments matches slash-separated path segments against pattern
+// segments, each a path.Match glob or "**" for zero or more segments.
+func matchSegments(pattern, parts []string) bool {
+	if len(pattern) == 0 {
+		return len(parts) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(parts); i++ {
+			if matchSegments(pattern[1:], parts[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(parts) == 0 {
+		return false
+	}
+	if ok, _ := path.Match(pattern[0], parts[0]); !ok {
+		return false
+	}
+	return matchSegments(pattern[1:], parts[1:])
+}
@@ -1,22 +1,29 @@
 package deploy_test
 
 import (
+	"bytes"
 	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/shishberg/mezzaops/internal/config"
 	"github.com/shishberg/mezzaops/internal/deploy"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
 func TestRunSteps_AllSucceed(t *testing.T) {
-	steps := []string{
+	steps := config.Steps(
 		"echo step1",
 		"echo step2",
 		"echo step3",
-	}
+	)
 
-	result, err := deploy.RunSteps(context.Background(), steps, t.TempDir())
+	result, err := deploy.RunSteps(context.Background(), steps, t.TempDir(), nil, deploy.Conditions{}, nil)
 	require.NoError(t, err)
 
 	assert.Equal(t, "success", result.Status)
@@ -27,13 +34,13 @@ func TestRunSteps_AllSucceed(t *testing.T) {
 }
 
 func TestRunSteps_FailsOnMiddleStep(t *testing.T) {
-	steps := []string{
+	steps := config.Steps(
 		"echo ok",
 		"exit 1",
 		"echo should-not-run",
-	}
+	)
 
-	result, err := deploy.RunSteps(context.Background(), steps, t.TempDir())
+	result, err := deploy.RunSteps(context.Background(), steps, t.TempDir(), nil, deploy.Conditions{}, nil)
 	require.NoError(t, err)
 
 	assert.Equal(t, "failed", result.Status)
@@ -45,20 +52,20 @@ func TestRunSteps_CancelledContext(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	cancel()
 
-	steps := []string{"echo hello"}
+	steps := config.Steps("echo hello")
 
-	result, err := deploy.RunSteps(ctx, steps, t.TempDir())
+	result, err := deploy.RunSteps(ctx, steps, t.TempDir(), nil, deploy.Conditions{}, nil)
 	require.NoError(t, err)
 	assert.Equal(t, "failed", result.Status)
 }
 
 func TestRunSteps_OutputCapturesStdoutAndStderr(t *testing.T) {
-	steps := []string{
+	steps := config.Steps(
 		"echo stdout-msg",
 		"echo stderr-msg >&2",
-	}
+	)
 
-	result, err := deploy.RunSteps(context.Background(), steps, t.TempDir())
+	result, err := deploy.RunSteps(context.Background(), steps, t.TempDir(), nil, deploy.Conditions{}, nil)
 	require.NoError(t, err)
 
 	assert.Equal(t, "success", result.Status)
@@ -66,8 +73,236 @@ func TestRunSteps_OutputCapturesStdoutAndStderr(t *testing.T) {
 	assert.Contains(t, result.Output, "stderr-msg")
 }
 
+func TestRunStepsTo_StreamsOutput(t *testing.T) {
+	var log bytes.Buffer
+	steps := []config.DeployStep{{Name: "greet", Run: "echo hello"}, {Run: "echo oops >&2; exit 1"}}
+
+	result, err := deploy.RunStepsTo(context.Background(), steps, t.TempDir(), nil, deploy.Conditions{}, nil, &log)
+	require.NoError(t, err)
+
+	assert.Equal(t, "failed", result.Status)
+	assert.Equal(t, result.Output, log.String())
+	assert.Contains(t, log.String(), "# greet\n$ echo hello\nhello\n")
+	assert.Contains(t, log.String(), "oops")
+}
+
 func TestRunSteps_EmptySteps(t *testing.T) {
-	result, err := deploy.RunSteps(context.Background(), nil, t.TempDir())
+	result, err := deploy.RunSteps(context.Background(), nil, t.TempDir(), nil, deploy.Conditions{}, nil)
 	require.NoError(t, err)
 	assert.Equal(t, "success", result.Status)
 }
+
+func TestRunSteps_Env(t *testing.T) {
+	env := append(os.Environ(), "MEZZAOPS_TEST_VAR=hello")
+	result, err := deploy.RunSteps(context.Background(), config.Steps("echo $MEZZAOPS_TEST_VAR"), t.TempDir(), env, deploy.Conditions{}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "success", result.Status)
+	assert.Contains(t, result.Output, "hello")
+}
+
+func TestRunSteps_StepResults(t *testing.T) {
+	steps := config.Steps("echo one", "echo two; exit 3", "echo three")
+
+	result, err := deploy.RunSteps(context.Background(), steps, t.TempDir(), nil, deploy.Conditions{}, nil)
+	require.NoError(t, err)
+
+	require.Len(t, result.Steps, 2)
+	assert.Equal(t, "echo one", result.Steps[0].Step)
+	assert.Equal(t, "success", result.Steps[0].Status)
+	assert.Equal(t, "one\n", result.Steps[0].Output)
+	assert.Equal(t, "failed", result.Steps[1].Status)
+	assert.Contains(t, result.Steps[1].Output, "two")
+	assert.Contains(t, result.Steps[1].Output, "exit status 3")
+	assert.NotContains(t, result.Steps[1].Output, "one")
+}
+
+func TestRunSteps_Timeout(t *testing.T) {
+	// The background sleep holds the output pipe open; the whole process
+	// group must be killed for the step to return.
+	steps := []config.DeployStep{{Name: "hang", Run: "sleep 30 & sleep 30", Timeout: 200 * time.Millisecond}}
+
+	start := time.Now()
+	result, err := deploy.RunSteps(context.Background(), steps, t.TempDir(), nil, deploy.Conditions{}, nil)
+	require.NoError(t, err)
+
+	assert.Less(t, time.Since(start), 3*time.Second)
+	assert.Equal(t, "failed", result.Status)
+	assert.Equal(t, "hang", result.FailedStep)
+	assert.Contains(t, result.Output, "timed out after 200ms")
+}
+
+func TestRunSteps_Retries(t *testing.T) {
+	dir := t.TempDir()
+	// Fails until the third attempt.
+	steps := []config.DeployStep{{
+		Run:     "echo x >> tries; [ $(wc -l < tries) -ge 3 ]",
+		Retries: 3,
+		Backoff: 10 * time.Millisecond,
+	}}
+
+	result, err := deploy.RunSteps(context.Background(), steps, dir, nil, deploy.Conditions{}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "success", result.Status)
+	require.Len(t, result.Steps, 1)
+	assert.Equal(t, 3, result.Steps[0].Attempts)
+	assert.Contains(t, result.Output, "retrying in 20ms (attempt 3 of 4)")
+}
+
+func TestRunSteps_RetriesExhausted(t *testing.T) {
+	steps := []config.DeployStep{{Run: "exit 1", Retries: 1, Backoff: time.Millisecond}}
+
+	result, err := deploy.RunSteps(context.Background(), steps, t.TempDir(), nil, deploy.Conditions{}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "failed", result.Status)
+	assert.Equal(t, 2, result.Steps[0].Attempts)
+}
+
+func TestRunSteps_ContinueOnError(t *testing.T) {
+	steps := []config.DeployStep{
+		{Name: "lint", Run: "exit 1", ContinueOnError: true},
+		{Run: "echo after"},
+	}
+
+	result, err := deploy.RunSteps(context.Background(), steps, t.TempDir(), nil, deploy.Conditions{}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "success", result.Status)
+	assert.Empty(t, result.FailedStep)
+	require.Len(t, result.Steps, 2)
+	assert.Equal(t, "failed", result.Steps[0].Status)
+	assert.Equal(t, "after\n", result.Steps[1].Output)
+}
+
+func TestRunSteps_StepEnvAndDir(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "web"), 0755))
+	steps := []config.DeployStep{{
+		Run: "echo $MEZZAOPS_STEP_VAR; basename $(pwd)",
+		Env: map[string]string{"MEZZAOPS_STEP_VAR": "step"},
+		Dir: "web",
+	}}
+
+	result, err := deploy.RunSteps(context.Background(), steps, dir, nil, deploy.Conditions{}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "success", result.Status)
+	assert.Equal(t, "step\nweb\n", result.Steps[0].Output)
+}
+
+func TestRunSteps_WhenBranch(t *testing.T) {
+	steps := []config.DeployStep{
+		{Name: "migrate", Run: "echo migrating", When: &config.StepCondition{Branch: "main"}},
+		{Name: "release", Run: "echo releasing", When: &config.StepCondition{Branch: "release/*"}},
+	}
+
+	result, err := deploy.RunSteps(context.Background(), steps, t.TempDir(), nil, deploy.Conditions{Branch: "release/1.2"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "success", result.Status)
+	require.Len(t, result.Steps, 2)
+	assert.Equal(t, "skipped", result.Steps[0].Status)
+	assert.Equal(t, "branch is release/1.2, want main", result.Steps[0].Output)
+	assert.Equal(t, "success", result.Steps[1].Status)
+	assert.NotContains(t, result.Output, "migrating")
+}
+
+func TestRunSteps_WhenChanged(t *testing.T) {
+	dir := t.TempDir()
+	git := func(args ...string) string {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=t", "-c", "user.email=t@example.com"}, args...)...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+		return strings.TrimSpace(string(out))
+	}
+	git("init", "-q")
+	git("commit", "-q", "--allow-empty", "-m", "one")
+	before := git("rev-parse", "HEAD")
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "migrations"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "migrations", "001.sql"), nil, 0644))
+	git("add", ".")
+	git("commit", "-q", "-m", "two")
+
+	steps := []config.DeployStep{
+		{Name: "migrate", Run: "echo migrating", When: &config.StepCondition{Changed: []string{"migrations"}}},
+		{Name: "deps", Run: "echo deps", When: &config.StepCondition{Changed: []string{"go.mod", "*.sum"}}},
+	}
+
+	result, err := deploy.RunSteps(context.Background(), steps, dir, nil, deploy.Conditions{Since: before}, nil)
+	require.NoError(t, err)
+	require.Len(t, result.Steps, 2)
+	assert.Equal(t, "success", result.Steps[0].Status)
+	assert.Equal(t, "skipped", result.Steps[1].Status)
+}
+
+func TestRunSteps_WhenChangedNested(t *testing.T) {
+	dir := t.TempDir()
+	git := func(args ...string) string {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=t", "-c", "user.email=t@example.com"}, args...)...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+		return strings.TrimSpace(string(out))
+	}
+	git("init", "-q")
+	git("commit", "-q", "--allow-empty", "-m", "one")
+	before := git("rev-parse", "HEAD")
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "cmd", "x"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "cmd", "x", "main.go"), nil, 0644))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "db", "migrations"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "db", "migrations", "001.sql"), nil, 0644))
+	git("add", ".")
+	git("commit", "-q", "-m", "two")
+
+	tests := []struct {
+		pattern string
+		want    string
+	}{
+		{"*.go", "success"},
+		{"main.go", "success"},
+		{"cmd/**/*.go", "success"},
+		{"**/*.sql", "success"},
+		{"**/migrations", "success"},
+		{"migrations/", "success"},
+		{"db", "success"},
+		{"cmd/x", "success"},
+		{"cmd/*.go", "skipped"},
+		{"x/main.go", "skipped"},
+		{"*.md", "skipped"},
+		{"web/**", "skipped"},
+	}
+	for _, tt := range tests {
+		steps := []config.DeployStep{
+			{Run: "true", When: &config.StepCondition{Changed: []string{tt.pattern}}},
+		}
+		result, err := deploy.RunSteps(context.Background(), steps, dir, nil, deploy.Conditions{Since: before}, nil)
+		require.NoError(t, err)
+		require.Len(t, result.Steps, 1)
+		assert.Equal(t, tt.want, result.Steps[0].Status, tt.pattern)
+	}
+}
+
+func TestRunSteps_Progress(t *testing.T) {
+	steps := []config.DeployStep{
+		{Name: "pull", Run: "echo pulled"},
+		{Run: "echo skip", When: &config.StepCondition{Branch: "main"}},
+		{Run: "exit 1"},
+	}
+
+	var events []deploy.StepResult
+	result, err := deploy.RunSteps(context.Background(), steps, t.TempDir(), nil, deploy.Conditions{}, func(sr deploy.StepResult) {
+		events = append(events, sr)
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "failed", result.Status)
+
+	var got []string
+	for _, ev := range events {
+		got = append(got, ev.Step+" "+ev.Status)
+	}
+	assert.Equal(t, []string{
+		"pull running",
+		"pull success",
+		"echo skip skipped",
+		"exit 1 running",
+		"exit 1 failed",
+	}, got)
+	assert.Equal(t, "pulled\n", events[1].Output)
+}
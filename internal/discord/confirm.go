@@ -0,0 +1,190 @@
+package discord
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/shishberg/mezzaops/internal/service"
+)
+
+// ConfirmHandler approves or denies a push to a service with
+// require_confirmation or approvals, which a webhook left awaiting approval.
+type ConfirmHandler interface {
+	Confirm(service, actor string) (service.PendingApproval, error)
+	Deny(service, actor string) error
+	PendingApprovals() []service.PendingApproval
+}
+
+// Custom ID prefixes of the buttons on a confirmation prompt; the service
+// name follows.
+const (
+	approveButton = "approve:"
+	denyButton    = "deny:"
+)
+
+// promptNoteRunes is the room left in a confirmation prompt for the note
+// closePrompt appends, such as who approved the push.
+const promptNoteRunes = 200
+
+// confirmPrompt is a confirmation prompt whose buttons are still live.
+type confirmPrompt struct {
+	id      string // message ID
+	content string
+}
+
+// SetConfirmHandler sets the handler for confirm and deny, from commands and
+// from the buttons on confirmation prompts.
+func (b *Bot) SetConfirmHandler(h ConfirmHandler) {
+	b.confirm = h
+}
+
+// PostConfirmation posts a confirmation prompt for a push to svc, with
+// Approve and Deny buttons and the deploy plan, replacing any earlier prompt
+// for svc. The buttons are disabled when ClosePrompt is called, or at
+// expires.
+func (b *Bot) PostConfirmation(svc, headline, plan string, expires time.Time) {
+	b.ClosePrompt(svc, "Superseded by a newer push.")
+
+	const format = "%s\n```\n%s\n```"
+	budget := discordMessageRuneLimit - promptNoteRunes - len([]rune(fmt.Sprintf(format, headline, "")))
+	content := fmt.Sprintf(format, headline, service.TruncateHeadToRuneBudget(strings.TrimRight(plan, "\n"), budget))
+	id := b.sendPrompt(&discordgo.MessageSend{
+		Content:    content,
+		Components: promptButtons(svc, false),
+	})
+	if id == "" {
+		return
+	}
+
+	b.mu.Lock()
+	if b.prompts == nil {
+		b.prompts = make(map[string]confirmPrompt)
+	}
+	b.prompts[svc] = confirmPrompt{id: id, content: content}
+	b.mu.Unlock()
+
+	time.AfterFunc(time.Until(expires), func() {
+		b.closePrompt(svc, id, "Expired.")
+	})
+}
+
+// ClosePrompt disables the buttons on svc's confirmation prompt, if it has
+// one, and appends note to it, e.g. who approved the push.
+func (b *Bot) ClosePrompt(svc, note string) {
+	b.closePrompt(svc, "", note)
+}
+
+// closePrompt is ClosePrompt, but only if svc's prompt is the message id,
+// unless id is "".
+func (b *Bot) closePrompt(svc, id, note string) {
+	b.mu.Lock()
+	p, ok := b.prompts[svc]
+	if !ok || (id != "" && p.id != id) {
+		b.mu.Unlock()
+		return
+	}
+	delete(b.prompts, svc)
+	b.mu.Unlock()
+
+	// The note must fit, or Discord rejects the edit and the buttons stay
+	// live.
+	room := discordMessageRuneLimit - len([]rune(p.content)) - 1
+	content := p.content + "\n" + service.TruncateHeadToRuneBudget(note, room)
+	b.editPrompt(&discordgo.MessageEdit{
+		ID:         p.id,
+		Channel:    b.cfg.ChannelID,
+		Content:    &content,
+		Components: promptButtons(svc, true),
+	})
+}
+
+// promptButtons returns the Approve and Deny buttons for svc's prompt.
+func promptButtons(svc string, disabled bool) []discordgo.MessageComponent {
+	return []discordgo.MessageComponent{
+		discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+			discordgo.Button{Label: "Approve", Style: discordgo.SuccessButton, CustomID: approveButton + svc, Disabled: disabled},
+			discordgo.Button{Label: "Deny", Style: discordgo.DangerButton, CustomID: denyButton + svc, Disabled: disabled},
+		}},
+	}
+}
+
+// routeComponent handles a click on a confirmation prompt's button.
+func (b *Bot) routeComponent(i *discordgo.InteractionCreate) string {
+	customID := i.MessageComponentData().CustomID
+	if svc, ok := strings.CutPrefix(customID, approveButton); ok {
+		return b.handleConfirm(svc, interactionUser(i))
+	}
+	if svc, ok := strings.CutPrefix(customID, denyButton); ok {
+		return b.handleDeny(svc, interactionUser(i))
+	}
+	return "unknown button"
+}
+
+// handleConfirm records an approval of a push awaiting approval.
+func (b *Bot) handleConfirm(svc, user string) string {
+	if b.confirm == nil {
+		return "Confirm handler not configured"
+	}
+	p, err := b.confirm.Confirm(svc, user)
+	if err != nil {
+		return fmt.Sprintf("Confirm error: %s", err.Error())
+	}
+	if !p.Approved() {
+		return fmt.Sprintf("%s approved deploy for %s (%d of %d approvals)", user, svc, len(p.ApprovedBy), p.Required)
+	}
+	return fmt.Sprintf("Confirmed deploy for %s", svc)
+}
+
+// handleDeny drops a push awaiting approval.
+func (b *Bot) handleDeny(svc, user string) string {
+	if b.confirm == nil {
+		return "Confirm handler not configured"
+	}
+	if err := b.confirm.Deny(svc, user); err != nil {
+		return fmt.Sprintf("Deny error: %s", err.Error())
+	}
+	return fmt.Sprintf("%s denied deploy for %s", user, svc)
+}
+
+// handlePending lists pushes awaiting approval.
+func (b *Bot) handlePending() string {
+	if b.confirm == nil {
+		return "Confirm handler not configured"
+	}
+	return "```\n" + service.FormatPending(b.confirm.PendingApprovals()) + "```"
+}
+
+// sendPrompt posts a message with components, returning its ID, or "" if
+// it wasn't posted.
+func (b *Bot) sendPrompt(m *discordgo.MessageSend) string {
+	if b.sendPromptFunc != nil {
+		return b.sendPromptFunc(m)
+	}
+	if b.session == nil || b.cfg.ChannelID == "" {
+		log.Println(m.Content)
+		return ""
+	}
+	msg, err := b.session.ChannelMessageSendComplex(b.cfg.ChannelID, m)
+	if err != nil {
+		log.Printf("discord send error: %v", err)
+		return ""
+	}
+	return msg.ID
+}
+
+// editPrompt edits a message posted by sendPrompt.
+func (b *Bot) editPrompt(m *discordgo.MessageEdit) {
+	if b.editPromptFunc != nil {
+		b.editPromptFunc(m)
+		return
+	}
+	if b.session == nil || b.cfg.ChannelID == "" {
+		return
+	}
+	if _, err := b.session.ChannelMessageEditComplex(m); err != nil {
+		log.Printf("discord edit error: %v", err)
+	}
+}
@@ -0,0 +1,224 @@
+package discord
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/shishberg/mezzaops/internal/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockConfirmHandler struct {
+	confirmService string
+	denyService    string
+	lastActor      string
+	approval       service.PendingApproval
+	err            error
+	pending        []service.PendingApproval
+}
+
+func (m *mockConfirmHandler) Confirm(svc, actor string) (service.PendingApproval, error) {
+	m.confirmService, m.lastActor = svc, actor
+	return m.approval, m.err
+}
+
+func (m *mockConfirmHandler) Deny(svc, actor string) error {
+	m.denyService, m.lastActor = svc, actor
+	return m.err
+}
+
+func (m *mockConfirmHandler) PendingApprovals() []service.PendingApproval {
+	return m.pending
+}
+
+func fakeComponentInteraction(customID, user string) *discordgo.InteractionCreate {
+	return &discordgo.InteractionCreate{
+		Interaction: &discordgo.Interaction{
+			Type:   discordgo.InteractionMessageComponent,
+			Data:   discordgo.MessageComponentInteractionData{CustomID: customID},
+			Member: &discordgo.Member{User: &discordgo.User{Username: user}},
+		},
+	}
+}
+
+func TestHandleInteraction_Confirm(t *testing.T) {
+	h := &mockConfirmHandler{approval: service.PendingApproval{Service: "api", Required: 2, ApprovedBy: []string{"alice"}}}
+	b := &Bot{manager: &mockManager{}}
+	b.SetConfirmHandler(h)
+
+	ic := fakeServiceInteraction("confirm", "api")
+	ic.Member = &discordgo.Member{User: &discordgo.User{Username: "alice"}}
+	resp := b.routeInteraction(ic)
+	assert.Equal(t, "api", h.confirmService)
+	assert.Equal(t, "alice", h.lastActor)
+	assert.Equal(t, "alice approved deploy for api (1 of 2 approvals)", resp)
+
+	h.approval.ApprovedBy = []string{"alice", "bob"}
+	assert.Equal(t, "Confirmed deploy for api", b.routeInteraction(ic))
+
+	h.err = fmt.Errorf("no deploy of api awaiting approval (or it expired)")
+	assert.Equal(t, "Confirm error: no deploy of api awaiting approval (or it expired)", b.routeInteraction(ic))
+}
+
+func TestHandleInteraction_Deny(t *testing.T) {
+	h := &mockConfirmHandler{}
+	b := &Bot{manager: &mockManager{}}
+	b.SetConfirmHandler(h)
+
+	ic := fakeServiceInteraction("deny", "api")
+	ic.Member = &discordgo.Member{User: &discordgo.User{Username: "alice"}}
+	assert.Equal(t, "alice denied deploy for api", b.routeInteraction(ic))
+	assert.Equal(t, "api", h.denyService)
+
+	h.err = fmt.Errorf("alice is not an approver for api")
+	assert.Equal(t, "Deny error: alice is not an approver for api", b.routeInteraction(ic))
+}
+
+func TestHandleInteraction_Pending(t *testing.T) {
+	b := &Bot{manager: &mockManager{}}
+	assert.Equal(t, "Confirm handler not configured", b.routeInteraction(fakeSubcommandInteraction("pending")))
+
+	b.SetConfirmHandler(&mockConfirmHandler{pending: []service.PendingApproval{
+		{Service: "api", Commit: "abc1234def", Pusher: "bob", Since: time.Now(), Required: 1},
+	}})
+	resp := b.routeInteraction(fakeSubcommandInteraction("pending"))
+	assert.Contains(t, resp, "api: abc1234 pushed by bob, 0 of 1 approvals")
+}
+
+func TestRouteComponent(t *testing.T) {
+	h := &mockConfirmHandler{approval: service.PendingApproval{Service: "api", Required: 1, ApprovedBy: []string{"bob"}}}
+	b := &Bot{manager: &mockManager{}}
+	b.SetConfirmHandler(h)
+
+	assert.Equal(t, "Confirmed deploy for api", b.routeComponent(fakeComponentInteraction("approve:api", "bob")))
+	assert.Equal(t, "api", h.confirmService)
+	assert.Equal(t, "bob", h.lastActor)
+
+	assert.Equal(t, "carol denied deploy for web", b.routeComponent(fakeComponentInteraction("deny:web", "carol")))
+	assert.Equal(t, "web", h.denyService)
+
+	assert.Equal(t, "unknown button", b.routeComponent(fakeComponentInteraction("other", "bob")))
+}
+
+// promptRecorder records the prompts a Bot sends and its edits to them.
+type promptRecorder struct {
+	mu    sync.Mutex
+	sent  []*discordgo.MessageSend
+	edits []*discordgo.MessageEdit
+}
+
+func (r *promptRecorder) attach(b *Bot) {
+	b.sendPromptFunc = func(m *discordgo.MessageSend) string {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.sent = append(r.sent, m)
+		return fmt.Sprintf("msg%d", len(r.sent))
+	}
+	b.editPromptFunc = func(m *discordgo.MessageEdit) {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.edits = append(r.edits, m)
+	}
+}
+
+func (r *promptRecorder) editCount() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.edits)
+}
+
+func buttons(t *testing.T, components []discordgo.MessageComponent) []discordgo.Button {
+	t.Helper()
+	require.Len(t, components, 1)
+	row, ok := components[0].(discordgo.ActionsRow)
+	require.True(t, ok)
+	var out []discordgo.Button
+	for _, c := range row.Components {
+		btn, ok := c.(discordgo.Button)
+		require.True(t, ok)
+		out = append(out, btn)
+	}
+	return out
+}
+
+func TestPostConfirmation(t *testing.T) {
+	b := &Bot{manager: &mockManager{}}
+	var r promptRecorder
+	r.attach(b)
+
+	b.PostConfirmation("api", "Deploy queued for **api**.", "2 new commits\n", time.Now().Add(time.Hour))
+	require.Len(t, r.sent, 1)
+	assert.Equal(t, "Deploy queued for **api**.\n```\n2 new commits\n```", r.sent[0].Content)
+	btns := buttons(t, r.sent[0].Components)
+	require.Len(t, btns, 2)
+	assert.Equal(t, "approve:api", btns[0].CustomID)
+	assert.Equal(t, "deny:api", btns[1].CustomID)
+	assert.False(t, btns[0].Disabled)
+
+	b.ClosePrompt("api", "Approved by alice.")
+	require.Len(t, r.edits, 1)
+	assert.Equal(t, "msg1", r.edits[0].ID)
+	assert.Equal(t, "Deploy queued for **api**.\n```\n2 new commits\n```\nApproved by alice.", *r.edits[0].Content)
+	for _, btn := range buttons(t, r.edits[0].Components) {
+		assert.True(t, btn.Disabled, "button %q should be disabled", btn.Label)
+	}
+
+	// Closing again does nothing: the prompt is gone.
+	b.ClosePrompt("api", "Denied by bob.")
+	assert.Len(t, r.edits, 1)
+}
+
+func TestPostConfirmation_Supersedes(t *testing.T) {
+	b := &Bot{manager: &mockManager{}}
+	var r promptRecorder
+	r.attach(b)
+
+	b.PostConfirmation("api", "first", "", time.Now().Add(time.Hour))
+	b.PostConfirmation("api", "second", "", time.Now().Add(time.Hour))
+	require.Len(t, r.sent, 2)
+	require.Len(t, r.edits, 1)
+	assert.Equal(t, "msg1", r.edits[0].ID)
+	assert.Contains(t, *r.edits[0].Content, "Superseded by a newer push.")
+}
+
+func TestPostConfirmation_Expires(t *testing.T) {
+	b := &Bot{manager: &mockManager{}}
+	var r promptRecorder
+	r.attach(b)
+
+	b.PostConfirmation("api", "Deploy queued for **api**.", "", time.Now().Add(10*time.Millisecond))
+	require.Eventually(t, func() bool { return r.editCount() == 1 }, time.Second, 5*time.Millisecond)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	assert.Contains(t, *r.edits[0].Content, "Expired.")
+}
+
+func TestPostConfirmation_TruncatesPlan(t *testing.T) {
+	b := &Bot{manager: &mockManager{}}
+	var r promptRecorder
+	r.attach(b)
+
+	plan := ""
+	for i := range 500 {
+		plan += fmt.Sprintf("commit %d\n", i)
+	}
+	b.PostConfirmation("api", "Deploy queued for **api**.", plan, time.Now().Add(time.Hour))
+	require.Len(t, r.sent, 1)
+	content := r.sent[0].Content
+	assert.LessOrEqual(t, len([]rune(content)), discordMessageRuneLimit)
+	// The plan's start is kept; its end is cut.
+	assert.Contains(t, content, "commit 0\ncommit 1\n")
+	assert.NotContains(t, content, "commit 499")
+	assert.Contains(t, content, "... (truncated)")
+
+	// Closing it still fits, even with a long list of approvers.
+	b.ClosePrompt("api", "Approved by "+strings.Repeat("someone, ", 50)+"alice.")
+	require.Len(t, r.edits, 1)
+	assert.LessOrEqual(t, len([]rune(*r.edits[0].Content)), discordMessageRuneLimit)
+	assert.Contains(t, *r.edits[0].Content, "Approved by someone")
+}
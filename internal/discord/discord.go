@@ -2,13 +2,16 @@ package discord
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"slices"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/bwmarrin/discordgo"
+	"github.com/shishberg/mezzaops/internal/service"
 )
 
 // Config holds Discord bot configuration.
@@ -22,12 +25,21 @@ type Config struct {
 // Uses interface segregation — only the methods Discord actually calls.
 type ServiceManager interface {
 	Do(name, op string) string
-	RequestDeploy(name string) error
+	RequestDeploy(name string, req service.DeployRequest) error
+	RequestRollback(name, target string, req service.DeployRequest) (string, error)
+	CancelDeploy(name, actor string) error
+	Freeze(target string, d time.Duration, reason, actor string) (service.Freeze, error)
+	Unfreeze(target, actor string) error
+	Resume(name, actor string) error
+	ScheduleDeploy(name string, at time.Time, req service.DeployRequest) (service.ScheduledDeploy, error)
+	ScheduledDeploys() []service.ScheduledDeploy
+	Unschedule(id, actor string) (service.ScheduledDeploy, error)
 	StartAll()
 	StopAll()
 	Reload() error
 	ServiceNames() []string
 	CountRunning() (int, int)
+	DeployQueue() service.DeployQueue
 	SetOnChange(fn func(name, event string))
 }
 
@@ -35,10 +47,17 @@ type ServiceManager interface {
 type Bot struct {
 	cfg     Config
 	manager ServiceManager
+	confirm ConfirmHandler // may be nil
 	session *discordgo.Session
 
 	mu       sync.Mutex
 	commands []*discordgo.ApplicationCommand
+	prompts  map[string]confirmPrompt // live confirmation prompts, by service
+
+	// sendPromptFunc and editPromptFunc override posting and editing
+	// confirmation prompts in tests. When nil, session is used.
+	sendPromptFunc func(*discordgo.MessageSend) string
+	editPromptFunc func(*discordgo.MessageEdit)
 }
 
 // New creates a Discord bot. Does not connect yet — call Run() for that.
@@ -55,13 +74,24 @@ func New(cfg Config, manager ServiceManager) *Bot {
 func (b *Bot) Notifier() *Notifier {
 	return &Notifier{
 		channelID: b.cfg.ChannelID,
-		sendFunc: func(msg string) {
+		sendFunc: func(msg string) string {
 			if b.session == nil || b.cfg.ChannelID == "" {
 				log.Println(msg)
-				return
+				return ""
 			}
-			if _, err := b.session.ChannelMessageSend(b.cfg.ChannelID, msg); err != nil {
+			m, err := b.session.ChannelMessageSend(b.cfg.ChannelID, msg)
+			if err != nil {
 				log.Printf("discord send error: %v", err)
+				return ""
+			}
+			return m.ID
+		},
+		editFunc: func(id, msg string) {
+			if b.session == nil || b.cfg.ChannelID == "" {
+				return
+			}
+			if _, err := b.session.ChannelMessageEdit(b.cfg.ChannelID, id, msg); err != nil {
+				log.Printf("discord edit error: %v", err)
 			}
 		},
 	}
@@ -148,10 +178,41 @@ func (b *Bot) Run(ctx context.Context) error {
 
 	// Handle interactions.
 	b.session.AddHandler(func(s *discordgo.Session, i *discordgo.InteractionCreate) {
-		if i.ApplicationCommandData().Name != "ops" {
+		var resp string
+		switch i.Type {
+		case discordgo.InteractionApplicationCommand:
+			if i.ApplicationCommandData().Name != "ops" {
+				return
+			}
+			if slowCommand(i) {
+				// Discord wants an answer within 3 seconds, so say one is
+				// coming and fill it in when it's ready.
+				_ = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+					Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+				})
+				resp = b.routeInteraction(i)
+				if _, err := s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{Content: &resp}); err != nil {
+					log.Printf("discord edit response error: %v", err)
+				}
+				return
+			}
+			resp = b.routeInteraction(i)
+		case discordgo.InteractionApplicationCommandAutocomplete:
+			if i.ApplicationCommandData().Name != "ops" {
+				return
+			}
+			_ = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+				Type: discordgo.InteractionApplicationCommandAutocompleteResult,
+				Data: &discordgo.InteractionResponseData{
+					Choices: b.autocomplete(i),
+				},
+			})
+			return
+		case discordgo.InteractionMessageComponent:
+			resp = b.routeComponent(i)
+		default:
 			return
 		}
-		resp := b.routeInteraction(i)
 		_ = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
 			Type: discordgo.InteractionResponseChannelMessageWithSource,
 			Data: &discordgo.InteractionResponseData{
@@ -186,92 +247,369 @@ func (b *Bot) rebuildCommands() {
 // routeInteraction inspects the interaction data and calls the appropriate
 // manager method. Returns the response string.
 func (b *Bot) routeInteraction(i *discordgo.InteractionCreate) string {
-	var opOpt, taskOpt *discordgo.ApplicationCommandInteractionDataOption
+	var taskOpt *discordgo.ApplicationCommandInteractionDataOption
 	for _, opt := range i.ApplicationCommandData().Options {
-		if opt.Type == discordgo.ApplicationCommandOptionSubCommandGroup {
-			opOpt = opt
-			break
-		}
-		if opt.Type == discordgo.ApplicationCommandOptionSubCommand {
-			switch opt.Name {
-			case "reload":
-				err := b.manager.Reload()
-				// Rebuild and re-register commands after reload.
-				b.rebuildCommands()
-				if b.session != nil {
-					b.mu.Lock()
-					cmds := b.commands
-					b.mu.Unlock()
-					_, _ = b.session.ApplicationCommandBulkOverwrite(b.session.State.User.ID, b.cfg.GuildID, cmds)
-				}
-				if err != nil {
-					return "Config reload error: " + err.Error()
-				}
-				return "Config reloaded"
-			case "start-all":
-				b.manager.StartAll()
-				return "all tasks starting"
-			case "stop-all":
-				b.manager.StopAll()
-				return "all tasks stopping"
-			}
-		}
-	}
-	if opOpt == nil {
-		return "operation required"
-	}
-	for _, opt := range opOpt.Options {
 		if opt.Type == discordgo.ApplicationCommandOptionSubCommand {
 			taskOpt = opt
 			break
 		}
 	}
 	if taskOpt == nil {
-		return "task required"
+		return "operation required"
+	}
+
+	switch taskOpt.Name {
+	case "reload":
+		err := b.manager.Reload()
+		// Rebuild and re-register commands after reload.
+		b.rebuildCommands()
+		if b.session != nil {
+			b.mu.Lock()
+			cmds := b.commands
+			b.mu.Unlock()
+			_, _ = b.session.ApplicationCommandBulkOverwrite(b.session.State.User.ID, b.cfg.GuildID, cmds)
+		}
+		if err != nil {
+			return "Config reload error: " + err.Error()
+		}
+		return "Config reloaded"
+	case "start-all":
+		b.manager.StartAll()
+		return "all tasks starting"
+	case "stop-all":
+		b.manager.StopAll()
+		return "all tasks stopping"
+	case "queue":
+		return "```\n" + service.FormatQueue(b.manager.DeployQueue()) + "```"
+	case "pending":
+		return b.handlePending()
+	case "scheduled":
+		return "```\n" + service.FormatSchedule(b.manager.ScheduledDeploys()) + "```"
+	case "unschedule":
+		sd, err := b.manager.Unschedule(stringOption(taskOpt, "id"), interactionUser(i))
+		if err != nil {
+			return fmt.Sprintf("Unschedule error: %s", err.Error())
+		}
+		return fmt.Sprintf("Cancelled scheduled deploy #%s of %s", sd.ID, sd.Service)
 	}
 
-	svcName := taskOpt.Name
-	opName := opOpt.Name
+	svcName := stringOption(taskOpt, "service")
+	if svcName == "" {
+		return "service required"
+	}
+	opName := taskOpt.Name
 
 	// deploy is special — it uses RequestDeploy instead of Do.
 	if opName == "deploy" {
-		if err := b.manager.RequestDeploy(svcName); err != nil {
+		ref := stringOption(taskOpt, "ref")
+		req := service.DeployRequest{Trigger: service.TriggerChat, Actor: interactionUser(i), Ref: ref,
+			Force: boolOption(taskOpt, "force")}
+		var when []string
+		if s := stringOption(taskOpt, "at"); s != "" {
+			when = append([]string{"at"}, strings.Fields(s)...)
+		} else if s := stringOption(taskOpt, "in"); s != "" {
+			when = []string{"in", s}
+		}
+		at, _, err := service.ParseSchedule(when, time.Now())
+		if err != nil {
 			return fmt.Sprintf("Deploy error: %s", err.Error())
 		}
+		if !at.IsZero() {
+			sd, err := b.manager.ScheduleDeploy(svcName, at, req)
+			if err != nil {
+				return fmt.Sprintf("Schedule error: %s", err.Error())
+			}
+			return fmt.Sprintf("Deploy #%s of %s scheduled for %s", sd.ID, svcName, sd.When())
+		}
+		if err := b.manager.RequestDeploy(svcName, req); err != nil {
+			var already *service.AlreadyDeployedError
+			if errors.As(err, &already) {
+				return fmt.Sprintf("%s is already at `%s`. Set `force` to deploy it again.", svcName, service.ShortSHA(already.Commit))
+			}
+			return fmt.Sprintf("Deploy error: %s", err.Error())
+		}
+		if ref != "" {
+			return fmt.Sprintf("Deploy requested for %s at `%s`", svcName, ref)
+		}
 		return fmt.Sprintf("Deploy requested for %s", svcName)
 	}
 
+	if opName == "rollback" {
+		target := stringOption(taskOpt, "target")
+		req := service.DeployRequest{Trigger: service.TriggerChat, Actor: interactionUser(i)}
+		sha, err := b.manager.RequestRollback(svcName, target, req)
+		if err != nil {
+			return fmt.Sprintf("Rollback error: %s", err.Error())
+		}
+		return fmt.Sprintf("Rollback of %s to `%s` requested", svcName, service.ShortSHA(sha))
+	}
+
+	if opName == "cancel" {
+		if err := b.manager.CancelDeploy(svcName, interactionUser(i)); err != nil {
+			return fmt.Sprintf("Cancel error: %s", err.Error())
+		}
+		return fmt.Sprintf("Cancelling deploy of %s", svcName)
+	}
+
+	if opName == "confirm" {
+		return b.handleConfirm(svcName, interactionUser(i))
+	}
+
+	if opName == "deny" {
+		return b.handleDeny(svcName, interactionUser(i))
+	}
+
+	if opName == "resume" {
+		if err := b.manager.Resume(svcName, interactionUser(i)); err != nil {
+			return fmt.Sprintf("Resume error: %s", err.Error())
+		}
+		return fmt.Sprintf("Resumed auto-deploy of %s", svcName)
+	}
+
+	if opName == "freeze" {
+		var d time.Duration
+		if s := stringOption(taskOpt, "duration"); s != "" {
+			var ok bool
+			if d, ok = service.ParseFreezeDuration(s); !ok {
+				return fmt.Sprintf("Freeze error: invalid duration %q", s)
+			}
+		}
+		f, err := b.manager.Freeze(svcName, d, stringOption(taskOpt, "reason"), interactionUser(i))
+		if err != nil {
+			return fmt.Sprintf("Freeze error: %s", err.Error())
+		}
+		return fmt.Sprintf("%s %s", svcName, f)
+	}
+
+	if opName == "unfreeze" {
+		if err := b.manager.Unfreeze(svcName, interactionUser(i)); err != nil {
+			return fmt.Sprintf("Unfreeze error: %s", err.Error())
+		}
+		return fmt.Sprintf("Unfroze %s", svcName)
+	}
+
 	result := b.manager.Do(svcName, opName)
-	if opName == "logs" {
+	if opName == "logs" || opName == "history" || opName == "plan" {
 		// Stop ``` in log output from closing the fence early.
 		safe := strings.ReplaceAll(result, "```", "``")
-		return fmt.Sprintf("%s:\n```\n%s\n```", svcName, safe)
+		const format = "%s:\n```\n%s\n```"
+		budget := discordMessageRuneLimit - len([]rune(fmt.Sprintf(format, svcName, "")))
+		if opName == "logs" {
+			safe = service.TruncateTailToRuneBudget(safe, budget)
+		} else {
+			safe = service.TruncateHeadToRuneBudget(safe, budget)
+		}
+		return fmt.Sprintf(format, svcName, safe)
 	}
 	return fmt.Sprintf("%s: %s", svcName, result)
 }
 
+// slowCommand reports whether the interaction is for a command that can
+// take longer than Discord waits for a response, such as plan, which
+// fetches from origin.
+func slowCommand(i *discordgo.InteractionCreate) bool {
+	for _, opt := range i.ApplicationCommandData().Options {
+		if opt.Type == discordgo.ApplicationCommandOptionSubCommand {
+			return opt.Name == "plan"
+		}
+	}
+	return false
+}
+
+// stringOption returns the value of the named string option of a
+// subcommand, or "" if it wasn't given.
+func stringOption(opt *discordgo.ApplicationCommandInteractionDataOption, name string) string {
+	for _, o := range opt.Options {
+		if o.Name == name {
+			return o.StringValue()
+		}
+	}
+	return ""
+}
+
+func boolOption(opt *discordgo.ApplicationCommandInteractionDataOption, name string) bool {
+	for _, o := range opt.Options {
+		if o.Name == name {
+			return o.BoolValue()
+		}
+	}
+	return false
+}
+
+// interactionUser returns the username of whoever sent the interaction: the
+// guild member in a server, or the user in a DM.
+func interactionUser(i *discordgo.InteractionCreate) string {
+	if i.Member != nil && i.Member.User != nil {
+		return i.Member.User.Username
+	}
+	if i.User != nil {
+		return i.User.Username
+	}
+	return ""
+}
+
+// maxChoices is the most choices Discord allows on an option. With more
+// services than this, the service option autocompletes instead.
+const maxChoices = 25
+
+// commandCharLimit is the most characters Discord allows in the names,
+// descriptions and choices of a command and its options.
+const commandCharLimit = 8000
+
 // buildCommands creates the /ops application command structure for the given
-// service names.
+// service names. Commands acting on a service take it as a "service" option,
+// so the command's size doesn't grow with the number of services past what
+// Discord accepts.
 func buildCommands(serviceNames []string) []*discordgo.ApplicationCommand {
-	return []*discordgo.ApplicationCommand{
-		{
-			Name:        "ops",
-			Description: "MezzaOps",
-			Type:        discordgo.ChatApplicationCommand,
-			Options: []*discordgo.ApplicationCommandOption{
-				subCommand("reload", "Reload config"),
-				subCommand("start-all", "Start all tasks"),
-				subCommand("stop-all", "Stop all tasks"),
-				subCommandGroup("start", "Start", serviceNames),
-				subCommandGroup("stop", "Stop", serviceNames),
-				subCommandGroup("restart", "Restart", serviceNames),
-				subCommandGroup("logs", "Logs", serviceNames),
-				subCommandGroup("status", "Status", serviceNames),
-				subCommandGroup("pull", "git pull", serviceNames),
-				subCommandGroup("deploy", "Deploy", serviceNames),
-			},
+	targets := freezeTargets(serviceNames)
+	ops := &discordgo.ApplicationCommand{
+		Name:        "ops",
+		Description: "MezzaOps",
+		Type:        discordgo.ChatApplicationCommand,
+		Options: []*discordgo.ApplicationCommandOption{
+			subCommand("reload", "Reload config"),
+			subCommand("start-all", "Start all tasks"),
+			subCommand("stop-all", "Stop all tasks"),
+			subCommand("queue", "Show running, queued and superseded deploys"),
+			subCommand("scheduled", "Show scheduled deploys"),
+			withRequiredOption(subCommand("unschedule", "Cancel a scheduled deploy"),
+				"id", "ID of the scheduled deploy, as shown by scheduled"),
+			subCommand("pending", "Show pushes awaiting approval"),
+			serviceCommand("start", "Start", serviceNames),
+			serviceCommand("stop", "Stop", serviceNames),
+			serviceCommand("restart", "Restart", serviceNames),
+			serviceCommand("logs", "Logs", serviceNames),
+			serviceCommand("status", "Status", serviceNames),
+			serviceCommand("pull", "git pull", serviceNames),
+			serviceCommand("plan", "Show what a deploy would bring in", serviceNames),
+			withStringOption(withStringOption(withBoolOption(withStringOption(serviceCommand("deploy", "Deploy", serviceNames),
+				"ref", "Tag, branch or commit to deploy (default: whatever the deploy steps pull)"),
+				"force", "Deploy even if the commit is already deployed"),
+				"at", "Deploy later, at 15:04 or 2006-01-02 15:04"),
+				"in", "Deploy later, after e.g. 30m or 2h"),
+			serviceCommand("history", "Deploy history", serviceNames),
+			withStringOption(serviceCommand("rollback", "Roll back to a previous revision", serviceNames),
+				"target", "Commit SHA, or N for the Nth previous good deploy (default 1)"),
+			serviceCommand("cancel", "Cancel a running deploy", serviceNames),
+			serviceCommand("confirm", "Approve a push awaiting approval, or deploy a held push", serviceNames),
+			serviceCommand("deny", "Drop a push awaiting approval", serviceNames),
+			serviceCommand("resume", "Resume auto-deploy after failed deploys paused it", serviceNames),
+			withStringOption(withStringOption(serviceCommand("freeze", "Hold pushes instead of deploying them", targets),
+				"duration", "How long, e.g. 2h or 3d (default: until unfrozen)"),
+				"reason", "Why deploys are frozen"),
+			serviceCommand("unfreeze", "Lift a freeze", targets),
 		},
 	}
+	if commandChars(ops) > commandCharLimit {
+		// The choices alone would take the command over the limit.
+		for _, sub := range ops.Options {
+			if len(sub.Options) > 0 && sub.Options[0].Name == "service" {
+				sub.Options[0].Choices = nil
+				sub.Options[0].Autocomplete = true
+			}
+		}
+	}
+	return []*discordgo.ApplicationCommand{ops}
+}
+
+// commandChars counts the characters of cmd that Discord counts towards
+// commandCharLimit.
+func commandChars(cmd *discordgo.ApplicationCommand) int {
+	n := len(cmd.Name) + len(cmd.Description)
+	var count func(opts []*discordgo.ApplicationCommandOption)
+	count = func(opts []*discordgo.ApplicationCommandOption) {
+		for _, opt := range opts {
+			n += len(opt.Name) + len(opt.Description)
+			for _, c := range opt.Choices {
+				n += len(c.Name) + len(fmt.Sprint(c.Value))
+			}
+			count(opt.Options)
+		}
+	}
+	count(cmd.Options)
+	return n
+}
+
+// freezeTargets returns the service names plus service.FreezeAll.
+func freezeTargets(serviceNames []string) []string {
+	if slices.Contains(serviceNames, service.FreezeAll) {
+		return serviceNames
+	}
+	return append(slices.Clone(serviceNames), service.FreezeAll)
+}
+
+// autocomplete returns the services matching what has been typed so far
+// into the service option of an /ops command, for when there are too many
+// to offer as choices.
+func (b *Bot) autocomplete(i *discordgo.InteractionCreate) []*discordgo.ApplicationCommandOptionChoice {
+	var sub, focused *discordgo.ApplicationCommandInteractionDataOption
+	for _, opt := range i.ApplicationCommandData().Options {
+		if opt.Type == discordgo.ApplicationCommandOptionSubCommand {
+			sub = opt
+			break
+		}
+	}
+	if sub == nil {
+		return nil
+	}
+	for _, o := range sub.Options {
+		if o.Focused {
+			focused = o
+		}
+	}
+	if focused == nil || focused.Name != "service" {
+		return nil
+	}
+
+	names := b.manager.ServiceNames()
+	if sub.Name == "freeze" || sub.Name == "unfreeze" {
+		names = freezeTargets(names)
+	}
+	typed := strings.ToLower(focused.StringValue())
+	var matches []string
+	for _, name := range names {
+		if strings.Contains(strings.ToLower(name), typed) {
+			matches = append(matches, name)
+		}
+	}
+	if len(matches) > maxChoices {
+		matches = matches[:maxChoices]
+	}
+	return serviceChoices(matches)
+}
+
+// withStringOption gives a subcommand an optional string option, such as the
+// ref for deploy.
+func withStringOption(sub *discordgo.ApplicationCommandOption, name, desc string) *discordgo.ApplicationCommandOption {
+	sub.Options = append(sub.Options, &discordgo.ApplicationCommandOption{
+		Name:        name,
+		Description: desc,
+		Type:        discordgo.ApplicationCommandOptionString,
+	})
+	return sub
+}
+
+// withBoolOption gives a subcommand an optional boolean option, such as
+// force for deploy.
+func withBoolOption(sub *discordgo.ApplicationCommandOption, name, desc string) *discordgo.ApplicationCommandOption {
+	sub.Options = append(sub.Options, &discordgo.ApplicationCommandOption{
+		Name:        name,
+		Description: desc,
+		Type:        discordgo.ApplicationCommandOptionBoolean,
+	})
+	return sub
+}
+
+// withRequiredOption gives a subcommand a required string option, such as
+// the ID for unschedule.
+func withRequiredOption(sub *discordgo.ApplicationCommandOption, name, desc string) *discordgo.ApplicationCommandOption {
+	sub.Options = append(sub.Options, &discordgo.ApplicationCommandOption{
+		Name:        name,
+		Description: desc,
+		Type:        discordgo.ApplicationCommandOptionString,
+		Required:    true,
+	})
+	return sub
 }
 
 func subCommand(name, desc string) *discordgo.ApplicationCommandOption {
@@ -282,18 +620,29 @@ func subCommand(name, desc string) *discordgo.ApplicationCommandOption {
 	}
 }
 
-func subCommandGroup(name, desc string, serviceNames []string) *discordgo.ApplicationCommandOption {
-	aco := &discordgo.ApplicationCommandOption{
-		Name:        name,
-		Description: desc,
-		Type:        discordgo.ApplicationCommandOptionSubCommandGroup,
+// serviceCommand returns a subcommand taking the service to act on, offered
+// as choices, or by autocomplete when there are more than Discord allows.
+func serviceCommand(name, desc string, serviceNames []string) *discordgo.ApplicationCommandOption {
+	opt := &discordgo.ApplicationCommandOption{
+		Name:        "service",
+		Description: "Service",
+		Type:        discordgo.ApplicationCommandOptionString,
+		Required:    true,
 	}
+	if len(serviceNames) > maxChoices {
+		opt.Autocomplete = true
+	} else {
+		opt.Choices = serviceChoices(serviceNames)
+	}
+	sub := subCommand(name, desc)
+	sub.Options = append(sub.Options, opt)
+	return sub
+}
+
+func serviceChoices(serviceNames []string) []*discordgo.ApplicationCommandOptionChoice {
+	choices := make([]*discordgo.ApplicationCommandOptionChoice, 0, len(serviceNames))
 	for _, sn := range serviceNames {
-		aco.Options = append(aco.Options, &discordgo.ApplicationCommandOption{
-			Name:        sn,
-			Description: sn,
-			Type:        discordgo.ApplicationCommandOptionSubCommand,
-		})
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: sn, Value: sn})
 	}
-	return aco
+	return choices
 }
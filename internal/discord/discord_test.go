@@ -4,8 +4,10 @@ import (
 	"fmt"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/bwmarrin/discordgo"
+	"github.com/shishberg/mezzaops/internal/deploy"
 	"github.com/shishberg/mezzaops/internal/service"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -19,6 +21,19 @@ type mockManager struct {
 	doOp           string
 	deployErr      error
 	deployName     string
+	deployReq      service.DeployRequest
+	rollbackTarget string
+	cancelName     string
+	cancelActor    string
+	cancelErr      error
+	freezeTarget   string
+	freezeFor      time.Duration
+	freezeReason   string
+	freezeErr      error
+	resumeName     string
+	resumeErr      error
+	scheduleAt     time.Time
+	unscheduleID   string
 	reloadErr      error
 	reloadCalled   bool
 	startAllCalled bool
@@ -35,11 +50,58 @@ func (m *mockManager) Do(name, op string) string {
 	return m.doResult
 }
 
-func (m *mockManager) RequestDeploy(name string) error {
+func (m *mockManager) RequestDeploy(name string, req service.DeployRequest) error {
 	m.deployName = name
+	m.deployReq = req
 	return m.deployErr
 }
 
+func (m *mockManager) RequestRollback(name, target string, req service.DeployRequest) (string, error) {
+	m.deployName = name
+	m.deployReq = req
+	m.rollbackTarget = target
+	return "0123456789abcdef", m.deployErr
+}
+
+func (m *mockManager) CancelDeploy(name, actor string) error {
+	m.cancelName = name
+	m.cancelActor = actor
+	return m.cancelErr
+}
+
+func (m *mockManager) Freeze(target string, d time.Duration, reason, actor string) (service.Freeze, error) {
+	m.freezeTarget = target
+	m.freezeFor = d
+	m.freezeReason = reason
+	return service.Freeze{Target: target, Reason: reason, By: actor}, m.freezeErr
+}
+
+func (m *mockManager) Unfreeze(target, actor string) error {
+	m.freezeTarget = target
+	return m.freezeErr
+}
+
+func (m *mockManager) Resume(name, actor string) error {
+	m.resumeName = name
+	return m.resumeErr
+}
+
+func (m *mockManager) ScheduleDeploy(name string, at time.Time, req service.DeployRequest) (service.ScheduledDeploy, error) {
+	m.deployName = name
+	m.deployReq = req
+	m.scheduleAt = at
+	return service.ScheduledDeploy{ID: "1", At: at, QueuedDeploy: service.QueuedDeploy{Service: name, DeployRequest: req}}, nil
+}
+
+func (m *mockManager) ScheduledDeploys() []service.ScheduledDeploy {
+	return nil
+}
+
+func (m *mockManager) Unschedule(id, actor string) (service.ScheduledDeploy, error) {
+	m.unscheduleID = id
+	return service.ScheduledDeploy{ID: id, QueuedDeploy: service.QueuedDeploy{Service: "api"}}, nil
+}
+
 func (m *mockManager) StartAll() {
 	m.startAllCalled = true
 }
@@ -61,6 +123,13 @@ func (m *mockManager) CountRunning() (int, int) {
 	return m.runningCount, m.totalCount
 }
 
+func (m *mockManager) DeployQueue() service.DeployQueue {
+	return service.DeployQueue{
+		MaxConcurrent: 1,
+		Running:       []service.QueuedDeploy{{Service: "api", DeployRequest: service.DeployRequest{Trigger: service.TriggerWebhook}}},
+	}
+}
+
 func (m *mockManager) SetOnChange(fn func(name, event string)) {
 	m.onChangeFn = fn
 }
@@ -76,58 +145,124 @@ func TestBuildCommands_Structure(t *testing.T) {
 	assert.Equal(t, "ops", ops.Name)
 	assert.Equal(t, discordgo.ChatApplicationCommand, ops.Type)
 
-	// Expect: reload, start-all, stop-all (subcommands)
-	//         start, stop, restart, logs, status, pull, deploy (subcommand groups)
-	require.Len(t, ops.Options, 10)
-
-	// Check the 3 subcommands
-	assert.Equal(t, "reload", ops.Options[0].Name)
-	assert.Equal(t, discordgo.ApplicationCommandOptionSubCommand, ops.Options[0].Type)
-	assert.Equal(t, "start-all", ops.Options[1].Name)
-	assert.Equal(t, discordgo.ApplicationCommandOptionSubCommand, ops.Options[1].Type)
-	assert.Equal(t, "stop-all", ops.Options[2].Name)
-	assert.Equal(t, discordgo.ApplicationCommandOptionSubCommand, ops.Options[2].Type)
-
-	// Check groups
-	groupNames := []string{"start", "stop", "restart", "logs", "status", "pull", "deploy"}
-	for i, gn := range groupNames {
-		opt := ops.Options[3+i]
-		assert.Equal(t, gn, opt.Name, "group at position %d", 3+i)
-		assert.Equal(t, discordgo.ApplicationCommandOptionSubCommandGroup, opt.Type)
-		// Each group should have one subcommand per service
-		require.Len(t, opt.Options, len(names), "group %q should have %d subcommands", gn, len(names))
+	// Expect: reload, start-all, stop-all, queue, scheduled, unschedule, pending,
+	//         start, stop, restart, logs, status, pull, plan, deploy, history, rollback,
+	//         cancel, confirm, deny, resume, freeze, unfreeze
+	require.Len(t, ops.Options, 23)
+	for _, opt := range ops.Options {
+		assert.Equal(t, discordgo.ApplicationCommandOptionSubCommand, opt.Type, "option %q", opt.Name)
+	}
+
+	for i, name := range []string{"reload", "start-all", "stop-all", "queue", "scheduled", "unschedule", "pending"} {
+		assert.Equal(t, name, ops.Options[i].Name)
+	}
+
+	// Service commands take the service as their first option, with one
+	// choice per service.
+	commands := []string{"start", "stop", "restart", "logs", "status", "pull", "plan", "deploy", "history", "rollback", "cancel", "confirm", "deny", "resume"}
+	for i, name := range commands {
+		opt := ops.Options[7+i]
+		assert.Equal(t, name, opt.Name, "command at position %d", 7+i)
+		svc := opt.Options[0]
+		assert.Equal(t, "service", svc.Name)
+		assert.True(t, svc.Required)
+		assert.False(t, svc.Autocomplete)
+		require.Len(t, svc.Choices, len(names), "command %q", name)
 		for j, sn := range names {
-			assert.Equal(t, sn, opt.Options[j].Name)
-			assert.Equal(t, discordgo.ApplicationCommandOptionSubCommand, opt.Options[j].Type)
+			assert.Equal(t, sn, svc.Choices[j].Value)
 		}
 	}
+
+	// freeze and unfreeze also take "all".
+	for i, name := range []string{"freeze", "unfreeze"} {
+		opt := ops.Options[21+i]
+		assert.Equal(t, name, opt.Name)
+		choices := opt.Options[0].Choices
+		require.Len(t, choices, len(names)+1)
+		assert.Equal(t, "all", choices[len(names)].Value)
+	}
 }
 
 func TestBuildCommands_EmptyServices(t *testing.T) {
 	cmds := buildCommands(nil)
 	require.Len(t, cmds, 1)
 	ops := cmds[0]
-	// Still 10 options (3 subcommands + 7 groups), but groups have 0 subcommands
-	require.Len(t, ops.Options, 10)
-	for _, opt := range ops.Options[3:] {
-		assert.Empty(t, opt.Options, "group %q should be empty", opt.Name)
+	require.Len(t, ops.Options, 23)
+	for _, opt := range ops.Options[7:21] {
+		assert.Empty(t, opt.Options[0].Choices, "command %q should offer no services", opt.Name)
+	}
+	for _, opt := range ops.Options[21:] {
+		require.Len(t, opt.Options[0].Choices, 1, "command %q", opt.Name)
+		assert.Equal(t, "all", opt.Options[0].Choices[0].Value)
 	}
 }
 
-func TestBuildCommands_IncludesDeployGroup(t *testing.T) {
+func TestBuildCommands_DeployOptions(t *testing.T) {
 	cmds := buildCommands([]string{"myapp"})
-	ops := cmds[0]
 
-	var found bool
-	for _, opt := range ops.Options {
+	var deploy *discordgo.ApplicationCommandOption
+	for _, opt := range cmds[0].Options {
 		if opt.Name == "deploy" {
-			found = true
-			assert.Equal(t, discordgo.ApplicationCommandOptionSubCommandGroup, opt.Type)
-			require.Len(t, opt.Options, 1)
-			assert.Equal(t, "myapp", opt.Options[0].Name)
+			deploy = opt
+		}
+	}
+	require.NotNil(t, deploy, "deploy command should exist")
+	var names []string
+	for _, opt := range deploy.Options {
+		names = append(names, opt.Name)
+	}
+	assert.Equal(t, []string{"service", "ref", "force", "at", "in"}, names)
+}
+
+func TestBuildCommands_ManyServices(t *testing.T) {
+	names := func(n int, prefix string) []string {
+		var out []string
+		for i := range n {
+			out = append(out, fmt.Sprintf("%s-%02d", prefix, i))
+		}
+		return out
+	}
+
+	// A dozen services fit as choices.
+	cmds := buildCommands(names(12, "service"))
+	assert.LessOrEqual(t, commandChars(cmds[0]), commandCharLimit)
+	assert.Len(t, cmds[0].Options[7].Options[0].Choices, 12)
+
+	// Too many services, or choices too long to fit: the service option
+	// autocompletes, and the command stays within Discord's limit.
+	for _, n := range []int{20, 40} {
+		cmds := buildCommands(names(n, "service-with-a-long-name"))
+		assert.LessOrEqual(t, commandChars(cmds[0]), commandCharLimit, "%d services", n)
+		for _, opt := range cmds[0].Options[7:] {
+			assert.True(t, opt.Options[0].Autocomplete, "command %q with %d services", opt.Name, n)
+			assert.Empty(t, opt.Options[0].Choices)
 		}
 	}
-	assert.True(t, found, "deploy group should exist")
+}
+
+func TestAutocomplete(t *testing.T) {
+	var names []string
+	for i := range 40 {
+		names = append(names, fmt.Sprintf("svc%02d", i))
+	}
+	b := &Bot{manager: &mockManager{serviceNames: names}}
+
+	ic := fakeServiceInteraction("freeze", "SVC1")
+	ic.Type = discordgo.InteractionApplicationCommandAutocomplete
+	ic.ApplicationCommandData().Options[0].Options[0].Focused = true
+	var got []string
+	for _, c := range b.autocomplete(ic) {
+		got = append(got, c.Value.(string))
+	}
+	assert.Equal(t, []string{"svc10", "svc11", "svc12", "svc13", "svc14", "svc15", "svc16", "svc17", "svc18", "svc19"}, got)
+
+	ic.ApplicationCommandData().Options[0].Options[0].Value = ""
+	assert.Len(t, b.autocomplete(ic), maxChoices)
+
+	ic.ApplicationCommandData().Options[0].Options[0].Value = "al"
+	choices := b.autocomplete(ic)
+	require.Len(t, choices, 1)
+	assert.Equal(t, "all", choices[0].Value)
 }
 
 // --- handleInteraction routing tests ---
@@ -150,8 +285,8 @@ func fakeSubcommandInteraction(subName string) *discordgo.InteractionCreate {
 	}
 }
 
-// helper to build a fake InteractionCreate with subcommand group + service subcommand
-func fakeGroupInteraction(group, svc string) *discordgo.InteractionCreate {
+// helper to build a fake InteractionCreate with a subcommand acting on a service
+func fakeServiceInteraction(sub, svc string) *discordgo.InteractionCreate {
 	return &discordgo.InteractionCreate{
 		Interaction: &discordgo.Interaction{
 			Type: discordgo.InteractionApplicationCommand,
@@ -159,12 +294,13 @@ func fakeGroupInteraction(group, svc string) *discordgo.InteractionCreate {
 				Name: "ops",
 				Options: []*discordgo.ApplicationCommandInteractionDataOption{
 					{
-						Name: group,
-						Type: discordgo.ApplicationCommandOptionSubCommandGroup,
+						Name: sub,
+						Type: discordgo.ApplicationCommandOptionSubCommand,
 						Options: []*discordgo.ApplicationCommandInteractionDataOption{
 							{
-								Name: svc,
-								Type: discordgo.ApplicationCommandOptionSubCommand,
+								Name:  "service",
+								Type:  discordgo.ApplicationCommandOptionString,
+								Value: svc,
 							},
 						},
 					},
@@ -197,6 +333,14 @@ func TestHandleInteraction_ReloadError(t *testing.T) {
 	assert.Equal(t, "Config reload error: bad config", resp)
 }
 
+func TestHandleInteraction_Queue(t *testing.T) {
+	b := &Bot{manager: &mockManager{}}
+
+	resp := b.routeInteraction(fakeSubcommandInteraction("queue"))
+	assert.True(t, strings.HasPrefix(resp, "```\n1 running, 0 queued (max 1 at once)\n"), resp)
+	assert.Contains(t, resp, "api: deploy (webhook)")
+}
+
 func TestHandleInteraction_StartAll(t *testing.T) {
 	mgr := &mockManager{}
 	b := &Bot{manager: mgr}
@@ -222,7 +366,7 @@ func TestHandleInteraction_StartService(t *testing.T) {
 	}
 	b := &Bot{manager: mgr}
 
-	resp := b.routeInteraction(fakeGroupInteraction("start", "api"))
+	resp := b.routeInteraction(fakeServiceInteraction("start", "api"))
 	assert.Equal(t, "api", mgr.doName)
 	assert.Equal(t, "start", mgr.doOp)
 	assert.Equal(t, "api: started", resp)
@@ -234,7 +378,7 @@ func TestHandleInteraction_StopService(t *testing.T) {
 	}
 	b := &Bot{manager: mgr}
 
-	resp := b.routeInteraction(fakeGroupInteraction("stop", "web"))
+	resp := b.routeInteraction(fakeServiceInteraction("stop", "web"))
 	assert.Equal(t, "web", mgr.doName)
 	assert.Equal(t, "stop", mgr.doOp)
 	assert.Equal(t, "web: stopped", resp)
@@ -246,7 +390,7 @@ func TestHandleInteraction_RestartService(t *testing.T) {
 	}
 	b := &Bot{manager: mgr}
 
-	resp := b.routeInteraction(fakeGroupInteraction("restart", "worker"))
+	resp := b.routeInteraction(fakeServiceInteraction("restart", "worker"))
 	assert.Equal(t, "worker", mgr.doName)
 	assert.Equal(t, "restart", mgr.doOp)
 	assert.Equal(t, "worker: restarted", resp)
@@ -258,7 +402,7 @@ func TestHandleInteraction_LogsService(t *testing.T) {
 	}
 	b := &Bot{manager: mgr}
 
-	resp := b.routeInteraction(fakeGroupInteraction("logs", "api"))
+	resp := b.routeInteraction(fakeServiceInteraction("logs", "api"))
 	assert.Equal(t, "api", mgr.doName)
 	assert.Equal(t, "logs", mgr.doOp)
 	assert.Equal(t, "api:\n```\nsome log output\n```", resp)
@@ -272,7 +416,7 @@ func TestHandleInteraction_LogsService_EscapesBackticks(t *testing.T) {
 	}
 	b := &Bot{manager: mgr}
 
-	resp := b.routeInteraction(fakeGroupInteraction("logs", "api"))
+	resp := b.routeInteraction(fakeServiceInteraction("logs", "api"))
 	assert.Equal(t, 2, strings.Count(resp, "```"),
 		"expected exactly two fence delimiters, got: %q", resp)
 }
@@ -283,7 +427,7 @@ func TestHandleInteraction_StatusService(t *testing.T) {
 	}
 	b := &Bot{manager: mgr}
 
-	resp := b.routeInteraction(fakeGroupInteraction("status", "api"))
+	resp := b.routeInteraction(fakeServiceInteraction("status", "api"))
 	assert.Equal(t, "api", mgr.doName)
 	assert.Equal(t, "status", mgr.doOp)
 	assert.Equal(t, "api: running", resp)
@@ -295,18 +439,179 @@ func TestHandleInteraction_PullService(t *testing.T) {
 	}
 	b := &Bot{manager: mgr}
 
-	resp := b.routeInteraction(fakeGroupInteraction("pull", "api"))
+	resp := b.routeInteraction(fakeServiceInteraction("pull", "api"))
 	assert.Equal(t, "api", mgr.doName)
 	assert.Equal(t, "pull", mgr.doOp)
 	assert.Equal(t, "api: Already up to date.", resp)
 }
 
+func TestHandleInteraction_Plan(t *testing.T) {
+	mgr := &mockManager{doResult: "api: 1 new commit on origin/main (abc1234..def5678)"}
+	b := &Bot{manager: mgr}
+
+	resp := b.routeInteraction(fakeServiceInteraction("plan", "api"))
+	assert.Equal(t, "plan", mgr.doOp)
+	assert.Equal(t, "api:\n```\napi: 1 new commit on origin/main (abc1234..def5678)\n```", resp)
+}
+
+func TestHandleInteraction_PlanTruncated(t *testing.T) {
+	plan := "api: 500 new commits on origin/main\n"
+	for i := range 500 {
+		plan += fmt.Sprintf("  abc%04d commit %d\n", i, i)
+	}
+	b := &Bot{manager: &mockManager{doResult: plan}}
+
+	ic := fakeServiceInteraction("plan", "api")
+	assert.True(t, slowCommand(ic))
+	assert.False(t, slowCommand(fakeServiceInteraction("status", "api")))
+	resp := b.routeInteraction(ic)
+	assert.LessOrEqual(t, len([]rune(resp)), discordMessageRuneLimit)
+	assert.True(t, strings.HasPrefix(resp, "api:\n```\napi: 500 new commits on origin/main\n"), resp)
+	assert.True(t, strings.HasSuffix(resp, "... (truncated)\n```"), resp)
+}
+
+func TestHandleInteraction_DeployRef(t *testing.T) {
+	mgr := &mockManager{}
+	b := &Bot{manager: mgr}
+
+	ic := fakeServiceInteraction("deploy", "api")
+	task := ic.ApplicationCommandData().Options[0]
+	task.Options = append(task.Options, []*discordgo.ApplicationCommandInteractionDataOption{
+		{Name: "ref", Type: discordgo.ApplicationCommandOptionString, Value: "v1.4.2"},
+	}...)
+	resp := b.routeInteraction(ic)
+	assert.Equal(t, "api", mgr.deployName)
+	assert.Equal(t, "v1.4.2", mgr.deployReq.Ref)
+	assert.Equal(t, "Deploy requested for api at `v1.4.2`", resp)
+}
+
+func TestHandleInteraction_DeployForce(t *testing.T) {
+	mgr := &mockManager{deployErr: &service.AlreadyDeployedError{Service: "api", Commit: "0123456789abcdef"}}
+	b := &Bot{manager: mgr}
+
+	resp := b.routeInteraction(fakeServiceInteraction("deploy", "api"))
+	assert.Equal(t, "api is already at `0123456`. Set `force` to deploy it again.", resp)
+
+	mgr.deployErr = nil
+	ic := fakeServiceInteraction("deploy", "api")
+	task := ic.ApplicationCommandData().Options[0]
+	task.Options = append(task.Options, []*discordgo.ApplicationCommandInteractionDataOption{
+		{Name: "force", Type: discordgo.ApplicationCommandOptionBoolean, Value: true},
+	}...)
+	resp = b.routeInteraction(ic)
+	assert.True(t, mgr.deployReq.Force)
+	assert.Equal(t, "Deploy requested for api", resp)
+}
+
+func TestHandleInteraction_ScheduleDeploy(t *testing.T) {
+	mgr := &mockManager{}
+	b := &Bot{manager: mgr}
+
+	before := time.Now()
+	ic := fakeServiceInteraction("deploy", "api")
+	task := ic.ApplicationCommandData().Options[0]
+	task.Options = append(task.Options, []*discordgo.ApplicationCommandInteractionDataOption{
+		{Name: "in", Type: discordgo.ApplicationCommandOptionString, Value: "2h"},
+	}...)
+	resp := b.routeInteraction(ic)
+	assert.True(t, strings.HasPrefix(resp, "Deploy #1 of api scheduled for "), resp)
+	assert.WithinDuration(t, before.Add(2*time.Hour), mgr.scheduleAt, time.Minute)
+
+	task.Options[1] = &discordgo.ApplicationCommandInteractionDataOption{Name: "at", Type: discordgo.ApplicationCommandOptionString, Value: "soon"}
+	resp = b.routeInteraction(ic)
+	assert.Contains(t, resp, "Deploy error: invalid time")
+
+	ic = fakeSubcommandInteraction("unschedule")
+	ic.ApplicationCommandData().Options[0].Options = []*discordgo.ApplicationCommandInteractionDataOption{
+		{Name: "id", Type: discordgo.ApplicationCommandOptionString, Value: "1"},
+	}
+	resp = b.routeInteraction(ic)
+	assert.Equal(t, "1", mgr.unscheduleID)
+	assert.Equal(t, "Cancelled scheduled deploy #1 of api", resp)
+
+	resp = b.routeInteraction(fakeSubcommandInteraction("scheduled"))
+	assert.Equal(t, "```\nno deploys scheduled\n```", resp)
+}
+
+func TestHandleInteraction_Rollback(t *testing.T) {
+	mgr := &mockManager{}
+	b := &Bot{manager: mgr}
+
+	ic := fakeServiceInteraction("rollback", "api")
+	task := ic.ApplicationCommandData().Options[0]
+	task.Options = append(task.Options, []*discordgo.ApplicationCommandInteractionDataOption{
+		{Name: "target", Type: discordgo.ApplicationCommandOptionString, Value: "abc1234"},
+	}...)
+	resp := b.routeInteraction(ic)
+	assert.Equal(t, "api", mgr.deployName)
+	assert.Equal(t, "abc1234", mgr.rollbackTarget)
+	assert.Equal(t, "Rollback of api to `0123456` requested", resp)
+}
+
+func TestHandleInteraction_Cancel(t *testing.T) {
+	mgr := &mockManager{}
+	b := &Bot{manager: mgr}
+
+	ic := fakeServiceInteraction("cancel", "api")
+	ic.Member = &discordgo.Member{User: &discordgo.User{Username: "alice"}}
+	resp := b.routeInteraction(ic)
+	assert.Equal(t, "api", mgr.cancelName)
+	assert.Equal(t, "alice", mgr.cancelActor)
+	assert.Equal(t, "Cancelling deploy of api", resp)
+
+	mgr.cancelErr = fmt.Errorf("no deploy in progress for api")
+	resp = b.routeInteraction(ic)
+	assert.Equal(t, "Cancel error: no deploy in progress for api", resp)
+}
+
+func TestHandleInteraction_Freeze(t *testing.T) {
+	mgr := &mockManager{}
+	b := &Bot{manager: mgr}
+
+	ic := fakeServiceInteraction("freeze", "all")
+	ic.Member = &discordgo.Member{User: &discordgo.User{Username: "alice"}}
+	task := ic.ApplicationCommandData().Options[0]
+	task.Options = append(task.Options, []*discordgo.ApplicationCommandInteractionDataOption{
+		{Name: "duration", Type: discordgo.ApplicationCommandOptionString, Value: "2d"},
+		{Name: "reason", Type: discordgo.ApplicationCommandOptionString, Value: "release week"},
+	}...)
+	resp := b.routeInteraction(ic)
+	assert.Equal(t, "all", mgr.freezeTarget)
+	assert.Equal(t, 48*time.Hour, mgr.freezeFor)
+	assert.Equal(t, "release week", mgr.freezeReason)
+	assert.Equal(t, "all frozen by alice: release week", resp)
+
+	task.Options[1].Value = "soon"
+	resp = b.routeInteraction(ic)
+	assert.Equal(t, `Freeze error: invalid duration "soon"`, resp)
+
+	resp = b.routeInteraction(fakeServiceInteraction("unfreeze", "api"))
+	assert.Equal(t, "api", mgr.freezeTarget)
+	assert.Equal(t, "Unfroze api", resp)
+}
+
+func TestHandleInteraction_Resume(t *testing.T) {
+	mgr := &mockManager{}
+	b := &Bot{manager: mgr}
+
+	resp := b.routeInteraction(fakeServiceInteraction("resume", "api"))
+	assert.Equal(t, "api", mgr.resumeName)
+	assert.Equal(t, "Resumed auto-deploy of api", resp)
+
+	mgr.resumeErr = fmt.Errorf("auto-deploy of api is not paused")
+	resp = b.routeInteraction(fakeServiceInteraction("resume", "api"))
+	assert.Equal(t, "Resume error: auto-deploy of api is not paused", resp)
+}
+
 func TestHandleInteraction_DeployService(t *testing.T) {
 	mgr := &mockManager{}
 	b := &Bot{manager: mgr}
 
-	resp := b.routeInteraction(fakeGroupInteraction("deploy", "api"))
+	ic := fakeServiceInteraction("deploy", "api")
+	ic.Member = &discordgo.Member{User: &discordgo.User{Username: "alice"}}
+	resp := b.routeInteraction(ic)
 	assert.Equal(t, "api", mgr.deployName)
+	assert.Equal(t, service.DeployRequest{Trigger: service.TriggerChat, Actor: "alice"}, mgr.deployReq)
 	assert.Equal(t, "Deploy requested for api", resp)
 }
 
@@ -316,7 +621,7 @@ func TestHandleInteraction_DeployError(t *testing.T) {
 	}
 	b := &Bot{manager: mgr}
 
-	resp := b.routeInteraction(fakeGroupInteraction("deploy", "api"))
+	resp := b.routeInteraction(fakeServiceInteraction("deploy", "api"))
 	assert.Equal(t, "api", mgr.deployName)
 	assert.Contains(t, resp, "not found")
 }
@@ -343,7 +648,7 @@ func TestHandleInteraction_NoOptions(t *testing.T) {
 func TestNotifier_ServiceEvent(t *testing.T) {
 	var sent string
 	n := &Notifier{
-		sendFunc: func(msg string) { sent = msg },
+		sendFunc: func(msg string) string { sent = msg; return "" },
 	}
 	n.ServiceEvent("api", "started")
 	assert.Equal(t, "**api**: started", sent)
@@ -352,7 +657,7 @@ func TestNotifier_ServiceEvent(t *testing.T) {
 func TestNotifier_DeployStarted(t *testing.T) {
 	var sent string
 	n := &Notifier{
-		sendFunc: func(msg string) { sent = msg },
+		sendFunc: func(msg string) string { sent = msg; return "" },
 	}
 	n.DeployStarted("web")
 	assert.Equal(t, "Deploying **web**...", sent)
@@ -361,26 +666,98 @@ func TestNotifier_DeployStarted(t *testing.T) {
 func TestNotifier_DeploySucceeded(t *testing.T) {
 	var sent string
 	n := &Notifier{
-		sendFunc: func(msg string) { sent = msg },
+		sendFunc: func(msg string) string { sent = msg; return "" },
 	}
-	n.DeploySucceeded("web", "all good")
+	n.DeploySucceeded("web", service.Changelog{})
 	assert.Equal(t, "Deploy of **web** succeeded.", sent)
+
+	n.DeploySucceeded("web", service.Changelog{
+		Before:  "1111111aaaa",
+		After:   "2222222bbbb",
+		Commits: []service.PlanCommit{{SHA: "2222222bbbb", Author: "alice", Subject: "Fix login"}},
+		Compare: "https://github.com/org/web/compare/1111111aaaa...2222222bbbb",
+	})
+	assert.Equal(t, "Deploy of **web** succeeded.\n"+
+		"- `2222222` Fix login (alice)\n"+
+		"[Compare 1111111...2222222](https://github.com/org/web/compare/1111111aaaa...2222222bbbb)", sent)
+}
+
+func TestNotifier_Rollback(t *testing.T) {
+	var sent []string
+	n := &Notifier{
+		sendFunc: func(msg string) string { sent = append(sent, msg); return "" },
+	}
+	n.RollbackStarted("web", "0123456789abcdef")
+	n.RollbackSucceeded("web", "0123456789abcdef")
+	n.RollbackFailed("web", "build", "boom", "")
+	assert.Equal(t, []string{
+		"Rolling back **web** to `0123456`...",
+		"Rolled back **web** to `0123456`.",
+		"Rollback of **web** failed at step `build`.\n```\nboom\n```",
+	}, sent)
+}
+
+func TestNotifier_DeployVerifyFailed(t *testing.T) {
+	var sent []string
+	n := &Notifier{
+		sendFunc: func(msg string) string { sent = append(sent, msg); return "" },
+	}
+	n.DeployVerifyFailed("web", "0123456789abcdef", "ERROR: service stopped 3s after restart\n", "")
+	n.DeployVerifyFailed("web", "", "ERROR: check failed after passing\n", "")
+	assert.Equal(t, []string{
+		"Deploy of **web** failed verification, rolled back to `0123456`.\n```\nERROR: service stopped 3s after restart\n\n```",
+		"Deploy of **web** failed verification and was not rolled back.\n```\nERROR: check failed after passing\n\n```",
+	}, sent)
+}
+
+func TestNotifier_DeployProgress(t *testing.T) {
+	var sent []string
+	edits := map[string]string{}
+	n := &Notifier{
+		sendFunc: func(msg string) string {
+			sent = append(sent, msg)
+			return fmt.Sprintf("m%d", len(sent))
+		},
+		editFunc: func(id, msg string) { edits[id] = msg },
+	}
+	n.DeployStarted("web")
+	n.DeployProgress("web", []deploy.StepResult{
+		{Step: "git pull", Status: "success", Duration: 2 * time.Second, Output: "Already up to date."},
+		{Step: "go build", Status: "running"},
+	})
+	n.DeploySucceeded("web", service.Changelog{})
+	n.DeployProgress("web", []deploy.StepResult{{Step: "late", Status: "running"}})
+
+	assert.Equal(t, []string{"Deploying **web**...", "Deploy of **web** succeeded."}, sent)
+	assert.Equal(t, map[string]string{
+		"m1": "Deploying **web**...\n✅ git pull (2s) → ⏳ go build…\n```\nAlready up to date.\n```",
+	}, edits)
 }
 
 func TestNotifier_DeployFailed(t *testing.T) {
 	var sent string
 	n := &Notifier{
-		sendFunc: func(msg string) { sent = msg },
+		sendFunc: func(msg string) string { sent = msg; return "" },
 	}
-	n.DeployFailed("web", "build", "exit code 1\nsome error")
+	n.DeployFailed("web", "build", "exit code 1\nsome error", "")
 	expected := "Deploy of **web** failed at step `build`.\n```\nexit code 1\nsome error\n```"
 	assert.Equal(t, expected, sent)
 }
 
+func TestNotifier_DeployFailed_LogLink(t *testing.T) {
+	var sent string
+	n := &Notifier{
+		sendFunc: func(msg string) string { sent = msg; return "" },
+	}
+	n.RollbackFailed("web", "build", "boom", "https://ops.example.com/log")
+	expected := "Rollback of **web** failed at step `build`. [Full log](https://ops.example.com/log)\n```\nboom\n```"
+	assert.Equal(t, expected, sent)
+}
+
 func TestNotifier_DeployFailed_LargeOutputTruncated(t *testing.T) {
 	var sent string
 	n := &Notifier{
-		sendFunc: func(msg string) { sent = msg },
+		sendFunc: func(msg string) string { sent = msg; return "" },
 	}
 
 	const tailMarker = "===FINAL_ERROR_MARKER_AT_TAIL==="
@@ -392,7 +769,7 @@ func TestNotifier_DeployFailed_LargeOutputTruncated(t *testing.T) {
 	buf = append(buf, tailMarker...)
 	output := string(buf)
 
-	n.DeployFailed("slurp", "go test -short ./...", output)
+	n.DeployFailed("slurp", "go test -short ./...", output, "")
 
 	// Whole sent message must fit under Discord's 2000-char message limit.
 	runes := len([]rune(sent))
@@ -416,7 +793,7 @@ func TestNotifier_DeployFailed_LargeOutputTruncated(t *testing.T) {
 func TestNotifier_WebhookReceived_Full(t *testing.T) {
 	var sent string
 	n := &Notifier{
-		sendFunc: func(msg string) { sent = msg },
+		sendFunc: func(msg string) string { sent = msg; return "" },
 	}
 	n.WebhookReceived("api", service.WebhookInfo{
 		Repo:      "acme/myapp",
@@ -443,7 +820,7 @@ func TestNotifier_WebhookReceived_Full(t *testing.T) {
 func TestNotifier_WebhookReceived_NoHeadCommit(t *testing.T) {
 	var sent string
 	n := &Notifier{
-		sendFunc: func(msg string) { sent = msg },
+		sendFunc: func(msg string) string { sent = msg; return "" },
 	}
 	n.WebhookReceived("api", service.WebhookInfo{
 		Repo:   "acme/myapp",
@@ -458,7 +835,7 @@ func TestNotifier_WebhookReceived_NoHeadCommit(t *testing.T) {
 func TestNotifier_WebhookReceived_LongCommitMsg(t *testing.T) {
 	var sent string
 	n := &Notifier{
-		sendFunc: func(msg string) { sent = msg },
+		sendFunc: func(msg string) string { sent = msg; return "" },
 	}
 	long := strings.Repeat("x", 400)
 	n.WebhookReceived("api", service.WebhookInfo{
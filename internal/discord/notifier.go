@@ -5,6 +5,7 @@ import (
 	"log"
 
 	"github.com/bwmarrin/discordgo"
+	"github.com/shishberg/mezzaops/internal/deploy"
 	"github.com/shishberg/mezzaops/internal/service"
 )
 
@@ -13,9 +14,14 @@ type Notifier struct {
 	session   *discordgo.Session
 	channelID string
 
-	// sendFunc overrides the default send behavior for testing.
-	// When nil, uses the Discord session to send messages.
-	sendFunc func(msg string)
+	// sendFunc and editFunc override sending and editing messages; Bot uses
+	// them to resolve its session lazily, and tests to capture messages.
+	// sendFunc returns the new message's ID. When nil, session is used.
+	sendFunc func(msg string) string
+	editFunc func(id, msg string)
+
+	// progress tracks the message each running deploy's steps are shown in.
+	progress service.ProgressMessages
 }
 
 // NewNotifier creates a Notifier that posts to the given Discord channel.
@@ -32,14 +38,24 @@ func (n *Notifier) ServiceEvent(name, event string) {
 	n.send(fmt.Sprintf("**%s**: %s", name, event))
 }
 
-// DeployStarted posts a deploy-started message.
+// DeployStarted posts a deploy-started message, which DeployProgress then
+// edits in place.
 func (n *Notifier) DeployStarted(name string) {
-	n.send(fmt.Sprintf("Deploying **%s**...", name))
+	n.sendProgress(name, fmt.Sprintf("Deploying **%s**...", name))
+}
+
+// DeployProgress edits the deploy-started message to show the steps so far.
+func (n *Notifier) DeployProgress(name string, steps []deploy.StepResult) {
+	if id, msg, ok := n.progress.Render(name, steps); ok {
+		n.edit(id, msg)
+	}
 }
 
-// DeploySucceeded posts a deploy-succeeded message.
-func (n *Notifier) DeploySucceeded(name, output string) {
-	n.send(fmt.Sprintf("Deploy of **%s** succeeded.", name))
+// DeploySucceeded posts a deploy-succeeded message listing the commits that
+// went out.
+func (n *Notifier) DeploySucceeded(name string, changes service.Changelog) {
+	n.progress.Done(name)
+	n.send(changes.SucceededMessage(fmt.Sprintf("Deploy of **%s** succeeded.", name)))
 }
 
 // discordMessageRuneLimit is the maximum size of a single Discord message.
@@ -51,12 +67,53 @@ const discordMessageRuneLimit = 2000
 // DeployFailed posts a deploy-failed message with the failed step and output.
 // The output is truncated from the head (keeping the tail, where errors tend
 // to be) so the whole message fits within Discord's 2000-character limit.
-func (n *Notifier) DeployFailed(name, step, output string) {
-	const format = "Deploy of **%s** failed at step `%s`.\n```\n%s\n```"
-	scaffolding := fmt.Sprintf(format, name, step, "")
+func (n *Notifier) DeployFailed(name, step, output, logURL string) {
+	n.progress.Done(name)
+	n.sendFailed("Deploy", name, step, output, logURL)
+}
+
+// DeployVerifyFailed sends a message saying the deploy failed verification
+// and whether it was rolled back, with the verification output truncated like
+// DeployFailed.
+func (n *Notifier) DeployVerifyFailed(name, rolledBackTo, output, logURL string) {
+	n.progress.Done(name)
+	headline := fmt.Sprintf("Deploy of **%s** failed verification and was not rolled back.", name)
+	if rolledBackTo != "" {
+		headline = fmt.Sprintf("Deploy of **%s** failed verification, rolled back to `%s`.", name, service.ShortSHA(rolledBackTo))
+	}
+	n.sendWithOutput(service.WithLogLink(headline, logURL), output)
+}
+
+// RollbackStarted posts a rollback-started message.
+func (n *Notifier) RollbackStarted(name, sha string) {
+	n.sendProgress(name, fmt.Sprintf("Rolling back **%s** to `%s`...", name, service.ShortSHA(sha)))
+}
+
+// RollbackSucceeded posts a rollback-succeeded message.
+func (n *Notifier) RollbackSucceeded(name, sha string) {
+	n.progress.Done(name)
+	n.send(fmt.Sprintf("Rolled back **%s** to `%s`.", name, service.ShortSHA(sha)))
+}
+
+// RollbackFailed posts a rollback-failed message, truncated like DeployFailed.
+func (n *Notifier) RollbackFailed(name, step, output, logURL string) {
+	n.progress.Done(name)
+	n.sendFailed("Rollback", name, step, output, logURL)
+}
+
+func (n *Notifier) sendFailed(what, name, step, output, logURL string) {
+	headline := fmt.Sprintf("%s of **%s** failed at step `%s`.", what, name, step)
+	n.sendWithOutput(service.WithLogLink(headline, logURL), output)
+}
+
+// sendWithOutput sends headline followed by output in a code block, truncating
+// output from the head so the whole message fits within Discord's limit.
+func (n *Notifier) sendWithOutput(headline, output string) {
+	const format = "%s\n```\n%s\n```"
+	scaffolding := fmt.Sprintf(format, headline, "")
 	budget := discordMessageRuneLimit - len([]rune(scaffolding))
 	truncated := service.TruncateTailToRuneBudget(output, budget)
-	n.send(fmt.Sprintf(format, name, step, truncated))
+	n.send(fmt.Sprintf(format, headline, truncated))
 }
 
 // WebhookReceived posts a notification describing an incoming webhook that
@@ -65,16 +122,39 @@ func (n *Notifier) WebhookReceived(name string, info service.WebhookInfo) {
 	n.send(info.FormatMessage(fmt.Sprintf("**%s**", name)))
 }
 
-func (n *Notifier) send(msg string) {
+// sendProgress posts the first message of a deploy and remembers it for
+// DeployProgress to edit.
+func (n *Notifier) sendProgress(name, msg string) {
+	n.progress.Start(name, n.send(msg), msg)
+}
+
+// send posts msg and returns its message ID, or "" if it wasn't posted.
+func (n *Notifier) send(msg string) string {
 	if n.sendFunc != nil {
-		n.sendFunc(msg)
-		return
+		return n.sendFunc(msg)
 	}
 	if n.session == nil || n.channelID == "" {
 		log.Println(msg)
-		return
+		return ""
 	}
-	if _, err := n.session.ChannelMessageSend(n.channelID, msg); err != nil {
+	m, err := n.session.ChannelMessageSend(n.channelID, msg)
+	if err != nil {
 		log.Printf("discord send error: %v", err)
+		return ""
+	}
+	return m.ID
+}
+
+// edit replaces the text of a message posted by send.
+func (n *Notifier) edit(id, msg string) {
+	if n.editFunc != nil {
+		n.editFunc(id, msg)
+		return
+	}
+	if n.session == nil || n.channelID == "" {
+		return
+	}
+	if _, err := n.session.ChannelMessageEdit(n.channelID, id, msg); err != nil {
+		log.Printf("discord edit error: %v", err)
 	}
 }
@@ -11,7 +11,6 @@ import (
 	"log"
 	"os"
 	"path/filepath"
-	"sort"
 	"strings"
 
 	"github.com/rs/zerolog"
@@ -23,17 +22,15 @@ import (
 	"maunium.net/go/mautrix/id"
 )
 
-// Command is a parsed bot command.
-type Command struct {
-	Action  string
-	Service string
-}
+// Command is a parsed bot command. User is the sender's Matrix user ID,
+// filled in by the bot.
+type Command = service.ChatCommand
 
 // ParseCommand returns a Command when the first whitespace-separated token of
 // message exactly equals prefix. Otherwise it returns nil. The remaining
-// tokens after the prefix become Action and (optionally) Service. The prefix
-// match is case-sensitive; the action's case is preserved for the caller to
-// fold as it sees fit.
+// tokens after the prefix become Action and (optionally) Service and Args.
+// The prefix match is case-sensitive; the action's case is preserved for the
+// caller to fold as it sees fit.
 func ParseCommand(message, prefix string) *Command {
 	fields := strings.Fields(message)
 	if len(fields) < 2 {
@@ -46,27 +43,21 @@ func ParseCommand(message, prefix string) *Command {
 	if len(fields) >= 3 {
 		cmd.Service = fields[2]
 	}
+	if len(fields) > 3 {
+		cmd.Args = fields[3:]
+	}
 	return cmd
 }
 
 // ServiceManager is the slice of the manager API the Matrix frontend uses.
-// Duplicated from internal/mattermost so the two packages stay independent;
-// extract to internal/service if a third frontend wants the same shape.
 type ServiceManager interface {
-	Do(name, op string) string
-	RequestDeploy(name string) error
-	StartAll()
-	StopAll()
-	Reload() error
-	ServiceNames() []string
-	CountRunning() (int, int)
-	GetAllStates() map[string]service.ServiceState
+	service.ChatManager
 }
 
-// ConfirmHandler completes a deploy confirmation initiated by a webhook for a
-// service with require_confirmation: true.
+// ConfirmHandler approves or denies a push to a service with
+// require_confirmation or approvals, which a webhook left awaiting approval.
 type ConfirmHandler interface {
-	Confirm(service string) bool
+	service.ChatApprovals
 }
 
 // Config holds everything matrix.New needs to construct a Bot. The four
@@ -93,12 +84,6 @@ type matrixClient interface {
 	ResolveAlias(ctx context.Context, alias id.RoomAlias) (*mautrix.RespAliasResolve, error)
 }
 
-// validCommands is listed in the unknown-command response.
-var validCommands = []string{
-	"status", "start", "stop", "restart", "logs", "pull",
-	"deploy", "confirm", "reload", "start-all", "stop-all",
-}
-
 // Bot is the Matrix frontend.
 type Bot struct {
 	cfg     Config
@@ -296,17 +281,29 @@ func (b *Bot) resolveRoom(ctx context.Context) error {
 // either condition is reachable before Run finishes (or at all, if it
 // errored).
 func (b *Bot) PostMessage(ctx context.Context, message string) {
+	b.sendMessage(ctx, message, "")
+}
+
+// sendMessage is PostMessage, returning the new event's ID, or "" if nothing
+// was sent. If replaces is set, the message is sent as an edit of that event.
+func (b *Bot) sendMessage(ctx context.Context, message string, replaces id.EventID) id.EventID {
 	if b.client == nil || b.roomID == "" {
 		log.Printf("matrix: PostMessage called before bot is ready, dropping message")
-		return
+		return ""
 	}
 	content := format.RenderMarkdown(message, true, false)
 	content.MsgType = event.MsgText
 	content.Body = message
 	content.Format = event.FormatHTML
-	if _, err := b.client.SendMessageEvent(ctx, b.roomID, event.EventMessage, content); err != nil {
+	if replaces != "" {
+		content.SetEdit(replaces)
+	}
+	resp, err := b.client.SendMessageEvent(ctx, b.roomID, event.EventMessage, content)
+	if err != nil {
 		log.Printf("matrix: send message: %v", err)
+		return ""
 	}
+	return resp.EventID
 }
 
 // handleMessage filters to the configured room, ignores our own messages,
@@ -326,6 +323,7 @@ func (b *Bot) handleMessage(ctx context.Context, evt *event.Event) {
 	if cmd == nil {
 		return
 	}
+	cmd.User = string(evt.Sender)
 	b.PostMessage(ctx, b.dispatchCommand(cmd))
 }
 
@@ -353,72 +351,5 @@ func (b *Bot) handleInvite(ctx context.Context, evt *event.Event) {
 // dispatchCommand routes a parsed command to the manager and returns a
 // markdown response.
 func (b *Bot) dispatchCommand(cmd *Command) string {
-	switch strings.ToLower(cmd.Action) {
-	case "status":
-		if cmd.Service == "" {
-			return formatStatusOverview(b.manager.GetAllStates())
-		}
-		return b.manager.Do(cmd.Service, "status")
-
-	case "start", "stop", "restart", "logs", "pull":
-		return b.manager.Do(cmd.Service, strings.ToLower(cmd.Action))
-
-	case "deploy":
-		if err := b.manager.RequestDeploy(cmd.Service); err != nil {
-			return fmt.Sprintf("Deploy error: %v", err)
-		}
-		return fmt.Sprintf("Deploy requested for **%s**.", cmd.Service)
-
-	case "confirm":
-		if b.confirm == nil {
-			return "Confirm handler not configured."
-		}
-		if !b.confirm.Confirm(cmd.Service) {
-			return fmt.Sprintf("No pending deploy confirmation for **%s** (or it expired).", cmd.Service)
-		}
-		return fmt.Sprintf("Confirmed deploy for **%s**.", cmd.Service)
-
-	case "reload":
-		if err := b.manager.Reload(); err != nil {
-			return fmt.Sprintf("Reload error: %v", err)
-		}
-		return "Config reloaded."
-
-	case "start-all":
-		b.manager.StartAll()
-		return "All services starting."
-
-	case "stop-all":
-		b.manager.StopAll()
-		return "All services stopping."
-
-	default:
-		return fmt.Sprintf("Unknown command: %q. Valid commands: %s",
-			cmd.Action, strings.Join(validCommands, ", "))
-	}
-}
-
-// formatStatusOverview formats service states as a markdown list, sorted by
-// service name so the output is deterministic.
-func formatStatusOverview(states map[string]service.ServiceState) string {
-	if len(states) == 0 {
-		return "No services configured."
-	}
-	names := make([]string, 0, len(states))
-	for name := range states {
-		names = append(names, name)
-	}
-	sort.Strings(names)
-
-	var sb strings.Builder
-	sb.WriteString("**Service Status**\n")
-	for _, name := range names {
-		state := states[name]
-		fmt.Fprintf(&sb, "- **%s**: %s", name, state.Status)
-		if state.LastResult != "" {
-			fmt.Fprintf(&sb, " (last: %s)", state.LastResult)
-		}
-		sb.WriteString("\n")
-	}
-	return sb.String()
+	return service.DispatchChat(b.manager, b.confirm, cmd)
 }
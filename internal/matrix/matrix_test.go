@@ -4,9 +4,9 @@ import (
 	"context"
 	"fmt"
 	"sort"
-	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/shishberg/mezzaops/internal/service"
 	"github.com/stretchr/testify/assert"
@@ -32,6 +32,7 @@ func TestParseCommand(t *testing.T) {
 		{"logs command", "!mezzaops logs myapp", &Command{Action: "logs", Service: "myapp"}},
 		{"pull command", "!mezzaops pull myapp", &Command{Action: "pull", Service: "myapp"}},
 		{"reload command", "!mezzaops reload", &Command{Action: "reload"}},
+		{"rollback with target", "!mezzaops rollback myapp 2", &Command{Action: "rollback", Service: "myapp", Args: []string{"2"}}},
 		{"start-all command", "!mezzaops start-all", &Command{Action: "start-all"}},
 		{"stop-all command", "!mezzaops stop-all", &Command{Action: "stop-all"}},
 		{"with extra whitespace", "  !mezzaops   deploy   myapp  ", &Command{Action: "deploy", Service: "myapp"}},
@@ -64,6 +65,14 @@ type mockServiceManager struct {
 	lastService string
 	doResult    string
 	deployErr   error
+	deployReq   service.DeployRequest
+	rollbackTo  string
+	cancelActor string
+	cancelErr   error
+	freezeFor   time.Duration
+	freezeErr   error
+	resumeErr   error
+	scheduleAt  time.Time
 	reloadErr   error
 	states      map[string]service.ServiceState
 }
@@ -86,14 +95,80 @@ func (m *mockServiceManager) Do(name, op string) string {
 	return m.doResult
 }
 
-func (m *mockServiceManager) RequestDeploy(name string) error {
+func (m *mockServiceManager) RequestDeploy(name string, req service.DeployRequest) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	m.lastService = name
 	m.lastOp = "deploy"
+	m.deployReq = req
 	return m.deployErr
 }
 
+func (m *mockServiceManager) RequestRollback(name, target string, req service.DeployRequest) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastService = name
+	m.lastOp = "rollback"
+	m.deployReq = req
+	m.rollbackTo = target
+	return "0123456789abcdef", m.deployErr
+}
+
+func (m *mockServiceManager) CancelDeploy(name, actor string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastService = name
+	m.lastOp = "cancel"
+	m.cancelActor = actor
+	return m.cancelErr
+}
+
+func (m *mockServiceManager) Freeze(target string, d time.Duration, reason, actor string) (service.Freeze, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastService = target
+	m.lastOp = "freeze"
+	m.freezeFor = d
+	return service.Freeze{Target: target, Reason: reason, By: actor}, m.freezeErr
+}
+
+func (m *mockServiceManager) Unfreeze(target, actor string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastService = target
+	m.lastOp = "unfreeze"
+	return m.freezeErr
+}
+
+func (m *mockServiceManager) Resume(name, actor string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastService = name
+	m.lastOp = "resume"
+	return m.resumeErr
+}
+
+func (m *mockServiceManager) ScheduleDeploy(name string, at time.Time, req service.DeployRequest) (service.ScheduledDeploy, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastService = name
+	m.lastOp = "schedule"
+	m.scheduleAt = at
+	m.deployReq = req
+	return service.ScheduledDeploy{ID: "1", At: at, QueuedDeploy: service.QueuedDeploy{Service: name, DeployRequest: req}}, nil
+}
+
+func (m *mockServiceManager) ScheduledDeploys() []service.ScheduledDeploy {
+	return nil
+}
+
+func (m *mockServiceManager) Unschedule(id, actor string) (service.ScheduledDeploy, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastOp = "unschedule"
+	return service.ScheduledDeploy{ID: id, QueuedDeploy: service.QueuedDeploy{Service: "myapp"}}, nil
+}
+
 func (m *mockServiceManager) StartAll() {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -126,6 +201,13 @@ func (m *mockServiceManager) ServiceNames() []string {
 
 func (m *mockServiceManager) CountRunning() (int, int) { return 1, 2 }
 
+func (m *mockServiceManager) DeployQueue() service.DeployQueue {
+	return service.DeployQueue{
+		MaxConcurrent: 1,
+		Running:       []service.QueuedDeploy{{Service: "app1", DeployRequest: service.DeployRequest{Trigger: service.TriggerWebhook}}},
+	}
+}
+
 func (m *mockServiceManager) GetAllStates() map[string]service.ServiceState {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -148,14 +230,30 @@ func (m *mockServiceManager) getLastService() string {
 type mockConfirmHandler struct {
 	mu          sync.Mutex
 	lastService string
-	result      bool
+	lastActor   string
+	approval    service.PendingApproval
+	err         error
+	pending     []service.PendingApproval
+}
+
+func (h *mockConfirmHandler) Confirm(svc, actor string) (service.PendingApproval, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastService = svc
+	h.lastActor = actor
+	return h.approval, h.err
 }
 
-func (h *mockConfirmHandler) Confirm(svc string) bool {
+func (h *mockConfirmHandler) Deny(svc, actor string) error {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 	h.lastService = svc
-	return h.result
+	h.lastActor = actor
+	return h.err
+}
+
+func (h *mockConfirmHandler) PendingApprovals() []service.PendingApproval {
+	return h.pending
 }
 
 func (h *mockConfirmHandler) getLastService() string {
@@ -199,7 +297,7 @@ func (f *fakeMatrixClient) SendMessageEvent(_ context.Context, roomID id.RoomID,
 		return nil, f.sendErr
 	}
 	f.sends = append(f.sends, sentMessage{RoomID: roomID, Type: eventType, Content: contentJSON})
-	return &mautrix.RespSendEvent{}, nil
+	return &mautrix.RespSendEvent{EventID: id.EventID(fmt.Sprintf("$event%d", len(f.sends)))}, nil
 }
 
 func (f *fakeMatrixClient) JoinRoomByID(_ context.Context, roomID id.RoomID) (*mautrix.RespJoinRoom, error) {
@@ -288,8 +386,8 @@ func TestDispatch_StatusSingleService(t *testing.T) {
 	assert.Equal(t, "myapp", mgr.getLastService())
 }
 
-func TestDispatch_StartStopRestartLogsPull(t *testing.T) {
-	for _, op := range []string{"start", "stop", "restart", "logs", "pull"} {
+func TestDispatch_StartStopRestartLogsPullPlan(t *testing.T) {
+	for _, op := range []string{"start", "stop", "restart", "logs", "pull", "plan"} {
 		t.Run(op, func(t *testing.T) {
 			mgr := newMockServiceManager()
 			bot := botForTest(t, newFakeMatrixClient(), mgr, nil)
@@ -320,6 +418,104 @@ func TestDispatch_Deploy(t *testing.T) {
 	assert.Equal(t, "myapp", mgr.getLastService())
 }
 
+func TestDispatch_DeployRef(t *testing.T) {
+	mgr := newMockServiceManager()
+	bot := botForTest(t, newFakeMatrixClient(), mgr, nil)
+
+	resp := bot.dispatchCommand(&Command{Action: "deploy", Service: "myapp@3f2c1ab"})
+	assert.Equal(t, "Deploy requested for **myapp** at `3f2c1ab`.", resp)
+	assert.Equal(t, "myapp", mgr.getLastService())
+	assert.Equal(t, "3f2c1ab", mgr.deployReq.Ref)
+}
+
+func TestDispatch_DeployAlreadyDeployed(t *testing.T) {
+	mgr := newMockServiceManager()
+	mgr.deployErr = &service.AlreadyDeployedError{Service: "myapp", Commit: "0123456789abcdef"}
+	bot := botForTest(t, newFakeMatrixClient(), mgr, nil)
+
+	resp := bot.dispatchCommand(&Command{Action: "deploy", Service: "myapp"})
+	assert.Equal(t, "**myapp** is already at `0123456`. Add `--force` to deploy it again.", resp)
+
+	mgr.deployErr = nil
+	bot.dispatchCommand(&Command{Action: "deploy", Service: "myapp", Args: []string{"--force"}})
+	assert.True(t, mgr.deployReq.Force)
+}
+
+func TestDispatch_Rollback(t *testing.T) {
+	mgr := newMockServiceManager()
+	bot := botForTest(t, newFakeMatrixClient(), mgr, nil)
+
+	resp := bot.dispatchCommand(&Command{Action: "rollback", Service: "myapp", User: "@alice:example.org"})
+	assert.Equal(t, "Rollback of **myapp** to `0123456` requested.", resp)
+	assert.Equal(t, "rollback", mgr.getLastOp())
+	assert.Equal(t, "", mgr.rollbackTo)
+	assert.Equal(t, "@alice:example.org", mgr.deployReq.Actor)
+}
+
+func TestDispatch_Cancel(t *testing.T) {
+	mgr := newMockServiceManager()
+	bot := botForTest(t, newFakeMatrixClient(), mgr, nil)
+
+	resp := bot.dispatchCommand(&Command{Action: "cancel", Service: "myapp", User: "@alice:example.org"})
+	assert.Equal(t, "Cancelling deploy of **myapp**.", resp)
+	assert.Equal(t, "cancel", mgr.getLastOp())
+	assert.Equal(t, "@alice:example.org", mgr.cancelActor)
+
+	mgr.cancelErr = fmt.Errorf("no deploy in progress for myapp")
+	resp = bot.dispatchCommand(&Command{Action: "cancel", Service: "myapp"})
+	assert.Equal(t, "Cancel error: no deploy in progress for myapp", resp)
+}
+
+func TestDispatch_Freeze(t *testing.T) {
+	mgr := newMockServiceManager()
+	bot := botForTest(t, newFakeMatrixClient(), mgr, nil)
+
+	resp := bot.dispatchCommand(&Command{Action: "freeze", Service: "myapp", Args: []string{"incident"}, User: "@alice:example.org"})
+	assert.Equal(t, "**myapp** frozen by @alice:example.org: incident. Pushes will be held until it lifts.", resp)
+	assert.Equal(t, "freeze", mgr.getLastOp())
+	assert.Equal(t, time.Duration(0), mgr.freezeFor)
+
+	resp = bot.dispatchCommand(&Command{Action: "unfreeze", Service: "myapp"})
+	assert.Equal(t, "Unfroze **myapp**.", resp)
+
+	mgr.freezeErr = fmt.Errorf("myapp is not frozen")
+	resp = bot.dispatchCommand(&Command{Action: "unfreeze", Service: "myapp"})
+	assert.Equal(t, "Unfreeze error: myapp is not frozen", resp)
+}
+
+func TestDispatch_Resume(t *testing.T) {
+	mgr := newMockServiceManager()
+	bot := botForTest(t, newFakeMatrixClient(), mgr, nil)
+
+	resp := bot.dispatchCommand(&Command{Action: "resume", Service: "myapp", User: "@alice:example.org"})
+	assert.Equal(t, "Resumed auto-deploy of **myapp**.", resp)
+	assert.Equal(t, "resume", mgr.getLastOp())
+
+	mgr.resumeErr = fmt.Errorf("auto-deploy of myapp is not paused")
+	resp = bot.dispatchCommand(&Command{Action: "resume", Service: "myapp"})
+	assert.Equal(t, "Resume error: auto-deploy of myapp is not paused", resp)
+}
+
+func TestDispatch_ScheduleDeploy(t *testing.T) {
+	mgr := newMockServiceManager()
+	bot := botForTest(t, newFakeMatrixClient(), mgr, nil)
+
+	before := time.Now()
+	resp := bot.dispatchCommand(&Command{Action: "deploy", Service: "myapp", Args: []string{"in", "30m"}, User: "@alice:example.org"})
+	assert.Contains(t, resp, "Deploy #1 of **myapp** scheduled for ")
+	assert.Equal(t, "schedule", mgr.getLastOp())
+	assert.WithinDuration(t, before.Add(30*time.Minute), mgr.scheduleAt, time.Minute)
+	assert.Equal(t, "@alice:example.org", mgr.deployReq.Actor)
+
+	resp = bot.dispatchCommand(&Command{Action: "unschedule", Service: "1"})
+	assert.Equal(t, "Cancelled scheduled deploy #1 of **myapp**.", resp)
+	assert.Equal(t, "unschedule", mgr.getLastOp())
+
+	assert.Equal(t, "no deploys scheduled\n", bot.dispatchCommand(&Command{Action: "scheduled"}))
+	resp = bot.dispatchCommand(&Command{Action: "deploy", Service: "myapp", Args: []string{"in"}})
+	assert.Equal(t, `Deploy error: nothing after "in"`, resp)
+}
+
 func TestDispatch_DeployError(t *testing.T) {
 	mgr := newMockServiceManager()
 	mgr.deployErr = fmt.Errorf("service not found")
@@ -332,20 +528,41 @@ func TestDispatch_DeployError(t *testing.T) {
 
 func TestDispatch_Confirm(t *testing.T) {
 	mgr := newMockServiceManager()
-	ch := &mockConfirmHandler{result: true}
+	ch := &mockConfirmHandler{}
 	bot := botForTest(t, newFakeMatrixClient(), mgr, ch)
 
-	resp := bot.dispatchCommand(&Command{Action: "confirm", Service: "myapp"})
+	resp := bot.dispatchCommand(&Command{Action: "confirm", Service: "myapp", User: "@alice:example.org"})
 	assert.Contains(t, resp, "Confirmed")
 	assert.Equal(t, "myapp", ch.getLastService())
+	assert.Equal(t, "@alice:example.org", ch.lastActor)
+
+	ch.approval = service.PendingApproval{Service: "myapp", Required: 2, ApprovedBy: []string{"@alice:example.org"}}
+	resp = bot.dispatchCommand(&Command{Action: "confirm", Service: "myapp", User: "@alice:example.org"})
+	assert.Equal(t, "Approved deploy for **myapp** (1 of 2 approvals).", resp)
 }
 
 func TestDispatch_ConfirmNoPending(t *testing.T) {
-	ch := &mockConfirmHandler{result: false}
+	ch := &mockConfirmHandler{err: fmt.Errorf("no deploy of myapp awaiting approval (or it expired)")}
 	bot := botForTest(t, newFakeMatrixClient(), newMockServiceManager(), ch)
 
 	resp := bot.dispatchCommand(&Command{Action: "confirm", Service: "myapp"})
-	assert.Contains(t, resp, "No pending")
+	assert.Equal(t, "Confirm error: no deploy of myapp awaiting approval (or it expired)", resp)
+}
+
+func TestDispatch_DenyAndPending(t *testing.T) {
+	ch := &mockConfirmHandler{pending: []service.PendingApproval{{Service: "myapp", Commit: "abc1234def", Required: 1, Since: time.Now()}}}
+	bot := botForTest(t, newFakeMatrixClient(), newMockServiceManager(), ch)
+
+	resp := bot.dispatchCommand(&Command{Action: "pending"})
+	assert.Contains(t, resp, "myapp: abc1234, 0 of 1 approvals, waiting ")
+
+	resp = bot.dispatchCommand(&Command{Action: "deny", Service: "myapp", User: "@bob:example.org"})
+	assert.Equal(t, "Denied deploy for **myapp**.", resp)
+	assert.Equal(t, "@bob:example.org", ch.lastActor)
+
+	ch.err = fmt.Errorf("@bob:example.org is not an approver for myapp")
+	resp = bot.dispatchCommand(&Command{Action: "deny", Service: "myapp", User: "@bob:example.org"})
+	assert.Equal(t, "Deny error: @bob:example.org is not an approver for myapp", resp)
 }
 
 func TestDispatch_ConfirmNoHandler(t *testing.T) {
@@ -374,6 +591,14 @@ func TestDispatch_ReloadError(t *testing.T) {
 	assert.Contains(t, resp, "bad config")
 }
 
+func TestDispatch_Queue(t *testing.T) {
+	bot := botForTest(t, newFakeMatrixClient(), newMockServiceManager(), nil)
+
+	resp := bot.dispatchCommand(&Command{Action: "queue"})
+	assert.Contains(t, resp, "1 running, 0 queued (max 1 at once)")
+	assert.Contains(t, resp, "app1: deploy (webhook)")
+}
+
 func TestDispatch_StartAll(t *testing.T) {
 	mgr := newMockServiceManager()
 	bot := botForTest(t, newFakeMatrixClient(), mgr, nil)
@@ -402,48 +627,6 @@ func TestDispatch_Unknown(t *testing.T) {
 	assert.Contains(t, resp, "deploy")
 }
 
-// --- Status overview format tests ---
-
-func TestStatusOverview_Format(t *testing.T) {
-	states := map[string]service.ServiceState{
-		"web":    {Status: "running", LastResult: "success"},
-		"worker": {Status: "stopped"},
-	}
-	overview := formatStatusOverview(states)
-	assert.Contains(t, overview, "Service Status")
-	assert.Contains(t, overview, "web")
-	assert.Contains(t, overview, "running")
-	assert.Contains(t, overview, "worker")
-	assert.Contains(t, overview, "stopped")
-	assert.Contains(t, overview, "success")
-}
-
-func TestStatusOverview_Empty(t *testing.T) {
-	overview := formatStatusOverview(map[string]service.ServiceState{})
-	assert.Contains(t, overview, "No services")
-}
-
-func TestStatusOverview_Sorted(t *testing.T) {
-	states := map[string]service.ServiceState{
-		"zeta":  {Status: "running"},
-		"alpha": {Status: "stopped"},
-		"mu":    {Status: "running"},
-	}
-	overview := formatStatusOverview(states)
-	lines := strings.Split(overview, "\n")
-	var svcLines []string
-	for _, line := range lines {
-		if strings.HasPrefix(line, "- **") {
-			svcLines = append(svcLines, line)
-		}
-	}
-	require.Len(t, svcLines, 3)
-	sorted := make([]string, len(svcLines))
-	copy(sorted, svcLines)
-	sort.Strings(sorted)
-	assert.Equal(t, sorted, svcLines)
-}
-
 // --- Invite handling tests ---
 
 func makeMemberEvent(roomID id.RoomID, sender id.UserID, target string, membership event.Membership) *event.Event {
@@ -527,6 +710,7 @@ func TestHandleMessage_DispatchesCommand(t *testing.T) {
 
 	assert.Equal(t, "deploy", mgr.getLastOp())
 	assert.Equal(t, "myapp", mgr.getLastService())
+	assert.Equal(t, service.DeployRequest{Trigger: service.TriggerChat, Actor: "@user:example.org"}, mgr.deployReq)
 	sends := fake.getSends()
 	require.Len(t, sends, 1)
 	assert.Contains(t, messageBody(t, sends[0]), "Deploy requested")
@@ -4,7 +4,9 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/shishberg/mezzaops/internal/deploy"
 	"github.com/shishberg/mezzaops/internal/service"
+	"maunium.net/go/mautrix/id"
 )
 
 // matrixMaxRunes caps the rune count of a notification posted to a Matrix
@@ -17,6 +19,7 @@ const matrixMaxRunes = 32 * 1024
 // notifier tests independent of the rest of Bot's surface.
 type messageSender interface {
 	PostMessage(ctx context.Context, message string)
+	sendMessage(ctx context.Context, message string, replaces id.EventID) id.EventID
 }
 
 var _ service.Notifier = (*Notifier)(nil)
@@ -25,6 +28,9 @@ var _ service.Notifier = (*Notifier)(nil)
 // configured Matrix room via Bot.PostMessage.
 type Notifier struct {
 	sender messageSender
+
+	// progress tracks the event each running deploy's steps are shown in.
+	progress service.ProgressMessages
 }
 
 // NewNotifier creates a Notifier that posts events through sender.
@@ -37,25 +43,84 @@ func (n *Notifier) ServiceEvent(name, ev string) {
 	n.sender.PostMessage(context.Background(), fmt.Sprintf("`%s` %s.", name, ev))
 }
 
-// DeployStarted posts a deploy-started notification.
+// DeployStarted posts a deploy-started notification, which DeployProgress
+// then edits in place.
 func (n *Notifier) DeployStarted(name string) {
-	n.sender.PostMessage(context.Background(), fmt.Sprintf("Deploying `%s`...", name))
+	n.postProgress(name, fmt.Sprintf("Deploying `%s`...", name))
+}
+
+// DeployProgress edits the deploy-started message to show the steps so far.
+func (n *Notifier) DeployProgress(name string, steps []deploy.StepResult) {
+	if evID, msg, ok := n.progress.Render(name, steps); ok {
+		n.sender.sendMessage(context.Background(), msg, id.EventID(evID))
+	}
 }
 
-// DeploySucceeded posts a deploy-succeeded notification.
-func (n *Notifier) DeploySucceeded(name, _ string) {
-	n.sender.PostMessage(context.Background(), fmt.Sprintf("Deploy of `%s` succeeded.", name))
+// DeploySucceeded posts a deploy-succeeded notification listing the commits
+// that went out.
+func (n *Notifier) DeploySucceeded(name string, changes service.Changelog) {
+	n.progress.Done(name)
+	n.sender.PostMessage(context.Background(), changes.SucceededMessage(fmt.Sprintf("Deploy of `%s` succeeded.", name)))
 }
 
 // DeployFailed posts a deploy-failed notification with the failed step and
 // output. The output is truncated from the head (keeping the tail, where the
 // real error usually is) so the whole message stays under matrixMaxRunes.
-func (n *Notifier) DeployFailed(name, step, output string) {
-	const format = "Deploy of `%s` failed at step `%s`.\n```\n%s\n```"
-	scaffolding := fmt.Sprintf(format, name, step, "")
+func (n *Notifier) DeployFailed(name, step, output, logURL string) {
+	n.progress.Done(name)
+	n.postFailed("Deploy", name, step, output, logURL)
+}
+
+// DeployVerifyFailed posts a message saying the deploy failed verification
+// and whether it was rolled back, with the verification output truncated like
+// DeployFailed.
+func (n *Notifier) DeployVerifyFailed(name, rolledBackTo, output, logURL string) {
+	n.progress.Done(name)
+	headline := fmt.Sprintf("Deploy of `%s` failed verification and was not rolled back.", name)
+	if rolledBackTo != "" {
+		headline = fmt.Sprintf("Deploy of `%s` failed verification, rolled back to `%s`.", name, service.ShortSHA(rolledBackTo))
+	}
+	n.postWithOutput(service.WithLogLink(headline, logURL), output)
+}
+
+// RollbackStarted posts a rollback-started notification.
+func (n *Notifier) RollbackStarted(name, sha string) {
+	n.postProgress(name, fmt.Sprintf("Rolling back `%s` to `%s`...", name, service.ShortSHA(sha)))
+}
+
+// RollbackSucceeded posts a rollback-succeeded notification.
+func (n *Notifier) RollbackSucceeded(name, sha string) {
+	n.progress.Done(name)
+	n.sender.PostMessage(context.Background(), fmt.Sprintf("Rolled back `%s` to `%s`.", name, service.ShortSHA(sha)))
+}
+
+// RollbackFailed posts a rollback-failed notification, truncated like
+// DeployFailed.
+func (n *Notifier) RollbackFailed(name, step, output, logURL string) {
+	n.progress.Done(name)
+	n.postFailed("Rollback", name, step, output, logURL)
+}
+
+// postProgress posts the first message of a deploy and remembers it for
+// DeployProgress to edit.
+func (n *Notifier) postProgress(name, msg string) {
+	evID := n.sender.sendMessage(context.Background(), msg, "")
+	n.progress.Start(name, string(evID), msg)
+}
+
+func (n *Notifier) postFailed(what, name, step, output, logURL string) {
+	headline := fmt.Sprintf("%s of `%s` failed at step `%s`.", what, name, step)
+	n.postWithOutput(service.WithLogLink(headline, logURL), output)
+}
+
+// postWithOutput posts headline followed by output in a code block, truncating
+// output from the head so the whole message fits within Matrix's limit.
+func (n *Notifier) postWithOutput(headline, output string) {
+	const format = "%s\n```\n%s\n```"
+	scaffolding := fmt.Sprintf(format, headline, "")
 	budget := matrixMaxRunes - len([]rune(scaffolding))
 	truncated := service.TruncateTailToRuneBudget(output, budget)
-	n.sender.PostMessage(context.Background(), fmt.Sprintf(format, name, step, truncated))
+	n.sender.PostMessage(context.Background(), fmt.Sprintf(format, headline, truncated))
 }
 
 // WebhookReceived posts a notification describing an incoming webhook that
@@ -3,10 +3,13 @@ package matrix
 import (
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/shishberg/mezzaops/internal/deploy"
 	"github.com/shishberg/mezzaops/internal/service"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"maunium.net/go/mautrix/event"
 )
 
 func notifierBot(t *testing.T) (*Bot, *fakeMatrixClient) {
@@ -38,9 +41,32 @@ func TestNotifier_DeployStarted(t *testing.T) {
 	assert.Contains(t, body, "myapp")
 }
 
+func TestNotifier_DeployProgress(t *testing.T) {
+	bot, fake := notifierBot(t)
+	n := NewNotifier(bot)
+	n.DeployStarted("myapp")
+	n.DeployProgress("myapp", []deploy.StepResult{
+		{Step: "git pull", Status: "success", Duration: 2 * time.Second},
+		{Step: "go build", Status: "running"},
+	})
+	n.DeploySucceeded("myapp", service.Changelog{})
+	n.DeployProgress("myapp", []deploy.StepResult{{Step: "late", Status: "running"}})
+
+	sends := fake.getSends()
+	require.Len(t, sends, 3)
+	edit, ok := sends[1].Content.(event.MessageEventContent)
+	require.True(t, ok)
+	require.NotNil(t, edit.RelatesTo)
+	assert.Equal(t, event.RelReplace, edit.RelatesTo.Type)
+	assert.Equal(t, "$event1", edit.RelatesTo.EventID.String())
+	require.NotNil(t, edit.NewContent)
+	assert.Equal(t, "Deploying `myapp`...\n✅ git pull (2s) → ⏳ go build…", edit.NewContent.Body)
+	assert.Contains(t, messageBody(t, sends[2]), "succeeded")
+}
+
 func TestNotifier_DeploySucceeded(t *testing.T) {
 	bot, fake := notifierBot(t)
-	NewNotifier(bot).DeploySucceeded("myapp", "build output")
+	NewNotifier(bot).DeploySucceeded("myapp", service.Changelog{})
 
 	sends := fake.getSends()
 	require.Len(t, sends, 1)
@@ -49,9 +75,45 @@ func TestNotifier_DeploySucceeded(t *testing.T) {
 	assert.Contains(t, body, "myapp")
 }
 
+func TestNotifier_Rollback(t *testing.T) {
+	bot, fake := notifierBot(t)
+	n := NewNotifier(bot)
+	n.RollbackStarted("myapp", "0123456789abcdef")
+	n.RollbackSucceeded("myapp", "0123456789abcdef")
+	n.RollbackFailed("myapp", "go build .", "error output", "")
+
+	sends := fake.getSends()
+	require.Len(t, sends, 3)
+	assert.Contains(t, messageBody(t, sends[0]), "Rolling back `myapp` to `0123456`")
+	assert.Contains(t, messageBody(t, sends[1]), "Rolled back `myapp` to `0123456`")
+	assert.Contains(t, messageBody(t, sends[2]), "Rollback of `myapp` failed at step `go build .`")
+}
+
+func TestNotifier_DeployVerifyFailed(t *testing.T) {
+	bot, fake := notifierBot(t)
+	n := NewNotifier(bot)
+	n.DeployVerifyFailed("myapp", "0123456789abcdef", "service stopped", "")
+	n.DeployVerifyFailed("myapp", "", "check failed", "")
+
+	sends := fake.getSends()
+	require.Len(t, sends, 2)
+	assert.Contains(t, messageBody(t, sends[0]), "Deploy of `myapp` failed verification, rolled back to `0123456`.")
+	assert.Contains(t, messageBody(t, sends[0]), "service stopped")
+	assert.Contains(t, messageBody(t, sends[1]), "failed verification and was not rolled back")
+}
+
+func TestNotifier_DeployFailed_LogLink(t *testing.T) {
+	bot, fake := notifierBot(t)
+	NewNotifier(bot).DeployFailed("myapp", "build", "error output", "https://ops.example.com/log")
+
+	sends := fake.getSends()
+	require.Len(t, sends, 1)
+	assert.Contains(t, messageBody(t, sends[0]), "Deploy of `myapp` failed at step `build`. [Full log](https://ops.example.com/log)\n")
+}
+
 func TestNotifier_DeployFailed(t *testing.T) {
 	bot, fake := notifierBot(t)
-	NewNotifier(bot).DeployFailed("myapp", "build", "error output")
+	NewNotifier(bot).DeployFailed("myapp", "build", "error output", "")
 
 	sends := fake.getSends()
 	require.Len(t, sends, 1)
@@ -75,7 +137,7 @@ func TestNotifier_DeployFailed_LargeOutputTruncated(t *testing.T) {
 	b.WriteString(tailMarker)
 	output := b.String()
 
-	NewNotifier(bot).DeployFailed("slurp", "go test ./...", output)
+	NewNotifier(bot).DeployFailed("slurp", "go test ./...", output, "")
 
 	sends := fake.getSends()
 	require.Len(t, sends, 1)
@@ -6,7 +6,6 @@ import (
 	"fmt"
 	"log"
 	"slices"
-	"sort"
 	"strings"
 	"time"
 
@@ -14,11 +13,9 @@ import (
 	"github.com/shishberg/mezzaops/internal/service"
 )
 
-// Command represents a parsed bot command.
-type Command struct {
-	Action  string
-	Service string
-}
+// Command represents a parsed bot command. User is the sender's username,
+// filled in by the bot.
+type Command = service.ChatCommand
 
 // ParseCommand extracts a Command from a message directed at the bot.
 // The first word (the @mention) is skipped. Returns nil if there is no command.
@@ -35,24 +32,20 @@ func ParseCommand(message string) *Command {
 	if len(fields) >= 3 {
 		cmd.Service = fields[2]
 	}
+	if len(fields) > 3 {
+		cmd.Args = fields[3:]
+	}
 	return cmd
 }
 
 // ServiceManager is the interface the Mattermost frontend needs from the manager.
 type ServiceManager interface {
-	Do(name, op string) string
-	RequestDeploy(name string) error
-	StartAll()
-	StopAll()
-	Reload() error
-	ServiceNames() []string
-	CountRunning() (int, int)
-	GetAllStates() map[string]service.ServiceState
+	service.ChatManager
 }
 
-// ConfirmHandler handles deploy confirmations (implemented by App).
+// ConfirmHandler handles deploy approvals (implemented by App).
 type ConfirmHandler interface {
-	Confirm(service string) bool
+	service.ChatApprovals
 }
 
 // Config holds all configuration needed to connect to Mattermost.
@@ -65,7 +58,9 @@ type Config struct {
 // restClient abstracts the Mattermost REST API methods we use.
 type restClient interface {
 	GetMe(ctx context.Context, etag string) (*model.User, *model.Response, error)
+	GetUser(ctx context.Context, userId, etag string) (*model.User, *model.Response, error)
 	CreatePost(ctx context.Context, post *model.Post) (*model.Post, *model.Response, error)
+	PatchPost(ctx context.Context, postId string, patch *model.PostPatch) (*model.Post, *model.Response, error)
 	GetChannel(ctx context.Context, channelId string) (*model.Channel, *model.Response, error)
 	GetChannelByNameForTeamName(ctx context.Context, channelName, teamName string, etag string) (*model.Channel, *model.Response, error)
 }
@@ -107,12 +102,6 @@ const (
 	maxReconnectDelay     = 5 * time.Minute
 )
 
-// validCommands lists the commands accepted by the bot, used in error messages.
-var validCommands = []string{
-	"status", "start", "stop", "restart", "logs", "pull",
-	"deploy", "confirm", "reload", "start-all", "stop-all",
-}
-
 // Bot connects to Mattermost via the SDK and dispatches commands.
 type Bot struct {
 	cfg       Config
@@ -175,12 +164,28 @@ func (b *Bot) Ready() <-chan struct{} {
 
 // PostMessage sends a message to the configured Mattermost channel.
 func (b *Bot) PostMessage(ctx context.Context, message string) {
+	b.post(ctx, message)
+}
+
+// post sends a message to the configured channel and returns the post ID, or
+// "" if it failed.
+func (b *Bot) post(ctx context.Context, message string) string {
 	post := &model.Post{
 		ChannelId: b.channelID,
 		Message:   message,
 	}
-	if _, _, err := b.rest.CreatePost(ctx, post); err != nil {
+	created, _, err := b.rest.CreatePost(ctx, post)
+	if err != nil {
 		log.Printf("mattermost: post message: %v", err)
+		return ""
+	}
+	return created.Id
+}
+
+// editPost replaces the message of a post made by the bot.
+func (b *Bot) editPost(ctx context.Context, postID, message string) {
+	if _, _, err := b.rest.PatchPost(ctx, postID, &model.PostPatch{Message: &message}); err != nil {
+		log.Printf("mattermost: edit post: %v", err)
 	}
 }
 
@@ -307,93 +312,27 @@ func (b *Bot) handleEvent(ctx context.Context, event *model.WebSocketEvent) {
 	if cmd == nil {
 		return
 	}
+	cmd.User = b.username(ctx, post.UserId)
 
 	response := b.dispatchCommand(cmd)
 	b.PostMessage(ctx, response)
 }
 
-// dispatchCommand routes a parsed command to the appropriate manager method.
-func (b *Bot) dispatchCommand(cmd *Command) string {
-	switch strings.ToLower(cmd.Action) {
-	case "status":
-		if cmd.Service == "" {
-			return b.handleStatusOverview()
-		}
-		return b.manager.Do(cmd.Service, "status")
-
-	case "start", "stop", "restart", "logs", "pull":
-		return b.manager.Do(cmd.Service, strings.ToLower(cmd.Action))
-
-	case "deploy":
-		if err := b.manager.RequestDeploy(cmd.Service); err != nil {
-			return fmt.Sprintf("Deploy error: %v", err)
-		}
-		return fmt.Sprintf("Deploy requested for **%s**.", cmd.Service)
-
-	case "confirm":
-		return b.handleConfirm(cmd.Service)
-
-	case "reload":
-		if err := b.manager.Reload(); err != nil {
-			return fmt.Sprintf("Reload error: %v", err)
-		}
-		return "Config reloaded."
-
-	case "start-all":
-		b.manager.StartAll()
-		return "All services starting."
-
-	case "stop-all":
-		b.manager.StopAll()
-		return "All services stopping."
-
-	default:
-		return fmt.Sprintf("Unknown command: %q. Valid commands: %s",
-			cmd.Action, strings.Join(validCommands, ", "))
+// username returns the Mattermost username of the user with the given ID,
+// looked up rather than taken from the event's sender_name, which is a
+// display name anyone can set. If the lookup fails it returns the ID.
+func (b *Bot) username(ctx context.Context, userID string) string {
+	user, _, err := b.rest.GetUser(ctx, userID, "")
+	if err != nil || user.Username == "" {
+		log.Printf("mattermost: looking up user %s: %v", userID, err)
+		return userID
 	}
+	return user.Username
 }
 
-// handleStatusOverview builds a markdown overview of all service states.
-func (b *Bot) handleStatusOverview() string {
-	states := b.manager.GetAllStates()
-	return formatStatusOverview(states)
-}
-
-// formatStatusOverview formats service states as a markdown list.
-func formatStatusOverview(states map[string]service.ServiceState) string {
-	if len(states) == 0 {
-		return "No services configured."
-	}
-
-	// Sort names for deterministic output
-	names := make([]string, 0, len(states))
-	for name := range states {
-		names = append(names, name)
-	}
-	sort.Strings(names)
-
-	var sb strings.Builder
-	sb.WriteString("**Service Status**\n")
-	for _, name := range names {
-		state := states[name]
-		fmt.Fprintf(&sb, "- **%s**: %s", name, state.Status)
-		if state.LastResult != "" {
-			fmt.Fprintf(&sb, " (last: %s)", state.LastResult)
-		}
-		sb.WriteString("\n")
-	}
-	return sb.String()
-}
-
-// handleConfirm dispatches to the confirm handler if set.
-func (b *Bot) handleConfirm(svc string) string {
-	if b.confirm == nil {
-		return "Confirm handler not configured."
-	}
-	if !b.confirm.Confirm(svc) {
-		return fmt.Sprintf("No pending deploy confirmation for **%s** (or it expired).", svc)
-	}
-	return fmt.Sprintf("Confirmed deploy for **%s**.", svc)
+// dispatchCommand routes a parsed command to the appropriate manager method.
+func (b *Bot) dispatchCommand(cmd *Command) string {
+	return service.DispatchChat(b.manager, b.confirm, cmd)
 }
 
 // isMentioned checks the "mentions" field in the event data for our user ID.
@@ -3,7 +3,7 @@ package mattermost
 import (
 	"context"
 	"fmt"
-	"sort"
+	"maps"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/shishberg/mezzaops/internal/deploy"
 	"github.com/shishberg/mezzaops/internal/service"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -33,6 +34,7 @@ func TestParseCommand(t *testing.T) {
 		{"logs command", "@mezzaops logs myapp", &Command{Action: "logs", Service: "myapp"}},
 		{"pull command", "@mezzaops pull myapp", &Command{Action: "pull", Service: "myapp"}},
 		{"reload command", "@mezzaops reload", &Command{Action: "reload"}},
+		{"rollback with target", "@mezzaops rollback myapp 2", &Command{Action: "rollback", Service: "myapp", Args: []string{"2"}}},
 		{"start-all command", "@mezzaops start-all", &Command{Action: "start-all"}},
 		{"stop-all command", "@mezzaops stop-all", &Command{Action: "stop-all"}},
 		{"with extra whitespace", "  @mezzaops   deploy   myapp  ", &Command{Action: "deploy", Service: "myapp"}},
@@ -96,21 +98,52 @@ func (m *mockWSClient) SetListenError(err *model.AppError) {
 
 // mockRestClient implements restClient for testing.
 type mockRestClient struct {
-	mu    sync.Mutex
-	posts []*model.Post
+	mu      sync.Mutex
+	posts   []*model.Post
+	patches map[string]string // post ID -> patched message
+	users   map[string]string // user ID -> username
 }
 
 func (m *mockRestClient) GetMe(_ context.Context, _ string) (*model.User, *model.Response, error) {
 	return &model.User{Id: "bot-user-id"}, &model.Response{}, nil
 }
 
+func (m *mockRestClient) GetUser(_ context.Context, userId, _ string) (*model.User, *model.Response, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	name, ok := m.users[userId]
+	if !ok {
+		return nil, &model.Response{StatusCode: 404}, fmt.Errorf("user %s not found", userId)
+	}
+	return &model.User{Id: userId, Username: name}, &model.Response{}, nil
+}
+
 func (m *mockRestClient) CreatePost(_ context.Context, post *model.Post) (*model.Post, *model.Response, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	m.posts = append(m.posts, post)
+	if post.Id == "" {
+		post.Id = fmt.Sprintf("post-%d", len(m.posts))
+	}
 	return post, &model.Response{}, nil
 }
 
+func (m *mockRestClient) PatchPost(_ context.Context, postId string, patch *model.PostPatch) (*model.Post, *model.Response, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.patches == nil {
+		m.patches = make(map[string]string)
+	}
+	m.patches[postId] = *patch.Message
+	return &model.Post{Id: postId, Message: *patch.Message}, &model.Response{}, nil
+}
+
+func (m *mockRestClient) getPatches() map[string]string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return maps.Clone(m.patches)
+}
+
 func (m *mockRestClient) GetChannel(_ context.Context, channelId string) (*model.Channel, *model.Response, error) {
 	return &model.Channel{Id: channelId}, &model.Response{}, nil
 }
@@ -134,6 +167,14 @@ type mockServiceManager struct {
 	lastService string
 	doResult    string
 	deployErr   error
+	deployReq   service.DeployRequest
+	rollbackTo  string
+	cancelActor string
+	cancelErr   error
+	freezeFor   time.Duration
+	freezeErr   error
+	resumeErr   error
+	scheduleAt  time.Time
 	reloadErr   error
 	names       []string
 	states      map[string]service.ServiceState
@@ -158,14 +199,80 @@ func (m *mockServiceManager) Do(name, op string) string {
 	return m.doResult
 }
 
-func (m *mockServiceManager) RequestDeploy(name string) error {
+func (m *mockServiceManager) RequestDeploy(name string, req service.DeployRequest) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	m.lastService = name
 	m.lastOp = "deploy"
+	m.deployReq = req
 	return m.deployErr
 }
 
+func (m *mockServiceManager) RequestRollback(name, target string, req service.DeployRequest) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastService = name
+	m.lastOp = "rollback"
+	m.deployReq = req
+	m.rollbackTo = target
+	return "0123456789abcdef", m.deployErr
+}
+
+func (m *mockServiceManager) CancelDeploy(name, actor string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastService = name
+	m.lastOp = "cancel"
+	m.cancelActor = actor
+	return m.cancelErr
+}
+
+func (m *mockServiceManager) Freeze(target string, d time.Duration, reason, actor string) (service.Freeze, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastService = target
+	m.lastOp = "freeze"
+	m.freezeFor = d
+	return service.Freeze{Target: target, Reason: reason, By: actor}, m.freezeErr
+}
+
+func (m *mockServiceManager) Unfreeze(target, actor string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastService = target
+	m.lastOp = "unfreeze"
+	return m.freezeErr
+}
+
+func (m *mockServiceManager) Resume(name, actor string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastService = name
+	m.lastOp = "resume"
+	return m.resumeErr
+}
+
+func (m *mockServiceManager) ScheduleDeploy(name string, at time.Time, req service.DeployRequest) (service.ScheduledDeploy, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastService = name
+	m.lastOp = "schedule"
+	m.scheduleAt = at
+	m.deployReq = req
+	return service.ScheduledDeploy{ID: "1", At: at, QueuedDeploy: service.QueuedDeploy{Service: name, DeployRequest: req}}, nil
+}
+
+func (m *mockServiceManager) ScheduledDeploys() []service.ScheduledDeploy {
+	return nil
+}
+
+func (m *mockServiceManager) Unschedule(id, actor string) (service.ScheduledDeploy, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastOp = "unschedule"
+	return service.ScheduledDeploy{ID: id, QueuedDeploy: service.QueuedDeploy{Service: "myapp"}}, nil
+}
+
 func (m *mockServiceManager) StartAll() {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -195,6 +302,13 @@ func (m *mockServiceManager) CountRunning() (int, int) {
 	return 1, 2
 }
 
+func (m *mockServiceManager) DeployQueue() service.DeployQueue {
+	return service.DeployQueue{
+		MaxConcurrent: 1,
+		Running:       []service.QueuedDeploy{{Service: "app1", DeployRequest: service.DeployRequest{Trigger: service.TriggerWebhook}}},
+	}
+}
+
 func (m *mockServiceManager) GetAllStates() map[string]service.ServiceState {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -218,14 +332,30 @@ func (m *mockServiceManager) getLastService() string {
 type mockConfirmHandler struct {
 	mu          sync.Mutex
 	lastService string
-	result      bool
+	lastActor   string
+	approval    service.PendingApproval
+	err         error
+	pending     []service.PendingApproval
+}
+
+func (h *mockConfirmHandler) Confirm(svc, actor string) (service.PendingApproval, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastService = svc
+	h.lastActor = actor
+	return h.approval, h.err
 }
 
-func (h *mockConfirmHandler) Confirm(svc string) bool {
+func (h *mockConfirmHandler) Deny(svc, actor string) error {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 	h.lastService = svc
-	return h.result
+	h.lastActor = actor
+	return h.err
+}
+
+func (h *mockConfirmHandler) PendingApprovals() []service.PendingApproval {
+	return h.pending
 }
 
 func (h *mockConfirmHandler) getLastService() string {
@@ -456,11 +586,30 @@ func TestHandleEvent_DispatchesCommand(t *testing.T) {
 
 	assert.Equal(t, "deploy", mgr.getLastOp())
 	assert.Equal(t, "myapp", mgr.getLastService())
+	assert.Equal(t, service.DeployRequest{Trigger: service.TriggerChat, Actor: "other-user"}, mgr.deployReq)
 	posts := rest.getPosts()
 	require.Len(t, posts, 1)
 	assert.Contains(t, posts[0].Message, "Deploy requested")
 }
 
+func TestHandleEvent_DeployActorIsUsername(t *testing.T) {
+	mgr := newMockServiceManager()
+	bot := &Bot{
+		cfg:       Config{URL: "http://localhost"},
+		manager:   mgr,
+		rest:      &mockRestClient{users: map[string]string{"other-user": "alice"}},
+		userID:    "bot-user-id",
+		channelID: "channel-123",
+	}
+
+	// The sender's display name is theirs to set, so it isn't trusted.
+	event := makePostEvent("channel-123", "other-user", "@mezzaops deploy myapp")
+	event.GetData()["sender_name"] = "@bob"
+	bot.handleEvent(context.Background(), event)
+
+	assert.Equal(t, "alice", mgr.deployReq.Actor)
+}
+
 func TestHandleEvent_IgnoresOwnMessages(t *testing.T) {
 	mgr := newMockServiceManager()
 	rest := &mockRestClient{}
@@ -652,6 +801,25 @@ func TestHandleEvent_Pull(t *testing.T) {
 	assert.Equal(t, "myapp", mgr.getLastService())
 }
 
+func TestHandleEvent_Plan(t *testing.T) {
+	mgr := newMockServiceManager()
+	rest := &mockRestClient{}
+
+	bot := &Bot{
+		cfg:       Config{URL: "http://localhost"},
+		manager:   mgr,
+		rest:      rest,
+		userID:    "bot-user-id",
+		channelID: "channel-123",
+	}
+
+	event := makePostEvent("channel-123", "other-user", "@mezzaops plan myapp")
+	bot.handleEvent(context.Background(), event)
+
+	assert.Equal(t, "plan", mgr.getLastOp())
+	assert.Equal(t, "myapp", mgr.getLastService())
+}
+
 func TestHandleEvent_StatusSingleService(t *testing.T) {
 	mgr := newMockServiceManager()
 	mgr.doResult = "running"
@@ -699,6 +867,14 @@ func TestHandleEvent_StatusOverview(t *testing.T) {
 	assert.Contains(t, posts[0].Message, "app2")
 }
 
+func TestDispatchCommand_Queue(t *testing.T) {
+	bot := &Bot{manager: newMockServiceManager()}
+
+	resp := bot.dispatchCommand(&Command{Action: "queue"})
+	assert.Contains(t, resp, "1 running, 0 queued (max 1 at once)")
+	assert.Contains(t, resp, "app1: deploy (webhook)")
+}
+
 func TestHandleEvent_Reload(t *testing.T) {
 	mgr := newMockServiceManager()
 	rest := &mockRestClient{}
@@ -805,6 +981,160 @@ func TestHandleEvent_Deploy(t *testing.T) {
 	assert.Contains(t, posts[0].Message, "Deploy requested")
 }
 
+func TestDispatchCommand_DeployRef(t *testing.T) {
+	mgr := newMockServiceManager()
+	bot := &Bot{manager: mgr}
+
+	resp := bot.dispatchCommand(&Command{Action: "deploy", Service: "myapp@v1.4.2"})
+	assert.Equal(t, "myapp", mgr.getLastService())
+	assert.Equal(t, "v1.4.2", mgr.deployReq.Ref)
+	assert.Equal(t, "Deploy requested for **myapp** at `v1.4.2`.", resp)
+}
+
+func TestDispatchCommand_DeployAlreadyDeployed(t *testing.T) {
+	mgr := newMockServiceManager()
+	mgr.deployErr = &service.AlreadyDeployedError{Service: "myapp", Commit: "0123456789abcdef"}
+	bot := &Bot{manager: mgr}
+
+	resp := bot.dispatchCommand(&Command{Action: "deploy", Service: "myapp"})
+	assert.Equal(t, "**myapp** is already at `0123456`. Add `--force` to deploy it again.", resp)
+	assert.False(t, mgr.deployReq.Force)
+
+	mgr.deployErr = nil
+	resp = bot.dispatchCommand(&Command{Action: "deploy", Service: "myapp", Args: []string{"--force"}})
+	assert.True(t, mgr.deployReq.Force)
+	assert.Equal(t, "Deploy requested for **myapp**.", resp)
+}
+
+func TestHandleEvent_Rollback(t *testing.T) {
+	mgr := newMockServiceManager()
+	rest := &mockRestClient{}
+
+	bot := &Bot{
+		cfg:       Config{URL: "http://localhost"},
+		manager:   mgr,
+		rest:      rest,
+		userID:    "bot-user-id",
+		channelID: "channel-123",
+	}
+
+	event := makePostEvent("channel-123", "other-user", "@mezzaops rollback myapp abc1234")
+	bot.handleEvent(context.Background(), event)
+
+	assert.Equal(t, "rollback", mgr.getLastOp())
+	assert.Equal(t, "myapp", mgr.getLastService())
+	assert.Equal(t, "abc1234", mgr.rollbackTo)
+	assert.Equal(t, service.TriggerChat, mgr.deployReq.Trigger)
+	posts := rest.getPosts()
+	require.Len(t, posts, 1)
+	assert.Contains(t, posts[0].Message, "Rollback of **myapp** to `0123456` requested")
+}
+
+func TestHandleEvent_Cancel(t *testing.T) {
+	mgr := newMockServiceManager()
+	rest := &mockRestClient{}
+
+	bot := &Bot{
+		cfg:       Config{URL: "http://localhost"},
+		manager:   mgr,
+		rest:      rest,
+		userID:    "bot-user-id",
+		channelID: "channel-123",
+	}
+
+	event := makePostEvent("channel-123", "other-user", "@mezzaops cancel myapp")
+	bot.handleEvent(context.Background(), event)
+
+	assert.Equal(t, "cancel", mgr.getLastOp())
+	assert.Equal(t, "myapp", mgr.getLastService())
+	posts := rest.getPosts()
+	require.Len(t, posts, 1)
+	assert.Equal(t, "Cancelling deploy of **myapp**.", posts[0].Message)
+}
+
+func TestHandleEvent_Freeze(t *testing.T) {
+	mgr := newMockServiceManager()
+	rest := &mockRestClient{}
+
+	bot := &Bot{
+		cfg:       Config{URL: "http://localhost"},
+		manager:   mgr,
+		rest:      rest,
+		userID:    "bot-user-id",
+		channelID: "channel-123",
+	}
+
+	event := makePostEvent("channel-123", "other-user", "@mezzaops freeze all 3d release week")
+	bot.handleEvent(context.Background(), event)
+
+	assert.Equal(t, "freeze", mgr.getLastOp())
+	assert.Equal(t, "all", mgr.getLastService())
+	assert.Equal(t, 72*time.Hour, mgr.freezeFor)
+	posts := rest.getPosts()
+	require.Len(t, posts, 1)
+	assert.Contains(t, posts[0].Message, "**all** frozen by ")
+	assert.Contains(t, posts[0].Message, ": release week. Pushes will be held until it lifts.")
+
+	bot.handleEvent(context.Background(), makePostEvent("channel-123", "other-user", "@mezzaops unfreeze all"))
+	assert.Equal(t, "unfreeze", mgr.getLastOp())
+	posts = rest.getPosts()
+	require.Len(t, posts, 2)
+	assert.Equal(t, "Unfroze **all**.", posts[1].Message)
+}
+
+func TestHandleEvent_Resume(t *testing.T) {
+	mgr := newMockServiceManager()
+	rest := &mockRestClient{}
+
+	bot := &Bot{
+		cfg:       Config{URL: "http://localhost"},
+		manager:   mgr,
+		rest:      rest,
+		userID:    "bot-user-id",
+		channelID: "channel-123",
+	}
+
+	bot.handleEvent(context.Background(), makePostEvent("channel-123", "other-user", "@mezzaops resume myapp"))
+	assert.Equal(t, "resume", mgr.getLastOp())
+	assert.Equal(t, "myapp", mgr.getLastService())
+	posts := rest.getPosts()
+	require.Len(t, posts, 1)
+	assert.Equal(t, "Resumed auto-deploy of **myapp**.", posts[0].Message)
+}
+
+func TestHandleEvent_ScheduleDeploy(t *testing.T) {
+	mgr := newMockServiceManager()
+	rest := &mockRestClient{}
+
+	bot := &Bot{
+		cfg:       Config{URL: "http://localhost"},
+		manager:   mgr,
+		rest:      rest,
+		userID:    "bot-user-id",
+		channelID: "channel-123",
+	}
+
+	before := time.Now()
+	bot.handleEvent(context.Background(), makePostEvent("channel-123", "other-user", "@mezzaops deploy myapp in 2h --force"))
+
+	assert.Equal(t, "schedule", mgr.getLastOp())
+	assert.Equal(t, "myapp", mgr.getLastService())
+	assert.WithinDuration(t, before.Add(2*time.Hour), mgr.scheduleAt, time.Minute)
+	assert.True(t, mgr.deployReq.Force)
+	posts := rest.getPosts()
+	require.Len(t, posts, 1)
+	assert.Contains(t, posts[0].Message, "Deploy #1 of **myapp** scheduled for ")
+
+	bot.handleEvent(context.Background(), makePostEvent("channel-123", "other-user", "@mezzaops unschedule 1"))
+	assert.Equal(t, "unschedule", mgr.getLastOp())
+	posts = rest.getPosts()
+	require.Len(t, posts, 2)
+	assert.Equal(t, "Cancelled scheduled deploy #1 of **myapp**.", posts[1].Message)
+
+	assert.Equal(t, "no deploys scheduled\n", bot.dispatchCommand(&Command{Action: "scheduled"}))
+	assert.Contains(t, bot.dispatchCommand(&Command{Action: "deploy", Service: "myapp", Args: []string{"at", "noon"}}), "Deploy error: invalid time")
+}
+
 func TestHandleEvent_DeployError(t *testing.T) {
 	mgr := newMockServiceManager()
 	mgr.deployErr = fmt.Errorf("service not found")
@@ -829,7 +1159,7 @@ func TestHandleEvent_DeployError(t *testing.T) {
 func TestHandleEvent_Confirm(t *testing.T) {
 	mgr := newMockServiceManager()
 	rest := &mockRestClient{}
-	ch := &mockConfirmHandler{result: true}
+	ch := &mockConfirmHandler{}
 
 	bot := &Bot{
 		cfg:       Config{URL: "http://localhost"},
@@ -844,15 +1174,22 @@ func TestHandleEvent_Confirm(t *testing.T) {
 	bot.handleEvent(context.Background(), event)
 
 	assert.Equal(t, "myapp", ch.getLastService())
+	assert.Equal(t, "other-user", ch.lastActor)
 	posts := rest.getPosts()
 	require.Len(t, posts, 1)
 	assert.Contains(t, posts[0].Message, "Confirmed")
+
+	ch.approval = service.PendingApproval{Service: "myapp", Required: 2, ApprovedBy: []string{"other-user"}}
+	bot.handleEvent(context.Background(), event)
+	posts = rest.getPosts()
+	require.Len(t, posts, 2)
+	assert.Equal(t, "Approved deploy for **myapp** (1 of 2 approvals).", posts[1].Message)
 }
 
 func TestHandleEvent_ConfirmNoPending(t *testing.T) {
 	mgr := newMockServiceManager()
 	rest := &mockRestClient{}
-	ch := &mockConfirmHandler{result: false}
+	ch := &mockConfirmHandler{err: fmt.Errorf("no deploy of myapp awaiting approval (or it expired)")}
 
 	bot := &Bot{
 		cfg:       Config{URL: "http://localhost"},
@@ -868,7 +1205,34 @@ func TestHandleEvent_ConfirmNoPending(t *testing.T) {
 
 	posts := rest.getPosts()
 	require.Len(t, posts, 1)
-	assert.Contains(t, posts[0].Message, "No pending")
+	assert.Equal(t, "Confirm error: no deploy of myapp awaiting approval (or it expired)", posts[0].Message)
+}
+
+func TestHandleEvent_DenyAndPending(t *testing.T) {
+	mgr := newMockServiceManager()
+	rest := &mockRestClient{}
+	ch := &mockConfirmHandler{pending: []service.PendingApproval{
+		{Service: "myapp", Branch: "main", Pusher: "bob", Required: 2, ApprovedBy: []string{"alice"}, Since: time.Now()},
+	}}
+
+	bot := &Bot{
+		cfg:       Config{URL: "http://localhost"},
+		manager:   mgr,
+		rest:      rest,
+		confirm:   ch,
+		userID:    "bot-user-id",
+		channelID: "channel-123",
+	}
+
+	bot.handleEvent(context.Background(), makePostEvent("channel-123", "other-user", "@mezzaops pending"))
+	bot.handleEvent(context.Background(), makePostEvent("channel-123", "other-user", "@mezzaops deny myapp"))
+
+	assert.Equal(t, "myapp", ch.getLastService())
+	assert.Equal(t, "other-user", ch.lastActor)
+	posts := rest.getPosts()
+	require.Len(t, posts, 2)
+	assert.Contains(t, posts[0].Message, "myapp: push on main pushed by bob, 1 of 2 approvals (alice), waiting ")
+	assert.Equal(t, "Denied deploy for **myapp**.", posts[1].Message)
 }
 
 func TestHandleEvent_ConfirmNoHandler(t *testing.T) {
@@ -995,6 +1359,30 @@ func TestNotifier_DeployStarted(t *testing.T) {
 	assert.Contains(t, posts[0].Message, "myapp")
 }
 
+func TestNotifier_DeployProgress(t *testing.T) {
+	rest := &mockRestClient{}
+	bot := &Bot{
+		rest:      rest,
+		channelID: "channel-123",
+	}
+
+	n := NewNotifier(bot)
+	n.DeployStarted("myapp")
+	n.DeployProgress("myapp", []deploy.StepResult{
+		{Step: "git pull", Status: "success", Duration: 2 * time.Second},
+		{Step: "go build", Status: "running"},
+	})
+	n.DeployFailed("myapp", "go build", "boom", "")
+	n.DeployProgress("myapp", []deploy.StepResult{{Step: "late", Status: "running"}})
+
+	posts := rest.getPosts()
+	require.Len(t, posts, 2)
+	assert.Equal(t, "Deploying `myapp`...", posts[0].Message)
+	assert.Equal(t, map[string]string{
+		"post-1": "Deploying `myapp`...\n✅ git pull (2s) → ⏳ go build…",
+	}, rest.getPatches())
+}
+
 func TestNotifier_DeploySucceeded(t *testing.T) {
 	rest := &mockRestClient{}
 	bot := &Bot{
@@ -1003,12 +1391,54 @@ func TestNotifier_DeploySucceeded(t *testing.T) {
 	}
 
 	n := NewNotifier(bot)
-	n.DeploySucceeded("myapp", "build output here")
+	n.DeploySucceeded("myapp", service.Changelog{
+		Before:  "1111111aaaa",
+		After:   "2222222bbbb",
+		Commits: []service.PlanCommit{{SHA: "2222222bbbb", Author: "alice", Subject: "Fix login"}},
+	})
 
 	posts := rest.getPosts()
 	require.Len(t, posts, 1)
 	assert.Contains(t, posts[0].Message, "succeeded")
 	assert.Contains(t, posts[0].Message, "myapp")
+	assert.Contains(t, posts[0].Message, "- `2222222` Fix login (alice)")
+}
+
+func TestNotifier_Rollback(t *testing.T) {
+	rest := &mockRestClient{}
+	bot := &Bot{
+		rest:      rest,
+		channelID: "channel-123",
+	}
+
+	n := NewNotifier(bot)
+	n.RollbackStarted("myapp", "0123456789abcdef")
+	n.RollbackSucceeded("myapp", "0123456789abcdef")
+	n.RollbackFailed("myapp", "go build .", "error output", "")
+
+	posts := rest.getPosts()
+	require.Len(t, posts, 3)
+	assert.Equal(t, "Rolling back `myapp` to `0123456`...", posts[0].Message)
+	assert.Equal(t, "Rolled back `myapp` to `0123456`.", posts[1].Message)
+	assert.Contains(t, posts[2].Message, "Rollback of `myapp` failed at step `go build .`")
+	assert.Contains(t, posts[2].Message, "error output")
+}
+
+func TestNotifier_DeployVerifyFailed(t *testing.T) {
+	rest := &mockRestClient{}
+	bot := &Bot{
+		rest:      rest,
+		channelID: "channel-123",
+	}
+
+	n := NewNotifier(bot)
+	n.DeployVerifyFailed("myapp", "0123456789abcdef", "service stopped", "")
+	n.DeployVerifyFailed("myapp", "", "check failed", "")
+
+	posts := rest.getPosts()
+	require.Len(t, posts, 2)
+	assert.Equal(t, "Deploy of `myapp` failed verification, rolled back to `0123456`.\n```\nservice stopped\n```", posts[0].Message)
+	assert.Equal(t, "Deploy of `myapp` failed verification and was not rolled back.\n```\ncheck failed\n```", posts[1].Message)
 }
 
 func TestNotifier_DeployFailed(t *testing.T) {
@@ -1019,7 +1449,7 @@ func TestNotifier_DeployFailed(t *testing.T) {
 	}
 
 	n := NewNotifier(bot)
-	n.DeployFailed("myapp", "build", "error output")
+	n.DeployFailed("myapp", "build", "error output", "")
 
 	posts := rest.getPosts()
 	require.Len(t, posts, 1)
@@ -1048,7 +1478,7 @@ func TestNotifier_DeployFailed_LargeOutputTruncated(t *testing.T) {
 	output := b.String()
 
 	n := NewNotifier(bot)
-	n.DeployFailed("slurp", "go test -short ./...", output)
+	n.DeployFailed("slurp", "go test -short ./...", output, "")
 
 	posts := rest.getPosts()
 	require.Len(t, posts, 1)
@@ -1157,28 +1587,6 @@ func TestNotifier_WebhookReceived_LongCommitMsg(t *testing.T) {
 	assert.NotContains(t, msg, long)
 }
 
-// --- Status overview format test ---
-
-func TestStatusOverview_Format(t *testing.T) {
-	states := map[string]service.ServiceState{
-		"web":    {Status: "running", LastResult: "success"},
-		"worker": {Status: "stopped"},
-	}
-
-	overview := formatStatusOverview(states)
-	assert.Contains(t, overview, "Service Status")
-	assert.Contains(t, overview, "web")
-	assert.Contains(t, overview, "running")
-	assert.Contains(t, overview, "worker")
-	assert.Contains(t, overview, "stopped")
-	assert.Contains(t, overview, "success")
-}
-
-func TestStatusOverview_Empty(t *testing.T) {
-	overview := formatStatusOverview(map[string]service.ServiceState{})
-	assert.Contains(t, overview, "No services")
-}
-
 // --- SetConfirmHandler test ---
 
 func TestSetConfirmHandler(t *testing.T) {
@@ -1188,29 +1596,3 @@ func TestSetConfirmHandler(t *testing.T) {
 	bot.SetConfirmHandler(ch)
 	assert.Equal(t, ch, bot.confirm)
 }
-
-// --- Status overview is deterministic (sorted) ---
-
-func TestStatusOverview_Sorted(t *testing.T) {
-	states := map[string]service.ServiceState{
-		"zeta":  {Status: "running"},
-		"alpha": {Status: "stopped"},
-		"mu":    {Status: "running"},
-	}
-
-	overview := formatStatusOverview(states)
-	lines := strings.Split(overview, "\n")
-
-	// Find lines with service names and verify they're sorted
-	var svcLines []string
-	for _, line := range lines {
-		if strings.HasPrefix(line, "- **") {
-			svcLines = append(svcLines, line)
-		}
-	}
-	require.Len(t, svcLines, 3)
-	sorted := make([]string, len(svcLines))
-	copy(sorted, svcLines)
-	sort.Strings(sorted)
-	assert.Equal(t, sorted, svcLines)
-}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 
 	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/shishberg/mezzaops/internal/deploy"
 	"github.com/shishberg/mezzaops/internal/service"
 )
 
@@ -14,6 +15,9 @@ var _ service.Notifier = (*Notifier)(nil)
 // Notifier implements service.Notifier by posting to Mattermost.
 type Notifier struct {
 	bot *Bot
+
+	// progress tracks the post each running deploy's steps are shown in.
+	progress service.ProgressMessages
 }
 
 // NewNotifier creates a Notifier that posts events to the bot's channel.
@@ -26,25 +30,83 @@ func (n *Notifier) ServiceEvent(name, event string) {
 	n.bot.PostMessage(context.Background(), fmt.Sprintf("`%s` %s.", name, event))
 }
 
-// DeployStarted posts a deploy-started notification.
+// DeployStarted posts a deploy-started notification, which DeployProgress
+// then edits in place.
 func (n *Notifier) DeployStarted(name string) {
-	n.bot.PostMessage(context.Background(), fmt.Sprintf("Deploying `%s`...", name))
+	n.postProgress(name, fmt.Sprintf("Deploying `%s`...", name))
+}
+
+// DeployProgress edits the deploy-started post to show the steps so far.
+func (n *Notifier) DeployProgress(name string, steps []deploy.StepResult) {
+	if id, msg, ok := n.progress.Render(name, steps); ok {
+		n.bot.editPost(context.Background(), id, msg)
+	}
 }
 
-// DeploySucceeded posts a deploy-succeeded notification.
-func (n *Notifier) DeploySucceeded(name, output string) {
-	n.bot.PostMessage(context.Background(), fmt.Sprintf("Deploy of `%s` succeeded.", name))
+// DeploySucceeded posts a deploy-succeeded notification listing the commits
+// that went out.
+func (n *Notifier) DeploySucceeded(name string, changes service.Changelog) {
+	n.progress.Done(name)
+	n.bot.PostMessage(context.Background(), changes.SucceededMessage(fmt.Sprintf("Deploy of `%s` succeeded.", name)))
 }
 
 // DeployFailed posts a deploy-failed notification with the failed step and output.
 // The output is truncated from the head (keeping the tail, where errors tend to
 // be) so the whole message fits within Mattermost's server-side rune limit.
-func (n *Notifier) DeployFailed(name, step, output string) {
-	const format = "Deploy of `%s` failed at step `%s`.\n```\n%s\n```"
-	scaffolding := fmt.Sprintf(format, name, step, "")
+func (n *Notifier) DeployFailed(name, step, output, logURL string) {
+	n.progress.Done(name)
+	n.postFailed("Deploy", name, step, output, logURL)
+}
+
+// DeployVerifyFailed posts a message saying the deploy failed verification
+// and whether it was rolled back, with the verification output truncated like
+// DeployFailed.
+func (n *Notifier) DeployVerifyFailed(name, rolledBackTo, output, logURL string) {
+	n.progress.Done(name)
+	headline := fmt.Sprintf("Deploy of `%s` failed verification and was not rolled back.", name)
+	if rolledBackTo != "" {
+		headline = fmt.Sprintf("Deploy of `%s` failed verification, rolled back to `%s`.", name, service.ShortSHA(rolledBackTo))
+	}
+	n.postWithOutput(service.WithLogLink(headline, logURL), output)
+}
+
+// RollbackStarted posts a rollback-started notification.
+func (n *Notifier) RollbackStarted(name, sha string) {
+	n.postProgress(name, fmt.Sprintf("Rolling back `%s` to `%s`...", name, service.ShortSHA(sha)))
+}
+
+// RollbackSucceeded posts a rollback-succeeded notification.
+func (n *Notifier) RollbackSucceeded(name, sha string) {
+	n.progress.Done(name)
+	n.bot.PostMessage(context.Background(), fmt.Sprintf("Rolled back `%s` to `%s`.", name, service.ShortSHA(sha)))
+}
+
+// RollbackFailed posts a rollback-failed notification, truncated like
+// DeployFailed.
+func (n *Notifier) RollbackFailed(name, step, output, logURL string) {
+	n.progress.Done(name)
+	n.postFailed("Rollback", name, step, output, logURL)
+}
+
+// postProgress posts the first message of a deploy and remembers it for
+// DeployProgress to edit.
+func (n *Notifier) postProgress(name, msg string) {
+	n.progress.Start(name, n.bot.post(context.Background(), msg), msg)
+}
+
+func (n *Notifier) postFailed(what, name, step, output, logURL string) {
+	headline := fmt.Sprintf("%s of `%s` failed at step `%s`.", what, name, step)
+	n.postWithOutput(service.WithLogLink(headline, logURL), output)
+}
+
+// postWithOutput posts headline followed by output in a code block, truncating
+// output from the head so the whole message fits within Mattermost's limit.
+func (n *Notifier) postWithOutput(headline, output string) {
+	const format = "%s\n```\n%s\n```"
+	scaffolding := fmt.Sprintf(format, headline, "")
 	budget := model.PostMessageMaxRunesV2 - len([]rune(scaffolding))
 	truncated := service.TruncateTailToRuneBudget(output, budget)
-	n.bot.PostMessage(context.Background(), fmt.Sprintf(format, name, step, truncated))
+	n.bot.PostMessage(context.Background(), fmt.Sprintf(format, headline, truncated))
 }
 
 // WebhookReceived posts a notification describing an incoming webhook that
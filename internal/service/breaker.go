@@ -0,0 +1,94 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// trackFailuresLocked counts a finished deploy towards the service's run of
+// failed deploys. Once pause_after_failures deploys in a row have failed,
+// automatic deploys are paused, and a successful deploy resumes them. It
+// returns a note for the channel if either happened. Cancelled deploys
+// neither count nor break the run. ms.stateMu must be held.
+func (ms *managedService) trackFailuresLocked(result string) string {
+	switch result {
+	case "success":
+		paused := ms.state.AutoDeployPaused
+		ms.state.FailedDeploys = 0
+		ms.state.AutoDeployPaused = false
+		if paused {
+			return "auto-deploy resumed after a successful deploy"
+		}
+	case "failed":
+		ms.state.FailedDeploys++
+		limit := ms.config.PauseAfterFailures
+		if limit > 0 && ms.state.FailedDeploys >= limit && !ms.state.AutoDeployPaused {
+			ms.state.AutoDeployPaused = true
+			return fmt.Sprintf("auto-deploy paused after %d failed deploys in a row; "+
+				"pushes are held until a deploy succeeds or `resume %s`", ms.state.FailedDeploys, ms.config.Name)
+		}
+	}
+	return ""
+}
+
+// notifyBreaker posts the note left by trackFailuresLocked, if any, once the
+// deploy's own success or failure has been reported.
+func (m *Manager) notifyBreaker(ms *managedService) {
+	ms.stateMu.Lock()
+	note := ms.breakerNote
+	ms.breakerNote = ""
+	ms.stateMu.Unlock()
+	if note != "" {
+		m.notifyEvent(ms.config.Name, note)
+	}
+}
+
+// autoDeployPaused returns how many deploys in a row have failed if that
+// paused automatic deploys of the named service, or 0 if they are not
+// paused.
+func (m *Manager) autoDeployPaused(name string) int {
+	m.mu.Lock()
+	ms, ok := m.services[name]
+	m.mu.Unlock()
+	if !ok {
+		return 0
+	}
+	ms.stateMu.Lock()
+	defer ms.stateMu.Unlock()
+	if !ms.state.AutoDeployPaused {
+		return 0
+	}
+	return ms.state.FailedDeploys
+}
+
+// Resume resumes automatic deploys of the named service after failed
+// deploys paused them, deploying any push held meanwhile unless deploys are
+// still paused for another reason.
+func (m *Manager) Resume(name, actor string) error {
+	m.mu.Lock()
+	ms, ok := m.services[name]
+	m.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("service %q not found", name)
+	}
+
+	ms.stateMu.Lock()
+	if !ms.state.AutoDeployPaused {
+		ms.stateMu.Unlock()
+		return fmt.Errorf("auto-deploy of %s is not paused", name)
+	}
+	ms.state.AutoDeployPaused = false
+	ms.state.FailedDeploys = 0
+	ms.stateMu.Unlock()
+	m.saveServiceState(ms)
+
+	note := "auto-deploy resumed"
+	if actor != "" {
+		note += " by " + actor
+	}
+	log.Printf("**%s**: %s", name, note)
+	m.notifyEvent(name, note)
+	m.checkFreezes(time.Now())
+	return nil
+}
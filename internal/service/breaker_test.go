@@ -0,0 +1,156 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shishberg/mezzaops/internal/config"
+)
+
+// waitForEvent polls until the notifier has seen a service event containing
+// substr, returning how many such events there were.
+func waitForEvent(t *testing.T, rec *recordingNotifier, substr string) int {
+	t.Helper()
+	deadline := time.After(10 * time.Second)
+	for {
+		n := 0
+		for _, e := range rec.getServiceEvents() {
+			if strings.Contains(e.a, substr) {
+				n++
+			}
+		}
+		if n > 0 {
+			return n
+		}
+		select {
+		case <-deadline:
+			t.Fatalf("timed out waiting for event %q; got %+v", substr, rec.getServiceEvents())
+		case <-time.After(20 * time.Millisecond):
+		}
+	}
+}
+
+func TestManager_AutoDeployBreaker(t *testing.T) {
+	dir, commit := gitRepo(t)
+	head := commit("one")
+	ok := filepath.Join(dir, "ok")
+
+	cfg := testConfig(t)
+	rec := &recordingNotifier{}
+	svc := sleepService("testsvc", dir)
+	svc.Deploy = config.Steps("test -f ok")
+	svc.PauseAfterFailures = 2
+	m, err := NewManager(cfg, []config.ServiceConfig{svc}, rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Stop()
+
+	deploy := func(n int) {
+		t.Helper()
+		if err := m.RequestDeploy("testsvc", DeployRequest{Trigger: TriggerChat, Actor: "alice"}); err != nil {
+			t.Fatal(err)
+		}
+		waitForHistory(t, m, "testsvc", n)
+	}
+
+	deploy(1)
+	if got := m.DeployBlock("testsvc"); got != "" {
+		t.Fatalf("paused after one failure: %q", got)
+	}
+	deploy(2)
+	waitForEvent(t, rec, "auto-deploy paused after 2 failed deploys in a row")
+	if got := m.DeployBlock("testsvc"); got != "auto-deploy paused after 2 failed deploys in a row" {
+		t.Fatalf("DeployBlock = %q", got)
+	}
+	if s, _, err := LoadState(cfg.StateDir, "testsvc"); err != nil || !s.AutoDeployPaused || s.FailedDeploys != 2 {
+		t.Errorf("persisted state = %+v, %v; want paused after 2 failures", s, err)
+	}
+
+	// Manual deploys still run, and the pause is only announced once.
+	deploy(3)
+	time.Sleep(100 * time.Millisecond)
+	if n := waitForEvent(t, rec, "auto-deploy paused"); n != 1 {
+		t.Errorf("pause announced %d times, want once", n)
+	}
+
+	// Resuming deploys the push held meanwhile.
+	if err := m.HoldDeploy("testsvc", DeployRequest{Trigger: TriggerWebhook, Actor: "bob", Commit: head}); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(ok, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Resume("testsvc", "carol"); err != nil {
+		t.Fatal(err)
+	}
+	waitForEvent(t, rec, "auto-deploy resumed by carol")
+	if records := waitForHistory(t, m, "testsvc", 4); records[0].Actor != "bob" || records[0].Result != "success" {
+		t.Errorf("last deploy = %+v, want bob's held push deployed", records[0])
+	}
+	if err := m.Resume("testsvc", "carol"); err == nil {
+		t.Error("Resume should fail when auto-deploy is not paused")
+	}
+
+	// A successful deploy resumes auto-deploy too.
+	if err := os.Remove(ok); err != nil {
+		t.Fatal(err)
+	}
+	deploy(5)
+	deploy(6)
+	if m.DeployBlock("testsvc") == "" {
+		t.Fatal("not paused after two more failures")
+	}
+
+	// Resuming with no one to credit says so.
+	if err := m.Resume("testsvc", ""); err != nil {
+		t.Fatal(err)
+	}
+	var resumed []string
+	for _, e := range rec.getServiceEvents() {
+		if strings.HasPrefix(e.a, "auto-deploy resumed") {
+			resumed = append(resumed, e.a)
+		}
+	}
+	if want := []string{"auto-deploy resumed by carol", "auto-deploy resumed"}; !slices.Equal(resumed, want) {
+		t.Errorf("resume events = %q, want %q", resumed, want)
+	}
+	deploy(7)
+	deploy(8)
+	if m.DeployBlock("testsvc") == "" {
+		t.Fatal("not paused after two more failures")
+	}
+	if err := os.WriteFile(ok, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	deploy(9)
+	waitForEvent(t, rec, "auto-deploy resumed after a successful deploy")
+	if got := m.DeployBlock("testsvc"); got != "" {
+		t.Errorf("DeployBlock after a successful deploy = %q", got)
+	}
+}
+
+func TestManager_AutoDeployBreakerOff(t *testing.T) {
+	rec := &recordingNotifier{}
+	svc := sleepService("testsvc", t.TempDir())
+	svc.Deploy = config.Steps("false")
+	m, err := NewManager(testConfig(t), []config.ServiceConfig{svc}, rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Stop()
+
+	for n := 1; n <= 3; n++ {
+		if err := m.RequestDeploy("testsvc", DeployRequest{Trigger: TriggerChat}); err != nil {
+			t.Fatal(err)
+		}
+		waitForHistory(t, m, "testsvc", n)
+	}
+	if got := m.DeployBlock("testsvc"); got != "" {
+		t.Errorf("DeployBlock without pause_after_failures = %q", got)
+	}
+}
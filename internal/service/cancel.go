@@ -0,0 +1,93 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// errDeployCancelled is the cancellation cause of a deploy stopped by
+// CancelDeploy, as opposed to one stopped by the manager shutting down.
+var errDeployCancelled = errors.New("deploy cancelled")
+
+// CancelDeploy cancels the named service's running deploy or rollback. The
+// running step's whole process group is killed and no further steps run. The
+// service's process was not stopped, so it keeps running the old version.
+// actor is recorded in history as who cancelled it. If the service's deploy
+// is still waiting in the queue, it is just removed.
+func (m *Manager) CancelDeploy(name, actor string) error {
+	m.mu.Lock()
+	ms, ok := m.services[name]
+	m.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("service %q not found", name)
+	}
+
+	ms.stateMu.Lock()
+	cancel := ms.cancelDeploy
+	if cancel != nil {
+		ms.cancelledBy = actor
+	}
+	ms.stateMu.Unlock()
+
+	if cancel == nil {
+		if d, ok := m.dequeueDeploy(name); ok {
+			m.restoreStatus(ms)
+			event := fmt.Sprintf("queued %s cancelled", d)
+			if actor != "" {
+				event += " by " + actor
+			}
+			m.notifyEvent(name, event)
+			return nil
+		}
+		return fmt.Errorf("no deploy in progress for %s", name)
+	}
+	cancel(errDeployCancelled)
+	return nil
+}
+
+// finishIfCancelled records the deploy as cancelled and reports true if
+// CancelDeploy stopped it. step is the step that was running.
+func (m *Manager) finishIfCancelled(ctx context.Context, ms *managedService, rec *DeployRecord, req DeployRequest, step, output string) bool {
+	if !errors.Is(context.Cause(ctx), errDeployCancelled) {
+		return false
+	}
+
+	ms.stateMu.Lock()
+	rec.CancelledBy = ms.cancelledBy
+	ms.stateMu.Unlock()
+
+	status, err := ms.backend.Status(m.ctx)
+	if err != nil {
+		status = "unknown"
+	}
+	m.recordDeploy(ms, rec, status, "cancelled", step, output)
+
+	event := "deploy cancelled"
+	if req.Rollback {
+		event = "rollback cancelled"
+	}
+	if step != "" {
+		event += fmt.Sprintf(" during `%s`", step)
+	}
+	if rec.CancelledBy != "" {
+		event += " by " + rec.CancelledBy
+	}
+	m.notifyEvent(ms.config.Name, event)
+	return true
+}
+
+// restoreStatus replaces a queued status with the backend's, once the
+// service's queued deploy is gone.
+func (m *Manager) restoreStatus(ms *managedService) {
+	status, err := ms.backend.Status(m.ctx)
+	if err != nil {
+		status = "unknown"
+	}
+	ms.stateMu.Lock()
+	if ms.state.Status == "queued" {
+		ms.state.Status = status
+	}
+	ms.stateMu.Unlock()
+}
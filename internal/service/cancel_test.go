@@ -0,0 +1,96 @@
+package service
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shishberg/mezzaops/internal/config"
+)
+
+func TestManager_CancelDeploy(t *testing.T) {
+	cfg := testConfig(t)
+	rec := &recordingNotifier{}
+
+	svc := sleepService("testsvc", t.TempDir())
+	svc.Deploy = []config.DeployStep{
+		{Run: "true"},
+		// The background sleep only goes away if the whole group is killed.
+		{Name: "build", Run: "sleep 30 & sleep 30"},
+		{Run: "echo should not run"},
+	}
+
+	m, err := NewManager(cfg, []config.ServiceConfig{svc}, rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Stop()
+
+	if out := m.Do("testsvc", "start"); !strings.Contains(out, "started") {
+		t.Fatalf("start: %s", out)
+	}
+
+	if err := m.CancelDeploy("testsvc", "alice"); err == nil {
+		t.Fatal("expected error cancelling with no deploy running")
+	}
+
+	if err := m.RequestDeploy("testsvc", DeployRequest{Trigger: TriggerChat, Actor: "bob"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Wait for the hanging step to start.
+	deadline := time.After(10 * time.Second)
+	for {
+		progress := rec.getDeployProgress()
+		if n := len(progress); n > 0 {
+			last := progress[n-1]
+			if s := last[len(last)-1]; s.Step == "build" && s.Status == "running" {
+				break
+			}
+		}
+		select {
+		case <-deadline:
+			t.Fatal("timed out waiting for build step")
+		case <-time.After(20 * time.Millisecond):
+		}
+	}
+
+	start := time.Now()
+	if err := m.CancelDeploy("testsvc", "alice"); err != nil {
+		t.Fatal(err)
+	}
+
+	records := waitForHistory(t, m, "testsvc", 1)
+	if time.Since(start) > 5*time.Second {
+		t.Fatalf("cancel took %s", time.Since(start))
+	}
+	r := records[0]
+	if r.Result != "cancelled" || r.FailedStep != "build" || r.CancelledBy != "alice" {
+		t.Fatalf("record = result %q step %q by %q", r.Result, r.FailedStep, r.CancelledBy)
+	}
+	if len(r.Steps) != 2 {
+		t.Fatalf("ran %d steps, want 2", len(r.Steps))
+	}
+
+	st := m.GetAllStates()["testsvc"]
+	if st.Status != "running" || st.LastResult != "cancelled" {
+		t.Fatalf("state = status %q result %q, want running/cancelled", st.Status, st.LastResult)
+	}
+	if len(rec.getDeployFailed()) != 0 || len(rec.getDeploySucceeded()) != 0 {
+		t.Fatal("cancelled deploy should not report success or failure")
+	}
+
+	var found bool
+	for _, ev := range rec.getServiceEvents() {
+		if ev.a == "deploy cancelled during `build` by alice" {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("no cancel event in %+v", rec.getServiceEvents())
+	}
+
+	if err := m.CancelDeploy("testsvc", "alice"); err == nil {
+		t.Fatal("expected error cancelling a finished deploy")
+	}
+}
@@ -0,0 +1,105 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Changelogs list at most this many commits; the rest are counted.
+const changelogCommitLimit = 10
+
+// changelogSubjectLimit caps each commit subject in a changelog, so a full
+// one fits in a chat message.
+const changelogSubjectLimit = 72
+
+// Changelog is what a successful deploy brought in, for its notification.
+type Changelog struct {
+	Before  string       // the commit checked out before the deploy
+	After   string       // the commit checked out after it
+	Commits []PlanCommit // Before..After, newest first
+	Compare string       // a link to the diff on GitHub, if the repo is there
+}
+
+// deployChangelog lists the commits between before and after in dir. repo is
+// the service's repo setting, used for the compare link if it is on GitHub.
+// Commits it can't list, e.g. for a deploy that moved HEAD backwards, are
+// left out.
+func deployChangelog(ctx context.Context, dir, repo, before, after string) Changelog {
+	c := Changelog{Before: before, After: after}
+	if before == "" || after == "" || before == after {
+		return c
+	}
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	g := &gitCmds{ctx: ctx, dir: dir}
+	if out, _, err := g.quiet("log", "--format=%H%x1f%an%x1f%s", before+".."+after); err == nil {
+		for _, line := range gitLines(out) {
+			f := strings.SplitN(line, "\x1f", 3)
+			if len(f) == 3 {
+				c.Commits = append(c.Commits, PlanCommit{SHA: f[0], Author: f[1], Subject: f[2]})
+			}
+		}
+	}
+	if path := githubPath(repo); path != "" {
+		c.Compare = fmt.Sprintf("https://github.com/%s/compare/%s...%s", path, before, after)
+	}
+	return c
+}
+
+// githubPath returns the "org/name" of a repo on GitHub, given as a full name,
+// a host path, a URL or an scp-style address, or "" if it isn't on GitHub.
+func githubPath(repo string) string {
+	path := repo
+	if _, rest, ok := strings.Cut(path, "://"); ok {
+		path = rest
+	}
+	path = strings.TrimPrefix(path, "git@")
+	if host, rest, ok := strings.Cut(path, ":"); ok {
+		path = host + "/" + rest
+	}
+	if host, rest, ok := strings.Cut(path, "/"); ok && strings.Contains(host, ".") {
+		if host != "github.com" {
+			return ""
+		}
+		path = rest
+	}
+	path = strings.TrimSuffix(strings.TrimSuffix(path, "/"), ".git")
+	org, name, ok := strings.Cut(path, "/")
+	if !ok || org == "" || name == "" || strings.Contains(name, "/") {
+		return ""
+	}
+	return path
+}
+
+// Format renders the changelog as Markdown lines to follow a deploy-succeeded
+// headline, e.g. "- `abc1234` Fix login (alice)", or "" if there is nothing
+// to list.
+func (c Changelog) Format() string {
+	var b strings.Builder
+	for i, commit := range c.Commits {
+		if i == changelogCommitLimit {
+			fmt.Fprintf(&b, "- +%d more\n", len(c.Commits)-i)
+			break
+		}
+		subject := commit.Subject
+		if r := []rune(subject); len(r) > changelogSubjectLimit {
+			subject = string(r[:changelogSubjectLimit]) + "..."
+		}
+		fmt.Fprintf(&b, "- `%s` %s (%s)\n", ShortSHA(commit.SHA), subject, commit.Author)
+	}
+	if c.Compare != "" {
+		fmt.Fprintf(&b, "[Compare %s...%s](%s)\n", ShortSHA(c.Before), ShortSHA(c.After), c.Compare)
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// SucceededMessage returns a deploy-succeeded headline followed by the
+// changelog, if it has anything to show.
+func (c Changelog) SucceededMessage(headline string) string {
+	if log := c.Format(); log != "" {
+		return headline + "\n" + log
+	}
+	return headline
+}
@@ -0,0 +1,107 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shishberg/mezzaops/internal/config"
+)
+
+func TestDeployChangelog(t *testing.T) {
+	dir, commit := gitRepo(t)
+	before := commit("one")
+	commit("Add widgets")
+	after := commit("Polish widgets")
+
+	c := deployChangelog(context.Background(), dir, "github.com/org/api", before, after)
+	if len(c.Commits) != 2 || c.Commits[0].Subject != "Polish widgets" || c.Commits[1].Author != "t" {
+		t.Errorf("commits = %+v", c.Commits)
+	}
+	if want := "https://github.com/org/api/compare/" + before + "..." + after; c.Compare != want {
+		t.Errorf("compare = %q, want %q", c.Compare, want)
+	}
+
+	want := fmt.Sprintf("Deploy of api succeeded.\n- `%s` Polish widgets (t)\n- `%s` Add widgets (t)\n[Compare %s...%s](%s)",
+		ShortSHA(after), ShortSHA(c.Commits[1].SHA), ShortSHA(before), ShortSHA(after), c.Compare)
+	if got := c.SucceededMessage("Deploy of api succeeded."); got != want {
+		t.Errorf("message = %q, want %q", got, want)
+	}
+
+	// Repos on GitHub get a compare link however they are given; others
+	// don't.
+	for _, repo := range []string{"org/api", "https://github.com/org/api", "https://github.com/org/api.git",
+		"git@github.com:org/api.git", "ssh://git@github.com/org/api.git"} {
+		if c := deployChangelog(context.Background(), dir, repo, before, after); !strings.HasPrefix(c.Compare, "https://github.com/org/api/compare/") {
+			t.Errorf("compare for %s = %q", repo, c.Compare)
+		}
+	}
+	for _, repo := range []string{"git@gitlab.com:org/api.git", "https://gitlab.com/org/api", "/srv/git/api", "/api"} {
+		if c := deployChangelog(context.Background(), dir, repo, before, after); c.Compare != "" {
+			t.Errorf("compare for %s = %q, want none", repo, c.Compare)
+		}
+	}
+	if c := deployChangelog(context.Background(), dir, "gitlab.com/org/api", before, after); c.Compare != "" || len(c.Commits) != 2 {
+		t.Errorf("changelog for a GitLab repo = %+v", c)
+	}
+	// Nothing went out.
+	if got := deployChangelog(context.Background(), dir, "github.com/org/api", after, after).SucceededMessage("ok"); got != "ok" {
+		t.Errorf("message with no change = %q", got)
+	}
+}
+
+func TestChangelog_FormatCapsCommits(t *testing.T) {
+	var c Changelog
+	for i := range 13 {
+		c.Commits = append(c.Commits, PlanCommit{SHA: fmt.Sprintf("%07d", i), Author: "t", Subject: fmt.Sprintf("change %d", i)})
+	}
+	c.Commits[0].Subject = strings.Repeat("x", 100)
+
+	lines := strings.Split(c.Format(), "\n")
+	if len(lines) != changelogCommitLimit+1 {
+		t.Fatalf("got %d lines, want %d:\n%s", len(lines), changelogCommitLimit+1, c.Format())
+	}
+	if want := "- `0000000` " + strings.Repeat("x", changelogSubjectLimit) + "... (t)"; lines[0] != want {
+		t.Errorf("long subject = %q, want %q", lines[0], want)
+	}
+	if got := lines[len(lines)-1]; got != "- +3 more" {
+		t.Errorf("last line = %q, want +3 more", got)
+	}
+}
+
+func TestManager_DeploySucceededChangelog(t *testing.T) {
+	dir, commit := gitRepo(t)
+	before := commit("one")
+
+	rec := &recordingNotifier{}
+	svc := sleepService("testsvc", dir)
+	svc.Repo = "github.com/org/testsvc"
+	svc.Deploy = config.Steps("git -c user.name=t -c user.email=t@example.com commit -q --allow-empty -m 'Ship it'")
+	m, err := NewManager(testConfig(t), []config.ServiceConfig{svc}, rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Stop()
+
+	if err := m.RequestDeploy("testsvc", DeployRequest{Trigger: TriggerChat}); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.After(10 * time.Second)
+	for len(rec.getDeploySucceeded()) == 0 {
+		select {
+		case <-deadline:
+			t.Fatal("timed out waiting for deploy")
+		case <-time.After(20 * time.Millisecond):
+		}
+	}
+
+	c := rec.getDeploySucceeded()[0].changes
+	if c.Before != before || len(c.Commits) != 1 || c.Commits[0].Subject != "Ship it" || c.Commits[0].SHA != c.After {
+		t.Errorf("changelog = %+v, want the commit the deploy made", c)
+	}
+	if !strings.HasPrefix(c.Compare, "https://github.com/org/testsvc/compare/"+before+"...") {
+		t.Errorf("compare = %q", c.Compare)
+	}
+}
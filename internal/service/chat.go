@@ -0,0 +1,226 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ChatCommand is a command typed into one of the text chat frontends
+// (Mattermost and Matrix), which parse their messages into it.
+type ChatCommand struct {
+	Action  string
+	Service string
+	Args    []string // any further tokens, nil if there are none
+	User    string   // sender, as the frontend identifies them
+}
+
+// ChatManager is the part of the manager API the text chat frontends use.
+type ChatManager interface {
+	Do(name, op string) string
+	RequestDeploy(name string, req DeployRequest) error
+	RequestRollback(name, target string, req DeployRequest) (string, error)
+	CancelDeploy(name, actor string) error
+	Freeze(target string, d time.Duration, reason, actor string) (Freeze, error)
+	Unfreeze(target, actor string) error
+	Resume(name, actor string) error
+	ScheduleDeploy(name string, at time.Time, req DeployRequest) (ScheduledDeploy, error)
+	ScheduledDeploys() []ScheduledDeploy
+	Unschedule(id, actor string) (ScheduledDeploy, error)
+	StartAll()
+	StopAll()
+	Reload() error
+	ServiceNames() []string
+	CountRunning() (int, int)
+	DeployQueue() DeployQueue
+	GetAllStates() map[string]ServiceState
+}
+
+// ChatApprovals approves or denies a push to a service with
+// require_confirmation or approvals, which a webhook left awaiting approval.
+type ChatApprovals interface {
+	Confirm(service, actor string) (PendingApproval, error)
+	Deny(service, actor string) error
+	PendingApprovals() []PendingApproval
+}
+
+// ChatCommands lists the commands DispatchChat accepts, for the
+// unknown-command response.
+var ChatCommands = []string{
+	"status", "start", "stop", "restart", "logs", "pull", "plan",
+	"history", "deploy", "rollback", "cancel", "freeze", "unfreeze", "resume", "confirm", "deny", "pending", "queue",
+	"scheduled", "unschedule", "reload", "start-all", "stop-all",
+}
+
+// DispatchChat runs a text chat command against the manager and returns a
+// markdown response. approvals may be nil if no handler is configured.
+func DispatchChat(m ChatManager, approvals ChatApprovals, cmd *ChatCommand) string {
+	switch strings.ToLower(cmd.Action) {
+	case "status":
+		if cmd.Service == "" {
+			return FormatStatusOverview(m.GetAllStates())
+		}
+		return m.Do(cmd.Service, "status")
+
+	case "start", "stop", "restart", "logs", "pull", "plan", "history":
+		return m.Do(cmd.Service, strings.ToLower(cmd.Action))
+
+	case "deploy":
+		name, ref := SplitRef(cmd.Service)
+		at, args, err := ParseSchedule(cmd.Args, time.Now())
+		if err != nil {
+			return fmt.Sprintf("Deploy error: %v", err)
+		}
+		req := DeployRequest{Trigger: TriggerChat, Actor: cmd.User, Ref: ref,
+			Force: slices.Contains(args, "--force")}
+		if !at.IsZero() {
+			s, err := m.ScheduleDeploy(name, at, req)
+			if err != nil {
+				return fmt.Sprintf("Schedule error: %v", err)
+			}
+			return fmt.Sprintf("Deploy #%s of **%s** scheduled for %s.", s.ID, name, s.When())
+		}
+		if err := m.RequestDeploy(name, req); err != nil {
+			var already *AlreadyDeployedError
+			if errors.As(err, &already) {
+				return fmt.Sprintf("**%s** is already at `%s`. Add `--force` to deploy it again.", name, ShortSHA(already.Commit))
+			}
+			return fmt.Sprintf("Deploy error: %v", err)
+		}
+		if ref != "" {
+			return fmt.Sprintf("Deploy requested for **%s** at `%s`.", name, ref)
+		}
+		return fmt.Sprintf("Deploy requested for **%s**.", name)
+
+	case "rollback":
+		var target string
+		if len(cmd.Args) > 0 {
+			target = cmd.Args[0]
+		}
+		req := DeployRequest{Trigger: TriggerChat, Actor: cmd.User}
+		sha, err := m.RequestRollback(cmd.Service, target, req)
+		if err != nil {
+			return fmt.Sprintf("Rollback error: %v", err)
+		}
+		return fmt.Sprintf("Rollback of **%s** to `%s` requested.", cmd.Service, ShortSHA(sha))
+
+	case "cancel":
+		if err := m.CancelDeploy(cmd.Service, cmd.User); err != nil {
+			return fmt.Sprintf("Cancel error: %v", err)
+		}
+		return fmt.Sprintf("Cancelling deploy of **%s**.", cmd.Service)
+
+	case "freeze":
+		d, reason := ParseFreezeArgs(cmd.Args)
+		f, err := m.Freeze(cmd.Service, d, reason, cmd.User)
+		if err != nil {
+			return fmt.Sprintf("Freeze error: %v", err)
+		}
+		return fmt.Sprintf("**%s** %s. Pushes will be held until it lifts.", cmd.Service, f)
+
+	case "unfreeze":
+		if err := m.Unfreeze(cmd.Service, cmd.User); err != nil {
+			return fmt.Sprintf("Unfreeze error: %v", err)
+		}
+		return fmt.Sprintf("Unfroze **%s**.", cmd.Service)
+
+	case "resume":
+		if err := m.Resume(cmd.Service, cmd.User); err != nil {
+			return fmt.Sprintf("Resume error: %v", err)
+		}
+		return fmt.Sprintf("Resumed auto-deploy of **%s**.", cmd.Service)
+
+	case "confirm":
+		if approvals == nil {
+			return "Confirm handler not configured."
+		}
+		p, err := approvals.Confirm(cmd.Service, cmd.User)
+		if err != nil {
+			return fmt.Sprintf("Confirm error: %v", err)
+		}
+		if !p.Approved() {
+			return fmt.Sprintf("Approved deploy for **%s** (%d of %d approvals).", cmd.Service, len(p.ApprovedBy), p.Required)
+		}
+		return fmt.Sprintf("Confirmed deploy for **%s**.", cmd.Service)
+
+	case "deny":
+		if approvals == nil {
+			return "Confirm handler not configured."
+		}
+		if err := approvals.Deny(cmd.Service, cmd.User); err != nil {
+			return fmt.Sprintf("Deny error: %v", err)
+		}
+		return fmt.Sprintf("Denied deploy for **%s**.", cmd.Service)
+
+	case "pending":
+		if approvals == nil {
+			return "Confirm handler not configured."
+		}
+		return FormatPending(approvals.PendingApprovals())
+
+	case "queue":
+		return FormatQueue(m.DeployQueue())
+
+	case "scheduled":
+		return FormatSchedule(m.ScheduledDeploys())
+
+	case "unschedule":
+		s, err := m.Unschedule(cmd.Service, cmd.User)
+		if err != nil {
+			return fmt.Sprintf("Unschedule error: %v", err)
+		}
+		return fmt.Sprintf("Cancelled scheduled deploy #%s of **%s**.", s.ID, s.Service)
+
+	case "reload":
+		if err := m.Reload(); err != nil {
+			return fmt.Sprintf("Reload error: %v", err)
+		}
+		return "Config reloaded."
+
+	case "start-all":
+		m.StartAll()
+		return "All services starting."
+
+	case "stop-all":
+		m.StopAll()
+		return "All services stopping."
+
+	default:
+		return fmt.Sprintf("Unknown command: %q. Valid commands: %s",
+			cmd.Action, strings.Join(ChatCommands, ", "))
+	}
+}
+
+// FormatStatusOverview formats service states as a markdown list, sorted by
+// service name so the output is deterministic.
+func FormatStatusOverview(states map[string]ServiceState) string {
+	if len(states) == 0 {
+		return "No services configured."
+	}
+	names := make([]string, 0, len(states))
+	for name := range states {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var sb strings.Builder
+	sb.WriteString("**Service Status**\n")
+	for _, name := range names {
+		state := states[name]
+		fmt.Fprintf(&sb, "- **%s**: %s", name, state.Status)
+		if state.LastResult != "" {
+			fmt.Fprintf(&sb, " (last: %s)", state.LastResult)
+		}
+		if state.Paused != "" {
+			fmt.Fprintf(&sb, " — %s", state.Paused)
+		}
+		if state.Held != nil {
+			sb.WriteString(", push held")
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
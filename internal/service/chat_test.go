@@ -0,0 +1,42 @@
+package service
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFormatStatusOverview(t *testing.T) {
+	states := map[string]ServiceState{
+		"zeta":   {Status: "stopped"},
+		"web":    {Status: "running", LastResult: "success"},
+		"worker": {Status: "running", Paused: "frozen by alice", Held: &HeldDeploy{Actor: "bob"}},
+	}
+
+	want := `**Service Status**
+- **web**: running (last: success)
+- **worker**: running — frozen by alice, push held
+- **zeta**: stopped
+`
+	if got := FormatStatusOverview(states); got != want {
+		t.Errorf("FormatStatusOverview =\n%s\nwant\n%s", got, want)
+	}
+	if got := FormatStatusOverview(nil); got != "No services configured." {
+		t.Errorf("FormatStatusOverview(nil) = %q", got)
+	}
+}
+
+func TestDispatchChat_NoApprovals(t *testing.T) {
+	for _, action := range []string{"confirm", "deny", "pending"} {
+		got := DispatchChat(nil, nil, &ChatCommand{Action: action, Service: "api"})
+		if got != "Confirm handler not configured." {
+			t.Errorf("%s without approvals = %q", action, got)
+		}
+	}
+}
+
+func TestDispatchChat_Unknown(t *testing.T) {
+	got := DispatchChat(nil, nil, &ChatCommand{Action: "foobar"})
+	if !strings.HasPrefix(got, `Unknown command: "foobar". Valid commands: status, start,`) {
+		t.Errorf("unknown command = %q", got)
+	}
+}
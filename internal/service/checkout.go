@@ -0,0 +1,202 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/shishberg/mezzaops/internal/config"
+	"github.com/shishberg/mezzaops/internal/deploy"
+)
+
+// checkoutRef is the built-in checkout phase of a deploy with a ref. It
+// fetches from origin (if fetch is set and the repo has an origin), resolves
+// ref to a commit and checks it out with a detached HEAD. A branch name
+// resolves to origin's copy first, so `deploy svc@main` gets the latest.
+// The deploy branch itself is left alone; the next plain deploy checks it
+// out again. It refuses to run over local changes rather than lose them.
+func checkoutRef(ctx context.Context, dir, ref string, fetch bool, env []string) (sr deploy.StepResult) {
+	sr = deploy.StepResult{Step: "checkout " + ref, Status: "failed"}
+	start := time.Now()
+	g := &gitCmds{ctx: ctx, dir: dir, env: env}
+	defer func() {
+		sr.Output = g.out.String()
+		sr.Duration = time.Since(start)
+	}()
+
+	if !g.clean() {
+		return sr
+	}
+	if fetch && !g.fetch() {
+		return sr
+	}
+	sha := g.resolve(ref)
+	if sha == "" {
+		return sr
+	}
+	if g.run("checkout", "--quiet", "--detach", sha) {
+		sr.Status = "success"
+	}
+	return sr
+}
+
+// checkoutBranch is the built-in checkout phase of a plain deploy after a
+// deploy with a ref left HEAD detached. It checks branch out again and
+// resets it to origin's copy, so the deploy steps carry on from origin
+// rather than from whatever was deployed by ref. Like checkoutRef, it
+// refuses to run over local changes.
+func checkoutBranch(ctx context.Context, dir, branch string, env []string) (sr deploy.StepResult) {
+	sr = deploy.StepResult{Step: "checkout " + branch, Status: "failed"}
+	start := time.Now()
+	g := &gitCmds{ctx: ctx, dir: dir, env: env}
+	defer func() {
+		sr.Output = g.out.String()
+		sr.Duration = time.Since(start)
+	}()
+
+	if branch == "" {
+		fmt.Fprintf(&g.out, "ERROR: HEAD is detached and no branch is configured to return to\n")
+		return sr
+	}
+	if !g.clean() || !g.fetch() || !g.run("checkout", "--quiet", branch) {
+		return sr
+	}
+	if _, _, err := g.quiet("rev-parse", "--verify", "--quiet", "origin/"+branch+"^{commit}"); err == nil {
+		if !g.run("reset", "--hard", "--quiet", "origin/"+branch) {
+			return sr
+		}
+	}
+	sr.Status = "success"
+	return sr
+}
+
+// detachedHead reports whether dir is a git repo whose HEAD is detached, as
+// a deploy with a ref leaves it.
+func detachedHead(dir string) bool {
+	if gitHead(dir) == "" {
+		return false
+	}
+	cmd := exec.Command("git", "symbolic-ref", "--quiet", "HEAD")
+	cmd.Dir = dir
+	return cmd.Run() != nil
+}
+
+// homeBranch returns the branch a plain deploy of the service checks out
+// when HEAD is detached: the configured branch, else origin's default
+// branch, else "".
+func homeBranch(cfg config.ServiceConfig) string {
+	if cfg.Branch != "" {
+		return cfg.Branch
+	}
+	cmd := exec.Command("git", "rev-parse", "--abbrev-ref", "origin/HEAD")
+	cmd.Dir = cfg.Dir
+	out, err := cmd.Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimPrefix(strings.TrimSpace(string(out)), "origin/")
+}
+
+// gitCmds runs git in a repo for a built-in deploy phase, logging each
+// command that matters and its output to out.
+type gitCmds struct {
+	ctx context.Context
+	dir string
+	env []string
+	out bytes.Buffer
+}
+
+// quiet runs git without logging it, returning its trimmed stdout and its
+// stderr.
+func (g *gitCmds) quiet(args ...string) (string, []byte, error) {
+	cmd := exec.CommandContext(g.ctx, "git", args...)
+	cmd.Dir = g.dir
+	cmd.Env = g.env
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	return strings.TrimSpace(stdout.String()), stderr.Bytes(), err
+}
+
+// run runs git, logging the command and its output, and reports whether it
+// succeeded.
+func (g *gitCmds) run(args ...string) bool {
+	fmt.Fprintf(&g.out, "$ git %s\n", strings.Join(args, " "))
+	stdout, stderr, err := g.quiet(args...)
+	if stdout != "" {
+		g.out.WriteString(stdout + "\n")
+	}
+	g.out.Write(stderr)
+	if err != nil {
+		fmt.Fprintf(&g.out, "ERROR: %s\n", err)
+		return false
+	}
+	return true
+}
+
+// clean reports whether the working tree has no changes to tracked files,
+// logging an error listing them if it has: checking out another commit
+// would lose them.
+func (g *gitCmds) clean() bool {
+	out, stderr, err := g.quiet("status", "--porcelain", "--untracked-files=no")
+	if err != nil {
+		g.out.Write(stderr)
+		fmt.Fprintf(&g.out, "ERROR: git status: %s\n", err)
+		return false
+	}
+	if out != "" {
+		fmt.Fprintf(&g.out, "ERROR: working tree has local changes; commit or discard them first:\n%s\n", out)
+		return false
+	}
+	return true
+}
+
+// fetch fetches from origin, if the repo has one.
+func (g *gitCmds) fetch() bool {
+	if _, _, err := g.quiet("remote", "get-url", "origin"); err != nil {
+		return true
+	}
+	return g.run("fetch", "--quiet", "--tags", "origin")
+}
+
+// resolve returns the commit ref names, trying origin's copy of a branch
+// first. It logs an error and returns "" if there is no such commit.
+func (g *gitCmds) resolve(ref string) string {
+	for _, candidate := range []string{"origin/" + ref, ref} {
+		if sha, _, err := g.quiet("rev-parse", "--verify", "--quiet", candidate+"^{commit}"); err == nil {
+			return sha
+		}
+	}
+	fmt.Fprintf(&g.out, "ERROR: unknown revision %q\n", ref)
+	return ""
+}
+
+// withoutPull drops plain `git pull` steps, which would undo the checkout of
+// a deploy with a ref.
+func withoutPull(steps []config.DeployStep) []config.DeployStep {
+	var out []config.DeployStep
+	for _, step := range steps {
+		if isPullStep(step.Run) {
+			continue
+		}
+		out = append(out, step)
+	}
+	return out
+}
+
+// isPullStep reports whether a deploy step is a plain `git pull`.
+func isPullStep(step string) bool {
+	f := strings.Fields(step)
+	return len(f) >= 2 && f[0] == "git" && f[1] == "pull"
+}
+
+// SplitRef splits the `svc@ref` syntax accepted by the deploy command into
+// the service name and ref. ref is empty if there is no @.
+func SplitRef(s string) (name, ref string) {
+	name, ref, _ = strings.Cut(s, "@")
+	return name, ref
+}
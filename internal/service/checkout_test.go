@@ -0,0 +1,139 @@
+package service
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/shishberg/mezzaops/internal/config"
+)
+
+func TestManager_DeployRef(t *testing.T) {
+	origin, commit := gitRepo(t)
+	first := commit("one")
+
+	dir := filepath.Join(t.TempDir(), "clone")
+	if out, err := exec.Command("git", "clone", "-q", origin, dir).CombinedOutput(); err != nil {
+		t.Fatalf("git clone: %v\n%s", err, out)
+	}
+
+	// Tagged after the clone, so the deploy has to fetch it.
+	second := commit("two")
+	if out, err := exec.Command("git", "-C", origin, "tag", "v2").CombinedOutput(); err != nil {
+		t.Fatalf("git tag: %v\n%s", err, out)
+	}
+	third := commit("three")
+	git := func(args ...string) string {
+		t.Helper()
+		out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	branch := git("rev-parse", "--abbrev-ref", "HEAD")
+
+	svc := config.ServiceConfig{
+		Name:       "testsvc",
+		Dir:        dir,
+		Entrypoint: []string{"sleep", "3600"},
+		Deploy:     config.Steps("git pull", "echo ref=$MEZZAOPS_REF"),
+	}
+	m, err := NewManager(testConfig(t), []config.ServiceConfig{svc}, NopNotifier{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Stop()
+
+	if err := m.RequestDeploy("testsvc", DeployRequest{Ref: "v2"}); err != nil {
+		t.Fatal(err)
+	}
+	r := waitForHistory(t, m, "testsvc", 1)[0]
+	if r.Result != "success" {
+		t.Fatalf("deploy failed at %q:\n%s", r.FailedStep, r.Output)
+	}
+	if r.SHABefore != first || r.SHAAfter != second {
+		t.Fatalf("SHAs: before=%s after=%s, want %s..%s", r.SHABefore, r.SHAAfter, first, second)
+	}
+	if r.Ref != "v2" || !strings.Contains(r.Output, "ref=v2") {
+		t.Fatalf("ref %q, output:\n%s", r.Ref, r.Output)
+	}
+	if len(r.Steps) != 2 || r.Steps[0].Step != "checkout v2" {
+		t.Fatalf("steps: %+v", r.Steps)
+	}
+
+	state, _ := m.GetServiceState("testsvc")
+	if state.Ref != "v2" {
+		t.Fatalf("state ref: got %q, want v2", state.Ref)
+	}
+
+	// The ref is checked out detached, leaving the branch where it was.
+	if got := git("rev-parse", branch); got != first {
+		t.Errorf("%s moved to %s, want it left at %s", branch, got, first)
+	}
+	if !detachedHead(dir) {
+		t.Error("HEAD not detached after deploying a ref")
+	}
+
+	if err := m.RequestDeploy("testsvc", DeployRequest{Ref: "nosuchref"}); err != nil {
+		t.Fatal(err)
+	}
+	r = waitForHistory(t, m, "testsvc", 2)[0]
+	if r.Result != "failed" || r.FailedStep != "checkout nosuchref" {
+		t.Fatalf("bad ref: result=%q step=%q", r.Result, r.FailedStep)
+	}
+
+	// A plain deploy goes back to the branch, at origin's head.
+	if err := m.RequestDeploy("testsvc", DeployRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	r = waitForHistory(t, m, "testsvc", 3)[0]
+	if r.Result != "success" || r.SHAAfter != third || r.Steps[0].Step != "checkout "+branch {
+		t.Fatalf("plain deploy: result=%q after=%s steps=%+v\n%s", r.Result, r.SHAAfter, r.Steps, r.Output)
+	}
+	if got := git("rev-parse", "--abbrev-ref", "HEAD"); got != branch {
+		t.Errorf("checked out %q after a plain deploy, want %q", got, branch)
+	}
+
+	// Local changes are never discarded by a checkout.
+	if err := os.WriteFile(filepath.Join(dir, "tracked"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	git("add", "tracked")
+	if err := m.RequestDeploy("testsvc", DeployRequest{Ref: "v2"}); err != nil {
+		t.Fatal(err)
+	}
+	r = waitForHistory(t, m, "testsvc", 4)[0]
+	if r.Result != "failed" || !strings.Contains(r.Output, "working tree has local changes") {
+		t.Fatalf("deploy over local changes: result=%q output:\n%s", r.Result, r.Output)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "tracked")); err != nil {
+		t.Errorf("local change lost: %v", err)
+	}
+}
+
+func TestWithoutPull(t *testing.T) {
+	got := withoutPull(config.Steps("git pull", "git pull --ff-only", "go build .", "git fetch"))
+	want := config.Steps("go build .", "git fetch")
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestSplitRef(t *testing.T) {
+	tests := []struct{ in, name, ref string }{
+		{"api", "api", ""},
+		{"api@v1.4.2", "api", "v1.4.2"},
+		{"api@3f2c1ab", "api", "3f2c1ab"},
+		{"api@", "api", ""},
+	}
+	for _, tt := range tests {
+		name, ref := SplitRef(tt.in)
+		if name != tt.name || ref != tt.ref {
+			t.Errorf("SplitRef(%q) = %q, %q; want %q, %q", tt.in, name, ref, tt.name, tt.ref)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/shishberg/mezzaops/internal/config"
+	"github.com/shishberg/mezzaops/internal/deploy"
+)
+
+// cloneRepo is the built-in first phase of a service's first deploy when
+// its dir doesn't exist yet: it clones the repo, at the configured branch if
+// there is one, into dir. env is from gitSSHEnv, to use the deploy key.
+func cloneRepo(ctx context.Context, cfg config.ServiceConfig, env []string) (sr deploy.StepResult) {
+	url := cfg.CloneURL()
+	sr = deploy.StepResult{Step: "clone " + url, Status: "failed"}
+	start := time.Now()
+	parent := filepath.Dir(cfg.Dir)
+	g := &gitCmds{ctx: ctx, dir: parent, env: env}
+	defer func() {
+		sr.Output = g.out.String()
+		sr.Duration = time.Since(start)
+	}()
+
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		fmt.Fprintf(&g.out, "ERROR: %s\n", err)
+		return sr
+	}
+	args := []string{"clone", "--quiet"}
+	if cfg.Branch != "" {
+		args = append(args, "--branch", cfg.Branch)
+	}
+	if g.run(append(args, url, cfg.Dir)...) {
+		sr.Status = "success"
+	}
+	return sr
+}
+
+// gitSSHEnv returns env, or mezzaops's own environment if it is nil, with
+// GIT_SSH_COMMAND set to use the service's deploy key, if it has one. It is
+// for git commands and deploy steps; the service's process never gets it.
+func gitSSHEnv(cfg config.ServiceConfig, env []string) []string {
+	ssh := cfg.GitSSHCommand()
+	if ssh == "" {
+		return env
+	}
+	if env == nil {
+		env = os.Environ()
+	}
+	return append(slices.Clip(env), "GIT_SSH_COMMAND="+ssh)
+}
@@ -0,0 +1,87 @@
+package service
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/shishberg/mezzaops/internal/config"
+)
+
+func TestManager_DeployClonesMissingDir(t *testing.T) {
+	origin, commit := gitRepo(t)
+	if err := os.WriteFile(filepath.Join(origin, "widgets.go"), []byte("package widgets\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := exec.Command("git", "-C", origin, "add", "widgets.go").CombinedOutput(); err != nil {
+		t.Fatalf("add: %v\n%s", err, out)
+	}
+	head := commit("Add widgets")
+	out, err := exec.Command("git", "-C", origin, "rev-parse", "--abbrev-ref", "HEAD").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := filepath.Join(t.TempDir(), "srv", "testsvc")
+	svc := sleepService("testsvc", dir)
+	svc.Repo = origin
+	svc.Branch = strings.TrimSpace(string(out))
+	svc.Deploy = config.Steps("test -f widgets.go")
+	m, err := NewManager(testConfig(t), []config.ServiceConfig{svc}, NopNotifier{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Stop()
+
+	if err := m.RequestDeploy("testsvc", DeployRequest{Trigger: TriggerChat}); err != nil {
+		t.Fatal(err)
+	}
+	r := waitForHistory(t, m, "testsvc", 1)[0]
+	if r.Result != "success" || len(r.Steps) != 2 || r.Steps[0].Step != "clone "+origin {
+		t.Fatalf("deploy = %s, steps %+v, output:\n%s", r.Result, r.Steps, r.Output)
+	}
+	if r.SHAAfter != head {
+		t.Errorf("deployed %s, want %s", r.SHAAfter, head)
+	}
+}
+
+func TestCloneRepo_Failure(t *testing.T) {
+	cfg := config.ServiceConfig{Name: "testsvc", Dir: filepath.Join(t.TempDir(), "testsvc"), Repo: filepath.Join(t.TempDir(), "missing")}
+	sr := cloneRepo(t.Context(), cfg, nil)
+	if sr.Status != "failed" || !strings.Contains(sr.Output, "$ git clone") {
+		t.Errorf("clone of a missing repo = %+v", sr)
+	}
+	if _, err := os.Stat(cfg.Dir); !os.IsNotExist(err) {
+		t.Errorf("failed clone left %s behind: %v", cfg.Dir, err)
+	}
+}
+
+func TestDeployKeyEnv(t *testing.T) {
+	svc := sleepService("testsvc", t.TempDir())
+	svc.DeployKey = "/etc/mezzaops/testsvc"
+	svc.Deploy = config.Steps(`test "$GIT_SSH_COMMAND" = "` + svc.GitSSHCommand() + `"`)
+	m, err := NewManager(testConfig(t), []config.ServiceConfig{svc}, NopNotifier{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Stop()
+
+	// The service's process doesn't get the key, but its deploy steps do.
+	env, err := m.serviceEnv(svc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, kv := range env {
+		if strings.HasPrefix(kv, "GIT_SSH_COMMAND=") {
+			t.Errorf("service env has %s", kv)
+		}
+	}
+	if err := m.RequestDeploy("testsvc", DeployRequest{Trigger: TriggerChat}); err != nil {
+		t.Fatal(err)
+	}
+	if r := waitForHistory(t, m, "testsvc", 1)[0]; r.Result != "success" {
+		t.Errorf("deploy = %s, output:\n%s", r.Result, r.Output)
+	}
+}
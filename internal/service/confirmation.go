@@ -1,70 +1,274 @@
 package service
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 	"sync"
 	"time"
+
+	"github.com/shishberg/mezzaops/internal/config"
 )
 
-type pendingConfirmation struct {
-	branch    string
-	createdAt time.Time
+// PendingApproval is a push waiting to be approved in chat before it
+// deploys.
+type PendingApproval struct {
+	Service string    `json:"service"`
+	Branch  string    `json:"branch,omitempty"`
+	Commit  string    `json:"commit,omitempty"` // the push's head commit
+	Pusher  string    `json:"pusher,omitempty"`
+	Since   time.Time `json:"since"`
+
+	// Required and Approvers are the service's approval rules when the push
+	// arrived; Approvers empty means anyone may approve.
+	Required  int      `json:"required"`
+	Approvers []string `json:"approvers,omitempty"`
+
+	// ApprovedBy lists who has approved so far, in order.
+	ApprovedBy []string `json:"approved_by,omitempty"`
+}
+
+// Approved reports whether the push has all the approvals it needs.
+func (p PendingApproval) Approved() bool {
+	return len(p.ApprovedBy) >= p.Required
+}
+
+// Request returns the deploy request for the push once approved. It deploys
+// the pushed commit, which is what the approvers saw, even if the branch has
+// moved on since.
+func (p PendingApproval) Request() DeployRequest {
+	return DeployRequest{
+		Trigger:    TriggerWebhook,
+		Actor:      p.Pusher,
+		Ref:        p.Commit,
+		Commit:     p.Commit,
+		Branch:     p.Branch,
+		ApprovedBy: slices.Clone(p.ApprovedBy),
+	}
 }
 
-// ConfirmationTracker tracks pending deploy confirmations with expiry.
+// String describes the pending approval, e.g. "api: abc1234 on main pushed
+// by bob, 1 of 2 approvals (alice)".
+func (p PendingApproval) String() string {
+	s := p.Service + ":"
+	if p.Commit != "" {
+		s += " " + ShortSHA(p.Commit)
+	} else {
+		s += " push"
+	}
+	if p.Branch != "" {
+		s += " on " + p.Branch
+	}
+	if p.Pusher != "" {
+		s += " pushed by " + p.Pusher
+	}
+	s += fmt.Sprintf(", %d of %d approvals", len(p.ApprovedBy), p.Required)
+	if len(p.ApprovedBy) > 0 {
+		s += " (" + strings.Join(p.ApprovedBy, ", ") + ")"
+	}
+	if len(p.Approvers) > 0 {
+		s += " from " + strings.Join(p.Approvers, ", ")
+	}
+	return s
+}
+
+// FormatPending renders pending approvals for chat and the CLI.
+func FormatPending(pending []PendingApproval) string {
+	if len(pending) == 0 {
+		return "no deploys awaiting approval\n"
+	}
+	var b strings.Builder
+	for _, p := range pending {
+		fmt.Fprintf(&b, "%s, waiting %s\n", p, time.Since(p.Since).Round(time.Second))
+	}
+	return b.String()
+}
+
+// approvalPath returns the file a pending approval is persisted in. Pending
+// approvals live in a subdirectory so cleanOrphans doesn't mistake them for
+// state files.
+func approvalPath(dir, name string) string {
+	return filepath.Join(dir, "approvals", name+".json")
+}
+
+// ConfirmationTracker tracks pushes awaiting approval, one per service, which
+// expire after a TTL. With a state dir they are persisted there, so they
+// survive a restart.
 type ConfirmationTracker struct {
 	mu      sync.Mutex
-	pending map[string]pendingConfirmation
+	pending map[string]PendingApproval
 	ttl     time.Duration
+	dir     string // state dir; "" keeps approvals in memory only
 }
 
-// NewConfirmationTracker creates a ConfirmationTracker with the given TTL.
-func NewConfirmationTracker(ttl time.Duration) *ConfirmationTracker {
-	return &ConfirmationTracker{
-		pending: make(map[string]pendingConfirmation),
+// NewConfirmationTracker creates a ConfirmationTracker with the given TTL,
+// loading any approvals still pending in stateDir. An empty stateDir keeps
+// them in memory only.
+func NewConfirmationTracker(ttl time.Duration, stateDir string) *ConfirmationTracker {
+	ct := &ConfirmationTracker{
+		pending: make(map[string]PendingApproval),
 		ttl:     ttl,
+		dir:     stateDir,
 	}
+	if stateDir == "" {
+		return ct
+	}
+	paths, _ := filepath.Glob(filepath.Join(stateDir, "approvals", "*.json"))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			log.Printf("loading pending approval: %v", err)
+			continue
+		}
+		var p PendingApproval
+		if err := json.Unmarshal(data, &p); err != nil {
+			log.Printf("loading pending approval %s: %v", path, err)
+			continue
+		}
+		ct.pending[p.Service] = p
+	}
+	ct.mu.Lock()
+	ct.expireLocked()
+	ct.mu.Unlock()
+	return ct
 }
 
-// AddPending registers a pending confirmation for a service. Overwrites any existing entry.
-func (ct *ConfirmationTracker) AddPending(service, branch string) {
+// AddPending registers a push awaiting approval, replacing any earlier one
+// for the same service.
+func (ct *ConfirmationTracker) AddPending(p PendingApproval) {
+	if p.Since.IsZero() {
+		p.Since = time.Now()
+	}
+	if p.Required < 1 {
+		p.Required = 1
+	}
 	ct.mu.Lock()
 	defer ct.mu.Unlock()
-	ct.pending[service] = pendingConfirmation{
-		branch:    branch,
-		createdAt: time.Now(),
-	}
+	ct.pending[p.Service] = p
+	ct.save(p)
 }
 
-// IsPending reports whether there is a non-expired pending confirmation for the service.
-// If the entry has expired it is deleted and false is returned.
+// IsPending reports whether a push to the service is awaiting approval.
 func (ct *ConfirmationTracker) IsPending(service string) bool {
 	ct.mu.Lock()
 	defer ct.mu.Unlock()
-	entry, ok := ct.pending[service]
-	if !ok {
-		return false
+	ct.expireLocked()
+	_, ok := ct.pending[service]
+	return ok
+}
+
+// Pending returns the pushes awaiting approval, by service.
+func (ct *ConfirmationTracker) Pending() []PendingApproval {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	ct.expireLocked()
+	pending := make([]PendingApproval, 0, len(ct.pending))
+	for _, p := range ct.pending {
+		pending = append(pending, p)
+	}
+	slices.SortFunc(pending, func(a, b PendingApproval) int {
+		return strings.Compare(a.Service, b.Service)
+	})
+	return pending
+}
+
+// Approve records actor's approval of the push awaiting approval for the
+// service. Once it has all the approvals it needs it is no longer pending,
+// and the returned PendingApproval reports Approved.
+func (ct *ConfirmationTracker) Approve(service, actor string) (PendingApproval, error) {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	p, err := ct.lookupLocked(service, actor)
+	if err != nil {
+		return PendingApproval{}, err
+	}
+	if slices.ContainsFunc(p.ApprovedBy, func(by string) bool { return config.SameUser(by, actor) }) {
+		return p, fmt.Errorf("%s has already approved %s", actor, service)
 	}
-	if time.Since(entry.createdAt) > ct.ttl {
-		delete(ct.pending, service)
-		return false
+	p.ApprovedBy = append(slices.Clone(p.ApprovedBy), actor)
+	if p.Approved() {
+		ct.removeLocked(service)
+	} else {
+		ct.pending[service] = p
+		ct.save(p)
 	}
-	return true
+	return p, nil
 }
 
-// Confirm removes the pending confirmation for a service and returns true if it
-// existed and had not expired. Returns false if no pending confirmation exists
-// or it has expired.
-func (ct *ConfirmationTracker) Confirm(service string) bool {
+// Deny drops the push awaiting approval for the service.
+func (ct *ConfirmationTracker) Deny(service, actor string) (PendingApproval, error) {
 	ct.mu.Lock()
 	defer ct.mu.Unlock()
-	entry, ok := ct.pending[service]
+	p, err := ct.lookupLocked(service, actor)
+	if err != nil {
+		return PendingApproval{}, err
+	}
+	ct.removeLocked(service)
+	return p, nil
+}
+
+// lookupLocked returns the service's pending approval if actor may act on
+// it. ct.mu must be held.
+func (ct *ConfirmationTracker) lookupLocked(service, actor string) (PendingApproval, error) {
+	ct.expireLocked()
+	p, ok := ct.pending[service]
 	if !ok {
-		return false
+		return PendingApproval{}, fmt.Errorf("no deploy of %s awaiting approval (or it expired)", service)
 	}
-	if time.Since(entry.createdAt) > ct.ttl {
-		delete(ct.pending, service)
-		return false
+	if actor == "" {
+		return PendingApproval{}, errors.New("approvals need to know who you are")
 	}
+	rules := config.ApprovalsConfig{Approvers: p.Approvers}
+	if !rules.MayApprove(actor) {
+		return PendingApproval{}, fmt.Errorf("%s is not an approver for %s", actor, service)
+	}
+	return p, nil
+}
+
+// expireLocked drops approvals pending longer than the TTL. ct.mu must be
+// held.
+func (ct *ConfirmationTracker) expireLocked() {
+	for name, p := range ct.pending {
+		if time.Since(p.Since) > ct.ttl {
+			log.Printf("**%s**: approval of %s expired", name, p)
+			ct.removeLocked(name)
+		}
+	}
+}
+
+func (ct *ConfirmationTracker) removeLocked(service string) {
 	delete(ct.pending, service)
-	return true
+	if ct.dir == "" {
+		return
+	}
+	if err := os.Remove(approvalPath(ct.dir, service)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Printf("**%s**: removing pending approval: %v", service, err)
+	}
+}
+
+// save persists a pending approval, logging any error: it is still pending
+// in memory, just not across a restart.
+func (ct *ConfirmationTracker) save(p PendingApproval) {
+	if ct.dir == "" {
+		return
+	}
+	data, err := json.Marshal(p)
+	if err == nil {
+		path := approvalPath(ct.dir, p.Service)
+		if err = os.MkdirAll(filepath.Dir(path), 0755); err == nil {
+			tmp := path + ".tmp"
+			if err = os.WriteFile(tmp, data, 0644); err == nil {
+				err = os.Rename(tmp, path)
+			}
+		}
+	}
+	if err != nil {
+		log.Printf("**%s**: saving pending approval: %v", p.Service, err)
+	}
 }
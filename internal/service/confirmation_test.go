@@ -1,51 +1,68 @@
 package service
 
 import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/shishberg/mezzaops/internal/config"
 )
 
 func TestConfirmationTracker_AddAndConfirm(t *testing.T) {
-	ct := NewConfirmationTracker(5 * time.Minute)
-	ct.AddPending("svc", "main")
+	ct := NewConfirmationTracker(5*time.Minute, "")
+	ct.AddPending(PendingApproval{Service: "svc", Branch: "main", Commit: "abc1234def", Pusher: "bob"})
 
-	if !ct.Confirm("svc") {
-		t.Fatal("Confirm should return true after AddPending")
+	p, err := ct.Approve("svc", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.Approved() {
+		t.Fatal("one approval should be enough by default")
+	}
+	req := p.Request()
+	if req.Commit != "abc1234def" || req.Actor != "bob" || len(req.ApprovedBy) != 1 || req.ApprovedBy[0] != "alice" {
+		t.Errorf("request = %+v, want bob's push approved by alice", req)
+	}
+	if req.Ref != "abc1234def" || req.Branch != "main" {
+		t.Errorf("request = %+v, want it pinned to the pushed commit on main", req)
 	}
 
-	// Second confirm should return false (entry consumed)
-	if ct.Confirm("svc") {
-		t.Fatal("Confirm should return false after already confirmed")
+	// Second approval fails (entry consumed)
+	if _, err := ct.Approve("svc", "carol"); err == nil {
+		t.Fatal("Approve should fail after already approved")
 	}
 }
 
 func TestConfirmationTracker_ConfirmWithoutPending(t *testing.T) {
-	ct := NewConfirmationTracker(5 * time.Minute)
+	ct := NewConfirmationTracker(5*time.Minute, "")
 
-	if ct.Confirm("svc") {
-		t.Fatal("Confirm should return false when nothing is pending")
+	if _, err := ct.Approve("svc", "alice"); err == nil {
+		t.Fatal("Approve should fail when nothing is pending")
 	}
 }
 
 func TestConfirmationTracker_ExpiredEntry(t *testing.T) {
-	ct := NewConfirmationTracker(1 * time.Millisecond)
-	ct.AddPending("svc", "main")
+	ct := NewConfirmationTracker(1*time.Millisecond, "")
+	ct.AddPending(PendingApproval{Service: "svc", Branch: "main"})
 
 	time.Sleep(5 * time.Millisecond)
 
-	if ct.Confirm("svc") {
-		t.Fatal("Confirm should return false for expired entry")
+	if _, err := ct.Approve("svc", "alice"); err == nil {
+		t.Fatal("Approve should fail for expired entry")
 	}
 }
 
 func TestConfirmationTracker_IsPending(t *testing.T) {
-	ct := NewConfirmationTracker(5 * time.Minute)
+	ct := NewConfirmationTracker(5*time.Minute, "")
 
 	if ct.IsPending("svc") {
 		t.Fatal("IsPending should return false with no entry")
 	}
 
-	ct.AddPending("svc", "main")
+	ct.AddPending(PendingApproval{Service: "svc", Branch: "main"})
 
 	if !ct.IsPending("svc") {
 		t.Fatal("IsPending should return true after AddPending")
@@ -58,8 +75,8 @@ func TestConfirmationTracker_IsPending(t *testing.T) {
 }
 
 func TestConfirmationTracker_IsPendingExpired(t *testing.T) {
-	ct := NewConfirmationTracker(1 * time.Millisecond)
-	ct.AddPending("svc", "main")
+	ct := NewConfirmationTracker(1*time.Millisecond, "")
+	ct.AddPending(PendingApproval{Service: "svc", Branch: "main"})
 
 	time.Sleep(5 * time.Millisecond)
 
@@ -69,12 +86,140 @@ func TestConfirmationTracker_IsPendingExpired(t *testing.T) {
 }
 
 func TestConfirmationTracker_OverwritesPending(t *testing.T) {
-	ct := NewConfirmationTracker(5 * time.Minute)
-	ct.AddPending("svc", "branch-1")
-	ct.AddPending("svc", "branch-2")
+	ct := NewConfirmationTracker(5*time.Minute, "")
+	ct.AddPending(PendingApproval{Service: "svc", Commit: "aaaaaaa"})
+	ct.AddPending(PendingApproval{Service: "svc", Commit: "bbbbbbb"})
+
+	// Latest write wins
+	p, err := ct.Approve("svc", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Commit != "bbbbbbb" {
+		t.Errorf("approved commit = %s, want the latest push", p.Commit)
+	}
+}
+
+func TestConfirmationTracker_MultipleApprovers(t *testing.T) {
+	ct := NewConfirmationTracker(5*time.Minute, "")
+	ct.AddPending(PendingApproval{Service: "svc", Required: 2, Approvers: []string{"alice", "@bob", "carol"}})
+
+	if _, err := ct.Approve("svc", "mallory"); err == nil || !strings.Contains(err.Error(), "not an approver") {
+		t.Errorf("Approve by mallory = %v, want not an approver", err)
+	}
+	if _, err := ct.Approve("svc", ""); err == nil {
+		t.Error("Approve by nobody should fail")
+	}
+
+	p, err := ct.Approve("svc", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Approved() || !ct.IsPending("svc") {
+		t.Fatal("one of two approvals should leave the push pending")
+	}
+	if _, err := ct.Approve("svc", "Alice"); err == nil || !strings.Contains(err.Error(), "already approved") {
+		t.Errorf("second approval by alice = %v, want already approved", err)
+	}
+
+	p, err = ct.Approve("svc", "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.Approved() || strings.Join(p.ApprovedBy, ",") != "alice,bob" {
+		t.Errorf("approval = %+v, want approved by alice and bob", p)
+	}
+	if ct.IsPending("svc") {
+		t.Error("fully approved push should no longer be pending")
+	}
+}
 
-	// Should still confirm (latest write wins)
-	if !ct.Confirm("svc") {
-		t.Fatal("Confirm should return true after overwrite")
+func TestConfirmationTracker_Deny(t *testing.T) {
+	ct := NewConfirmationTracker(5*time.Minute, "")
+	ct.AddPending(PendingApproval{Service: "svc", Approvers: []string{"alice"}})
+
+	if _, err := ct.Deny("svc", "bob"); err == nil {
+		t.Error("Deny by a non-approver should fail")
+	}
+	if _, err := ct.Deny("svc", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if ct.IsPending("svc") {
+		t.Error("denied push should no longer be pending")
+	}
+	if _, err := ct.Deny("svc", "alice"); err == nil {
+		t.Error("Deny with nothing pending should fail")
+	}
+}
+
+func TestConfirmationTracker_Persists(t *testing.T) {
+	dir := t.TempDir()
+	ct := NewConfirmationTracker(5*time.Minute, dir)
+	ct.AddPending(PendingApproval{Service: "api", Commit: "abc1234def", Pusher: "bob", Required: 2})
+	ct.AddPending(PendingApproval{Service: "web"})
+	if _, err := ct.Approve("api", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ct.Deny("web", "alice"); err != nil {
+		t.Fatal(err)
+	}
+
+	// A restart picks up where it left off.
+	ct = NewConfirmationTracker(5*time.Minute, dir)
+	pending := ct.Pending()
+	if len(pending) != 1 || pending[0].Service != "api" || len(pending[0].ApprovedBy) != 1 {
+		t.Fatalf("pending after restart = %+v, want api approved once", pending)
+	}
+	if got := FormatPending(pending); !strings.HasPrefix(got, "api: abc1234 pushed by bob, 1 of 2 approvals (alice), waiting ") {
+		t.Errorf("FormatPending = %q", got)
+	}
+
+	// Approvals that expired while mezzaops was down are dropped.
+	ct = NewConfirmationTracker(time.Nanosecond, dir)
+	if got := ct.Pending(); len(got) != 0 {
+		t.Errorf("pending after expiry = %+v, want none", got)
+	}
+	if got := NewConfirmationTracker(5*time.Minute, dir).Pending(); len(got) != 0 {
+		t.Errorf("expired approvals were not removed from the state dir: %+v", got)
+	}
+}
+
+func TestManager_DeployApprovedCommit(t *testing.T) {
+	origin, commit := gitRepo(t)
+	commit("one")
+	dir := filepath.Join(t.TempDir(), "clone")
+	if out, err := exec.Command("git", "clone", "-q", origin, dir).CombinedOutput(); err != nil {
+		t.Fatalf("git clone: %v\n%s", err, out)
+	}
+	pushed := commit("two")
+	out, err := exec.Command("git", "-C", origin, "rev-parse", "--abbrev-ref", "HEAD").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	branch := strings.TrimSpace(string(out))
+
+	svc := sleepService("testsvc", dir)
+	svc.Deploy = []config.DeployStep{
+		{Run: "git pull"},
+		{Run: "touch on-branch", When: &config.StepCondition{Branch: branch}},
+	}
+	m, err := NewManager(testConfig(t), []config.ServiceConfig{svc}, NopNotifier{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Stop()
+
+	// The branch moves on while the push awaits approval.
+	p := PendingApproval{Service: "testsvc", Branch: branch, Commit: pushed, Pusher: "bob", Required: 1, ApprovedBy: []string{"alice"}}
+	commit("three")
+	if err := m.RequestDeploy("testsvc", p.Request()); err != nil {
+		t.Fatal(err)
+	}
+	r := waitForHistory(t, m, "testsvc", 1)[0]
+	if r.Result != "success" || r.SHAAfter != pushed {
+		t.Fatalf("deploy = %s at %s, want the approved %s; output:\n%s", r.Result, r.SHAAfter, pushed, r.Output)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "on-branch")); err != nil {
+		t.Errorf("when: branch step didn't run: %v", err)
 	}
 }
@@ -0,0 +1,70 @@
+package service
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// AlreadyDeployedError is returned by RequestDeploy for a deploy of the
+// commit the service already runs. Forcing the deploy skips the check.
+type AlreadyDeployedError struct {
+	Service string
+	Commit  string
+}
+
+func (e *AlreadyDeployedError) Error() string {
+	return fmt.Sprintf("%s is already at %s", e.Service, ShortSHA(e.Commit))
+}
+
+// CheckDeployed returns an *AlreadyDeployedError if req would deploy the
+// commit the named service's last successful deploy left live, so that
+// redelivered webhooks and re-pushes of the same commit don't rebuild and
+// restart it. Forced deploys and rollbacks always go ahead, as does any
+// deploy while another is queued or running, or whose commit isn't known
+// before the deploy steps pull.
+func (m *Manager) CheckDeployed(name string, req DeployRequest) error {
+	if req.Force || req.Rollback {
+		return nil
+	}
+	m.mu.Lock()
+	ms, ok := m.services[name]
+	m.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("service %q not found", name)
+	}
+
+	ms.stateMu.Lock()
+	deployed, status := ms.state.DeployedCommit, ms.state.Status
+	ms.stateMu.Unlock()
+	if deployed == "" || status == "deploying" || status == "queued" {
+		return nil
+	}
+	if target := targetCommit(ms.config.Dir, req); target != "" && target == deployed {
+		return &AlreadyDeployedError{Service: name, Commit: deployed}
+	}
+	return nil
+}
+
+// targetCommit returns the full SHA of the commit req deploys, if that is
+// known up front: the pushed commit, or a ref that names a commit in the
+// repo at dir. Branches and tags can move, so they are not resolved.
+func targetCommit(dir string, req DeployRequest) string {
+	if req.Commit != "" {
+		return req.Commit
+	}
+	if req.Ref == "" {
+		return ""
+	}
+	cmd := exec.Command("git", "rev-parse", "--verify", "--quiet", req.Ref+"^{commit}")
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		return ""
+	}
+	sha := strings.TrimSpace(string(out))
+	if !strings.HasPrefix(sha, strings.ToLower(req.Ref)) {
+		return ""
+	}
+	return sha
+}
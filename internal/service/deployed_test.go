@@ -0,0 +1,67 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/shishberg/mezzaops/internal/config"
+)
+
+func TestManager_SkipsDeployedCommit(t *testing.T) {
+	dir, commit := gitRepo(t)
+	commit("one")
+	head := commit("two")
+
+	svc := sleepService("testsvc", dir)
+	svc.Deploy = config.Steps("true")
+	m, err := NewManager(testConfig(t), []config.ServiceConfig{svc}, NopNotifier{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Stop()
+
+	if err := m.RequestDeploy("testsvc", DeployRequest{Trigger: TriggerWebhook, Commit: head}); err != nil {
+		t.Fatal(err)
+	}
+	waitForHistory(t, m, "testsvc", 1)
+	if st, _ := m.GetServiceState("testsvc"); st.DeployedCommit != head {
+		t.Fatalf("deployed commit = %q, want %q", st.DeployedCommit, head)
+	}
+
+	for _, req := range []DeployRequest{
+		{Trigger: TriggerWebhook, Commit: head},
+		{Trigger: TriggerChat, Ref: ShortSHA(head)},
+	} {
+		var already *AlreadyDeployedError
+		if err := m.RequestDeploy("testsvc", req); !errors.As(err, &already) || already.Commit != head {
+			t.Errorf("RequestDeploy(%+v) = %v, want already at %s", req, err, ShortSHA(head))
+		}
+	}
+
+	// A branch can move, a rollback restores the tree, and a forced deploy
+	// is wanted regardless.
+	for _, req := range []DeployRequest{
+		{Trigger: TriggerChat, Ref: "master"},
+		{Trigger: TriggerChat, Ref: head, Rollback: true},
+		{Trigger: TriggerChat, Commit: head, Force: true},
+	} {
+		if err := m.CheckDeployed("testsvc", req); err != nil {
+			t.Errorf("CheckDeployed(%+v) = %v, want nil", req, err)
+		}
+	}
+	if err := m.RequestDeploy("testsvc", DeployRequest{Trigger: TriggerChat, Commit: head, Force: true}); err != nil {
+		t.Fatal(err)
+	}
+	waitForHistory(t, m, "testsvc", 2)
+
+	// A held push of the deployed commit is dropped rather than deployed.
+	if err := m.HoldDeploy("testsvc", DeployRequest{Trigger: TriggerWebhook, Commit: head}); err != nil {
+		t.Fatal(err)
+	}
+	if !m.ReleaseHeld("testsvc", "") {
+		t.Fatal("ReleaseHeld = false, want the held push handled")
+	}
+	if st, _ := m.GetServiceState("testsvc"); st.Held != nil || st.Status == "queued" {
+		t.Errorf("state after releasing = %+v, want nothing held or queued", st)
+	}
+}
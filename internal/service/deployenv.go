@@ -0,0 +1,31 @@
+package service
+
+import (
+	"os"
+
+	"github.com/shishberg/mezzaops/internal/config"
+)
+
+// deployContextEnv returns env with the variables that tell deploy steps
+// what they are deploying and why appended. commit is the commit being
+// deployed, or "" if it is only known once the steps have pulled. A nil env
+// means the steps inherit mezzaops's own environment, so that is the base.
+func deployContextEnv(env []string, cfg config.ServiceConfig, rec *DeployRecord, req DeployRequest, commit string) []string {
+	if env == nil {
+		env = os.Environ()
+	}
+	env = append(env,
+		"MEZZAOPS_SERVICE="+cfg.Name,
+		"MEZZAOPS_REPO="+cfg.Repo,
+		"MEZZAOPS_BRANCH="+deployBranch(cfg, req),
+		"MEZZAOPS_COMMIT="+commit,
+		"MEZZAOPS_PREV_COMMIT="+rec.SHABefore,
+		"MEZZAOPS_TRIGGER="+req.Trigger,
+		"MEZZAOPS_ACTOR="+req.Actor,
+		"MEZZAOPS_DEPLOY_ID="+rec.ID,
+	)
+	if req.Ref != "" {
+		env = append(env, "MEZZAOPS_REF="+req.Ref)
+	}
+	return env
+}
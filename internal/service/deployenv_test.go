@@ -0,0 +1,80 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/shishberg/mezzaops/internal/config"
+)
+
+func TestManager_DeployContextEnv(t *testing.T) {
+	dir, commit := gitRepo(t)
+	first := commit("one")
+	second := commit("two")
+
+	out := filepath.Join(t.TempDir(), "env")
+	svc := sleepService("testsvc", dir)
+	svc.Repo = "org/testrepo"
+	svc.Branch = "main"
+	svc.Deploy = config.Steps("env | grep ^MEZZAOPS_ | sort > " + out)
+
+	m, err := NewManager(testConfig(t), []config.ServiceConfig{svc}, NopNotifier{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Stop()
+
+	readEnv := func() map[string]string {
+		t.Helper()
+		data, err := os.ReadFile(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		env := map[string]string{}
+		for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+			k, v, _ := strings.Cut(line, "=")
+			env[k] = v
+		}
+		return env
+	}
+	check := func(env map[string]string, want map[string]string) {
+		t.Helper()
+		for k, v := range want {
+			if env[k] != v {
+				t.Errorf("%s = %q, want %q", k, env[k], v)
+			}
+		}
+	}
+
+	req := DeployRequest{Trigger: TriggerWebhook, Actor: "alice", Commit: second}
+	if err := m.RequestDeploy("testsvc", req); err != nil {
+		t.Fatal(err)
+	}
+	r := waitForHistory(t, m, "testsvc", 1)[0]
+	check(readEnv(), map[string]string{
+		"MEZZAOPS_SERVICE":     "testsvc",
+		"MEZZAOPS_REPO":        "org/testrepo",
+		"MEZZAOPS_BRANCH":      "main",
+		"MEZZAOPS_COMMIT":      second,
+		"MEZZAOPS_PREV_COMMIT": second,
+		"MEZZAOPS_TRIGGER":     "webhook",
+		"MEZZAOPS_ACTOR":       "alice",
+		"MEZZAOPS_DEPLOY_ID":   r.ID,
+	})
+
+	// A rollback checks out its target, which is then the commit.
+	if _, err := m.RequestRollback("testsvc", first, DeployRequest{Trigger: TriggerChat, Actor: "bob"}); err != nil {
+		t.Fatal(err)
+	}
+	r = waitForHistory(t, m, "testsvc", 2)[0]
+	check(readEnv(), map[string]string{
+		"MEZZAOPS_COMMIT":      first,
+		"MEZZAOPS_PREV_COMMIT": second,
+		"MEZZAOPS_TRIGGER":     "chat",
+		"MEZZAOPS_ACTOR":       "bob",
+		"MEZZAOPS_REF":         first,
+		"MEZZAOPS_DEPLOY_ID":   r.ID,
+	})
+}
@@ -0,0 +1,156 @@
+package service
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// deploySummaryRunes and stepSummaryRunes bound the tail of a deploy's
+// output, and of each step's, kept in its state and history record. The full
+// output is in the deploy's log file.
+const (
+	deploySummaryRunes = 4000
+	stepSummaryRunes   = 1000
+)
+
+// deployLogPath returns the file a deploy's full output is written to.
+func deployLogPath(logDir, name, id string) string {
+	return filepath.Join(logDir, "deploys", name, id+".log")
+}
+
+// deployLog is a deploy's log file. Writes never fail: a deploy shouldn't
+// stop because its log can't be written, so errors are logged once and the
+// rest of the output is dropped. A nil *deployLog discards everything.
+type deployLog struct {
+	name, file string
+	f          *os.File
+}
+
+// openDeployLog creates the log file for a deploy. It returns nil if the file
+// can't be created, in which case the output is only kept in memory.
+func openDeployLog(logDir, name, id string) *deployLog {
+	path := deployLogPath(logDir, name, id)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		log.Printf("**%s**: creating deploy log: %v", name, err)
+		return nil
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		log.Printf("**%s**: creating deploy log: %v", name, err)
+		return nil
+	}
+	return &deployLog{name: name, file: path, f: f}
+}
+
+// path returns the log file's path, or "" if there is none.
+func (l *deployLog) path() string {
+	if l == nil {
+		return ""
+	}
+	return l.file
+}
+
+func (l *deployLog) Write(p []byte) (int, error) {
+	if l == nil || l.f == nil {
+		return len(p), nil
+	}
+	if _, err := l.f.Write(p); err != nil {
+		log.Printf("**%s**: writing deploy log: %v", l.name, err)
+		l.close()
+	}
+	return len(p), nil
+}
+
+// add writes the output of a built-in step.
+func (l *deployLog) add(s string) {
+	_, _ = io.WriteString(l, s)
+}
+
+func (l *deployLog) close() {
+	if l == nil || l.f == nil {
+		return
+	}
+	_ = l.f.Close()
+	l.f = nil
+}
+
+// pruneDeployLogs removes a service's deploy logs beyond the newest
+// historyLimit, which are those its history still points to. IDs sort in
+// start order, so the newest logs sort last.
+func pruneDeployLogs(logDir, name string) {
+	paths, err := filepath.Glob(filepath.Join(logDir, "deploys", name, "*.log"))
+	if err != nil || len(paths) <= historyLimit {
+		return
+	}
+	slices.Sort(paths)
+	for _, path := range paths[:len(paths)-historyLimit] {
+		_ = os.Remove(path)
+	}
+}
+
+// summarizeOutput returns what of a deploy's output to keep in its state and
+// history record: all of it if there is no log file, else its tail. The
+// output of rec's steps is cut down likewise.
+func summarizeOutput(rec *DeployRecord, output string) string {
+	if rec.Log == "" {
+		return output
+	}
+	for i := range rec.Steps {
+		rec.Steps[i].Output = TruncateTailToRuneBudget(rec.Steps[i].Output, stepSummaryRunes)
+	}
+	return TruncateTailToRuneBudget(output, deploySummaryRunes)
+}
+
+// OpenDeployLog opens the full output of one of a service's recorded
+// deploys. A deploy whose log file is gone, or that predates log files,
+// yields the output kept in its record. The error wraps fs.ErrNotExist if
+// there is no such service or deploy.
+func (m *Manager) OpenDeployLog(name, id string) (io.ReadCloser, error) {
+	records, ok := m.GetDeployHistory(name)
+	if !ok {
+		return nil, fmt.Errorf("service %q: %w", name, fs.ErrNotExist)
+	}
+	for _, r := range records {
+		if r.ID != id {
+			continue
+		}
+		if r.Log != "" {
+			f, err := os.Open(r.Log)
+			if err == nil {
+				return f, nil
+			}
+			if !os.IsNotExist(err) {
+				return nil, err
+			}
+		}
+		return io.NopCloser(strings.NewReader(r.Output)), nil
+	}
+	return nil, fmt.Errorf("deploy %s of %s: %w", id, name, fs.ErrNotExist)
+}
+
+// deployLogURL returns the dashboard URL of a deploy's full log, or "" if
+// the dashboard has no public URL or the deploy has no log file.
+func (m *Manager) deployLogURL(name string, rec *DeployRecord) string {
+	m.mu.Lock()
+	base := m.publicURL
+	m.mu.Unlock()
+	if base == "" || rec.Log == "" {
+		return ""
+	}
+	return base + "/api/service/" + url.PathEscape(name) + "/deploys/" + url.PathEscape(rec.ID) + "/log"
+}
+
+// SetPublicURL sets the dashboard's public base URL, which failure
+// notifications link deploy logs under. "" turns the links off.
+func (m *Manager) SetPublicURL(u string) {
+	m.mu.Lock()
+	m.publicURL = strings.TrimRight(u, "/")
+	m.mu.Unlock()
+}
@@ -0,0 +1,106 @@
+package service
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shishberg/mezzaops/internal/config"
+)
+
+func TestManager_DeployLog(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.Dashboard = &config.DashboardConfig{PublicURL: "https://ops.example.com/"}
+	rec := &recordingNotifier{}
+
+	svc := sleepService("testsvc", t.TempDir())
+	svc.Deploy = config.Steps("seq 1 5000", "echo FINAL; exit 1")
+
+	m, err := NewManager(cfg, []config.ServiceConfig{svc}, rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Stop()
+
+	if err := m.RequestDeploy("testsvc", DeployRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	r := waitForHistory(t, m, "testsvc", 1)[0]
+
+	if want := deployLogPath(cfg.LogDir, "testsvc", r.ID); r.Log != want {
+		t.Fatalf("record log = %q, want %q", r.Log, want)
+	}
+	data, err := os.ReadFile(r.Log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	full := string(data)
+	if !strings.HasPrefix(full, "$ seq 1 5000\n1\n2\n") || !strings.Contains(full, "FINAL\n") {
+		t.Errorf("log file does not hold the full output:\n%s", TruncateTailToRuneBudget(full, 200))
+	}
+
+	// State and history keep only the tail.
+	if len(r.Output) >= len(full) || !strings.Contains(r.Output, "FINAL") {
+		t.Errorf("record output is %d bytes of %d, want the tail", len(r.Output), len(full))
+	}
+	st, _ := m.GetServiceState("testsvc")
+	if st.LastOutput != r.Output || st.LastDeployID != r.ID {
+		t.Errorf("state = %d bytes of output, deploy %q; want the record's summary and %q", len(st.LastOutput), st.LastDeployID, r.ID)
+	}
+
+	rc, err := m.OpenDeployLog("testsvc", r.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := io.ReadAll(rc)
+	rc.Close()
+	if string(got) != full {
+		t.Error("OpenDeployLog did not return the log file")
+	}
+	if _, err := m.OpenDeployLog("testsvc", "nope"); err == nil {
+		t.Error("expected error opening an unknown deploy's log")
+	}
+
+	deadline := time.After(10 * time.Second)
+	for len(rec.getDeployFailed()) == 0 {
+		select {
+		case <-deadline:
+			t.Fatal("timed out waiting for DeployFailed")
+		case <-time.After(20 * time.Millisecond):
+		}
+	}
+	want := "https://ops.example.com/api/service/testsvc/deploys/" + r.ID + "/log"
+	if got := rec.getDeployFailed()[0].logURL; got != want {
+		t.Errorf("log URL = %q, want %q", got, want)
+	}
+}
+
+func TestPruneDeployLogs(t *testing.T) {
+	dir := t.TempDir()
+	logs := filepath.Join(dir, "deploys", "svc")
+	if err := os.MkdirAll(logs, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for i := range historyLimit + 3 {
+		if err := os.WriteFile(filepath.Join(logs, fmt.Sprintf("20260101-0000%02d.000.log", i)), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pruneDeployLogs(dir, "svc")
+
+	entries, err := os.ReadDir(logs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != historyLimit {
+		t.Fatalf("%d logs left, want %d", len(entries), historyLimit)
+	}
+	if entries[0].Name() != "20260101-000003.000.log" {
+		t.Errorf("oldest log left = %s, want the three oldest pruned", entries[0].Name())
+	}
+}
@@ -0,0 +1,373 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shishberg/mezzaops/internal/config"
+)
+
+// FreezeAll is the freeze target that covers every service.
+const FreezeAll = "all"
+
+// freezeCheckInterval is how often expired freezes are lifted and held
+// pushes re-checked. Deploy windows are minute-granular, so this is too.
+const freezeCheckInterval = time.Minute
+
+// Freeze pauses automatic deploys of a service, or of every service when
+// Target is FreezeAll. Manual deploys still go ahead.
+type Freeze struct {
+	Target string    `json:"target"`
+	Reason string    `json:"reason,omitempty"`
+	By     string    `json:"by,omitempty"`
+	Since  time.Time `json:"since"`
+	Until  time.Time `json:"until,omitzero"` // zero: until unfrozen
+}
+
+// String describes the freeze, e.g. "frozen until 2026-10-20 17:00 UTC by
+// alice: release week".
+func (f Freeze) String() string {
+	s := "frozen"
+	if !f.Until.IsZero() {
+		s += " until " + f.Until.Format("2006-01-02 15:04 MST")
+	}
+	if f.By != "" {
+		s += " by " + f.By
+	}
+	if f.Reason != "" {
+		s += ": " + f.Reason
+	}
+	return s
+}
+
+// expired reports whether the freeze has lapsed by now.
+func (f Freeze) expired(now time.Time) bool {
+	return !f.Until.IsZero() && !now.Before(f.Until)
+}
+
+// HeldDeploy is a push that arrived while deploys were paused. It deploys
+// when they resume, or straight away if someone confirms it.
+type HeldDeploy struct {
+	Actor  string    `json:"actor,omitempty"`
+	Commit string    `json:"commit,omitempty"` // the push's head commit
+	Since  time.Time `json:"since"`
+	Reason string    `json:"reason"` // why it was held
+}
+
+// freezePath returns the file a freeze is persisted in. Freezes live in a
+// subdirectory so cleanOrphans doesn't mistake them for state files.
+func freezePath(dir, target string) string {
+	return filepath.Join(dir, "freezes", target+".json")
+}
+
+// SaveFreeze persists a freeze, replacing any earlier one on the same target.
+func SaveFreeze(dir string, f Freeze) error {
+	data, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+	path := freezePath(dir, f.Target)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// LoadFreezes reads every persisted freeze, keyed by target.
+func LoadFreezes(dir string) (map[string]Freeze, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "freezes", "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	freezes := make(map[string]Freeze, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var f Freeze
+		if err := json.Unmarshal(data, &f); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		freezes[f.Target] = f
+	}
+	return freezes, nil
+}
+
+// RemoveFreeze deletes a persisted freeze.
+func RemoveFreeze(dir, target string) {
+	if err := os.Remove(freezePath(dir, target)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Printf("removing freeze on %s: %v", target, err)
+	}
+}
+
+// ParseFreezeArgs splits the arguments after `freeze <target>` into an
+// optional leading duration and a free-text reason. Durations take Go
+// syntax ("90m", "2h30m") plus whole days ("3d").
+func ParseFreezeArgs(args []string) (time.Duration, string) {
+	if len(args) == 0 {
+		return 0, ""
+	}
+	if d, ok := ParseFreezeDuration(args[0]); ok {
+		return d, strings.Join(args[1:], " ")
+	}
+	return 0, strings.Join(args, " ")
+}
+
+// ParseFreezeDuration parses a positive freeze duration such as "90m" or
+// "3d".
+func ParseFreezeDuration(s string) (time.Duration, bool) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return 0, false
+		}
+		return time.Duration(n) * 24 * time.Hour, true
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, false
+	}
+	return d, true
+}
+
+// Freeze pauses automatic deploys of target, a service name or FreezeAll,
+// for d, or until Unfreeze if d is 0. Pushes that arrive meanwhile are
+// held and deploy when the freeze lifts.
+func (m *Manager) Freeze(target string, d time.Duration, reason, actor string) (Freeze, error) {
+	if target == "" {
+		return Freeze{}, fmt.Errorf("service name or %q required", FreezeAll)
+	}
+	m.mu.Lock()
+	_, ok := m.services[target]
+	m.mu.Unlock()
+	if !ok && target != FreezeAll {
+		return Freeze{}, fmt.Errorf("service %q not found", target)
+	}
+
+	now := time.Now()
+	f := Freeze{Target: target, Reason: reason, By: actor, Since: now}
+	if d > 0 {
+		f.Until = now.Add(d)
+	}
+
+	m.mu.Lock()
+	m.freezes[target] = f
+	m.mu.Unlock()
+
+	if m.stateDir != "" {
+		if err := SaveFreeze(m.stateDir, f); err != nil {
+			log.Printf("saving freeze on %s: %v", target, err)
+		}
+	}
+	log.Printf("**%s**: %s", target, f)
+	return f, nil
+}
+
+// Unfreeze lifts the freeze on target. Unfreezing FreezeAll lifts every
+// freeze. Held pushes for services that may now deploy are released.
+func (m *Manager) Unfreeze(target, actor string) error {
+	now := time.Now()
+	m.mu.Lock()
+	var lifted []string
+	if target == FreezeAll {
+		for t, f := range m.freezes {
+			if !f.expired(now) {
+				lifted = append(lifted, t)
+			}
+		}
+	} else if f, ok := m.freezes[target]; ok && !f.expired(now) {
+		lifted = []string{target}
+	}
+	all, allFrozen := m.freezes[FreezeAll]
+	for _, t := range lifted {
+		delete(m.freezes, t)
+	}
+	m.mu.Unlock()
+
+	if len(lifted) == 0 {
+		switch {
+		case target == FreezeAll:
+			return errors.New("nothing is frozen")
+		case allFrozen && !all.expired(now):
+			return fmt.Errorf("%s is covered by a freeze on %s; unfreeze %s to lift it", target, FreezeAll, FreezeAll)
+		default:
+			return fmt.Errorf("%s is not frozen", target)
+		}
+	}
+
+	for _, t := range lifted {
+		if m.stateDir != "" {
+			RemoveFreeze(m.stateDir, t)
+		}
+		log.Printf("**%s**: unfrozen by %s", t, actor)
+	}
+	m.checkFreezes(now)
+	return nil
+}
+
+// activeFreeze returns the freeze covering a service at now: its own, or
+// else the one on FreezeAll.
+func (m *Manager) activeFreeze(name string, now time.Time) (Freeze, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, target := range []string{name, FreezeAll} {
+		if f, ok := m.freezes[target]; ok && !f.expired(now) {
+			return f, true
+		}
+	}
+	return Freeze{}, false
+}
+
+// DeployBlock returns why pushes to the named service would be held right
+// now, or "" if they deploy straight away.
+func (m *Manager) DeployBlock(name string) string {
+	cfg, ok := m.GetServiceConfig(name)
+	if !ok {
+		return ""
+	}
+	return m.deployBlock(cfg, time.Now())
+}
+
+func (m *Manager) deployBlock(cfg config.ServiceConfig, now time.Time) string {
+	if n := m.autoDeployPaused(cfg.Name); n > 0 {
+		return fmt.Sprintf("auto-deploy paused after %d failed deploys in a row", n)
+	}
+	if f, ok := m.activeFreeze(cfg.Name, now); ok {
+		if f.Target == FreezeAll {
+			return "all services " + f.String()
+		}
+		return f.String()
+	}
+	if !config.InDeployWindow(cfg.DeployWindows, now) {
+		windows := make([]string, len(cfg.DeployWindows))
+		for i, w := range cfg.DeployWindows {
+			windows[i] = w.String()
+		}
+		return "outside deploy windows (" + strings.Join(windows, "; ") + ")"
+	}
+	return ""
+}
+
+// HoldDeploy records a push that arrived while the service's deploys were
+// paused, replacing any push already held. It deploys when DeployBlock
+// clears, or when ReleaseHeld is called.
+func (m *Manager) HoldDeploy(name string, req DeployRequest) error {
+	m.mu.Lock()
+	ms, ok := m.services[name]
+	m.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("service %q not found", name)
+	}
+
+	reason := m.deployBlock(ms.config, time.Now())
+	ms.stateMu.Lock()
+	ms.state.Held = &HeldDeploy{Actor: req.Actor, Commit: req.Commit, Since: time.Now(), Reason: reason}
+	ms.stateMu.Unlock()
+	m.saveServiceState(ms)
+
+	m.notifyEvent(name, "push held, "+reason+"; it will deploy when deploys resume")
+	return nil
+}
+
+// ReleaseHeld deploys the named service's held push now, whether or not
+// deploys are still paused. actor is the chat user who released it, recorded
+// as the deploy's actor; empty means deploys resumed on their own and the
+// pusher is recorded instead. It reports false if no push was held.
+func (m *Manager) ReleaseHeld(name, actor string) bool {
+	m.mu.Lock()
+	ms, ok := m.services[name]
+	m.mu.Unlock()
+	if !ok {
+		return false
+	}
+
+	ms.stateMu.Lock()
+	held := ms.state.Held
+	ms.stateMu.Unlock()
+	if held == nil {
+		return false
+	}
+
+	req := DeployRequest{Trigger: TriggerWebhook, Actor: held.Actor, Commit: held.Commit}
+	if actor != "" {
+		req.Trigger, req.Actor = TriggerChat, actor
+	}
+	if err := m.RequestDeploy(name, req); err != nil {
+		var already *AlreadyDeployedError
+		if !errors.As(err, &already) {
+			log.Printf("**%s**: releasing held deploy: %v", name, err)
+			return false
+		}
+		// Nothing to deploy, so the push is no longer held.
+		ms.stateMu.Lock()
+		ms.state.Held = nil
+		ms.stateMu.Unlock()
+		m.saveServiceState(ms)
+		m.notifyEvent(name, fmt.Sprintf("held push skipped: already at `%s`", ShortSHA(already.Commit)))
+	}
+	return true
+}
+
+// watchFreezes periodically lifts expired freezes and releases held pushes
+// once their service may deploy again.
+func (m *Manager) watchFreezes() {
+	defer m.wg.Done()
+	ticker := time.NewTicker(freezeCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			m.checkFreezes(now)
+		case <-m.ctx.Done():
+			return
+		}
+	}
+}
+
+// checkFreezes forgets freezes that have expired by now and deploys every
+// held push whose service is no longer frozen or outside its windows.
+func (m *Manager) checkFreezes(now time.Time) {
+	m.mu.Lock()
+	var expired []string
+	for target, f := range m.freezes {
+		if f.expired(now) {
+			expired = append(expired, target)
+			delete(m.freezes, target)
+		}
+	}
+	services := slices.Collect(maps.Values(m.services))
+	m.mu.Unlock()
+
+	for _, target := range expired {
+		if m.stateDir != "" {
+			RemoveFreeze(m.stateDir, target)
+		}
+		log.Printf("**%s**: freeze expired", target)
+	}
+
+	for _, ms := range services {
+		ms.stateMu.Lock()
+		held := ms.state.Held != nil
+		ms.stateMu.Unlock()
+		if !held || m.deployBlock(ms.config, now) != "" {
+			continue
+		}
+		m.notifyEvent(ms.config.Name, "deploys resumed, deploying held push")
+		m.ReleaseHeld(ms.config.Name, "")
+	}
+}
@@ -0,0 +1,232 @@
+package service
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shishberg/mezzaops/internal/config"
+)
+
+func TestManager_FreezeAndUnfreeze(t *testing.T) {
+	cfg := testConfig(t)
+	svcs := []config.ServiceConfig{
+		sleepService("api", t.TempDir()),
+		sleepService("web", t.TempDir()),
+	}
+
+	m, err := NewManager(cfg, svcs, NopNotifier{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Stop()
+
+	if got := m.DeployBlock("api"); got != "" {
+		t.Fatalf("DeployBlock before freeze = %q, want empty", got)
+	}
+
+	f, err := m.Freeze("api", 2*time.Hour, "release week", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Until.Sub(f.Since) != 2*time.Hour {
+		t.Errorf("freeze lasts %s, want 2h", f.Until.Sub(f.Since))
+	}
+	got := m.DeployBlock("api")
+	if !strings.HasPrefix(got, "frozen until ") || !strings.HasSuffix(got, " by alice: release week") {
+		t.Errorf("DeployBlock = %q", got)
+	}
+	if got := m.DeployBlock("web"); got != "" {
+		t.Errorf("web DeployBlock = %q, want empty", got)
+	}
+
+	state, _ := m.GetServiceState("api")
+	if state.Freeze == nil || state.Freeze.Reason != "release week" || state.Paused != got {
+		t.Errorf("state = %+v, want freeze and paused set", state)
+	}
+
+	if _, err := m.Freeze("all", 0, "", "bob"); err != nil {
+		t.Fatal(err)
+	}
+	if got := m.DeployBlock("web"); got != "all services frozen by bob" {
+		t.Errorf("web DeployBlock = %q", got)
+	}
+
+	if err := m.Unfreeze("web", "carol"); err == nil || !strings.Contains(err.Error(), "unfreeze all") {
+		t.Errorf("Unfreeze(web) error = %v, want hint to unfreeze all", err)
+	}
+	if err := m.Unfreeze("api", "carol"); err != nil {
+		t.Fatal(err)
+	}
+	if got := m.DeployBlock("api"); !strings.HasPrefix(got, "all services frozen") {
+		t.Errorf("api DeployBlock after unfreeze = %q, want the freeze on all", got)
+	}
+	if err := m.Unfreeze("all", "carol"); err != nil {
+		t.Fatal(err)
+	}
+	if got := m.DeployBlock("api"); got != "" {
+		t.Errorf("DeployBlock after unfreeze all = %q, want empty", got)
+	}
+	if err := m.Unfreeze("all", "carol"); err == nil {
+		t.Error("expected error unfreezing when nothing is frozen")
+	}
+}
+
+func TestManager_FreezeErrors(t *testing.T) {
+	m, err := NewManager(testConfig(t), []config.ServiceConfig{sleepService("api", t.TempDir())}, NopNotifier{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Stop()
+
+	if _, err := m.Freeze("nope", 0, "", ""); err == nil {
+		t.Error("expected error freezing an unknown service")
+	}
+	if err := m.Unfreeze("api", ""); err == nil || !strings.Contains(err.Error(), "not frozen") {
+		t.Errorf("Unfreeze error = %v, want not frozen", err)
+	}
+}
+
+func TestManager_FreezePersisted(t *testing.T) {
+	cfg := testConfig(t)
+	svcs := []config.ServiceConfig{sleepService("api", t.TempDir())}
+
+	m, err := NewManager(cfg, svcs, NopNotifier{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Freeze("api", 0, "incident", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	m.Stop()
+
+	m2, err := NewManager(cfg, svcs, NopNotifier{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m2.Stop()
+
+	if got := m2.DeployBlock("api"); got != "frozen by alice: incident" {
+		t.Errorf("DeployBlock after restart = %q", got)
+	}
+	if err := m2.Unfreeze("api", "bob"); err != nil {
+		t.Fatal(err)
+	}
+	if freezes, _ := LoadFreezes(cfg.StateDir); len(freezes) != 0 {
+		t.Errorf("freezes on disk after unfreeze = %v, want none", freezes)
+	}
+}
+
+func TestManager_HeldDeployReleasedWhenFreezeExpires(t *testing.T) {
+	cfg := testConfig(t)
+	rec := &recordingNotifier{}
+	svc := sleepService("testsvc", t.TempDir())
+	svc.Deploy = config.Steps("true")
+
+	m, err := NewManager(cfg, []config.ServiceConfig{svc}, rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Stop()
+
+	f, err := m.Freeze("testsvc", time.Hour, "", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.HoldDeploy("testsvc", DeployRequest{Trigger: TriggerWebhook, Actor: "pusher"}); err != nil {
+		t.Fatal(err)
+	}
+
+	state, _ := m.GetServiceState("testsvc")
+	if state.Held == nil || state.Held.Actor != "pusher" {
+		t.Fatalf("Held = %+v, want push from pusher", state.Held)
+	}
+	events := rec.getServiceEvents()
+	if len(events) == 0 || !strings.HasPrefix(events[len(events)-1].a, "push held, frozen until") {
+		t.Errorf("events = %v, want push held", events)
+	}
+
+	// Still frozen: nothing happens.
+	m.checkFreezes(time.Now())
+	if h := m.GetAllStates()["testsvc"].Held; h == nil {
+		t.Fatal("held push released while still frozen")
+	}
+
+	m.checkFreezes(f.Until)
+	records := waitForHistory(t, m, "testsvc", 1)
+	if records[0].Trigger != TriggerWebhook || records[0].Actor != "pusher" {
+		t.Errorf("deploy = %+v, want webhook deploy by pusher", records[0])
+	}
+	if h := m.GetAllStates()["testsvc"].Held; h != nil {
+		t.Errorf("Held after release = %+v, want nil", h)
+	}
+	if got := m.DeployBlock("testsvc"); got != "" {
+		t.Errorf("DeployBlock after expiry = %q, want empty", got)
+	}
+}
+
+func TestManager_ReleaseHeld(t *testing.T) {
+	cfg := testConfig(t)
+	svc := sleepService("testsvc", t.TempDir())
+	svc.Deploy = config.Steps("true")
+
+	m, err := NewManager(cfg, []config.ServiceConfig{svc}, NopNotifier{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Stop()
+
+	if m.ReleaseHeld("testsvc", "") {
+		t.Fatal("ReleaseHeld with nothing held returned true")
+	}
+	if _, err := m.Freeze("testsvc", 0, "", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.HoldDeploy("testsvc", DeployRequest{Trigger: TriggerWebhook}); err != nil {
+		t.Fatal(err)
+	}
+	if !m.ReleaseHeld("testsvc", "") {
+		t.Fatal("ReleaseHeld returned false")
+	}
+	waitForHistory(t, m, "testsvc", 1)
+}
+
+func TestManager_DeployBlockOutsideWindows(t *testing.T) {
+	svc := sleepService("testsvc", t.TempDir())
+	svc.DeployWindows = []config.DeployWindow{{Days: []string{"mon"}, Start: "00:00", End: "00:01", Timezone: "UTC"}}
+
+	m, err := NewManager(testConfig(t), []config.ServiceConfig{svc}, NopNotifier{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Stop()
+
+	// 2026-10-20 is a Tuesday.
+	got := m.deployBlock(svc, time.Date(2026, 10, 20, 12, 0, 0, 0, time.UTC))
+	if got != "outside deploy windows (mon 00:00-00:01 UTC)" {
+		t.Errorf("deployBlock = %q", got)
+	}
+	if got := m.deployBlock(svc, time.Date(2026, 10, 19, 0, 0, 30, 0, time.UTC)); got != "" {
+		t.Errorf("deployBlock inside window = %q, want empty", got)
+	}
+}
+
+func TestParseFreezeArgs(t *testing.T) {
+	tests := []struct {
+		args   []string
+		d      time.Duration
+		reason string
+	}{
+		{nil, 0, ""},
+		{[]string{"2h"}, 2 * time.Hour, ""},
+		{[]string{"3d", "release", "week"}, 72 * time.Hour, "release week"},
+		{[]string{"incident", "42"}, 0, "incident 42"},
+		{[]string{"-1h"}, 0, "-1h"},
+	}
+	for _, tt := range tests {
+		d, reason := ParseFreezeArgs(tt.args)
+		if d != tt.d || reason != tt.reason {
+			t.Errorf("ParseFreezeArgs(%q) = %s, %q; want %s, %q", tt.args, d, reason, tt.d, tt.reason)
+		}
+	}
+}
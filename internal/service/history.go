@@ -0,0 +1,194 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/shishberg/mezzaops/internal/deploy"
+)
+
+// historyLimit is how many deploy records are kept per service. Older records
+// are dropped when a new one is added.
+const historyLimit = 50
+
+// Deploy triggers, recorded in DeployRequest and DeployRecord.
+const (
+	TriggerWebhook  = "webhook"
+	TriggerChat     = "chat"
+	TriggerCLI      = "cli"
+	TriggerVerify   = "verify"   // automatic rollback after failed verification
+	TriggerSchedule = "schedule" // a scheduled deploy coming due; Actor scheduled it
+)
+
+// DeployRequest describes who or what asked for a deploy.
+type DeployRequest struct {
+	Trigger string `json:"trigger,omitempty"` // TriggerWebhook, TriggerChat, TriggerCLI, TriggerVerify or TriggerSchedule
+	Actor   string `json:"actor,omitempty"`   // pusher or chat user; empty if unknown
+
+	// Ref is the tag, branch or commit to check out before the deploy
+	// steps run. Empty deploys whatever the steps pull.
+	Ref string `json:"ref,omitempty"`
+
+	// Rollback marks a rollback; Ref is then the commit rolled back to.
+	Rollback bool `json:"rollback,omitempty"`
+
+	// Commit is the head commit of the push that triggered the deploy, if
+	// any. A checkout of Ref overrides it with the commit checked out.
+	Commit string `json:"commit,omitempty"`
+
+	// Branch is the branch pushed to, for a push deployed by its commit
+	// rather than by pulling the branch; when: branch conditions match it.
+	Branch string `json:"branch,omitempty"`
+
+	// Force deploys even if the commit is already deployed.
+	Force bool `json:"force,omitempty"`
+
+	// ApprovedBy lists who approved the push, for services needing approval.
+	ApprovedBy []string `json:"approved_by,omitempty"`
+}
+
+// DeployRecord is one entry in a service's deploy history.
+type DeployRecord struct {
+	ID         string              `json:"id"`
+	Trigger    string              `json:"trigger,omitempty"`
+	Actor      string              `json:"actor,omitempty"`
+	Started    time.Time           `json:"started"`
+	Finished   time.Time           `json:"finished"`
+	Duration   time.Duration       `json:"duration"`
+	Result     string              `json:"result"`                // "success", "failed" or "cancelled"
+	FailedStep string              `json:"failed_step,omitempty"` // or the step running when cancelled
+	SHABefore  string              `json:"sha_before,omitempty"`
+	SHAAfter   string              `json:"sha_after,omitempty"`
+	Release    string              `json:"release,omitempty"` // release made live, in release mode
+	Ref        string              `json:"ref,omitempty"`
+	Rollback   bool                `json:"rollback,omitempty"`
+	Steps      []deploy.StepResult `json:"steps,omitempty"`
+	Output     string              `json:"output,omitempty"` // the tail, if Log is set
+	Log        string              `json:"log,omitempty"`    // file holding the full output
+
+	ApprovedBy  []string `json:"approved_by,omitempty"`
+	CancelledBy string   `json:"cancelled_by,omitempty"`
+}
+
+// ShortSHA returns the abbreviated commit the deploy left checked out.
+func (r DeployRecord) ShortSHA() string {
+	return ShortSHA(r.SHAAfter)
+}
+
+// historyPath returns the history file for a service. History lives in a
+// subdirectory so cleanOrphans doesn't mistake it for a state file.
+func historyPath(dir, name string) string {
+	return filepath.Join(dir, "history", name+".json")
+}
+
+// LoadHistory reads a service's deploy history, newest first. A service that
+// has never deployed has an empty history.
+func LoadHistory(dir, name string) ([]DeployRecord, error) {
+	data, err := os.ReadFile(historyPath(dir, name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var records []DeployRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// AppendHistory adds rec to the front of a service's deploy history, keeping
+// at most historyLimit records. The file is replaced atomically.
+func AppendHistory(dir, name string, rec DeployRecord) error {
+	records, err := LoadHistory(dir, name)
+	if err != nil {
+		return err
+	}
+	records = append([]DeployRecord{rec}, records...)
+	if len(records) > historyLimit {
+		records = records[:historyLimit]
+	}
+
+	data, err := json.Marshal(records)
+	if err != nil {
+		return err
+	}
+	path := historyPath(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// deployID returns the ID for a deploy started at t. IDs sort in start order.
+func deployID(t time.Time) string {
+	return t.UTC().Format("20060102-150405.000")
+}
+
+// ShortSHA returns the first 7 characters of a commit SHA.
+func ShortSHA(sha string) string {
+	if len(sha) < 7 {
+		return sha
+	}
+	return sha[:7]
+}
+
+// FormatHistory renders up to limit records as plain text, one line per
+// deploy, newest first.
+func FormatHistory(name string, records []DeployRecord, limit int) string {
+	if len(records) == 0 {
+		return fmt.Sprintf("no deploys recorded for %s", name)
+	}
+	if len(records) > limit {
+		records = records[:limit]
+	}
+
+	var b strings.Builder
+	for _, r := range records {
+		fmt.Fprintf(&b, "%s  %-7s %6s", r.Started.Local().Format("2006-01-02 15:04:05"),
+			r.Result, r.Duration.Round(time.Second))
+		if r.Rollback {
+			b.WriteString("  rollback")
+		} else if r.Ref != "" {
+			fmt.Fprintf(&b, "  @%s", r.Ref)
+		}
+		if r.SHABefore != "" || r.SHAAfter != "" {
+			fmt.Fprintf(&b, "  %s..%s", ShortSHA(r.SHABefore), ShortSHA(r.SHAAfter))
+		}
+		if r.Trigger != "" {
+			fmt.Fprintf(&b, "  %s", r.Trigger)
+			if r.Actor != "" {
+				fmt.Fprintf(&b, " by %s", r.Actor)
+			}
+		}
+		if len(r.ApprovedBy) > 0 {
+			fmt.Fprintf(&b, ", approved by %s", strings.Join(r.ApprovedBy, ", "))
+		}
+		switch {
+		case r.Result == "cancelled":
+			b.WriteString("  (cancelled")
+			if r.FailedStep != "" {
+				fmt.Fprintf(&b, " during %s", r.FailedStep)
+			}
+			if r.CancelledBy != "" {
+				fmt.Fprintf(&b, " by %s", r.CancelledBy)
+			}
+			b.WriteString(")")
+		case r.FailedStep != "":
+			fmt.Fprintf(&b, "  (failed: %s)", r.FailedStep)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,88 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAppendHistory_NewestFirstAndBounded(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Date(2026, 4, 6, 12, 0, 0, 0, time.UTC)
+
+	for i := range historyLimit + 5 {
+		rec := DeployRecord{
+			ID:      fmt.Sprintf("d%d", i),
+			Started: start.Add(time.Duration(i) * time.Minute),
+			Result:  "success",
+		}
+		if err := AppendHistory(dir, "web", rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	records, err := LoadHistory(dir, "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != historyLimit {
+		t.Fatalf("got %d records, want %d", len(records), historyLimit)
+	}
+	if records[0].ID != fmt.Sprintf("d%d", historyLimit+4) {
+		t.Fatalf("newest record: got %q", records[0].ID)
+	}
+	if records[len(records)-1].ID != "d5" {
+		t.Fatalf("oldest record: got %q, want d5", records[len(records)-1].ID)
+	}
+}
+
+func TestLoadHistory_Missing(t *testing.T) {
+	records, err := LoadHistory(t.TempDir(), "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 0 {
+		t.Fatalf("got %d records, want none", len(records))
+	}
+}
+
+func TestFormatHistory(t *testing.T) {
+	records := []DeployRecord{
+		{
+			Started:    time.Date(2026, 4, 6, 12, 0, 0, 0, time.UTC),
+			Duration:   3 * time.Second,
+			Result:     "failed",
+			FailedStep: "go build .",
+			SHABefore:  "abcdef0123456789",
+			SHAAfter:   "1234567890abcdef",
+			Trigger:    TriggerChat,
+			Actor:      "alice",
+		},
+		{Result: "success"},
+	}
+
+	out := FormatHistory("web", records, 1)
+	for _, want := range []string{"failed", "3s", "abcdef0..1234567", "chat by alice", "(failed: go build .)"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output %q missing %q", out, want)
+		}
+	}
+	if strings.Count(out, "\n") != 1 {
+		t.Errorf("limit 1: got %q", out)
+	}
+
+	approved := FormatHistory("api", []DeployRecord{{Result: "success", Trigger: TriggerWebhook, Actor: "dave", ApprovedBy: []string{"alice", "bob"}}}, 10)
+	if !strings.Contains(approved, "webhook by dave, approved by alice, bob") {
+		t.Errorf("approved: got %q", approved)
+	}
+
+	cancelled := FormatHistory("web", []DeployRecord{{Result: "cancelled", FailedStep: "go build .", CancelledBy: "bob"}}, 10)
+	if !strings.Contains(cancelled, "(cancelled during go build . by bob)") {
+		t.Errorf("cancelled: got %q", cancelled)
+	}
+
+	if got := FormatHistory("web", nil, 10); got != "no deploys recorded for web" {
+		t.Errorf("empty history: got %q", got)
+	}
+}
@@ -10,8 +10,11 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"reflect"
 	"runtime"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"syscall"
@@ -33,41 +36,83 @@ type ServiceState struct {
 	LastDeploy  time.Time `json:"last_deploy,omitzero"`
 	LastRestart time.Time `json:"last_restart,omitzero"`
 	LastResult  string    `json:"last_result,omitempty"`
-	LastOutput  string    `json:"last_output,omitempty"`
+	LastOutput  string    `json:"last_output,omitempty"` // tail of the last deploy's output
 	FailedStep  string    `json:"failed_step,omitempty"`
+	Ref         string    `json:"ref,omitempty"`     // ref of the last deploy; empty for the configured branch
+	Release     string    `json:"release,omitempty"` // live release in release mode; filled in by liveState
+
+	// DeployedCommit is the commit the last successful deploy left live.
+	DeployedCommit string `json:"deployed_commit,omitempty"`
+
+	// LastDeployID is the ID of the last deploy, whose full output
+	// OpenDeployLog returns.
+	LastDeployID string `json:"last_deploy_id,omitempty"`
+
+	// FailedDeploys counts the deploys in a row that have failed, and
+	// AutoDeployPaused is set once there are pause_after_failures of them.
+	FailedDeploys    int  `json:"failed_deploys,omitempty"`
+	AutoDeployPaused bool `json:"auto_deploy_paused,omitempty"`
+
+	// Held is a push waiting for deploys to resume. Paused says why pushes
+	// are held right now, and Freeze is the freeze responsible, if any;
+	// both are filled in by liveState.
+	Held   *HeldDeploy `json:"held,omitempty"`
+	Paused string      `json:"paused,omitempty"`
+	Freeze *Freeze     `json:"freeze,omitempty"`
 }
 
 // managedService wraps a backend with its config, event loop, and deploy queue.
 type managedService struct {
 	config           config.ServiceConfig
 	backend          Backend
-	opCh             chan syncOp   // synchronous ops: start/stop/restart/status/logs/pull
-	deployCh         chan struct{} // async deploy trigger (capacity 1, latest-wins)
-	restartOnStartup bool          // adopt: false triggers a restart when the loop starts
+	opCh             chan syncOp        // synchronous ops: start/stop/restart/status/logs/pull
+	deployCh         chan DeployRequest // async deploy trigger (capacity 1, latest-wins)
+	restartOnStartup bool               // adopt: false triggers a restart when the loop starts
 
 	// state is only accessed from the service loop goroutine (no lock needed).
 	state ServiceState
 
 	// stateMu protects reads of state from outside the loop (GetAllStates, etc.)
 	stateMu sync.Mutex
+
+	// cancelDeploy cancels the running deploy, or is nil between deploys;
+	// cancelledBy is who cancelled it. Both are guarded by stateMu.
+	cancelDeploy context.CancelCauseFunc
+	cancelledBy  string
+
+	// breakerNote is trackFailuresLocked's note on the last deploy, for
+	// notifyBreaker. Guarded by stateMu.
+	breakerNote string
 }
 
 // Manager manages a set of services.
 type Manager struct {
-	services map[string]*managedService
-	notifier Notifier
-	onChange func(name, event string) // for Discord presence updates
-	mu       sync.Mutex
-	ctx      context.Context
-	cancel   context.CancelFunc
-	wg       sync.WaitGroup
+	services       map[string]*managedService
+	notifier       Notifier
+	onChange       func(name, event string)   // for Discord presence updates
+	onReload       func() error               // after services are reloaded
+	secrets        *config.SecretStore        // for secret_env; nil means none
+	freezes        map[string]Freeze          // by target; guarded by mu
+	scheduled      map[string]ScheduledDeploy // by ID; guarded by mu
+	lastScheduleID int                        // guarded by mu
+	scheduleWake   chan struct{}
+	queue          deployQueue
+	mu             sync.Mutex
+	ctx            context.Context
+	cancel         context.CancelFunc
+	wg             sync.WaitGroup
 
 	// Config for creating new services
 	logDir   string
 	stateDir string
 
+	// publicURL is the dashboard's public base URL, without a trailing
+	// slash; guarded by mu.
+	publicURL string
+
 	// For reload
 	servicesDir string
+	profile     string
 
 	// readyCh is closed when frontends are connected and it's safe to send notifications.
 	readyCh chan struct{}
@@ -91,15 +136,42 @@ func NewManager(cfg *config.Config, services []config.ServiceConfig, notifier No
 
 	ctx, cancel := context.WithCancel(context.Background())
 	m := &Manager{
-		services:    make(map[string]*managedService, len(services)),
-		notifier:    notifier,
-		ctx:         ctx,
-		cancel:      cancel,
-		logDir:      cfg.LogDir,
-		stateDir:    cfg.StateDir,
-		servicesDir: cfg.ServicesDir,
-		readyCh:     make(chan struct{}),
-		shutdownCh:  make(chan struct{}),
+		services:     make(map[string]*managedService, len(services)),
+		notifier:     notifier,
+		ctx:          ctx,
+		cancel:       cancel,
+		logDir:       cfg.LogDir,
+		stateDir:     cfg.StateDir,
+		servicesDir:  cfg.ServicesDir,
+		profile:      cfg.Profile,
+		publicURL:    cfg.DashboardURL(),
+		readyCh:      make(chan struct{}),
+		shutdownCh:   make(chan struct{}),
+		scheduleWake: make(chan struct{}, 1),
+	}
+	m.queue.max = cfg.MaxConcurrentDeploys()
+
+	freezes, err := LoadFreezes(cfg.StateDir)
+	if err != nil {
+		log.Printf("loading freezes: %v", err)
+	}
+	m.freezes = freezes
+	if m.freezes == nil {
+		m.freezes = make(map[string]Freeze)
+	}
+
+	scheduled, err := LoadScheduled(cfg.StateDir)
+	if err != nil {
+		log.Printf("loading scheduled deploys: %v", err)
+	}
+	m.scheduled = scheduled
+	if m.scheduled == nil {
+		m.scheduled = make(map[string]ScheduledDeploy)
+	}
+	for id := range m.scheduled {
+		if n, err := strconv.Atoi(id); err == nil {
+			m.lastScheduleID = max(m.lastScheduleID, n)
+		}
 	}
 
 	for _, svc := range services {
@@ -111,6 +183,10 @@ func NewManager(cfg *config.Config, services []config.ServiceConfig, notifier No
 	// Clean up orphan state files
 	m.cleanOrphans()
 
+	m.wg.Add(2)
+	go m.watchFreezes()
+	go m.watchSchedule()
+
 	return m, nil
 }
 
@@ -122,7 +198,7 @@ func (m *Manager) newManagedService(svc config.ServiceConfig) *managedService {
 		config:   svc,
 		backend:  backend,
 		opCh:     make(chan syncOp, 10),
-		deployCh: make(chan struct{}, 1),
+		deployCh: make(chan DeployRequest, 1),
 	}
 
 	// Always try to load persisted state (deploy info, backend state)
@@ -132,13 +208,20 @@ func (m *Manager) newManagedService(svc config.ServiceConfig) *managedService {
 		ms.state.LastRestart = s.LastRestart
 		ms.state.LastResult = s.LastResult
 		ms.state.LastOutput = s.LastOutput
+		ms.state.LastDeployID = s.LastDeployID
+		ms.state.DeployedCommit = s.DeployedCommit
 		ms.state.FailedStep = s.FailedStep
+		ms.state.Ref = s.Ref
+		ms.state.Held = s.Held
+		ms.state.FailedDeploys = s.FailedDeploys
+		ms.state.AutoDeployPaused = s.AutoDeployPaused
 		backend.RestoreBackendState(raw)
 	}
 
 	// On startup: adopt existing state or mark for restart
 	adopt := svc.ShouldAdopt()
 	if pb, ok := backend.(*ProcessBackend); ok {
+		pb.environ = func() ([]string, error) { return m.serviceEnv(svc) }
 		pb.adopt = adopt
 		msg := pb.TryAdopt()
 		log.Printf("**%s**: %s", svc.Name, msg)
@@ -153,7 +236,7 @@ func (m *Manager) newManagedService(svc config.ServiceConfig) *managedService {
 func (m *Manager) backendForConfig(svc config.ServiceConfig) Backend {
 	if len(svc.Entrypoint) > 0 || svc.Process.Cmd != "" {
 		return NewProcessBackend(
-			svc.Name, svc.Dir,
+			svc.Name, svc.WorkDir(),
 			svc.Entrypoint, svc.Process.Cmd,
 			m.logDir,
 		)
@@ -219,8 +302,10 @@ func (m *Manager) serviceLoop(ms *managedService) {
 				exitCh = pb.WaitForExit()
 			}
 
-		case <-ms.deployCh:
-			m.executeDeploy(ms)
+		case req := <-ms.deployCh:
+			m.executeDeploy(ms, req)
+			m.deployDone(ms.config.Name)
+			m.notifyBreaker(ms)
 
 			// Refresh exit channel after deploy (may have restarted)
 			if pb, ok := ms.backend.(*ProcessBackend); ok {
@@ -298,6 +383,7 @@ func (m *Manager) handleOp(ms *managedService, op string) string {
 func (m *Manager) gitPull(ms *managedService) string {
 	cmd := exec.Command("git", "pull")
 	cmd.Dir = ms.config.Dir
+	cmd.Env = gitSSHEnv(ms.config, nil)
 
 	var buf bytes.Buffer
 	cmd.Stdout = &buf
@@ -315,78 +401,331 @@ func (m *Manager) gitPull(ms *managedService) string {
 }
 
 // executeDeploy runs the deploy pipeline for a service.
-func (m *Manager) executeDeploy(ms *managedService) {
+func (m *Manager) executeDeploy(ms *managedService, req DeployRequest) {
 	name := ms.config.Name
-	steps := ms.config.Deploy
 
+	ctx, cancel := context.WithCancelCause(m.ctx)
+	defer cancel(nil)
+
+	now := time.Now()
 	ms.stateMu.Lock()
 	ms.state.Status = "deploying"
-	ms.state.LastDeploy = time.Now()
+	ms.state.LastDeploy = now
+	ms.state.Ref = req.Ref
+	ms.cancelDeploy = cancel
+	ms.cancelledBy = ""
 	ms.stateMu.Unlock()
-
-	m.notifier.DeployStarted(name)
-
-	result, err := deploy.RunSteps(m.ctx, steps, ms.config.Dir)
-	if err != nil || result.Status != "success" {
-		failedStep := ""
-		output := ""
-		if result != nil {
-			failedStep = result.FailedStep
-			output = result.Output
-		}
-
+	defer func() {
 		ms.stateMu.Lock()
-		ms.state.Status = "failed"
-		ms.state.LastResult = "failed"
-		ms.state.LastOutput = output
-		ms.state.FailedStep = failedStep
+		ms.cancelDeploy = nil
 		ms.stateMu.Unlock()
+	}()
+
+	rec := &DeployRecord{
+		ID:         deployID(now),
+		Trigger:    req.Trigger,
+		Actor:      req.Actor,
+		Started:    now,
+		SHABefore:  gitHead(ms.config.WorkDir()),
+		Ref:        req.Ref,
+		Rollback:   req.Rollback,
+		ApprovedBy: req.ApprovedBy,
+	}
+	dlog := openDeployLog(m.logDir, name, rec.ID)
+	defer dlog.close()
+	rec.Log = dlog.path()
 
-		m.saveServiceState(ms)
-		m.notifier.DeployFailed(name, failedStep, output)
+	m.notifyStarted(name, req)
+	progress := &stepProgress{notifier: m.notifier, name: name}
+
+	env, err := m.serviceEnv(ms.config)
+	if err != nil {
+		dlog.add(err.Error())
+		m.finishDeploy(ms, rec, "env", err.Error())
+		m.notifyFailed(name, req, rec, "env", err.Error())
 		return
 	}
 
+	// A rollback in release mode to a release that is still on disk needs
+	// no build: it just makes that release live again.
+	release := ""
+	if ms.config.Releases != nil && req.Rollback {
+		release = findRelease(ms.config, req.Ref)
+	}
+	var output string
+	if release == "" {
+		var ok bool
+		if release, output, ok = m.build(ctx, ms, rec, req, env, progress, dlog); !ok {
+			return
+		}
+	}
+
+	if ms.config.Releases != nil {
+		sr := activateRelease(ms.config, release)
+		progress.update(sr)
+		rec.Steps = append(rec.Steps, sr)
+		output += sr.Output
+		dlog.add(sr.Output)
+		if sr.Status != "success" {
+			m.finishDeploy(ms, rec, sr.Step, output)
+			m.notifyFailed(name, req, rec, sr.Step, output)
+			return
+		}
+		rec.Release = release
+	}
+
 	// Self-deploy: skip restart, save state, notify, then signal shutdown
 	if ms.config.SelfDeploy {
-		ms.stateMu.Lock()
-		ms.state.Status = "running"
-		ms.state.LastResult = "success"
-		ms.state.LastOutput = result.Output
-		ms.state.FailedStep = ""
-		ms.stateMu.Unlock()
-
-		m.saveServiceState(ms)
-		m.notifier.DeploySucceeded(name, result.Output)
+		m.finishDeploy(ms, rec, "", output)
+		m.notifySucceeded(ms, req, rec)
 		close(m.shutdownCh)
 		return
 	}
 
 	// Deploy succeeded, restart the service
 	if restartErr := ms.backend.Restart(m.ctx); restartErr != nil {
-		ms.stateMu.Lock()
-		ms.state.Status = "failed"
-		ms.state.LastResult = "failed"
-		ms.state.LastOutput = result.Output
-		ms.state.FailedStep = "restart"
-		ms.stateMu.Unlock()
-
-		m.saveServiceState(ms)
-		m.notifier.DeployFailed(name, "restart", result.Output)
+		m.finishDeploy(ms, rec, "restart", output)
+		m.notifyFailed(name, req, rec, "restart", output)
 		return
 	}
 
 	ms.stateMu.Lock()
-	ms.state.Status = "running"
-	ms.state.LastResult = "success"
-	ms.state.LastOutput = result.Output
-	ms.state.FailedStep = ""
 	ms.state.LastRestart = time.Now()
 	ms.stateMu.Unlock()
 
-	m.saveServiceState(ms)
-	m.notifier.DeploySucceeded(name, result.Output)
+	if v := ms.config.Verify; v != nil {
+		progress.update(deploy.StepResult{Step: "verify", Status: "running"})
+		sr := verifyDeploy(ctx, ms.backend, v, ms.config.WorkDir(), env)
+		progress.update(sr)
+		rec.Steps = append(rec.Steps, sr)
+		output += sr.Output
+		dlog.add(sr.Output)
+		if sr.Status != "success" {
+			if m.finishIfCancelled(ctx, ms, rec, req, sr.Step, output) {
+				return
+			}
+			m.finishDeploy(ms, rec, sr.Step, output)
+			m.rollBackUnverified(ms, req, rec, sr.Output)
+			return
+		}
+	}
+
+	m.finishDeploy(ms, rec, "", output)
+	m.notifySucceeded(ms, req, rec)
 	m.notifyEvent(name, "restarted")
+	if ms.config.Releases != nil {
+		pruneReleases(ms.config)
+	}
+}
+
+// build is the part of a deploy that runs before the new version goes live:
+// the built-in checkout of a ref, or in release mode the creation of a new
+// release, followed by the deploy steps. It returns the release built, if
+// any, and the output so far. If it fails it records and reports the
+// failure and returns ok false; a failed release is removed. Output is
+// written to dlog as it is produced.
+func (m *Manager) build(ctx context.Context, ms *managedService, rec *DeployRecord, req DeployRequest, env []string, progress *stepProgress, dlog *deployLog) (release, output string, ok bool) {
+	name := ms.config.Name
+	env = gitSSHEnv(ms.config, env)
+	fail := func(step, output string) (string, string, bool) {
+		if release != "" {
+			removeRelease(ms.config, release)
+		}
+		if m.finishIfCancelled(ctx, ms, rec, req, step, output) {
+			return "", "", false
+		}
+		m.finishDeploy(ms, rec, step, output)
+		m.notifyFailed(name, req, rec, step, output)
+		return "", "", false
+	}
+
+	// A new service's first deploy clones its repo.
+	if ms.config.AwaitingClone() {
+		progress.update(deploy.StepResult{Step: "clone " + ms.config.CloneURL(), Status: "running"})
+		sr := cloneRepo(ctx, ms.config, env)
+		progress.update(sr)
+		rec.Steps = append(rec.Steps, sr)
+		dlog.add(sr.Output)
+		output = sr.Output
+		if sr.Status != "success" {
+			return fail(sr.Step, output)
+		}
+	}
+
+	// Rollback targets are already-resolved local commits, so skip the
+	// fetch: a rollback shouldn't depend on the remote being reachable.
+	workDir := ms.config.Dir
+	steps := ms.config.Deploy
+	var sr deploy.StepResult
+	switch {
+	case ms.config.Releases != nil:
+		ref := req.Ref
+		if ref == "" {
+			ref = deployBranch(ms.config, req)
+		}
+		progress.update(deploy.StepResult{Step: "release " + ref, Status: "running"})
+		release, sr = prepareRelease(ctx, ms.config, ref, !req.Rollback, env, rec.Started)
+		workDir = filepath.Join(ms.config.Dir, config.ReleasesDir, release)
+		steps = withoutPull(steps)
+	case req.Ref != "":
+		progress.update(deploy.StepResult{Step: "checkout " + req.Ref, Status: "running"})
+		sr = checkoutRef(ctx, ms.config.Dir, req.Ref, !req.Rollback, env)
+		steps = withoutPull(steps)
+	case detachedHead(ms.config.Dir):
+		branch := homeBranch(ms.config)
+		progress.update(deploy.StepResult{Step: "checkout " + branch, Status: "running"})
+		sr = checkoutBranch(ctx, ms.config.Dir, branch, env)
+	}
+	commit := req.Commit
+	if sr.Step != "" {
+		progress.update(sr)
+		rec.Steps = append(rec.Steps, sr)
+		dlog.add(sr.Output)
+		if sr.Status != "success" {
+			return fail(sr.Step, sr.Output)
+		}
+		output += sr.Output
+		commit = gitHead(workDir)
+	}
+	env = deployContextEnv(env, ms.config, rec, req, commit)
+
+	cond := deploy.Conditions{Branch: deployBranch(ms.config, req), Since: rec.SHABefore}
+	result, err := deploy.RunStepsTo(ctx, steps, workDir, env, cond, progress.update, dlog)
+	if result != nil {
+		rec.Steps = append(rec.Steps, result.Steps...)
+		output += result.Output
+	}
+	if err != nil || result.Status != "success" {
+		failedStep := ""
+		if result != nil {
+			failedStep = result.FailedStep
+		}
+		return fail(failedStep, output)
+	}
+	return release, output, true
+}
+
+// rollBackUnverified handles a deploy that failed verification. Unless it
+// was itself a rollback, or verify.rollback is off, it redeploys the commit
+// checked out before the deploy, then reports whether that worked.
+func (m *Manager) rollBackUnverified(ms *managedService, req DeployRequest, rec *DeployRecord, output string) {
+	name := ms.config.Name
+	if req.Rollback {
+		m.notifier.RollbackFailed(name, "verify", output, m.deployLogURL(name, rec))
+		return
+	}
+
+	target := rec.SHABefore
+	switch {
+	case !ms.config.Verify.ShouldRollback():
+		target = ""
+	case m.ctx.Err() != nil:
+		output += "not rolling back while shutting down\n"
+		target = ""
+	case target == "":
+		output += "no previous commit to roll back to\n"
+	case target == gitHead(ms.config.WorkDir()):
+		output += "the deploy did not change the commit, so there is nothing to roll back to\n"
+		target = ""
+	}
+	logURL := m.deployLogURL(name, rec)
+	if target == "" {
+		m.notifier.DeployVerifyFailed(name, "", output, logURL)
+		return
+	}
+
+	log.Printf("**%s**: deploy failed verification, rolling back to %s", name, ShortSHA(target))
+	m.executeDeploy(ms, DeployRequest{Trigger: TriggerVerify, Actor: req.Actor, Ref: target, Rollback: true})
+
+	ms.stateMu.Lock()
+	rolledBack := ms.state.LastResult == "success"
+	ms.stateMu.Unlock()
+	if !rolledBack {
+		target = ""
+	}
+	m.notifier.DeployVerifyFailed(name, target, output, logURL)
+}
+
+// finishDeploy records the outcome of a deploy in the service state and its
+// deploy history. An empty failedStep means the deploy succeeded.
+func (m *Manager) finishDeploy(ms *managedService, rec *DeployRecord, failedStep, output string) {
+	status, result := "running", "success"
+	if failedStep != "" {
+		status, result = "failed", "failed"
+	}
+	m.recordDeploy(ms, rec, status, result, failedStep, output)
+}
+
+// recordDeploy sets the service's status and last deploy result, and appends
+// rec to its deploy history. If the deploy has a log file, only the tail of
+// its output is kept in either.
+func (m *Manager) recordDeploy(ms *managedService, rec *DeployRecord, status, result, failedStep, output string) {
+	output = summarizeOutput(rec, output)
+	rec.SHAAfter = gitHead(ms.config.WorkDir())
+
+	ms.stateMu.Lock()
+	ms.state.Status = status
+	ms.state.LastResult = result
+	ms.state.LastOutput = output
+	ms.state.LastDeployID = rec.ID
+	if result == "success" {
+		ms.state.DeployedCommit = rec.SHAAfter
+	}
+	if !rec.Rollback {
+		ms.breakerNote = ms.trackFailuresLocked(result)
+	}
+	ms.state.FailedStep = failedStep
+	ms.stateMu.Unlock()
+
+	m.saveServiceState(ms)
+
+	if m.stateDir == "" {
+		return
+	}
+	rec.Finished = time.Now()
+	rec.Duration = rec.Finished.Sub(rec.Started)
+	rec.Result = result
+	rec.FailedStep = failedStep
+	rec.Output = output
+	if err := AppendHistory(m.stateDir, ms.config.Name, *rec); err != nil {
+		log.Printf("**%s**: saving deploy history: %v", ms.config.Name, err)
+	}
+	pruneDeployLogs(m.logDir, ms.config.Name)
+}
+
+// gitHead returns the commit checked out in dir, or "" if dir is not a git
+// repository.
+func gitHead(dir string) string {
+	cmd := exec.Command("git", "rev-parse", "HEAD")
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// deployBranch returns the branch a deploy is for, which steps' when: branch
+// conditions are matched against: the branch pushed to, else the ref if one
+// was given, else the configured branch, else whatever the working tree has
+// checked out.
+func deployBranch(cfg config.ServiceConfig, req DeployRequest) string {
+	if req.Branch != "" {
+		return req.Branch
+	}
+	if req.Ref != "" && !req.Rollback {
+		return req.Ref
+	}
+	if cfg.Branch != "" {
+		return cfg.Branch
+	}
+	cmd := exec.Command("git", "rev-parse", "--abbrev-ref", "HEAD")
+	cmd.Dir = cfg.Dir
+	out, err := cmd.Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
 }
 
 // saveServiceState persists the current state of a managed service to disk.
@@ -396,12 +735,18 @@ func (m *Manager) saveServiceState(ms *managedService) {
 	}
 	ms.stateMu.Lock()
 	state := State{
-		Status:     ms.state.Status,
-		LastDeploy: ms.state.LastDeploy,
-		LastResult: ms.state.LastResult,
-		LastOutput: ms.state.LastOutput,
-		FailedStep: ms.state.FailedStep,
-		Backend:    ms.backend.SaveBackendState(),
+		Status:           ms.state.Status,
+		LastDeploy:       ms.state.LastDeploy,
+		LastResult:       ms.state.LastResult,
+		LastOutput:       ms.state.LastOutput,
+		LastDeployID:     ms.state.LastDeployID,
+		DeployedCommit:   ms.state.DeployedCommit,
+		FailedStep:       ms.state.FailedStep,
+		Ref:              ms.state.Ref,
+		Held:             ms.state.Held,
+		FailedDeploys:    ms.state.FailedDeploys,
+		AutoDeployPaused: ms.state.AutoDeployPaused,
+		Backend:          ms.backend.SaveBackendState(),
 	}
 	ms.stateMu.Unlock()
 
@@ -428,6 +773,36 @@ func (m *Manager) notifyEvent(name, event string) {
 	}
 }
 
+// notifyStarted reports the start of a deploy or rollback.
+func (m *Manager) notifyStarted(name string, req DeployRequest) {
+	if req.Rollback {
+		m.notifier.RollbackStarted(name, req.Ref)
+		return
+	}
+	m.notifier.DeployStarted(name)
+}
+
+// notifySucceeded reports a successful deploy or rollback, a deploy with the
+// commits between rec's before and after.
+func (m *Manager) notifySucceeded(ms *managedService, req DeployRequest, rec *DeployRecord) {
+	name := ms.config.Name
+	if req.Rollback {
+		m.notifier.RollbackSucceeded(name, req.Ref)
+		return
+	}
+	m.notifier.DeploySucceeded(name, deployChangelog(m.ctx, ms.config.Dir, ms.config.Repo, rec.SHABefore, rec.SHAAfter))
+}
+
+// notifyFailed reports a failed deploy or rollback, linking to rec's log.
+func (m *Manager) notifyFailed(name string, req DeployRequest, rec *DeployRecord, step, output string) {
+	logURL := m.deployLogURL(name, rec)
+	if req.Rollback {
+		m.notifier.RollbackFailed(name, step, output, logURL)
+		return
+	}
+	m.notifier.DeployFailed(name, step, output, logURL)
+}
+
 // Do sends a synchronous operation to the named service and blocks for the result.
 func (m *Manager) Do(name, op string) string {
 	m.mu.Lock()
@@ -438,6 +813,20 @@ func (m *Manager) Do(name, op string) string {
 		return fmt.Sprintf("service %q not found", name)
 	}
 
+	// History is read from disk, and a plan only fetches, so neither needs
+	// to wait behind a running deploy.
+	switch op {
+	case "history":
+		records, _ := m.GetDeployHistory(name)
+		return FormatHistory(name, records, 10)
+	case "plan":
+		plan, err := m.Plan(name)
+		if err != nil {
+			return fmt.Sprintf("plan failed: %v", err)
+		}
+		return FormatPlan(plan)
+	}
+
 	so := syncOp{
 		op:     op,
 		result: make(chan string, 1),
@@ -457,8 +846,12 @@ func (m *Manager) Do(name, op string) string {
 	}
 }
 
-// RequestDeploy queues a deploy request for the named service (latest-wins).
-func (m *Manager) RequestDeploy(name string) error {
+// RequestDeploy queues a deploy request for the named service. Deploys start
+// first come, first served, at most deploy.max_concurrent at once; a newer
+// request for a service supersedes one still waiting (latest-wins). req is
+// recorded in the service's deploy history. A deploy of the commit already
+// deployed is skipped with an *AlreadyDeployedError unless req.Force is set.
+func (m *Manager) RequestDeploy(name string, req DeployRequest) error {
 	m.mu.Lock()
 	ms, ok := m.services[name]
 	m.mu.Unlock()
@@ -466,24 +859,23 @@ func (m *Manager) RequestDeploy(name string) error {
 	if !ok {
 		return fmt.Errorf("service %q not found", name)
 	}
+	if err := m.CheckDeployed(name, req); err != nil {
+		return err
+	}
 
-	// Mark as deploying synchronously so callers see a non-idle state immediately.
+	// Mark as queued synchronously so callers see a non-idle state
+	// immediately; it turns to deploying once the deploy has a slot. A
+	// deploy of the branch, or of a push to it, supersedes any held push.
 	ms.stateMu.Lock()
-	ms.state.Status = "deploying"
-	ms.stateMu.Unlock()
-
-	// Drain any pending deploy request (latest-wins).
-	select {
-	case <-ms.deployCh:
-	default:
+	if ms.state.Status != "deploying" {
+		ms.state.Status = "queued"
 	}
-
-	// Non-blocking send.
-	select {
-	case ms.deployCh <- struct{}{}:
-	default:
+	if req.Ref == "" || req.Branch != "" {
+		ms.state.Held = nil
 	}
+	ms.stateMu.Unlock()
 
+	m.enqueueDeploy(name, req)
 	return nil
 }
 
@@ -516,17 +908,29 @@ func (m *Manager) StopAll() {
 }
 
 // Reload re-reads services from the services directory and adds/removes/updates
-// services as needed.
+// services as needed. The service files are validated first; if any problem
+// is found nothing is changed and the validation error is returned. Secrets
+// are re-read too; running processes see rotated values when they next start.
 func (m *Manager) Reload() error {
 	if m.servicesDir == "" {
 		return fmt.Errorf("no services_dir configured")
 	}
 
-	newConfigs, err := config.LoadServices(m.servicesDir)
+	if err := config.ValidateServices(m.servicesDir, m.profile); err != nil {
+		return fmt.Errorf("reload: %w", err)
+	}
+
+	newConfigs, err := config.LoadServices(m.servicesDir, m.profile)
 	if err != nil {
 		return fmt.Errorf("reload: %w", err)
 	}
 
+	if m.secrets != nil {
+		if err := m.secrets.Reload(); err != nil {
+			return fmt.Errorf("reload: %w", err)
+		}
+	}
+
 	seen := make(map[string]bool)
 	for _, svc := range newConfigs {
 		seen[svc.Name] = true
@@ -577,12 +981,21 @@ func (m *Manager) Reload() error {
 
 	m.cleanOrphans()
 
+	m.mu.Lock()
+	onReload := m.onReload
+	m.mu.Unlock()
+	if onReload != nil {
+		if err := onReload(); err != nil {
+			return fmt.Errorf("reload: %w", err)
+		}
+	}
+
 	return nil
 }
 
 // serviceConfigEqual compares two ServiceConfigs for equality.
 func serviceConfigEqual(a, b config.ServiceConfig) bool {
-	if a.Name != b.Name || a.Dir != b.Dir || a.Branch != b.Branch || a.Repo != b.Repo {
+	if a.Name != b.Name || a.Dir != b.Dir || a.Branch != b.Branch || a.Repo != b.Repo || a.DeployKey != b.DeployKey {
 		return false
 	}
 	if a.ServiceName != b.ServiceName || a.UserService != b.UserService || a.Sudo != b.Sudo {
@@ -599,15 +1012,16 @@ func serviceConfigEqual(a, b config.ServiceConfig) bool {
 			return false
 		}
 	}
-	if len(a.Deploy) != len(b.Deploy) {
+	if !reflect.DeepEqual(a.Deploy, b.Deploy) {
 		return false
 	}
-	for i := range a.Deploy {
-		if a.Deploy[i] != b.Deploy[i] {
-			return false
-		}
+	if a.RequireConfirmation != b.RequireConfirmation || !reflect.DeepEqual(a.Approvals, b.Approvals) || a.PauseAfterFailures != b.PauseAfterFailures {
+		return false
+	}
+	if !reflect.DeepEqual(a.DeployWindows, b.DeployWindows) || !reflect.DeepEqual(a.Verify, b.Verify) || !reflect.DeepEqual(a.Releases, b.Releases) {
+		return false
 	}
-	if a.RequireConfirmation != b.RequireConfirmation {
+	if !maps.Equal(a.Env, b.Env) || !maps.Equal(a.SecretEnv, b.SecretEnv) {
 		return false
 	}
 	return a.SelfDeploy == b.SelfDeploy
@@ -652,6 +1066,47 @@ func (m *Manager) SetOnChange(fn func(name, event string)) {
 	m.onChange = fn
 }
 
+// SetOnReload registers a callback invoked at the end of each Reload, after
+// services have been updated. Its error is returned from Reload.
+func (m *Manager) SetOnReload(fn func() error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onReload = fn
+}
+
+// SetSecrets sets the store used to resolve services' secret_env. Must be
+// called before services start, like SetNotifier.
+func (m *Manager) SetSecrets(s *config.SecretStore) {
+	m.secrets = s
+}
+
+// serviceEnv returns the environment for a service's process and deploy
+// steps, or nil to inherit mezzaops's own when it sets no env or secret_env.
+func (m *Manager) serviceEnv(svc config.ServiceConfig) ([]string, error) {
+	if len(svc.Env) == 0 && len(svc.SecretEnv) == 0 {
+		return nil, nil
+	}
+	env := os.Environ()
+	for _, k := range slices.Sorted(maps.Keys(svc.Env)) {
+		env = append(env, k+"="+svc.Env[k])
+	}
+	for _, k := range slices.Sorted(maps.Keys(svc.SecretEnv)) {
+		name := svc.SecretEnv[k]
+		if m.secrets == nil {
+			return nil, fmt.Errorf("secret_env %s: no secret store configured", k)
+		}
+		v, ok, err := m.secrets.Lookup(name)
+		if err != nil {
+			return nil, fmt.Errorf("secret_env %s: %w", k, err)
+		}
+		if !ok {
+			return nil, fmt.Errorf("secret_env %s: secret %s not found", k, name)
+		}
+		env = append(env, k+"="+v)
+	}
+	return env, nil
+}
+
 // GetAllStates returns a snapshot of all service states.
 func (m *Manager) GetAllStates() map[string]ServiceState {
 	m.mu.Lock()
@@ -667,13 +1122,22 @@ func (m *Manager) GetAllStates() map[string]ServiceState {
 }
 
 // liveState returns the service state with a live status probe.
-// During "deploying", the cached status is preserved.
+// While deploying or queued, the cached status is preserved.
 func (m *Manager) liveState(ms *managedService) ServiceState {
 	ms.stateMu.Lock()
 	s := ms.state
 	ms.stateMu.Unlock()
 
-	if s.Status == "deploying" {
+	now := time.Now()
+	s.Paused = m.deployBlock(ms.config, now)
+	if ms.config.Releases != nil {
+		s.Release = currentRelease(ms.config)
+	}
+	if f, ok := m.activeFreeze(ms.config.Name, now); ok {
+		s.Freeze = &f
+	}
+
+	if s.Status == "deploying" || s.Status == "queued" {
 		return s
 	}
 
@@ -716,6 +1180,23 @@ func (m *Manager) GetServiceLogs(name string) string {
 	return m.Do(name, "logs")
 }
 
+// GetDeployHistory returns the recorded deploys for a named service, newest
+// first.
+func (m *Manager) GetDeployHistory(name string) ([]DeployRecord, bool) {
+	m.mu.Lock()
+	_, ok := m.services[name]
+	m.mu.Unlock()
+	if !ok || m.stateDir == "" {
+		return nil, ok
+	}
+
+	records, err := LoadHistory(m.stateDir, name)
+	if err != nil {
+		log.Printf("**%s**: loading deploy history: %v", name, err)
+	}
+	return records, true
+}
+
 // GetServiceConfig returns the config for a named service.
 func (m *Manager) GetServiceConfig(name string) (config.ServiceConfig, bool) {
 	m.mu.Lock()
@@ -752,6 +1233,12 @@ func (m *Manager) SignalReady() {
 	close(m.readyCh)
 }
 
+// NotifyEvent reports a service event to the notifier, for events the app
+// detects itself, such as a skipped push.
+func (m *Manager) NotifyEvent(name, event string) {
+	m.notifyEvent(name, event)
+}
+
 // NotifyWebhook forwards webhook details to the notifier, for a service that
 // matched an incoming webhook.
 func (m *Manager) NotifyWebhook(name string, info WebhookInfo) {
@@ -338,7 +338,7 @@ func TestManager_RequestDeploy_Success(t *testing.T) {
 		Name:       "testsvc",
 		Dir:        dir,
 		Entrypoint: []string{"sleep", "3600"},
-		Deploy:     []string{"echo deploying"},
+		Deploy:     config.Steps("echo deploying"),
 	}
 
 	m, err := NewManager(cfg, []config.ServiceConfig{svc}, rec)
@@ -350,7 +350,7 @@ func TestManager_RequestDeploy_Success(t *testing.T) {
 	// Start the service first so restart works
 	m.Do("testsvc", "start")
 
-	if err := m.RequestDeploy("testsvc"); err != nil {
+	if err := m.RequestDeploy("testsvc", DeployRequest{}); err != nil {
 		t.Fatal(err)
 	}
 
@@ -386,7 +386,7 @@ func TestManager_RequestDeploy_Failure(t *testing.T) {
 		Name:       "testsvc",
 		Dir:        dir,
 		Entrypoint: []string{"sleep", "3600"},
-		Deploy:     []string{"false"}, // will fail
+		Deploy:     config.Steps("false"), // will fail
 	}
 
 	m, err := NewManager(cfg, []config.ServiceConfig{svc}, rec)
@@ -395,7 +395,7 @@ func TestManager_RequestDeploy_Failure(t *testing.T) {
 	}
 	defer m.Stop()
 
-	if err := m.RequestDeploy("testsvc"); err != nil {
+	if err := m.RequestDeploy("testsvc", DeployRequest{}); err != nil {
 		t.Fatal(err)
 	}
 
@@ -421,6 +421,43 @@ func TestManager_RequestDeploy_Failure(t *testing.T) {
 	}
 }
 
+func TestManager_RequestDeploy_FailedStepName(t *testing.T) {
+	cfg := testConfig(t)
+	rec := &recordingNotifier{}
+
+	svc := config.ServiceConfig{
+		Name:       "testsvc",
+		Dir:        t.TempDir(),
+		Entrypoint: []string{"sleep", "3600"},
+		Deploy: []config.DeployStep{
+			{Run: "true"},
+			{Name: "build", Run: "exit 2"},
+		},
+	}
+
+	m, err := NewManager(cfg, []config.ServiceConfig{svc}, rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Stop()
+
+	if err := m.RequestDeploy("testsvc", DeployRequest{}); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.After(10 * time.Second)
+	for len(rec.getDeployFailed()) == 0 {
+		select {
+		case <-deadline:
+			t.Fatal("timed out waiting for DeployFailed")
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+	if got := rec.getDeployFailed()[0].a; got != "build" {
+		t.Fatalf("failed step = %q, want %q", got, "build")
+	}
+}
+
 func TestManager_RequestDeploy_NotFound(t *testing.T) {
 	cfg := testConfig(t)
 	m, err := NewManager(cfg, nil, NopNotifier{})
@@ -429,7 +466,7 @@ func TestManager_RequestDeploy_NotFound(t *testing.T) {
 	}
 	defer m.Stop()
 
-	if err := m.RequestDeploy("nonexistent"); err == nil {
+	if err := m.RequestDeploy("nonexistent", DeployRequest{}); err == nil {
 		t.Fatal("expected error for nonexistent service")
 	}
 }
@@ -579,7 +616,7 @@ func TestManager_Reload(t *testing.T) {
 	cfg := testConfig(t)
 	cfg.ServicesDir = servicesDir
 
-	services, err := config.LoadServices(servicesDir)
+	services, err := config.LoadServices(servicesDir, "")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -622,6 +659,47 @@ func TestManager_Reload(t *testing.T) {
 	}
 }
 
+func TestManager_Reload_RejectsInvalidConfig(t *testing.T) {
+	servicesDir := t.TempDir()
+	svcData := []byte("dir: /tmp\nentrypoint:\n  - sleep\n  - \"3600\"\n")
+	if err := os.WriteFile(filepath.Join(servicesDir, "svc1.yaml"), svcData, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := testConfig(t)
+	cfg.ServicesDir = servicesDir
+
+	services, err := config.LoadServices(servicesDir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := NewManager(cfg, services, NopNotifier{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Stop()
+
+	// A typo in a new file must not be applied, and must not disturb svc1.
+	badData := []byte("dir: /tmp\nentry_point:\n  - sleep\n")
+	if err := os.WriteFile(filepath.Join(servicesDir, "svc2.yaml"), badData, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	err = m.Reload()
+	if err == nil {
+		t.Fatal("expected reload to fail")
+	}
+	if !strings.Contains(err.Error(), "svc2.yaml:2") || !strings.Contains(err.Error(), "entry_point") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	names := m.ServiceNames()
+	if len(names) != 1 || names[0] != "svc1" {
+		t.Fatalf("after rejected reload: got %v", names)
+	}
+}
+
 func TestManager_ProcessExitNotification(t *testing.T) {
 	cfg := testConfig(t)
 	dir := t.TempDir()
@@ -686,7 +764,7 @@ func TestManager_DeployNoSteps(t *testing.T) {
 	// Start the service first so restart works
 	m.Do("testsvc", "start")
 
-	if err := m.RequestDeploy("testsvc"); err != nil {
+	if err := m.RequestDeploy("testsvc", DeployRequest{}); err != nil {
 		t.Fatal(err)
 	}
 
@@ -725,7 +803,7 @@ func TestManager_DeployRestartFailure(t *testing.T) {
 		Name:       "badsvc",
 		Dir:        dir,
 		Entrypoint: []string{"/nonexistent/binary"},
-		Deploy:     []string{"echo ok"},
+		Deploy:     config.Steps("echo ok"),
 	}
 
 	m, err := NewManager(cfg, []config.ServiceConfig{svc}, rec)
@@ -734,7 +812,7 @@ func TestManager_DeployRestartFailure(t *testing.T) {
 	}
 	defer m.Stop()
 
-	if err := m.RequestDeploy("badsvc"); err != nil {
+	if err := m.RequestDeploy("badsvc", DeployRequest{}); err != nil {
 		t.Fatal(err)
 	}
 
@@ -839,7 +917,7 @@ func TestManager_DeployStateSurvivesRestart(t *testing.T) {
 		Name:       "testsvc",
 		Dir:        dir,
 		Entrypoint: []string{"sleep", "3600"},
-		Deploy:     []string{"echo deploying"},
+		Deploy:     config.Steps("echo deploying"),
 	}
 
 	m, err := NewManager(cfg, []config.ServiceConfig{svc}, rec)
@@ -849,7 +927,7 @@ func TestManager_DeployStateSurvivesRestart(t *testing.T) {
 
 	// Start and deploy
 	m.Do("testsvc", "start")
-	if err := m.RequestDeploy("testsvc"); err != nil {
+	if err := m.RequestDeploy("testsvc", DeployRequest{}); err != nil {
 		t.Fatal(err)
 	}
 
@@ -993,7 +1071,7 @@ func TestManager_SelfDeploy(t *testing.T) {
 		Name:       "selfsvc",
 		Dir:        dir,
 		Entrypoint: []string{"sleep", "3600"},
-		Deploy:     []string{"echo deploying"},
+		Deploy:     config.Steps("echo deploying"),
 		SelfDeploy: true,
 	}
 
@@ -1012,7 +1090,7 @@ func TestManager_SelfDeploy(t *testing.T) {
 		t.Fatalf("status before deploy: got %q, want running", states["selfsvc"].Status)
 	}
 
-	if err := m.RequestDeploy("selfsvc"); err != nil {
+	if err := m.RequestDeploy("selfsvc", DeployRequest{}); err != nil {
 		t.Fatal(err)
 	}
 
@@ -1055,7 +1133,7 @@ func TestManager_SelfDeploy_Failure(t *testing.T) {
 		Name:       "selfsvc",
 		Dir:        dir,
 		Entrypoint: []string{"sleep", "3600"},
-		Deploy:     []string{"false"}, // will fail
+		Deploy:     config.Steps("false"), // will fail
 		SelfDeploy: true,
 	}
 
@@ -1065,7 +1143,7 @@ func TestManager_SelfDeploy_Failure(t *testing.T) {
 	}
 	defer m.Stop()
 
-	if err := m.RequestDeploy("selfsvc"); err != nil {
+	if err := m.RequestDeploy("selfsvc", DeployRequest{}); err != nil {
 		t.Fatal(err)
 	}
 
@@ -1159,3 +1237,118 @@ func TestManager_ServiceLoopWithContext(t *testing.T) {
 	result := m.Do("testsvc", "status")
 	_ = result // may return error or timeout, just shouldn't hang
 }
+
+func TestManager_DeployWithSecretEnv(t *testing.T) {
+	cfg := testConfig(t)
+	credDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(credDir, "db_password"), []byte("hunter2\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	secrets, err := config.NewSecretStore([]config.SecretSource{{Type: "dir", Path: credDir}}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	svc := config.ServiceConfig{
+		Name:      "testsvc",
+		Dir:       t.TempDir(),
+		Deploy:    config.Steps("echo $MODE:$DB_PASSWORD"),
+		Env:       map[string]string{"MODE": "prod"},
+		SecretEnv: map[string]string{"DB_PASSWORD": "db_password"},
+	}
+	missing := config.ServiceConfig{
+		Name:      "missing",
+		Dir:       t.TempDir(),
+		Deploy:    config.Steps("echo should not run"),
+		SecretEnv: map[string]string{"TOKEN": "no_such_secret"},
+	}
+
+	rec := &recordingNotifier{}
+	m, err := NewManager(cfg, []config.ServiceConfig{svc, missing}, rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Stop()
+	m.SetSecrets(secrets)
+
+	for _, name := range []string{"testsvc", "missing"} {
+		if err := m.RequestDeploy(name, DeployRequest{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deadline := time.After(10 * time.Second)
+	for {
+		s1, _ := m.GetServiceState("testsvc")
+		s2, _ := m.GetServiceState("missing")
+		if s1.LastResult != "" && s2.LastResult != "" {
+			break
+		}
+		select {
+		case <-deadline:
+			t.Fatal("timed out waiting for deploys")
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+
+	state, _ := m.GetServiceState("testsvc")
+	if !strings.Contains(state.LastOutput, "prod:hunter2") {
+		t.Errorf("deploy output = %q, want it to contain prod:hunter2", state.LastOutput)
+	}
+
+	state, _ = m.GetServiceState("missing")
+	if state.LastResult != "failed" || state.FailedStep != "env" {
+		t.Errorf("missing secret: result=%q step=%q, want failed at env", state.LastResult, state.FailedStep)
+	}
+	if !strings.Contains(state.LastOutput, "secret no_such_secret not found") {
+		t.Errorf("missing secret output = %q", state.LastOutput)
+	}
+}
+
+func TestManager_DeployHistory(t *testing.T) {
+	cfg := testConfig(t)
+	dir, commit := gitRepo(t)
+	commit("one")
+
+	svc := config.ServiceConfig{
+		Name:       "testsvc",
+		Dir:        dir,
+		Entrypoint: []string{"sleep", "3600"},
+		Deploy: config.Steps(
+			"echo building",
+			"git -c user.name=t -c user.email=t@example.com commit -q --allow-empty -m two",
+		),
+	}
+
+	m, err := NewManager(cfg, []config.ServiceConfig{svc}, NopNotifier{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Stop()
+
+	req := DeployRequest{Trigger: TriggerChat, Actor: "alice"}
+	if err := m.RequestDeploy("testsvc", req); err != nil {
+		t.Fatal(err)
+	}
+
+	r := waitForHistory(t, m, "testsvc", 1)[0]
+	if r.Result != "success" || r.Trigger != TriggerChat || r.Actor != "alice" {
+		t.Fatalf("record: result=%q trigger=%q actor=%q", r.Result, r.Trigger, r.Actor)
+	}
+	if r.SHABefore == "" || r.SHAAfter == "" || r.SHABefore == r.SHAAfter {
+		t.Fatalf("SHAs: before=%q after=%q, want two different commits", r.SHABefore, r.SHAAfter)
+	}
+	if len(r.Steps) != 2 || r.Steps[0].Output != "building\n" {
+		t.Fatalf("steps: %+v", r.Steps)
+	}
+	if r.Finished.Before(r.Started) || r.Duration <= 0 {
+		t.Fatalf("timing: started=%v finished=%v duration=%v", r.Started, r.Finished, r.Duration)
+	}
+
+	if out := m.Do("testsvc", "history"); !strings.Contains(out, "chat by alice") {
+		t.Fatalf("history command: got %q", out)
+	}
+	if _, ok := m.GetDeployHistory("nonexistent"); ok {
+		t.Fatal("expected not found for nonexistent")
+	}
+}
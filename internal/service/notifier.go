@@ -3,6 +3,8 @@ package service
 import (
 	"fmt"
 	"strings"
+
+	"github.com/shishberg/mezzaops/internal/deploy"
 )
 
 // WebhookInfo carries details about a received webhook for notifications.
@@ -21,10 +23,7 @@ type WebhookInfo struct {
 // ShortSHA returns the first 7 characters of the commit SHA, or the full ID
 // if it's shorter than 7 characters.
 func (w WebhookInfo) ShortSHA() string {
-	if len(w.CommitID) < 7 {
-		return w.CommitID
-	}
-	return w.CommitID[:7]
+	return ShortSHA(w.CommitID)
 }
 
 // ShortMessage returns the first line of the commit message, truncated to 300
@@ -80,12 +79,40 @@ func (w WebhookInfo) FormatMessage(wrappedName string) string {
 	return b.String()
 }
 
+// WithLogLink appends a Markdown link to a deploy's full log to a failure
+// headline, if there is a log URL.
+func WithLogLink(headline, logURL string) string {
+	if logURL == "" {
+		return headline
+	}
+	return fmt.Sprintf("%s [Full log](%s)", headline, logURL)
+}
+
 // Notifier receives service lifecycle and deploy events.
+//
+// DeployProgress is called between DeployStarted (or RollbackStarted) and the
+// matching success or failure, each time a step starts or finishes. steps
+// holds every step so far, the running one last with Status "running", and
+// each finished step's Output trimmed to its last few lines.
+//
+// DeploySucceeded's changes lists the commits the deploy brought in.
+//
+// DeployVerifyFailed follows a deploy that failed its post-restart
+// verification, once any automatic rollback has finished. rolledBackTo is the
+// commit restored, or empty if the deploy was not rolled back.
+//
+// The failure events' logURL is where the deploy's full output can be read,
+// or empty if there is no such page; output may be only its tail.
 type Notifier interface {
 	ServiceEvent(name, event string)
 	DeployStarted(name string)
-	DeploySucceeded(name, output string)
-	DeployFailed(name, step, output string)
+	DeployProgress(name string, steps []deploy.StepResult)
+	DeploySucceeded(name string, changes Changelog)
+	DeployFailed(name, step, output, logURL string)
+	DeployVerifyFailed(name, rolledBackTo, output, logURL string)
+	RollbackStarted(name, sha string)
+	RollbackSucceeded(name, sha string)
+	RollbackFailed(name, step, output, logURL string)
 	WebhookReceived(name string, info WebhookInfo)
 }
 
@@ -106,17 +133,52 @@ func (m MultiNotifier) DeployStarted(name string) {
 	}
 }
 
+// DeployProgress notifies all registered notifiers.
+func (m MultiNotifier) DeployProgress(name string, steps []deploy.StepResult) {
+	for _, n := range m {
+		n.DeployProgress(name, steps)
+	}
+}
+
 // DeploySucceeded notifies all registered notifiers.
-func (m MultiNotifier) DeploySucceeded(name, output string) {
+func (m MultiNotifier) DeploySucceeded(name string, changes Changelog) {
 	for _, n := range m {
-		n.DeploySucceeded(name, output)
+		n.DeploySucceeded(name, changes)
 	}
 }
 
 // DeployFailed notifies all registered notifiers.
-func (m MultiNotifier) DeployFailed(name, step, output string) {
+func (m MultiNotifier) DeployFailed(name, step, output, logURL string) {
+	for _, n := range m {
+		n.DeployFailed(name, step, output, logURL)
+	}
+}
+
+// DeployVerifyFailed notifies all registered notifiers.
+func (m MultiNotifier) DeployVerifyFailed(name, rolledBackTo, output, logURL string) {
+	for _, n := range m {
+		n.DeployVerifyFailed(name, rolledBackTo, output, logURL)
+	}
+}
+
+// RollbackStarted notifies all registered notifiers.
+func (m MultiNotifier) RollbackStarted(name, sha string) {
+	for _, n := range m {
+		n.RollbackStarted(name, sha)
+	}
+}
+
+// RollbackSucceeded notifies all registered notifiers.
+func (m MultiNotifier) RollbackSucceeded(name, sha string) {
+	for _, n := range m {
+		n.RollbackSucceeded(name, sha)
+	}
+}
+
+// RollbackFailed notifies all registered notifiers.
+func (m MultiNotifier) RollbackFailed(name, step, output, logURL string) {
 	for _, n := range m {
-		n.DeployFailed(name, step, output)
+		n.RollbackFailed(name, step, output, logURL)
 	}
 }
 
@@ -130,8 +192,13 @@ func (m MultiNotifier) WebhookReceived(name string, info WebhookInfo) {
 // NopNotifier discards all events. Useful as a default or in tests.
 type NopNotifier struct{}
 
-func (NopNotifier) ServiceEvent(string, string)         {}
-func (NopNotifier) DeployStarted(string)                {}
-func (NopNotifier) DeploySucceeded(string, string)      {}
-func (NopNotifier) DeployFailed(string, string, string) {}
-func (NopNotifier) WebhookReceived(string, WebhookInfo) {}
+func (NopNotifier) ServiceEvent(string, string)                       {}
+func (NopNotifier) DeployStarted(string)                              {}
+func (NopNotifier) DeployProgress(string, []deploy.StepResult)        {}
+func (NopNotifier) DeploySucceeded(string, Changelog)                 {}
+func (NopNotifier) DeployFailed(string, string, string, string)       {}
+func (NopNotifier) DeployVerifyFailed(string, string, string, string) {}
+func (NopNotifier) RollbackStarted(string, string)                    {}
+func (NopNotifier) RollbackSucceeded(string, string)                  {}
+func (NopNotifier) RollbackFailed(string, string, string, string)     {}
+func (NopNotifier) WebhookReceived(string, WebhookInfo)               {}
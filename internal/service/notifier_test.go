@@ -3,6 +3,8 @@ package service
 import (
 	"sync"
 	"testing"
+
+	"github.com/shishberg/mezzaops/internal/deploy"
 )
 
 // recordingNotifier captures all calls for assertion. Thread-safe.
@@ -10,8 +12,11 @@ type recordingNotifier struct {
 	mu              sync.Mutex
 	serviceEvents   []notifierCall
 	deployStarted   []string
-	deploySucceeded []notifierCall
+	deployProgress  [][]deploy.StepResult
+	deploySucceeded []succeededCall
 	deployFailed    []notifierCall
+	rollbackEvents  []notifierCall // a is started/succeeded/failed, b the SHA or step
+	verifyFailed    []notifierCall // a is the commit rolled back to, b the output
 	webhookReceived []webhookCall
 }
 
@@ -22,6 +27,12 @@ type webhookCall struct {
 
 type notifierCall struct {
 	name, a, b string
+	logURL     string
+}
+
+type succeededCall struct {
+	name    string
+	changes Changelog
 }
 
 func (r *recordingNotifier) ServiceEvent(name, event string) {
@@ -36,16 +47,46 @@ func (r *recordingNotifier) DeployStarted(name string) {
 	r.deployStarted = append(r.deployStarted, name)
 }
 
-func (r *recordingNotifier) DeploySucceeded(name, output string) {
+func (r *recordingNotifier) DeployProgress(name string, steps []deploy.StepResult) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.deployProgress = append(r.deployProgress, steps)
+}
+
+func (r *recordingNotifier) DeploySucceeded(name string, changes Changelog) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.deploySucceeded = append(r.deploySucceeded, succeededCall{name: name, changes: changes})
+}
+
+func (r *recordingNotifier) DeployFailed(name, step, output, logURL string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.deployFailed = append(r.deployFailed, notifierCall{name: name, a: step, b: output, logURL: logURL})
+}
+
+func (r *recordingNotifier) DeployVerifyFailed(name, rolledBackTo, output, logURL string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.verifyFailed = append(r.verifyFailed, notifierCall{name: name, a: rolledBackTo, b: output, logURL: logURL})
+}
+
+func (r *recordingNotifier) RollbackStarted(name, sha string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.rollbackEvents = append(r.rollbackEvents, notifierCall{name: name, a: "started", b: sha})
+}
+
+func (r *recordingNotifier) RollbackSucceeded(name, sha string) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	r.deploySucceeded = append(r.deploySucceeded, notifierCall{name: name, a: output})
+	r.rollbackEvents = append(r.rollbackEvents, notifierCall{name: name, a: "succeeded", b: sha})
 }
 
-func (r *recordingNotifier) DeployFailed(name, step, output string) {
+func (r *recordingNotifier) RollbackFailed(name, step, _, logURL string) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	r.deployFailed = append(r.deployFailed, notifierCall{name: name, a: step, b: output})
+	r.rollbackEvents = append(r.rollbackEvents, notifierCall{name: name, a: "failed", b: step, logURL: logURL})
 }
 
 func (r *recordingNotifier) WebhookReceived(name string, info WebhookInfo) {
@@ -72,10 +113,18 @@ func (r *recordingNotifier) getDeployStarted() []string {
 	return cp
 }
 
-func (r *recordingNotifier) getDeploySucceeded() []notifierCall {
+func (r *recordingNotifier) getDeployProgress() [][]deploy.StepResult {
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	cp := make([]notifierCall, len(r.deploySucceeded))
+	cp := make([][]deploy.StepResult, len(r.deployProgress))
+	copy(cp, r.deployProgress)
+	return cp
+}
+
+func (r *recordingNotifier) getDeploySucceeded() []succeededCall {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cp := make([]succeededCall, len(r.deploySucceeded))
 	copy(cp, r.deploySucceeded)
 	return cp
 }
@@ -88,6 +137,22 @@ func (r *recordingNotifier) getDeployFailed() []notifierCall {
 	return cp
 }
 
+func (r *recordingNotifier) getVerifyFailed() []notifierCall {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cp := make([]notifierCall, len(r.verifyFailed))
+	copy(cp, r.verifyFailed)
+	return cp
+}
+
+func (r *recordingNotifier) getRollbackEvents() []notifierCall {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cp := make([]notifierCall, len(r.rollbackEvents))
+	copy(cp, r.rollbackEvents)
+	return cp
+}
+
 func (r *recordingNotifier) getWebhookReceived() []webhookCall {
 	r.mu.Lock()
 	defer r.mu.Unlock()
@@ -131,9 +196,9 @@ func TestMultiNotifierDeploySucceeded(t *testing.T) {
 	r2 := &recordingNotifier{}
 	multi := MultiNotifier{r1, r2}
 
-	multi.DeploySucceeded("svc", "output")
+	multi.DeploySucceeded("svc", Changelog{After: "abc1234"})
 
-	if len(r1.deploySucceeded) != 1 || r1.deploySucceeded[0].name != "svc" || r1.deploySucceeded[0].a != "output" {
+	if len(r1.deploySucceeded) != 1 || r1.deploySucceeded[0].name != "svc" || r1.deploySucceeded[0].changes.After != "abc1234" {
 		t.Fatalf("r1 got %+v", r1.deploySucceeded)
 	}
 	if len(r2.deploySucceeded) != 1 {
@@ -146,7 +211,7 @@ func TestMultiNotifierDeployFailed(t *testing.T) {
 	r2 := &recordingNotifier{}
 	multi := MultiNotifier{r1, r2}
 
-	multi.DeployFailed("svc", "step1", "error output")
+	multi.DeployFailed("svc", "step1", "error output", "")
 
 	if len(r1.deployFailed) != 1 || r1.deployFailed[0].name != "svc" || r1.deployFailed[0].a != "step1" || r1.deployFailed[0].b != "error output" {
 		t.Fatalf("r1 got %+v", r1.deployFailed)
@@ -156,13 +221,29 @@ func TestMultiNotifierDeployFailed(t *testing.T) {
 	}
 }
 
+func TestMultiNotifierDeployVerifyFailed(t *testing.T) {
+	r1 := &recordingNotifier{}
+	r2 := &recordingNotifier{}
+	multi := MultiNotifier{r1, r2}
+
+	multi.DeployVerifyFailed("svc", "abc123", "service stopped", "")
+
+	want := notifierCall{name: "svc", a: "abc123", b: "service stopped"}
+	if len(r1.verifyFailed) != 1 || r1.verifyFailed[0] != want {
+		t.Fatalf("r1 got %+v", r1.verifyFailed)
+	}
+	if len(r2.verifyFailed) != 1 {
+		t.Fatalf("r2 got %+v", r2.verifyFailed)
+	}
+}
+
 func TestMultiNotifierEmpty(t *testing.T) {
 	multi := MultiNotifier{}
 	// Should not panic
 	multi.ServiceEvent("svc", "started")
 	multi.DeployStarted("svc")
-	multi.DeploySucceeded("svc", "out")
-	multi.DeployFailed("svc", "step", "err")
+	multi.DeploySucceeded("svc", Changelog{})
+	multi.DeployFailed("svc", "step", "err", "")
 	multi.WebhookReceived("svc", WebhookInfo{})
 }
 
@@ -199,7 +280,7 @@ func TestNopNotifier(t *testing.T) {
 	// Should not panic
 	n.ServiceEvent("svc", "started")
 	n.DeployStarted("svc")
-	n.DeploySucceeded("svc", "out")
-	n.DeployFailed("svc", "step", "err")
+	n.DeploySucceeded("svc", Changelog{})
+	n.DeployFailed("svc", "step", "err", "")
 	n.WebhookReceived("svc", WebhookInfo{})
 }
@@ -0,0 +1,161 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// planTimeout bounds the git fetch and queries behind a deploy plan.
+const planTimeout = time.Minute
+
+// Plans list at most this many commits and files; the rest are counted.
+const (
+	planCommitLimit = 20
+	planFileLimit   = 30
+)
+
+// DeployPlan is what a deploy of a service's branch would bring in.
+type DeployPlan struct {
+	Service  string       `json:"service"`
+	Upstream string       `json:"upstream"` // e.g. "origin/main"
+	Head     string       `json:"head"`     // the commit checked out (live, in release mode)
+	Target   string       `json:"target"`   // the upstream commit
+	Commits  []PlanCommit `json:"commits"`  // newest first
+	Files    []string     `json:"files"`    // git diff --name-status lines, e.g. "M\tmain.go"
+	Dirty    []string     `json:"dirty"`    // git status --porcelain lines
+}
+
+// PlanCommit is one incoming commit in a DeployPlan.
+type PlanCommit struct {
+	SHA     string `json:"sha"`
+	Author  string `json:"author"`
+	Subject string `json:"subject"`
+}
+
+// Plan fetches the named service's repo and reports the commits and files
+// between what is checked out and the upstream branch, and whether the
+// working tree is dirty. Nothing is checked out or changed.
+func (m *Manager) Plan(name string) (*DeployPlan, error) {
+	m.mu.Lock()
+	ms, ok := m.services[name]
+	m.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("service %q not found", name)
+	}
+	cfg := ms.config
+
+	env, err := m.serviceEnv(cfg)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(m.ctx, planTimeout)
+	defer cancel()
+
+	plan := &DeployPlan{Service: name, Head: gitHead(cfg.WorkDir())}
+	if plan.Head == "" {
+		return nil, fmt.Errorf("%s has no commit checked out", cfg.WorkDir())
+	}
+	g := &gitCmds{ctx: ctx, dir: cfg.Dir, env: gitSSHEnv(cfg, env)}
+	if !g.fetch() {
+		return nil, fmt.Errorf("git fetch failed:\n%s", g.out.String())
+	}
+
+	branch := deployBranch(cfg, DeployRequest{})
+	if branch == "" {
+		return nil, fmt.Errorf("cannot tell which branch %s deploys", name)
+	}
+	for _, upstream := range []string{"origin/" + branch, branch} {
+		if sha, _, err := g.quiet("rev-parse", "--verify", "--quiet", upstream+"^{commit}"); err == nil {
+			plan.Upstream, plan.Target = upstream, sha
+			break
+		}
+	}
+	if plan.Upstream == "" {
+		return nil, fmt.Errorf("unknown branch %q", branch)
+	}
+
+	commits, stderr, err := g.quiet("log", "--format=%H%x1f%an%x1f%s", plan.Head+".."+plan.Target)
+	if err != nil {
+		return nil, fmt.Errorf("git log: %s", strings.TrimSpace(string(stderr)))
+	}
+	for _, line := range gitLines(commits) {
+		f := strings.SplitN(line, "\x1f", 3)
+		if len(f) == 3 {
+			plan.Commits = append(plan.Commits, PlanCommit{SHA: f[0], Author: f[1], Subject: f[2]})
+		}
+	}
+
+	// Three dots: only what the upstream changed, not local commits.
+	files, stderr, err := g.quiet("diff", "--name-status", plan.Head+"..."+plan.Target)
+	if err != nil {
+		return nil, fmt.Errorf("git diff: %s", strings.TrimSpace(string(stderr)))
+	}
+	plan.Files = gitLines(files)
+
+	// Not quiet: it trims the leading space of a porcelain status line.
+	cmd := exec.CommandContext(ctx, "git", "status", "--porcelain")
+	cmd.Dir = cfg.WorkDir()
+	cmd.Env = env
+	status, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git status: %w", err)
+	}
+	plan.Dirty = gitLines(strings.TrimRight(string(status), "\n"))
+	return plan, nil
+}
+
+// gitLines splits git output into lines, returning nil for no output.
+func gitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
+
+// FormatPlan renders a deploy plan for chat and the CLI.
+func FormatPlan(p *DeployPlan) string {
+	var b strings.Builder
+	if len(p.Commits) == 0 {
+		fmt.Fprintf(&b, "%s is up to date with %s (%s)\n", p.Service, p.Upstream, ShortSHA(p.Head))
+	} else {
+		s := "s"
+		if len(p.Commits) == 1 {
+			s = ""
+		}
+		fmt.Fprintf(&b, "%s: %d new commit%s on %s (%s..%s)\n", p.Service, len(p.Commits), s,
+			p.Upstream, ShortSHA(p.Head), ShortSHA(p.Target))
+		for i, c := range p.Commits {
+			if i == planCommitLimit {
+				fmt.Fprintf(&b, "  ... and %d more\n", len(p.Commits)-i)
+				break
+			}
+			fmt.Fprintf(&b, "  %s %s (%s)\n", ShortSHA(c.SHA), c.Subject, c.Author)
+		}
+	}
+	if len(p.Files) > 0 {
+		fmt.Fprintf(&b, "Files changed (%d):\n", len(p.Files))
+		for i, f := range p.Files {
+			if i == planFileLimit {
+				fmt.Fprintf(&b, "  ... and %d more\n", len(p.Files)-i)
+				break
+			}
+			fmt.Fprintf(&b, "  %s\n", strings.ReplaceAll(f, "\t", " "))
+		}
+	}
+	if len(p.Dirty) > 0 {
+		fmt.Fprintf(&b, "Working tree is dirty (%d):\n", len(p.Dirty))
+		for i, f := range p.Dirty {
+			if i == planFileLimit {
+				fmt.Fprintf(&b, "  ... and %d more\n", len(p.Dirty)-i)
+				break
+			}
+			fmt.Fprintf(&b, "  %s\n", f)
+		}
+	} else {
+		b.WriteString("Working tree is clean.\n")
+	}
+	return b.String()
+}
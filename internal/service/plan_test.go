@@ -0,0 +1,87 @@
+package service
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/shishberg/mezzaops/internal/config"
+)
+
+func TestManager_Plan(t *testing.T) {
+	origin, commit := gitRepo(t)
+	base := commit("one")
+
+	dir := filepath.Join(t.TempDir(), "clone")
+	if out, err := exec.Command("git", "clone", "-q", origin, dir).CombinedOutput(); err != nil {
+		t.Fatalf("clone: %v\n%s", err, out)
+	}
+	out, err := exec.Command("git", "-C", dir, "rev-parse", "--abbrev-ref", "HEAD").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	branch := strings.TrimSpace(string(out))
+
+	if err := os.WriteFile(filepath.Join(origin, "widgets.go"), []byte("package widgets\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := exec.Command("git", "-C", origin, "add", "widgets.go").CombinedOutput(); err != nil {
+		t.Fatalf("add: %v\n%s", err, out)
+	}
+	commit("Add widgets")
+	target := commit("Polish widgets")
+	if err := os.WriteFile(filepath.Join(dir, "scratch"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	svc := sleepService("testsvc", dir)
+	svc.Branch = branch
+	m, err := NewManager(testConfig(t), []config.ServiceConfig{svc}, NopNotifier{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Stop()
+
+	plan, err := m.Plan("testsvc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.Head != base || plan.Target != target || plan.Upstream != "origin/"+branch {
+		t.Fatalf("plan = %s %s..%s, want %s..%s", plan.Upstream, plan.Head, plan.Target, base, target)
+	}
+	if len(plan.Commits) != 2 || plan.Commits[0].Subject != "Polish widgets" || plan.Commits[1].Author != "t" {
+		t.Errorf("commits = %+v", plan.Commits)
+	}
+	if len(plan.Files) != 1 || plan.Files[0] != "A\twidgets.go" {
+		t.Errorf("files = %q", plan.Files)
+	}
+	if len(plan.Dirty) != 1 || plan.Dirty[0] != "?? scratch" {
+		t.Errorf("dirty = %q", plan.Dirty)
+	}
+	if head := gitHead(dir); head != base {
+		t.Errorf("plan moved HEAD to %s", head)
+	}
+
+	text := m.Do("testsvc", "plan")
+	for _, want := range []string{
+		"testsvc: 2 new commits on origin/" + branch,
+		ShortSHA(target) + " Polish widgets (t)",
+		"A widgets.go",
+		"Working tree is dirty (1):\n  ?? scratch",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("plan output missing %q:\n%s", want, text)
+		}
+	}
+}
+
+func TestFormatPlan_UpToDate(t *testing.T) {
+	sha := "1111111111111111111111111111111111111111"
+	got := FormatPlan(&DeployPlan{Service: "api", Upstream: "origin/main", Head: sha, Target: sha})
+	want := "api is up to date with origin/main (1111111)\nWorking tree is clean.\n"
+	if got != want {
+		t.Errorf("FormatPlan = %q, want %q", got, want)
+	}
+}
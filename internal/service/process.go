@@ -34,6 +34,10 @@ type ProcessBackend struct {
 	logDir     string
 	adopt      bool // whether to attempt process adoption
 
+	// environ, if set, returns the environment for each new process; a nil
+	// result inherits mezzaops's own.
+	environ func() ([]string, error)
+
 	mu      sync.Mutex
 	pid     int
 	pgid    int
@@ -77,6 +81,13 @@ func (p *ProcessBackend) Start(ctx context.Context) error {
 
 	cmd.Dir = p.dir
 	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if p.environ != nil {
+		env, err := p.environ()
+		if err != nil {
+			return fmt.Errorf("resolving env: %w", err)
+		}
+		cmd.Env = env
+	}
 
 	// Create log file with temp name (we don't know PID yet)
 	tmpPath := filepath.Join(p.logDir, p.name+".starting.log")
@@ -0,0 +1,122 @@
+package service
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shishberg/mezzaops/internal/deploy"
+)
+
+// progressTailLines and progressTailRunes bound the output sent with each
+// finished step in a progress report, so an edited chat message stays small.
+const (
+	progressTailLines = 5
+	progressTailRunes = 500
+)
+
+// stepProgress collects a deploy's step events and reports the steps so far
+// to the notifier after each one.
+type stepProgress struct {
+	notifier Notifier
+	name     string
+	steps    []deploy.StepResult
+}
+
+// update records a step starting (Status "running") or finishing, replacing
+// the running entry for the same step, and notifies.
+func (p *stepProgress) update(sr deploy.StepResult) {
+	sr.Output = outputTail(sr.Output)
+	if n := len(p.steps); n > 0 && p.steps[n-1].Status == "running" && p.steps[n-1].Step == sr.Step {
+		p.steps[n-1] = sr
+	} else {
+		p.steps = append(p.steps, sr)
+	}
+	p.notifier.DeployProgress(p.name, slices.Clone(p.steps))
+}
+
+// outputTail returns the last few lines of a step's output.
+func outputTail(s string) string {
+	lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
+	if len(lines) > progressTailLines {
+		lines = lines[len(lines)-progressTailLines:]
+	}
+	return TruncateTailToRuneBudget(strings.Join(lines, "\n"), progressTailRunes)
+}
+
+// FormatProgress renders a deploy's steps so far as Markdown, e.g.
+// "✅ git pull (2s) → ⏳ go build…", followed by the output tail of the most
+// recently finished step, if it printed anything.
+func FormatProgress(steps []deploy.StepResult) string {
+	parts := make([]string, len(steps))
+	tail := ""
+	for i, sr := range steps {
+		switch sr.Status {
+		case "running":
+			parts[i] = fmt.Sprintf("⏳ %s…", sr.Step)
+		case "skipped":
+			parts[i] = fmt.Sprintf("⏭️ %s", sr.Step)
+		case "success":
+			parts[i] = fmt.Sprintf("✅ %s (%s)", sr.Step, sr.Duration.Round(time.Second))
+			tail = sr.Output
+		default:
+			parts[i] = fmt.Sprintf("❌ %s (%s)", sr.Step, sr.Duration.Round(time.Second))
+			tail = sr.Output
+		}
+	}
+
+	out := strings.Join(parts, " → ")
+	if tail != "" {
+		out += "\n```\n" + tail + "\n```"
+	}
+	return out
+}
+
+// ProgressMessages remembers, per service, the chat message a running
+// deploy's progress is edited into and the text it was posted with. Frontend
+// notifiers record the message in DeployStarted, render edits in
+// DeployProgress and forget it when the deploy finishes. Safe for concurrent
+// use; the zero value is ready to use.
+type ProgressMessages struct {
+	mu       sync.Mutex
+	messages map[string]progressMessage
+}
+
+type progressMessage struct {
+	id, header string
+}
+
+// Start records that name's deploy posted header as message id. An empty id
+// (the post failed) is ignored.
+func (p *ProgressMessages) Start(name, id, header string) {
+	if id == "" {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.messages == nil {
+		p.messages = make(map[string]progressMessage)
+	}
+	p.messages[name] = progressMessage{id: id, header: header}
+}
+
+// Render returns the message to edit and its new text, or ok=false if no
+// message was recorded for name.
+func (p *ProgressMessages) Render(name string, steps []deploy.StepResult) (id, text string, ok bool) {
+	p.mu.Lock()
+	msg, ok := p.messages[name]
+	p.mu.Unlock()
+	if !ok {
+		return "", "", false
+	}
+	return msg.id, msg.header + "\n" + FormatProgress(steps), true
+}
+
+// Done forgets name's progress message.
+func (p *ProgressMessages) Done(name string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.messages, name)
+}
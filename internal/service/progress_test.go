@@ -0,0 +1,82 @@
+package service
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shishberg/mezzaops/internal/config"
+	"github.com/shishberg/mezzaops/internal/deploy"
+)
+
+func TestFormatProgress(t *testing.T) {
+	got := FormatProgress([]deploy.StepResult{
+		{Step: "git pull", Status: "success", Duration: 2100 * time.Millisecond, Output: "Already up to date."},
+		{Step: "migrate", Status: "skipped", Output: "branch is dev, want main"},
+		{Step: "go build", Status: "running"},
+	})
+	want := "✅ git pull (2s) → ⏭️ migrate → ⏳ go build…\n```\nAlready up to date.\n```"
+	if got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+
+	got = FormatProgress([]deploy.StepResult{{Step: "test", Status: "failed", Duration: time.Second}})
+	if got != "❌ test (1s)" {
+		t.Fatalf("got %q", got)
+	}
+}
+
+func TestOutputTail(t *testing.T) {
+	got := outputTail("1\n2\n3\n4\n5\n6\n7\n")
+	if got != "3\n4\n5\n6\n7" {
+		t.Fatalf("got %q", got)
+	}
+	if got := outputTail(strings.Repeat("x", 2000)); len([]rune(got)) > progressTailRunes {
+		t.Fatalf("tail is %d runes, want at most %d", len([]rune(got)), progressTailRunes)
+	}
+}
+
+func TestManager_DeployProgress(t *testing.T) {
+	cfg := testConfig(t)
+	rec := &recordingNotifier{}
+
+	svc := config.ServiceConfig{
+		Name:       "testsvc",
+		Dir:        t.TempDir(),
+		Entrypoint: []string{"sleep", "3600"},
+		Deploy:     config.Steps("echo one", "echo two"),
+	}
+
+	m, err := NewManager(cfg, []config.ServiceConfig{svc}, rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Stop()
+
+	if err := m.RequestDeploy("testsvc", DeployRequest{}); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.After(10 * time.Second)
+	for len(rec.getDeploySucceeded()) == 0 {
+		select {
+		case <-deadline:
+			t.Fatal("timed out waiting for deploy")
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+
+	var got []string
+	for _, steps := range rec.getDeployProgress() {
+		last := steps[len(steps)-1]
+		got = append(got, last.Step+" "+last.Status)
+	}
+	want := []string{"echo one running", "echo one success", "echo two running", "echo two success"}
+	if strings.Join(got, ", ") != strings.Join(want, ", ") {
+		t.Fatalf("progress = %q, want %q", got, want)
+	}
+	final := rec.getDeployProgress()[3]
+	if len(final) != 2 || final[0].Output != "one" {
+		t.Fatalf("final progress = %+v", final)
+	}
+}
@@ -0,0 +1,214 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// supersededLimit is how many superseded deploy requests the queue
+// remembers for the queue command.
+const supersededLimit = 20
+
+// QueuedDeploy is a deploy request in the deploy queue.
+type QueuedDeploy struct {
+	Service string `json:"service"`
+	DeployRequest
+
+	// Since is when the deploy was queued, started or superseded, depending
+	// on which list of the DeployQueue it is in.
+	Since time.Time `json:"since"`
+}
+
+// String describes the request, e.g. "deploy @v1.2 (chat by alice)".
+func (q QueuedDeploy) String() string {
+	s := "deploy"
+	switch {
+	case q.Rollback:
+		s = "rollback to " + ShortSHA(q.Ref)
+	case q.Ref != "" && q.Ref == q.Commit:
+		s += " @" + ShortSHA(q.Ref)
+	case q.Ref != "":
+		s += " @" + q.Ref
+	}
+	if q.Trigger != "" {
+		s += " (" + q.Trigger
+		if q.Actor != "" {
+			s += " by " + q.Actor
+		}
+		s += ")"
+	}
+	return s
+}
+
+// DeployQueue is a snapshot of the manager's deploys.
+type DeployQueue struct {
+	MaxConcurrent int            `json:"max_concurrent"` // 0: no limit
+	Running       []QueuedDeploy `json:"running"`
+	Queued        []QueuedDeploy `json:"queued"`     // oldest first, next to run first
+	Superseded    []QueuedDeploy `json:"superseded"` // newest first
+}
+
+// deployQueue runs at most max deploys at once, one per service, starting
+// queued deploys first come, first served. A service has at most one queued
+// deploy: a newer request takes its place in the queue and the older one is
+// superseded.
+type deployQueue struct {
+	mu         sync.Mutex
+	max        int
+	running    []QueuedDeploy
+	queued     []QueuedDeploy
+	superseded []QueuedDeploy
+}
+
+func (q *deployQueue) isRunning(name string) bool {
+	return slices.ContainsFunc(q.running, func(d QueuedDeploy) bool { return d.Service == name })
+}
+
+// enqueueDeploy queues a deploy of the named service and starts whatever
+// deploys now may run. A deploy of the service already waiting is replaced,
+// and reported as superseded.
+func (m *Manager) enqueueDeploy(name string, req DeployRequest) {
+	now := time.Now()
+	entry := QueuedDeploy{Service: name, DeployRequest: req, Since: now}
+
+	m.queue.mu.Lock()
+	i := slices.IndexFunc(m.queue.queued, func(d QueuedDeploy) bool { return d.Service == name })
+	var old QueuedDeploy
+	if i >= 0 {
+		old = m.queue.queued[i]
+		m.queue.queued[i] = entry
+		old.Since = now
+		m.queue.superseded = slices.Insert(m.queue.superseded, 0, old)
+		if len(m.queue.superseded) > supersededLimit {
+			m.queue.superseded = m.queue.superseded[:supersededLimit]
+		}
+	} else {
+		m.queue.queued = append(m.queue.queued, entry)
+	}
+	m.queue.mu.Unlock()
+
+	if i >= 0 {
+		log.Printf("**%s**: queued %s superseded by %s", name, old, entry)
+		m.notifyEvent(name, fmt.Sprintf("queued %s superseded by %s", old, entry))
+	}
+	m.dispatchDeploys()
+}
+
+// dispatchDeploys hands queued deploys to their service loops, oldest first,
+// while there are free slots. A service already deploying keeps its place in
+// the queue until that deploy finishes.
+func (m *Manager) dispatchDeploys() {
+	m.queue.mu.Lock()
+	var start []QueuedDeploy
+	for i := 0; i < len(m.queue.queued); {
+		if m.queue.max > 0 && len(m.queue.running) >= m.queue.max {
+			break
+		}
+		d := m.queue.queued[i]
+		if m.queue.isRunning(d.Service) {
+			i++
+			continue
+		}
+		m.queue.queued = slices.Delete(m.queue.queued, i, i+1)
+		d.Since = time.Now()
+		m.queue.running = append(m.queue.running, d)
+		start = append(start, d)
+	}
+	m.queue.mu.Unlock()
+
+	for _, d := range start {
+		m.mu.Lock()
+		ms, ok := m.services[d.Service]
+		m.mu.Unlock()
+		if !ok {
+			m.deployDone(d.Service)
+			continue
+		}
+
+		ms.stateMu.Lock()
+		ms.state.Status = "deploying"
+		ms.stateMu.Unlock()
+
+		// The loop takes one deploy at a time and this service has no other
+		// running, so the channel is empty.
+		select {
+		case ms.deployCh <- d.DeployRequest:
+		default:
+			log.Printf("**%s**: deploy channel full, dropping %s", d.Service, d)
+			m.deployDone(d.Service)
+		}
+	}
+}
+
+// deployDone frees the named service's deploy slot and starts the next
+// queued deploys.
+func (m *Manager) deployDone(name string) {
+	m.queue.mu.Lock()
+	if i := slices.IndexFunc(m.queue.running, func(d QueuedDeploy) bool { return d.Service == name }); i >= 0 {
+		m.queue.running = slices.Delete(m.queue.running, i, i+1)
+	}
+	m.queue.mu.Unlock()
+	m.dispatchDeploys()
+}
+
+// dequeueDeploy removes the named service's waiting deploy, reporting
+// whether there was one.
+func (m *Manager) dequeueDeploy(name string) (QueuedDeploy, bool) {
+	m.queue.mu.Lock()
+	defer m.queue.mu.Unlock()
+	i := slices.IndexFunc(m.queue.queued, func(d QueuedDeploy) bool { return d.Service == name })
+	if i < 0 {
+		return QueuedDeploy{}, false
+	}
+	d := m.queue.queued[i]
+	m.queue.queued = slices.Delete(m.queue.queued, i, i+1)
+	return d, true
+}
+
+// SetMaxConcurrent changes how many deploys may run at once; 0 means no
+// limit. Deploys already running are not affected.
+func (m *Manager) SetMaxConcurrent(n int) {
+	m.queue.mu.Lock()
+	m.queue.max = n
+	m.queue.mu.Unlock()
+	m.dispatchDeploys()
+}
+
+// DeployQueue returns the deploys running, waiting and recently superseded.
+func (m *Manager) DeployQueue() DeployQueue {
+	m.queue.mu.Lock()
+	defer m.queue.mu.Unlock()
+	return DeployQueue{
+		MaxConcurrent: m.queue.max,
+		Running:       slices.Clone(m.queue.running),
+		Queued:        slices.Clone(m.queue.queued),
+		Superseded:    slices.Clone(m.queue.superseded),
+	}
+}
+
+// FormatQueue renders the deploy queue for chat and the CLI.
+func FormatQueue(q DeployQueue) string {
+	var b strings.Builder
+	limit := "no limit"
+	if q.MaxConcurrent > 0 {
+		limit = fmt.Sprintf("max %d at once", q.MaxConcurrent)
+	}
+	fmt.Fprintf(&b, "%d running, %d queued (%s)\n", len(q.Running), len(q.Queued), limit)
+	section := func(title, verb string, deploys []QueuedDeploy) {
+		if len(deploys) == 0 {
+			return
+		}
+		fmt.Fprintf(&b, "%s:\n", title)
+		for i, d := range deploys {
+			fmt.Fprintf(&b, "  %d. %s: %s, %s %s\n", i+1, d.Service, d, verb, d.Since.Local().Format("15:04:05"))
+		}
+	}
+	section("Running", "since", q.Running)
+	section("Queued", "since", q.Queued)
+	section("Superseded", "at", q.Superseded)
+	return b.String()
+}
@@ -0,0 +1,187 @@
+package service
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shishberg/mezzaops/internal/config"
+)
+
+// waitForQueue polls the deploy queue until cond holds.
+func waitForQueue(t *testing.T, m *Manager, cond func(DeployQueue) bool) DeployQueue {
+	t.Helper()
+	deadline := time.After(10 * time.Second)
+	for {
+		q := m.DeployQueue()
+		if cond(q) {
+			return q
+		}
+		select {
+		case <-deadline:
+			t.Fatalf("timed out waiting for deploy queue, have %+v", q)
+		case <-time.After(20 * time.Millisecond):
+		}
+	}
+}
+
+func TestManager_DeployQueue(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.Deploy = &config.DeployConfig{MaxConcurrent: 1}
+	rec := &recordingNotifier{}
+
+	var services []config.ServiceConfig
+	for _, name := range []string{"a", "b"} {
+		svc := sleepService(name, t.TempDir())
+		svc.Deploy = config.Steps("sleep 0.5")
+		services = append(services, svc)
+	}
+
+	m, err := NewManager(cfg, services, rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Stop()
+
+	if err := m.RequestDeploy("a", DeployRequest{Trigger: TriggerChat, Actor: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.RequestDeploy("b", DeployRequest{Trigger: TriggerChat, Actor: "bob"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.RequestDeploy("b", DeployRequest{Trigger: TriggerWebhook}); err != nil {
+		t.Fatal(err)
+	}
+
+	q := m.DeployQueue()
+	if q.MaxConcurrent != 1 || len(q.Running) != 1 || q.Running[0].Service != "a" {
+		t.Fatalf("running = %+v, want only a", q.Running)
+	}
+	if len(q.Queued) != 1 || q.Queued[0].Service != "b" || q.Queued[0].Trigger != TriggerWebhook {
+		t.Fatalf("queued = %+v, want b's webhook deploy", q.Queued)
+	}
+	if len(q.Superseded) != 1 || q.Superseded[0].Actor != "bob" {
+		t.Fatalf("superseded = %+v, want bob's deploy of b", q.Superseded)
+	}
+	if st := m.GetAllStates()["b"]; st.Status != "queued" {
+		t.Errorf("b status = %q, want queued", st.Status)
+	}
+
+	var found bool
+	for _, ev := range rec.getServiceEvents() {
+		if ev.name == "b" && ev.a == "queued deploy (chat by bob) superseded by deploy (webhook)" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("no superseded event in %+v", rec.getServiceEvents())
+	}
+
+	// b only starts once a has finished.
+	waitForQueue(t, m, func(q DeployQueue) bool {
+		return len(q.Running) == 1 && q.Running[0].Service == "b"
+	})
+	if records, _ := m.GetDeployHistory("a"); len(records) != 1 {
+		t.Fatalf("b started with %d records for a, want a finished first", len(records))
+	}
+	r := waitForHistory(t, m, "b", 1)[0]
+	if r.Result != "success" {
+		t.Fatalf("b deploy = %+v", r)
+	}
+	waitForQueue(t, m, func(q DeployQueue) bool { return len(q.Running) == 0 })
+}
+
+func TestManager_CancelQueuedDeploy(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.Deploy = &config.DeployConfig{MaxConcurrent: 1}
+	rec := &recordingNotifier{}
+
+	a := sleepService("a", t.TempDir())
+	a.Deploy = config.Steps("sleep 30")
+	b := sleepService("b", t.TempDir())
+	b.Deploy = config.Steps("true")
+
+	m, err := NewManager(cfg, []config.ServiceConfig{a, b}, rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Stop()
+
+	if err := m.RequestDeploy("a", DeployRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.RequestDeploy("b", DeployRequest{Trigger: TriggerChat, Actor: "bob"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.CancelDeploy("b", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if q := m.DeployQueue(); len(q.Queued) != 0 {
+		t.Fatalf("queued = %+v after cancel", q.Queued)
+	}
+	if st := m.GetAllStates()["b"]; st.Status == "queued" {
+		t.Error("b still shows as queued after cancel")
+	}
+	var found bool
+	for _, ev := range rec.getServiceEvents() {
+		if ev.name == "b" && ev.a == "queued deploy (chat by bob) cancelled by alice" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("no cancel event in %+v", rec.getServiceEvents())
+	}
+	if err := m.CancelDeploy("b", "alice"); err == nil {
+		t.Error("expected error cancelling with nothing queued")
+	}
+
+	// a can only be cancelled once its deploy has started.
+	deadline := time.After(10 * time.Second)
+	for len(rec.getDeployStarted()) == 0 {
+		select {
+		case <-deadline:
+			t.Fatal("timed out waiting for a's deploy to start")
+		case <-time.After(20 * time.Millisecond):
+		}
+	}
+	if err := m.CancelDeploy("a", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	waitForHistory(t, m, "a", 1)
+	if records, _ := m.GetDeployHistory("b"); len(records) != 0 {
+		t.Errorf("cancelled queued deploy ran: %+v", records)
+	}
+}
+
+func TestFormatQueue(t *testing.T) {
+	at := time.Date(2026, 10, 19, 9, 30, 0, 0, time.Local)
+	q := DeployQueue{
+		MaxConcurrent: 2,
+		Running: []QueuedDeploy{
+			{Service: "api", DeployRequest: DeployRequest{Trigger: TriggerChat, Actor: "alice"}, Since: at},
+		},
+		Queued: []QueuedDeploy{
+			{Service: "web", DeployRequest: DeployRequest{Trigger: TriggerWebhook, Ref: "v2"}, Since: at},
+		},
+		Superseded: []QueuedDeploy{
+			{Service: "web", DeployRequest: DeployRequest{Trigger: TriggerChat, Ref: "abcdef1234567", Rollback: true}, Since: at},
+		},
+	}
+
+	want := `1 running, 1 queued (max 2 at once)
+Running:
+  1. api: deploy (chat by alice), since 09:30:00
+Queued:
+  1. web: deploy @v2 (webhook), since 09:30:00
+Superseded:
+  1. web: rollback to abcdef1 (chat), at 09:30:00
+`
+	if got := FormatQueue(q); got != want {
+		t.Errorf("FormatQueue =\n%s\nwant\n%s", got, want)
+	}
+
+	if got := FormatQueue(DeployQueue{}); !strings.HasPrefix(got, "0 running, 0 queued (no limit)") {
+		t.Errorf("FormatQueue(empty) = %q", got)
+	}
+}
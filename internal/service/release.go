@@ -0,0 +1,187 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/shishberg/mezzaops/internal/config"
+	"github.com/shishberg/mezzaops/internal/deploy"
+)
+
+// prepareRelease is the built-in first phase of a release-mode deploy. It
+// fetches from origin (if fetch is set), resolves ref and adds a detached
+// git worktree of that commit at releases/<timestamp-sha> under the service
+// dir, for the deploy steps to build in. It returns the release's name.
+func prepareRelease(ctx context.Context, cfg config.ServiceConfig, ref string, fetch bool, env []string, now time.Time) (name string, sr deploy.StepResult) {
+	sr = deploy.StepResult{Step: "release " + ref, Status: "failed"}
+	start := time.Now()
+	g := &gitCmds{ctx: ctx, dir: cfg.Dir, env: env}
+	defer func() {
+		sr.Output = g.out.String()
+		sr.Duration = time.Since(start)
+	}()
+
+	if err := excludeReleases(g); err != nil {
+		fmt.Fprintf(&g.out, "ERROR: %s\n", err)
+		return "", sr
+	}
+	if fetch && !g.fetch() {
+		return "", sr
+	}
+	sha := g.resolve(ref)
+	if sha == "" {
+		return "", sr
+	}
+	name = now.UTC().Format("20060102-150405.000") + "-" + ShortSHA(sha)
+	if !g.run("worktree", "add", "--quiet", "--detach", filepath.Join(config.ReleasesDir, name), sha) {
+		return "", sr
+	}
+	sr.Status = "success"
+	return name, sr
+}
+
+// excludeReleases adds the releases directory and current symlink to the
+// repo's info/exclude, so they don't show up as untracked files in dir.
+func excludeReleases(g *gitCmds) error {
+	path, stderr, err := g.quiet("rev-parse", "--git-path", "info/exclude")
+	if err != nil {
+		return fmt.Errorf("%s is not a git repository: %s", g.dir, strings.TrimSpace(string(stderr)))
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(g.dir, path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	lines := strings.Split(string(data), "\n")
+	var add string
+	for _, pattern := range []string{"/" + config.ReleasesDir + "/", "/" + config.CurrentLink} {
+		if !slices.Contains(lines, pattern) {
+			add += pattern + "\n"
+		}
+	}
+	if add == "" {
+		return nil
+	}
+	if len(data) > 0 && !strings.HasSuffix(string(data), "\n") {
+		add = "\n" + add
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = f.WriteString(add)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// activateRelease makes the named release live by pointing the current
+// symlink at it. The new link is renamed over the old one, so current always
+// points at a complete release.
+func activateRelease(cfg config.ServiceConfig, name string) (sr deploy.StepResult) {
+	sr = deploy.StepResult{Step: "activate " + name, Status: "failed"}
+	start := time.Now()
+	defer func() { sr.Duration = time.Since(start) }()
+
+	link := filepath.Join(cfg.Dir, config.CurrentLink)
+	if fi, err := os.Lstat(link); err == nil && fi.Mode()&os.ModeSymlink == 0 {
+		sr.Output = fmt.Sprintf("ERROR: %s exists and is not a symlink\n", link)
+		return sr
+	}
+	tmp := link + ".tmp"
+	_ = os.Remove(tmp)
+	if err := os.Symlink(filepath.Join(config.ReleasesDir, name), tmp); err != nil {
+		sr.Output = fmt.Sprintf("ERROR: %s\n", err)
+		return sr
+	}
+	if err := os.Rename(tmp, link); err != nil {
+		_ = os.Remove(tmp)
+		sr.Output = fmt.Sprintf("ERROR: %s\n", err)
+		return sr
+	}
+	sr.Output = fmt.Sprintf("%s -> %s\n", config.CurrentLink, name)
+	sr.Status = "success"
+	return sr
+}
+
+// currentRelease returns the name of the live release, or "" if there is
+// none.
+func currentRelease(cfg config.ServiceConfig) string {
+	target, err := os.Readlink(filepath.Join(cfg.Dir, config.CurrentLink))
+	if err != nil {
+		return ""
+	}
+	return filepath.Base(target)
+}
+
+// listReleases returns the names of the service's releases, oldest first.
+// Names start with a timestamp, so name order is age order.
+func listReleases(cfg config.ServiceConfig) []string {
+	entries, err := os.ReadDir(filepath.Join(cfg.Dir, config.ReleasesDir))
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, e := range entries {
+		if e.IsDir() {
+			names = append(names, e.Name())
+		}
+	}
+	return names
+}
+
+// findRelease returns the newest release built from sha, or "" if none
+// is left.
+func findRelease(cfg config.ServiceConfig, sha string) string {
+	names := listReleases(cfg)
+	for _, name := range slices.Backward(names) {
+		if !strings.HasSuffix(name, "-"+ShortSHA(sha)) {
+			continue
+		}
+		if gitHead(filepath.Join(cfg.Dir, config.ReleasesDir, name)) == sha {
+			return name
+		}
+	}
+	return ""
+}
+
+// removeRelease deletes a release's worktree.
+func removeRelease(cfg config.ServiceConfig, name string) {
+	g := &gitCmds{ctx: context.Background(), dir: cfg.Dir}
+	path := filepath.Join(config.ReleasesDir, name)
+	if _, stderr, err := g.quiet("worktree", "remove", "--force", path); err != nil {
+		log.Printf("**%s**: removing release %s: %s", cfg.Name, name, strings.TrimSpace(string(stderr)))
+		_ = os.RemoveAll(filepath.Join(cfg.Dir, path))
+		_, _, _ = g.quiet("worktree", "prune")
+	}
+}
+
+// pruneReleases removes the oldest releases beyond releases.keep, never the
+// live one.
+func pruneReleases(cfg config.ServiceConfig) {
+	names := listReleases(cfg)
+	current := currentRelease(cfg)
+	excess := len(names) - cfg.Releases.KeepReleases()
+	for _, name := range names {
+		if excess <= 0 {
+			break
+		}
+		if name == current {
+			continue
+		}
+		removeRelease(cfg, name)
+		excess--
+	}
+}
@@ -0,0 +1,134 @@
+package service
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/shishberg/mezzaops/internal/config"
+)
+
+// releaseService returns a release-mode service in the git repo at dir whose
+// deploy writes an artifact recording the commit it built, and fails when
+// building a commit whose message is "bad".
+func releaseService(dir string, keep int) config.ServiceConfig {
+	svc := sleepService("testsvc", dir)
+	svc.Deploy = config.Steps(
+		`test "$(git log -1 --format=%s)" != bad`,
+		"git rev-parse HEAD > artifact",
+	)
+	svc.Releases = &config.ReleasesConfig{Keep: keep}
+	return svc
+}
+
+func TestManager_ReleaseMode(t *testing.T) {
+	dir, commit := gitRepo(t)
+	first := commit("one")
+
+	svc := releaseService(dir, 5)
+	m, err := NewManager(testConfig(t), []config.ServiceConfig{svc}, NopNotifier{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Stop()
+
+	deployAndWait := func(n int) DeployRecord {
+		t.Helper()
+		if err := m.RequestDeploy("testsvc", DeployRequest{}); err != nil {
+			t.Fatal(err)
+		}
+		return waitForHistory(t, m, "testsvc", n)[0]
+	}
+
+	r := deployAndWait(1)
+	if r.Result != "success" || r.SHAAfter != first || r.Release == "" {
+		t.Fatalf("first deploy = %+v", r)
+	}
+	firstRelease := r.Release
+	artifact, err := os.ReadFile(filepath.Join(dir, "current", "artifact"))
+	if err != nil || strings.TrimSpace(string(artifact)) != first {
+		t.Fatalf("current/artifact = %q, %v; want %s", artifact, err, first)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "artifact")); err == nil {
+		t.Error("deploy steps ran in dir, want the release dir")
+	}
+	if out, _ := exec.Command("git", "-C", dir, "status", "--porcelain").Output(); len(out) != 0 {
+		t.Errorf("dir has untracked files:\n%s", out)
+	}
+
+	second := commit("two")
+	r = deployAndWait(2)
+	if r.SHABefore != first || r.SHAAfter != second {
+		t.Fatalf("second deploy SHAs = %s..%s, want %s..%s", r.SHABefore, r.SHAAfter, first, second)
+	}
+	secondRelease := r.Release
+	if state, _ := m.GetServiceState("testsvc"); state.Release != secondRelease {
+		t.Errorf("state release = %q, want %q", state.Release, secondRelease)
+	}
+
+	// A failed build leaves the live release alone and is cleaned up.
+	commit("bad")
+	r = deployAndWait(3)
+	if r.Result != "failed" || r.SHAAfter != second {
+		t.Fatalf("bad deploy = %+v, want failure leaving %s live", r, second)
+	}
+	if got := currentRelease(svc); got != secondRelease {
+		t.Errorf("current = %q after failed build, want %q", got, secondRelease)
+	}
+	if got := listReleases(svc); !slices.Equal(got, []string{firstRelease, secondRelease}) {
+		t.Errorf("releases = %v, want the failed one removed", got)
+	}
+
+	// Rolling back to a kept release just flips the symlink.
+	if _, err := m.RequestRollback("testsvc", "", DeployRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	r = waitForHistory(t, m, "testsvc", 4)[0]
+	if !r.Rollback || r.Result != "success" || r.Release != firstRelease || r.SHAAfter != first {
+		t.Fatalf("rollback = %+v, want %s live again", r, firstRelease)
+	}
+	if len(r.Steps) != 1 || !strings.HasPrefix(r.Steps[0].Step, "activate ") {
+		t.Errorf("rollback steps = %+v, want only the activation", r.Steps)
+	}
+}
+
+func TestPruneReleases(t *testing.T) {
+	dir := t.TempDir()
+	svc := config.ServiceConfig{Name: "testsvc", Dir: dir, Releases: &config.ReleasesConfig{Keep: 2}}
+	names := []string{
+		"20261019-090000.000-aaaaaaa",
+		"20261019-100000.000-bbbbbbb",
+		"20261019-110000.000-ccccccc",
+		"20261019-120000.000-ddddddd",
+	}
+	for _, name := range names {
+		if err := os.MkdirAll(filepath.Join(dir, "releases", name), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if sr := activateRelease(svc, names[0]); sr.Status != "success" {
+		t.Fatalf("activate: %s", sr.Output)
+	}
+
+	pruneReleases(svc)
+
+	want := []string{names[0], names[3]}
+	if got := listReleases(svc); !slices.Equal(got, want) {
+		t.Errorf("releases after prune = %v, want %v (the live one and the newest)", got, want)
+	}
+}
+
+func TestActivateRelease_NotASymlink(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "current"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	svc := config.ServiceConfig{Name: "testsvc", Dir: dir, Releases: &config.ReleasesConfig{}}
+	sr := activateRelease(svc, "20261019-090000.000-aaaaaaa")
+	if sr.Status != "failed" || !strings.Contains(sr.Output, "not a symlink") {
+		t.Errorf("activate = %+v, want failure", sr)
+	}
+}
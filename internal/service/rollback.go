@@ -0,0 +1,95 @@
+package service
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// RequestRollback queues a rollback of the named service and returns the
+// commit it will roll back to. target is a commit (anything git rev-parse
+// accepts), a small number N for the Nth previous good revision, or empty for
+// the last one. A rollback checks out the commit, re-runs the deploy steps
+// and restarts, and is recorded in history as a rollback. In release mode, if
+// a release of the commit is still kept, it just makes that release live.
+func (m *Manager) RequestRollback(name, target string, req DeployRequest) (string, error) {
+	m.mu.Lock()
+	ms, ok := m.services[name]
+	m.mu.Unlock()
+
+	if !ok {
+		return "", fmt.Errorf("service %q not found", name)
+	}
+
+	sha, err := m.rollbackTarget(ms.config.Name, ms.config.Dir, ms.config.WorkDir(), target)
+	if err != nil {
+		return "", err
+	}
+	req.Ref = sha
+	req.Rollback = true
+	if err := m.RequestDeploy(name, req); err != nil {
+		return "", err
+	}
+	return sha, nil
+}
+
+// rollbackTarget resolves a rollback target to a full commit SHA in the repo
+// at dir; previous revisions are counted back from the one live in workDir.
+// Numbers of up to three digits count back through previous good revisions;
+// anything longer is a commit, since git abbreviates to at least four.
+func (m *Manager) rollbackTarget(name, dir, workDir, target string) (string, error) {
+	n := 1
+	if target != "" {
+		v, err := strconv.Atoi(target)
+		if err != nil || len(target) > 3 {
+			return resolveCommit(dir, target)
+		}
+		if v < 1 {
+			return "", fmt.Errorf("rollback: N must be at least 1")
+		}
+		n = v
+	}
+
+	good := m.goodRevisions(name, gitHead(workDir))
+	if len(good) == 0 {
+		return "", fmt.Errorf("no earlier successful deploy of %s to roll back to", name)
+	}
+	if n > len(good) {
+		return "", fmt.Errorf("only %d earlier good revision(s) of %s in history", len(good), name)
+	}
+	return good[n-1], nil
+}
+
+// goodRevisions returns the distinct commits left checked out by successful
+// deploys, newest first, excluding current.
+func (m *Manager) goodRevisions(name, current string) []string {
+	if m.stateDir == "" {
+		return nil
+	}
+	records, err := LoadHistory(m.stateDir, name)
+	if err != nil {
+		return nil
+	}
+	seen := map[string]bool{current: true}
+	var revs []string
+	for _, r := range records {
+		if r.Result != "success" || r.SHAAfter == "" || seen[r.SHAAfter] {
+			continue
+		}
+		seen[r.SHAAfter] = true
+		revs = append(revs, r.SHAAfter)
+	}
+	return revs
+}
+
+// resolveCommit expands rev to a full commit SHA in the repo at dir.
+func resolveCommit(dir, rev string) (string, error) {
+	cmd := exec.Command("git", "rev-parse", "--verify", "--quiet", rev+"^{commit}")
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("unknown revision %q", rev)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
@@ -0,0 +1,133 @@
+package service
+
+import (
+	"os/exec"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shishberg/mezzaops/internal/config"
+)
+
+// gitRepo initialises a git repository in a temp dir and returns the dir and
+// a function that makes an empty commit and returns its SHA.
+func gitRepo(t *testing.T) (string, func(msg string) string) {
+	t.Helper()
+	dir := t.TempDir()
+	run := func(args ...string) string {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-c", "user.name=t", "-c", "user.email=t@example.com"}, args...)...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	run("init", "-q")
+	return dir, func(msg string) string {
+		run("commit", "-q", "--allow-empty", "-m", msg)
+		return run("rev-parse", "HEAD")
+	}
+}
+
+// waitForHistory polls until the service has n deploy records.
+func waitForHistory(t *testing.T, m *Manager, name string, n int) []DeployRecord {
+	t.Helper()
+	deadline := time.After(10 * time.Second)
+	for {
+		records, _ := m.GetDeployHistory(name)
+		if len(records) >= n {
+			return records
+		}
+		select {
+		case <-deadline:
+			t.Fatalf("timed out waiting for %d deploy records, have %d", n, len(records))
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+}
+
+func TestManager_Rollback(t *testing.T) {
+	dir, commit := gitRepo(t)
+	first := commit("one")
+
+	svc := config.ServiceConfig{
+		Name:       "testsvc",
+		Dir:        dir,
+		Entrypoint: []string{"sleep", "3600"},
+		Deploy:     config.Steps("git rev-parse HEAD"),
+	}
+	rec := &recordingNotifier{}
+	m, err := NewManager(testConfig(t), []config.ServiceConfig{svc}, rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Stop()
+
+	if _, err := m.RequestRollback("testsvc", "", DeployRequest{}); err == nil {
+		t.Fatal("expected an error with no deploy history")
+	}
+
+	if err := m.RequestDeploy("testsvc", DeployRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	waitForHistory(t, m, "testsvc", 1)
+	second := commit("two")
+	if err := m.RequestDeploy("testsvc", DeployRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	waitForHistory(t, m, "testsvc", 2)
+
+	if _, err := m.RequestRollback("testsvc", "2", DeployRequest{}); err == nil {
+		t.Fatal("expected an error for N past the history")
+	}
+
+	sha, err := m.RequestRollback("testsvc", "", DeployRequest{Trigger: TriggerCLI, Actor: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sha != first {
+		t.Fatalf("rollback target: got %s, want %s", sha, first)
+	}
+
+	records := waitForHistory(t, m, "testsvc", 3)
+	r := records[0]
+	if !r.Rollback || r.Result != "success" {
+		t.Fatalf("rollback record: rollback=%v result=%q", r.Rollback, r.Result)
+	}
+	if r.SHABefore != second || r.SHAAfter != first {
+		t.Fatalf("rollback SHAs: before=%s after=%s, want %s..%s", r.SHABefore, r.SHAAfter, second, first)
+	}
+	if r.Actor != "alice" {
+		t.Fatalf("actor: got %q", r.Actor)
+	}
+	if !strings.Contains(r.Output, first) {
+		t.Fatalf("deploy steps should run at the rolled-back commit, output:\n%s", r.Output)
+	}
+
+	got := rec.getRollbackEvents()
+	want := []notifierCall{
+		{name: "testsvc", a: "started", b: first},
+		{name: "testsvc", a: "succeeded", b: first},
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("rollback notifications: got %+v, want %+v", got, want)
+	}
+	if n := len(rec.getDeployStarted()); n != 2 {
+		t.Fatalf("rollback should not notify as a deploy: %d DeployStarted calls", n)
+	}
+
+	// A SHA names the commit directly.
+	sha, err = m.RequestRollback("testsvc", second[:10], DeployRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sha != second {
+		t.Fatalf("explicit target: got %s, want %s", sha, second)
+	}
+	if _, err := m.RequestRollback("testsvc", "nosuchrev", DeployRequest{}); err == nil {
+		t.Fatal("expected an error for an unknown revision")
+	}
+}
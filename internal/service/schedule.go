@@ -0,0 +1,286 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// scheduleIdle is how long the schedule watcher sleeps with nothing
+// scheduled; ScheduleDeploy wakes it sooner.
+const scheduleIdle = time.Hour
+
+// ScheduledDeploy is a deploy requested to start at a later time. Since is
+// when it was scheduled.
+type ScheduledDeploy struct {
+	ID string    `json:"id"`
+	At time.Time `json:"at"`
+	QueuedDeploy
+}
+
+// String describes the scheduled deploy, e.g. "#3 api: deploy (chat by
+// alice) at 2026-10-20 02:00 UTC".
+func (s ScheduledDeploy) String() string {
+	return fmt.Sprintf("#%s %s: %s at %s", s.ID, s.Service, s.QueuedDeploy, s.When())
+}
+
+// When formats the time the deploy is scheduled for.
+func (s ScheduledDeploy) When() string {
+	return s.At.Format("2006-01-02 15:04 MST")
+}
+
+// schedulePath returns the file a scheduled deploy is persisted in.
+// Scheduled deploys live in a subdirectory so cleanOrphans doesn't mistake
+// them for state files.
+func schedulePath(dir, id string) string {
+	return filepath.Join(dir, "scheduled", id+".json")
+}
+
+// SaveScheduled persists a scheduled deploy.
+func SaveScheduled(dir string, s ScheduledDeploy) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	path := schedulePath(dir, s.ID)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// LoadScheduled reads every persisted scheduled deploy, keyed by ID.
+func LoadScheduled(dir string) (map[string]ScheduledDeploy, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "scheduled", "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	scheduled := make(map[string]ScheduledDeploy, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var s ScheduledDeploy
+		if err := json.Unmarshal(data, &s); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		scheduled[s.ID] = s
+	}
+	return scheduled, nil
+}
+
+// RemoveScheduled deletes a persisted scheduled deploy.
+func RemoveScheduled(dir, id string) {
+	if err := os.Remove(schedulePath(dir, id)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Printf("removing scheduled deploy #%s: %v", id, err)
+	}
+}
+
+// ParseSchedule finds "at <time>" or "in <duration>" among the arguments of
+// a deploy command and returns when to deploy, or the zero time for now,
+// and the remaining arguments. Times are "15:04", the next time the clock
+// reads that, or "2006-01-02 15:04", both in now's location. Durations are
+// as for freezes, e.g. "30m" or "2d".
+func ParseSchedule(args []string, now time.Time) (time.Time, []string, error) {
+	for i, arg := range args {
+		word := strings.ToLower(arg)
+		if word != "at" && word != "in" {
+			continue
+		}
+		if i+1 == len(args) {
+			return time.Time{}, nil, fmt.Errorf("nothing after %q", word)
+		}
+		rest := slices.Delete(slices.Clone(args), i, i+2)
+		if word == "in" {
+			d, ok := ParseFreezeDuration(args[i+1])
+			if !ok {
+				return time.Time{}, nil, fmt.Errorf("invalid duration %q", args[i+1])
+			}
+			return now.Add(d), rest, nil
+		}
+		if i+2 < len(args) {
+			if t, err := time.ParseInLocation("2006-01-02 15:04", args[i+1]+" "+args[i+2], now.Location()); err == nil {
+				return t, slices.Delete(rest, i, i+1), nil
+			}
+		}
+		t, err := parseScheduleTime(args[i+1], now)
+		return t, rest, err
+	}
+	return time.Time{}, args, nil
+}
+
+// parseScheduleTime parses a one-word time for ParseSchedule.
+func parseScheduleTime(s string, now time.Time) (time.Time, error) {
+	if t, err := time.ParseInLocation("15:04", s, now.Location()); err == nil {
+		at := time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), 0, 0, now.Location())
+		if !at.After(now) {
+			at = at.AddDate(0, 0, 1)
+		}
+		return at, nil
+	}
+	for _, layout := range []string{"2006-01-02T15:04", time.RFC3339} {
+		if t, err := time.ParseInLocation(layout, s, now.Location()); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q: use 15:04 or 2006-01-02 15:04", s)
+}
+
+// ScheduleDeploy arranges for req to be requested of the named service at
+// at, even across restarts. When it comes due, the deploy goes through
+// RequestDeploy with TriggerSchedule; like any manual deploy, it isn't held
+// by freezes or deploy windows.
+func (m *Manager) ScheduleDeploy(name string, at time.Time, req DeployRequest) (ScheduledDeploy, error) {
+	now := time.Now()
+	if !at.After(now) {
+		return ScheduledDeploy{}, fmt.Errorf("%s is in the past", at.Format("2006-01-02 15:04 MST"))
+	}
+
+	m.mu.Lock()
+	if _, ok := m.services[name]; !ok {
+		m.mu.Unlock()
+		return ScheduledDeploy{}, fmt.Errorf("service %q not found", name)
+	}
+	m.lastScheduleID++
+	s := ScheduledDeploy{
+		ID:           strconv.Itoa(m.lastScheduleID),
+		At:           at,
+		QueuedDeploy: QueuedDeploy{Service: name, DeployRequest: req, Since: now},
+	}
+	m.scheduled[s.ID] = s
+	m.mu.Unlock()
+
+	if m.stateDir != "" {
+		if err := SaveScheduled(m.stateDir, s); err != nil {
+			log.Printf("saving scheduled deploy #%s: %v", s.ID, err)
+		}
+	}
+	log.Printf("**%s**: scheduled %s", name, s)
+	m.wakeSchedule()
+	return s, nil
+}
+
+// ScheduledDeploys returns the deploys waiting to start, soonest first.
+func (m *Manager) ScheduledDeploys() []ScheduledDeploy {
+	m.mu.Lock()
+	scheduled := make([]ScheduledDeploy, 0, len(m.scheduled))
+	for _, s := range m.scheduled {
+		scheduled = append(scheduled, s)
+	}
+	m.mu.Unlock()
+	slices.SortFunc(scheduled, func(a, b ScheduledDeploy) int {
+		return a.At.Compare(b.At)
+	})
+	return scheduled
+}
+
+// Unschedule cancels a scheduled deploy by ID ("3" or "#3").
+func (m *Manager) Unschedule(id, actor string) (ScheduledDeploy, error) {
+	id = strings.TrimPrefix(id, "#")
+	m.mu.Lock()
+	s, ok := m.scheduled[id]
+	delete(m.scheduled, id)
+	m.mu.Unlock()
+	if !ok {
+		return ScheduledDeploy{}, fmt.Errorf("no scheduled deploy #%s", id)
+	}
+
+	if m.stateDir != "" {
+		RemoveScheduled(m.stateDir, id)
+	}
+	log.Printf("**%s**: unscheduled %s by %s", s.Service, s, actor)
+	return s, nil
+}
+
+// FormatSchedule renders scheduled deploys for chat and the CLI.
+func FormatSchedule(scheduled []ScheduledDeploy) string {
+	if len(scheduled) == 0 {
+		return "no deploys scheduled\n"
+	}
+	var b strings.Builder
+	for _, s := range scheduled {
+		fmt.Fprintf(&b, "%s\n", s)
+	}
+	return b.String()
+}
+
+// wakeSchedule makes the schedule watcher recheck when to wake next.
+func (m *Manager) wakeSchedule() {
+	select {
+	case m.scheduleWake <- struct{}{}:
+	default:
+	}
+}
+
+// watchSchedule requests scheduled deploys as they come due. Any that came
+// due while mezzaops was down are requested once the frontends are ready,
+// so their notifications are delivered.
+func (m *Manager) watchSchedule() {
+	defer m.wg.Done()
+	select {
+	case <-m.readyCh:
+	case <-m.ctx.Done():
+		return
+	}
+	timer := time.NewTimer(m.runDueDeploys(time.Now()))
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+		case <-m.scheduleWake:
+		case <-m.ctx.Done():
+			return
+		}
+		timer.Reset(m.runDueDeploys(time.Now()))
+	}
+}
+
+// runDueDeploys requests every scheduled deploy due by now and returns how
+// long until the next one is.
+func (m *Manager) runDueDeploys(now time.Time) time.Duration {
+	var due []ScheduledDeploy
+	next := scheduleIdle
+	m.mu.Lock()
+	for id, s := range m.scheduled {
+		if wait := s.At.Sub(now); wait > 0 {
+			if wait < next {
+				next = wait
+			}
+			continue
+		}
+		due = append(due, s)
+		delete(m.scheduled, id)
+	}
+	m.mu.Unlock()
+
+	slices.SortFunc(due, func(a, b ScheduledDeploy) int {
+		return a.At.Compare(b.At)
+	})
+	for _, s := range due {
+		if m.stateDir != "" {
+			RemoveScheduled(m.stateDir, s.ID)
+		}
+		req := s.DeployRequest
+		req.Trigger = TriggerSchedule
+		if err := m.RequestDeploy(s.Service, req); err != nil {
+			log.Printf("**%s**: scheduled deploy #%s: %v", s.Service, s.ID, err)
+			m.notifyEvent(s.Service, fmt.Sprintf("scheduled deploy #%s skipped: %v", s.ID, err))
+			continue
+		}
+		log.Printf("**%s**: starting scheduled deploy #%s", s.Service, s.ID)
+	}
+	return next
+}
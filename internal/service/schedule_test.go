@@ -0,0 +1,153 @@
+package service
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shishberg/mezzaops/internal/config"
+)
+
+func TestParseSchedule(t *testing.T) {
+	now := time.Date(2026, 4, 6, 14, 30, 0, 0, time.UTC)
+	tests := []struct {
+		args []string
+		want time.Time
+		rest []string
+	}{
+		{nil, time.Time{}, nil},
+		{[]string{"--force"}, time.Time{}, []string{"--force"}},
+		{[]string{"in", "90m"}, now.Add(90 * time.Minute), []string{}},
+		{[]string{"--force", "in", "2d"}, now.Add(48 * time.Hour), []string{"--force"}},
+		{[]string{"at", "16:00"}, time.Date(2026, 4, 6, 16, 0, 0, 0, time.UTC), []string{}},
+		{[]string{"at", "02:00", "--force"}, time.Date(2026, 4, 7, 2, 0, 0, 0, time.UTC), []string{"--force"}},
+		{[]string{"AT", "2026-05-01", "09:15"}, time.Date(2026, 5, 1, 9, 15, 0, 0, time.UTC), []string{}},
+		{[]string{"at", "2026-05-01T09:15"}, time.Date(2026, 5, 1, 9, 15, 0, 0, time.UTC), []string{}},
+	}
+	for _, tt := range tests {
+		got, rest, err := ParseSchedule(tt.args, now)
+		if err != nil {
+			t.Errorf("ParseSchedule(%q) error: %v", tt.args, err)
+			continue
+		}
+		if !got.Equal(tt.want) || strings.Join(rest, " ") != strings.Join(tt.rest, " ") {
+			t.Errorf("ParseSchedule(%q) = %v, %q; want %v, %q", tt.args, got, rest, tt.want, tt.rest)
+		}
+	}
+
+	for _, args := range [][]string{{"at"}, {"at", "noon"}, {"in", "soon"}} {
+		if _, _, err := ParseSchedule(args, now); err == nil {
+			t.Errorf("ParseSchedule(%q): expected error", args)
+		}
+	}
+}
+
+func TestManager_ScheduleDeploy(t *testing.T) {
+	cfg := testConfig(t)
+	svc := sleepService("testsvc", t.TempDir())
+	svc.Deploy = config.Steps("true")
+
+	m, err := NewManager(cfg, []config.ServiceConfig{svc}, NopNotifier{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := m.ScheduleDeploy("testsvc", time.Now().Add(-time.Minute), DeployRequest{}); err == nil {
+		t.Error("expected error scheduling a deploy in the past")
+	}
+	if _, err := m.ScheduleDeploy("nope", time.Now().Add(time.Hour), DeployRequest{}); err == nil {
+		t.Error("expected error scheduling a deploy of an unknown service")
+	}
+
+	req := DeployRequest{Trigger: TriggerChat, Actor: "alice"}
+	later, err := m.ScheduleDeploy("testsvc", time.Now().Add(2*time.Hour), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sooner, err := m.ScheduleDeploy("testsvc", time.Now().Add(time.Hour), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if later.ID != "1" || sooner.ID != "2" {
+		t.Errorf("IDs = %s, %s; want 1, 2", later.ID, sooner.ID)
+	}
+	m.Stop()
+
+	// The schedule survives a restart, and IDs carry on from it.
+	m, err = NewManager(cfg, []config.ServiceConfig{svc}, NopNotifier{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Stop()
+
+	got := m.ScheduledDeploys()
+	if len(got) != 2 || got[0].ID != "2" || got[1].ID != "1" || got[1].Actor != "alice" {
+		t.Fatalf("scheduled after restart = %+v, want #2 then #1", got)
+	}
+	if out := FormatSchedule(got); !strings.HasPrefix(out, "#2 testsvc: deploy (chat by alice) at ") {
+		t.Errorf("FormatSchedule = %q", out)
+	}
+	next, err := m.ScheduleDeploy("testsvc", time.Now().Add(3*time.Hour), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.ID != "3" {
+		t.Errorf("ID after restart = %s, want 3", next.ID)
+	}
+
+	if _, err := m.Unschedule("#1", "bob"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Unschedule("1", "bob"); err == nil {
+		t.Error("expected error unscheduling #1 twice")
+	}
+	if scheduled, _ := LoadScheduled(cfg.StateDir); len(scheduled) != 2 || scheduled["1"].ID != "" {
+		t.Errorf("persisted schedule = %+v, want #2 and #3", scheduled)
+	}
+
+	// Due deploys are requested and dropped from the schedule.
+	if wait := m.runDueDeploys(time.Now().Add(90 * time.Minute)); wait <= 0 || wait > 90*time.Minute {
+		t.Errorf("wait for next scheduled deploy = %s", wait)
+	}
+	r := waitForHistory(t, m, "testsvc", 1)[0]
+	if r.Trigger != TriggerSchedule || r.Actor != "alice" {
+		t.Errorf("deploy record = %+v, want scheduled deploy by alice", r)
+	}
+	if got := m.ScheduledDeploys(); len(got) != 1 || got[0].ID != "3" {
+		t.Errorf("scheduled after #2 ran = %+v, want only #3", got)
+	}
+	if scheduled, _ := LoadScheduled(cfg.StateDir); len(scheduled) != 1 {
+		t.Errorf("persisted schedule = %+v, want only #3", scheduled)
+	}
+}
+
+func TestManager_ScheduleWaitsForReady(t *testing.T) {
+	cfg := testConfig(t)
+	svc := sleepService("testsvc", t.TempDir())
+	svc.Deploy = config.Steps("true")
+
+	m, err := NewManager(cfg, []config.ServiceConfig{svc}, NopNotifier{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.ScheduleDeploy("testsvc", time.Now().Add(50*time.Millisecond), DeployRequest{Trigger: TriggerChat}); err != nil {
+		t.Fatal(err)
+	}
+	m.Stop()
+	time.Sleep(100 * time.Millisecond)
+
+	// The deploy that came due while stopped waits for the frontends.
+	m, err = NewManager(cfg, []config.ServiceConfig{svc}, NopNotifier{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Stop()
+	time.Sleep(200 * time.Millisecond)
+	if records, _ := m.GetDeployHistory("testsvc"); len(records) != 0 {
+		t.Fatalf("deployed before ready: %+v", records)
+	}
+	m.SignalReady()
+	if r := waitForHistory(t, m, "testsvc", 1)[0]; r.Trigger != TriggerSchedule {
+		t.Errorf("deploy record = %+v, want the scheduled deploy", r)
+	}
+}
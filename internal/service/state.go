@@ -9,13 +9,21 @@ import (
 
 // State represents the persisted state of a managed service.
 type State struct {
-	Status      string          `json:"status"`
-	LastDeploy  time.Time       `json:"last_deploy,omitzero"`
-	LastRestart time.Time       `json:"last_restart,omitzero"`
-	LastResult  string          `json:"last_result,omitempty"`
-	LastOutput  string          `json:"last_output,omitempty"`
-	FailedStep  string          `json:"failed_step,omitempty"`
-	Backend     json.RawMessage `json:"backend,omitempty"`
+	Status         string          `json:"status"`
+	LastDeploy     time.Time       `json:"last_deploy,omitzero"`
+	LastRestart    time.Time       `json:"last_restart,omitzero"`
+	LastResult     string          `json:"last_result,omitempty"`
+	LastOutput     string          `json:"last_output,omitempty"`
+	LastDeployID   string          `json:"last_deploy_id,omitempty"`
+	DeployedCommit string          `json:"deployed_commit,omitempty"`
+	FailedStep     string          `json:"failed_step,omitempty"`
+	Ref            string          `json:"ref,omitempty"`
+	Held           *HeldDeploy     `json:"held,omitempty"`
+	Backend        json.RawMessage `json:"backend,omitempty"`
+
+	// The auto-deploy circuit breaker; see ServiceState.
+	FailedDeploys    int  `json:"failed_deploys,omitempty"`
+	AutoDeployPaused bool `json:"auto_deploy_paused,omitempty"`
 }
 
 func statePath(dir, name string) string {
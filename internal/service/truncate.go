@@ -2,6 +2,7 @@ package service
 
 import (
 	"fmt"
+	"strings"
 	"unicode/utf8"
 )
 
@@ -49,6 +50,42 @@ func TruncateTailToRuneBudget(s string, budget int) string {
 	return marker + runeSuffix(s, budget-utf8.RuneCountInString(marker))
 }
 
+// truncatedMarker ends a string cut short by TruncateHeadToRuneBudget.
+const truncatedMarker = "\n... (truncated)"
+
+// TruncateHeadToRuneBudget is TruncateTailToRuneBudget for text whose start
+// matters most, such as a deploy plan: it keeps the head of s, cut at a line
+// break where there is one, and appends a marker line.
+func TruncateHeadToRuneBudget(s string, budget int) string {
+	if utf8.RuneCountInString(s) <= budget {
+		return s
+	}
+	markerRunes := utf8.RuneCountInString(truncatedMarker)
+	if budget <= markerRunes {
+		return runePrefix(s, budget)
+	}
+	head := runePrefix(s, budget-markerRunes)
+	if i := strings.LastIndexByte(head, '\n'); i > 0 {
+		head = head[:i]
+	}
+	return head + truncatedMarker
+}
+
+// runePrefix returns the first n runes of s, or s itself if s has fewer
+// runes than n. It never splits a multibyte rune.
+func runePrefix(s string, n int) string {
+	if n <= 0 {
+		return ""
+	}
+	for i := range s {
+		if n == 0 {
+			return s[:i]
+		}
+		n--
+	}
+	return s
+}
+
 // runeSuffix returns the last n runes of s, or s itself if s has fewer
 // runes than n. It never splits a multibyte rune.
 func runeSuffix(s string, n int) string {
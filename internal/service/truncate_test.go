@@ -136,3 +136,25 @@ func min(a, b int) int {
 	}
 	return b
 }
+
+func TestTruncateHeadToRuneBudget(t *testing.T) {
+	if got := TruncateHeadToRuneBudget("short", 10); got != "short" {
+		t.Errorf("short input = %q", got)
+	}
+
+	s := "headline\n" + strings.Repeat("commit line é\n", 100)
+	got := TruncateHeadToRuneBudget(s, 100)
+	if n := utf8.RuneCountInString(got); n > 100 {
+		t.Errorf("got %d runes, want at most 100", n)
+	}
+	if !strings.HasPrefix(got, "headline\ncommit line é\n") || !strings.HasSuffix(got, "é\n... (truncated)") {
+		t.Errorf("got %q, want the head cut at a line break", got)
+	}
+	if !utf8.ValidString(got) {
+		t.Errorf("got invalid UTF-8 %q", got)
+	}
+
+	if got := TruncateHeadToRuneBudget("ééééé", 3); got != "ééé" {
+		t.Errorf("tiny budget = %q", got)
+	}
+}
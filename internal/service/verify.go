@@ -0,0 +1,121 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/shishberg/mezzaops/internal/config"
+	"github.com/shishberg/mezzaops/internal/deploy"
+)
+
+// verifyLogTail is how much of the service's logs a failed verification
+// includes in its output, in runes. Backends read their tail in bytes or
+// lines, so what they return is cut down to this.
+const verifyLogTail = 1500
+
+// verifyDeploy is the verification phase of a deploy, run after the restart.
+// For v.Soak the service must keep running and, if v.Check is set, the check
+// must pass at least once and not fail after it has. It stops early on the
+// first failure or when ctx is cancelled.
+func verifyDeploy(ctx context.Context, backend Backend, v *config.VerifyConfig, dir string, env []string) (sr deploy.StepResult) {
+	sr = deploy.StepResult{Step: "verify", Status: "failed"}
+	start := time.Now()
+	var out strings.Builder
+	defer func() {
+		if sr.Status != "success" && ctx.Err() == nil {
+			if logs, err := backend.Logs(ctx, verifyLogTail); err == nil && logs != "" {
+				fmt.Fprintf(&out, "--- service logs ---\n%s", TruncateTailToRuneBudget(logs, verifyLogTail))
+			}
+		}
+		sr.Output = out.String()
+		sr.Duration = time.Since(start)
+	}()
+
+	fmt.Fprintf(&out, "# soaking for %s\n", v.Soak)
+	deadline := start.Add(v.Soak)
+	passed := v.Check == ""
+	var lastErr error
+	for {
+		status, err := backend.Status(ctx)
+		if err != nil {
+			fmt.Fprintf(&out, "ERROR: checking status: %s\n", err)
+			return sr
+		}
+		if status != "running" {
+			fmt.Fprintf(&out, "ERROR: service %s %s after restart\n", status, time.Since(start).Round(time.Second))
+			return sr
+		}
+
+		if v.Check != "" {
+			err := runCheck(ctx, v, dir, env)
+			switch {
+			case err == nil && !passed:
+				fmt.Fprintf(&out, "check passed after %s\n", time.Since(start).Round(time.Second))
+				passed = true
+			case err != nil && passed:
+				fmt.Fprintf(&out, "ERROR: check failed after passing: %s\n", err)
+				return sr
+			case err != nil:
+				lastErr = err
+			}
+		}
+
+		wait := time.Until(deadline)
+		if wait <= 0 {
+			break
+		}
+		if interval := v.CheckInterval(); interval < wait {
+			wait = interval
+		}
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			fmt.Fprintf(&out, "ERROR: verification interrupted\n")
+			return sr
+		}
+	}
+
+	if !passed {
+		fmt.Fprintf(&out, "ERROR: check never passed within %s: %s\n", v.Soak, lastErr)
+		return sr
+	}
+	fmt.Fprintf(&out, "service stayed up for %s\n", v.Soak)
+	sr.Status = "success"
+	return sr
+}
+
+// runCheck runs the health check once: a GET that must answer 2xx if Check
+// is a URL, or else a shell command that must exit 0.
+func runCheck(ctx context.Context, v *config.VerifyConfig, dir string, env []string) error {
+	ctx, cancel := context.WithTimeout(ctx, v.CheckTimeout())
+	defer cancel()
+
+	if v.IsHTTP() {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.Check, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return fmt.Errorf("GET %s: %s", v.Check, resp.Status)
+		}
+		return nil
+	}
+
+	step := config.DeployStep{Run: v.Check}
+	result, err := deploy.RunSteps(ctx, []config.DeployStep{step}, dir, env, deploy.Conditions{}, nil)
+	if err != nil {
+		return err
+	}
+	if result.Status != "success" {
+		return fmt.Errorf("%s: %s", v.Check, strings.TrimSpace(result.Output))
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shishberg/mezzaops/internal/config"
+)
+
+// waitForVerifyFailed polls until DeployVerifyFailed has been called.
+func waitForVerifyFailed(t *testing.T, rec *recordingNotifier) notifierCall {
+	t.Helper()
+	deadline := time.After(10 * time.Second)
+	for {
+		if calls := rec.getVerifyFailed(); len(calls) > 0 {
+			return calls[0]
+		}
+		select {
+		case <-deadline:
+			t.Fatal("timed out waiting for DeployVerifyFailed")
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+}
+
+func TestManager_VerifyFailureRollsBack(t *testing.T) {
+	dir, commit := gitRepo(t)
+	good := commit("good")
+	bad := commit("bad")
+	if out, err := exec.Command("git", "-C", dir, "reset", "-q", "--hard", good).CombinedOutput(); err != nil {
+		t.Fatalf("git reset: %v\n%s", err, out)
+	}
+
+	svc := sleepService("testsvc", dir)
+	svc.Deploy = config.Steps("true")
+	svc.Verify = &config.VerifyConfig{
+		Soak:     300 * time.Millisecond,
+		Interval: 50 * time.Millisecond,
+		Check:    `test "$(git log -1 --format=%s)" = good`,
+	}
+	rec := &recordingNotifier{}
+	m, err := NewManager(testConfig(t), []config.ServiceConfig{svc}, rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Stop()
+
+	if err := m.RequestDeploy("testsvc", DeployRequest{Trigger: TriggerCLI, Actor: "alice", Ref: bad}); err != nil {
+		t.Fatal(err)
+	}
+
+	call := waitForVerifyFailed(t, rec)
+	if call.a != good {
+		t.Errorf("rolled back to %q, want %s", call.a, good)
+	}
+	if !strings.Contains(call.b, "check never passed") {
+		t.Errorf("verify output = %q, want the check failure", call.b)
+	}
+
+	records := waitForHistory(t, m, "testsvc", 2)
+	deployed, rolledBack := records[1], records[0]
+	if deployed.Result != "failed" || deployed.FailedStep != "verify" || deployed.SHAAfter != bad {
+		t.Errorf("deploy record = %+v, want failed at verify on %s", deployed, bad)
+	}
+	if !rolledBack.Rollback || rolledBack.Trigger != TriggerVerify || rolledBack.Result != "success" || rolledBack.SHAAfter != good {
+		t.Errorf("rollback record = %+v, want successful verify rollback to %s", rolledBack, good)
+	}
+	if state, _ := m.GetServiceState("testsvc"); state.Status != "running" {
+		t.Errorf("status after rollback = %q, want running", state.Status)
+	}
+	if got := rec.getDeploySucceeded(); len(got) != 0 {
+		t.Errorf("DeploySucceeded calls = %+v, want none", got)
+	}
+}
+
+func TestManager_VerifyServiceExits(t *testing.T) {
+	dir := t.TempDir()
+	noRollback := false
+	svc := config.ServiceConfig{
+		Name:       "testsvc",
+		Dir:        dir,
+		Entrypoint: []string{"sh", "-c", "echo crashing; sleep 0.1"},
+		Deploy:     config.Steps("true"),
+		Verify: &config.VerifyConfig{
+			Soak:     2 * time.Second,
+			Interval: 50 * time.Millisecond,
+			Rollback: &noRollback,
+		},
+	}
+	rec := &recordingNotifier{}
+	m, err := NewManager(testConfig(t), []config.ServiceConfig{svc}, rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Stop()
+
+	if err := m.RequestDeploy("testsvc", DeployRequest{}); err != nil {
+		t.Fatal(err)
+	}
+
+	call := waitForVerifyFailed(t, rec)
+	if call.a != "" {
+		t.Errorf("rolled back to %q with rollback disabled", call.a)
+	}
+	if !strings.Contains(call.b, "service stopped") || !strings.Contains(call.b, "crashing") {
+		t.Errorf("verify output = %q, want the stop and the service's logs", call.b)
+	}
+	records := waitForHistory(t, m, "testsvc", 1)
+	if records[0].FailedStep != "verify" {
+		t.Errorf("failed step = %q, want verify", records[0].FailedStep)
+	}
+	if len(records) != 1 {
+		t.Errorf("%d deploy records, want no rollback", len(records))
+	}
+}
+
+func TestManager_VerifyPasses(t *testing.T) {
+	svc := sleepService("testsvc", t.TempDir())
+	svc.Deploy = config.Steps("true")
+	svc.Verify = &config.VerifyConfig{Soak: 200 * time.Millisecond, Interval: 50 * time.Millisecond, Check: "true"}
+	rec := &recordingNotifier{}
+	m, err := NewManager(testConfig(t), []config.ServiceConfig{svc}, rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Stop()
+
+	if err := m.RequestDeploy("testsvc", DeployRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	records := waitForHistory(t, m, "testsvc", 1)
+	r := records[0]
+	if r.Result != "success" {
+		t.Fatalf("result = %q, output:\n%s", r.Result, r.Output)
+	}
+	last := r.Steps[len(r.Steps)-1]
+	if last.Step != "verify" || last.Status != "success" || last.Duration < 200*time.Millisecond {
+		t.Errorf("last step = %+v, want verify passing after the soak", last)
+	}
+	if got := rec.getVerifyFailed(); len(got) != 0 {
+		t.Errorf("DeployVerifyFailed calls = %+v, want none", got)
+	}
+}
+
+// lineLogsBackend is a stopped service whose Logs, like journalctl's, returns
+// tail lines rather than bytes.
+type lineLogsBackend struct{}
+
+func (lineLogsBackend) Start(context.Context) error   { return nil }
+func (lineLogsBackend) Stop(context.Context) error    { return nil }
+func (lineLogsBackend) Restart(context.Context) error { return nil }
+func (lineLogsBackend) Status(context.Context) (string, error) {
+	return "stopped", nil
+}
+func (lineLogsBackend) Logs(_ context.Context, tail int) (string, error) {
+	return strings.Repeat("a long line of service output\n", tail), nil
+}
+func (lineLogsBackend) SaveBackendState() json.RawMessage   { return nil }
+func (lineLogsBackend) RestoreBackendState(json.RawMessage) {}
+
+func TestVerifyDeploy_TruncatesLogs(t *testing.T) {
+	v := &config.VerifyConfig{Soak: time.Second}
+	sr := verifyDeploy(context.Background(), lineLogsBackend{}, v, t.TempDir(), nil)
+	if sr.Status != "failed" {
+		t.Fatalf("status = %q, want failed", sr.Status)
+	}
+	_, logs, ok := strings.Cut(sr.Output, "--- service logs ---\n")
+	if !ok {
+		t.Fatalf("output = %q, want the service's logs", sr.Output)
+	}
+	if n := len([]rune(logs)); n > verifyLogTail {
+		t.Errorf("logs are %d runes, want at most %d", n, verifyLogTail)
+	}
+	if !strings.Contains(logs, "truncated") {
+		t.Errorf("logs = %q, want a truncation marker", logs)
+	}
+}
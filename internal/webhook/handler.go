@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
 )
 
 // PushEvent is the relevant subset of a GitHub push webhook payload.
@@ -36,6 +37,7 @@ type DeployTrigger interface {
 
 // Handler handles incoming GitHub webhook requests.
 type Handler struct {
+	mu      sync.RWMutex
 	secret  string
 	trigger DeployTrigger
 }
@@ -45,6 +47,13 @@ func NewHandler(secret string, trigger DeployTrigger) *Handler {
 	return &Handler{secret: secret, trigger: trigger}
 }
 
+// SetSecret replaces the HMAC secret, e.g. after it has been rotated.
+func (h *Handler) SetSecret(secret string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.secret = secret
+}
+
 // ServeHTTP implements http.Handler.
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20)) // 1 MB limit
@@ -131,7 +140,11 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 // verifySignature checks that the X-Hub-Signature-256 header matches the HMAC of the body.
 func (h *Handler) verifySignature(signature string, body []byte) bool {
-	mac := hmac.New(sha256.New, []byte(h.secret))
+	h.mu.RLock()
+	secret := h.secret
+	h.mu.RUnlock()
+
+	mac := hmac.New(sha256.New, []byte(secret))
 	mac.Write(body)
 	expected := "sha256=" + hex.EncodeToString(mac.Sum(nil))
 	return hmac.Equal([]byte(signature), []byte(expected))
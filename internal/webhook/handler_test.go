@@ -346,3 +346,25 @@ func TestWebhook_ExtractsRepoBranch(t *testing.T) {
 	assert.Equal(t, "org/backend-api", trigger.calledRepo)
 	assert.Equal(t, "feature/deploy-v2", trigger.calledRef)
 }
+
+func TestWebhook_SetSecret(t *testing.T) {
+	trigger := &mockDeployTrigger{}
+	handler := webhook.NewHandler("old-secret", trigger)
+	handler.SetSecret("new-secret")
+
+	body := []byte(`{"ref":"refs/heads/main","repository":{"full_name":"acme/myapp"}}`)
+	for _, tc := range []struct {
+		secret string
+		want   int
+	}{
+		{"old-secret", http.StatusForbidden},
+		{"new-secret", http.StatusOK},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/webhook/github", strings.NewReader(string(body)))
+		req.Header.Set("X-GitHub-Event", "push")
+		req.Header.Set("X-Hub-Signature-256", signPayload(tc.secret, body))
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		assert.Equal(t, tc.want, rr.Code, "signed with %s", tc.secret)
+	}
+}
@@ -3,15 +3,21 @@ package main
 import (
 	"context"
 	"embed"
+	"errors"
 	"flag"
+	"fmt"
 	"io/fs"
 	"log"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strings"
 	"syscall"
 
 	"github.com/shishberg/mezzaops/internal/app"
 	"github.com/shishberg/mezzaops/internal/cli"
+	"github.com/shishberg/mezzaops/internal/config"
+	"gopkg.in/yaml.v3"
 )
 
 //go:embed templates
@@ -20,15 +26,23 @@ var templatesFS embed.FS
 func main() {
 	configPath := flag.String("config", "config.yaml", "config file path")
 	envPath := flag.String("env", ".env", "env file path")
+	profile := flag.String("profile", "", "config profile: overlays config.<profile>.yaml and each service's profiles.<profile> section")
 	interactive := flag.Bool("i", false, "interactive CLI mode")
 	flag.Parse()
 
+	switch {
+	case flag.Arg(0) == "validate":
+		os.Exit(runValidate(*configPath, *profile, *envPath))
+	case flag.Arg(0) == "config" && flag.Arg(1) == "print":
+		os.Exit(runConfigPrint(*configPath, *profile))
+	}
+
 	templates, err := fs.Sub(templatesFS, "templates")
 	if err != nil {
 		log.Fatalf("embedded templates: %v", err)
 	}
 
-	a, err := app.New(*configPath, *envPath, templates)
+	a, err := app.New(*configPath, *profile, *envPath, templates)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -36,18 +50,31 @@ func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	// Signal handling.
+	// Signal handling. SIGHUP reloads like the reload command: services,
+	// secrets, and frontend settings in config.yaml.
 	sc := make(chan os.Signal, 1)
 	signal.Notify(sc, syscall.SIGINT, syscall.SIGTERM)
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
 	go func() {
-		select {
-		case <-sc:
-			log.Println("Shutting down...")
-		case <-a.Manager().ShutdownCh():
-			log.Println("Self-deploy complete, shutting down...")
+		for {
+			select {
+			case <-hup:
+				if err := a.Manager().Reload(); err != nil {
+					log.Println(err)
+				} else {
+					log.Println("Reloaded.")
+				}
+				continue
+			case <-sc:
+				log.Println("Shutting down...")
+			case <-a.Manager().ShutdownCh():
+				log.Println("Self-deploy complete, shutting down...")
+			}
+			a.Shutdown()
+			cancel()
+			return
 		}
-		a.Shutdown()
-		cancel()
 	}()
 
 	if *interactive {
@@ -68,3 +95,89 @@ func main() {
 		log.Fatal(err)
 	}
 }
+
+// runValidate checks the config and service files without starting anything
+// and returns the process exit code.
+func runValidate(configPath, profile, envPath string) int {
+	env, err := validateEnv(configPath, profile, envPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := config.Validate(configPath, profile, env); err != nil {
+		var verr *config.ValidationError
+		if errors.As(err, &verr) {
+			for _, p := range verr.Problems {
+				fmt.Fprintln(os.Stderr, p)
+			}
+		} else {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		return 1
+	}
+	fmt.Printf("%s: ok\n", configPath)
+	return 0
+}
+
+// validateEnv resolves the secrets validate checks for. If the config cannot
+// be loaded, only .env and the environment are used; Validate reports why.
+func validateEnv(configPath, profile, envPath string) (*config.Env, error) {
+	cfg, err := config.LoadConfig(configPath, profile)
+	if err != nil {
+		return config.LoadEnv(envPath)
+	}
+	secrets, err := config.NewSecretStore(cfg.Secrets, envPath)
+	if err != nil {
+		return nil, err
+	}
+	return secrets.Env()
+}
+
+// runConfigPrint writes the effective config and services, with defaults,
+// templates and the profile overlay applied, as YAML documents on stdout and
+// returns the process exit code.
+func runConfigPrint(configPath, profile string) int {
+	cfg, err := config.LoadConfig(configPath, profile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	svcs, err := config.LoadServices(cfg.ServicesDir, cfg.Profile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	sources := configPath
+	if profile != "" {
+		sources += " + " + config.ProfilePath(configPath, profile)
+	}
+	fmt.Printf("# %s\n", sources)
+	if err := printYAML(cfg); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	for _, svc := range svcs {
+		names := make([]string, len(svc.Sources))
+		for i, src := range svc.Sources {
+			names[i] = filepath.Base(src)
+		}
+		fmt.Printf("---\n# service %s (%s)\n", svc.Name, strings.Join(names, " + "))
+		if err := printYAML(svc); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+	return 0
+}
+
+// printYAML writes v to stdout as a YAML document with two-space indents.
+func printYAML(v any) error {
+	enc := yaml.NewEncoder(os.Stdout)
+	enc.SetIndent(2)
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	return enc.Close()
+}